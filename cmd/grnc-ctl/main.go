@@ -25,8 +25,10 @@ Usage of grnc-ctl:
 
 	grnc-ctl [options] command [qualifiers] [command_args]
 
-	--port, --p  The port on which the application is listening for control messages (default 9099).
-	--host, --h  The host on which the application is running (default localhost).
+	--port, --p    The port on which the application is listening for control messages (default 9099).
+	--host, --h    The host on which the application is running (default localhost).
+	--socket, --s  The path of a unix domain socket on which the application is listening for control messages. Overrides
+	               --port and --host.
 
 Built-in commands:
 
@@ -52,8 +54,10 @@ import (
 )
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -108,6 +112,13 @@ func parseArgs() (*ctlCommandRequest, *toolArgs) {
 func runCommand(ta *toolArgs, cr *ctlCommandRequest) {
 
 	url := fmt.Sprintf("http://%s:%d/command", ta.Host, ta.Port)
+	client := http.DefaultClient
+
+	if ta.Socket != "" {
+		// The host in the URL is ignored when connecting over a unix socket
+		url = "http://unix/command"
+		client = unixSocketClient(ta.Socket)
+	}
 
 	var b []byte
 	var err error
@@ -118,7 +129,7 @@ func runCommand(ta *toolArgs, cr *ctlCommandRequest) {
 
 	var r *http.Response
 
-	if r, err = http.Post(url, "application/json; charset=utf-8", bytes.NewReader(b)); err != nil {
+	if r, err = client.Post(url, "application/json; charset=utf-8", bytes.NewReader(b)); err != nil {
 		exitError("Problem executing web service call: %s", err.Error())
 	}
 
@@ -135,6 +146,17 @@ func runCommand(ta *toolArgs, cr *ctlCommandRequest) {
 
 }
 
+func unixSocketClient(path string) *http.Client {
+
+	t := new(http.Transport)
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+
+	return &http.Client{Transport: t}
+}
+
 func processErrors(res *ctlResponse) {
 
 	if res.Errors == nil || (res.Errors.ByField == nil && res.Errors.General == nil) {
@@ -429,6 +451,16 @@ func extractToolArgs(args []string) (*toolArgs, []string) {
 				} else {
 					exitError("Host option specified with no value.")
 				}
+			} else if isSocket(a) {
+
+				if i+1 < al {
+					i++
+					ta.Socket = args[i]
+					continue
+
+				} else {
+					exitError("Socket option specified with no value.")
+				}
 			} else if isPort(a) {
 
 				if i+1 < al {
@@ -472,14 +504,19 @@ func isHost(a string) bool {
 	return a == "--host" || a == "--h"
 }
 
+func isSocket(a string) bool {
+	return a == "--socket" || a == "--s"
+}
+
 func usageExit() {
 
 	tabPrint("\nIssues commands to a running instance of a Granitic application\n", 0)
 	tabPrint("usage: grnc-ctl [options] command [qualifiers] [command_args]", 0)
 	tabPrint("options:", 1)
-	tabPrint("--help       Prints this usage message", 2)
-	tabPrint("--port, --p  The port on which the application is listening for control messages (default 9099).", 2)
-	tabPrint("--host, --h  The host on which the application is running (default localhost).\n", 2)
+	tabPrint("--help         Prints this usage message", 2)
+	tabPrint("--port, --p    The port on which the application is listening for control messages (default 9099).", 2)
+	tabPrint("--host, --h    The host on which the application is running (default localhost).", 2)
+	tabPrint("--socket, --s  The path of a unix socket on which the application is listening (overrides --port and --host).\n", 2)
 
 	exitNormal()
 
@@ -501,8 +538,9 @@ func newToolArgs() *toolArgs {
 }
 
 type toolArgs struct {
-	Host string
-	Port int
+	Host   string
+	Port   int
+	Socket string
 }
 
 func tabPrint(s string, t int) {
@@ -15,3 +15,12 @@ func TestPadRightTo(t *testing.T) {
 	}
 
 }
+
+func TestSocketToolArg(t *testing.T) {
+
+	ta, remain := extractToolArgs([]string{"--s", "/tmp/ctl.sock", "help"})
+
+	if ta.Socket != "/tmp/ctl.sock" || len(remain) != 1 {
+		t.Errorf("Unexpected parse result %v %v", ta, remain)
+	}
+}
@@ -410,7 +410,8 @@ func (ac *Accessor) arrayVal(a reflect.Value) (reflect.Value, error) {
 
 // Populate sets the fields on the supplied target object using the JSON data
 // at the supplied path. This is acheived using Go's json.Marshal to convert the data
-// back into text JSON and then json.Unmarshal to unmarshal back into the target.
+// back into text JSON and then json.Unmarshal to unmarshal back into the target. An error is returned
+// if the data cannot be converted to the types of the target's fields.
 func (ac *Accessor) Populate(path string, target interface{}) error {
 	exists := ac.PathExists(path)
 
@@ -424,8 +425,8 @@ func (ac *Accessor) Populate(path string, target interface{}) error {
 	if data, err := json.Marshal(object); err != nil {
 		m := fmt.Sprintf("%T cannot be marshalled to JSON", object)
 		return errors.New(m)
-	} else if json.Unmarshal(data, target); err != nil {
-		return fmt.Errorf("%T cannot be populated with %v to JSON", object, data)
+	} else if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("invalid configuration at %s: %s", path, err.Error())
 	}
 
 	return nil
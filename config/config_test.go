@@ -189,9 +189,10 @@ func TestPopulateOutOfBoundsNumbers(t *testing.T) {
 
 	var sc SimpleConfig
 
+	// Values that cannot be converted to the type of the target field are reported
 	err := ca.Populate("simpleOne", &sc)
 
-	test.ExpectNil(t, err)
+	test.ExpectNotNil(t, err)
 }
 
 func TestSetField(t *testing.T) {
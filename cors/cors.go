@@ -0,0 +1,319 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package cors provides types that allow an HTTP server to support Cross-Origin Resource Sharing (CORS).
+
+Most applications will not use the types in this package directly. Instead they will enable the CORS facility
+(see the facility/cors package) which applies a default Policy to every request handled by the HTTPServer facility.
+
+Individual handlers can override the default policy by having a Policy injected into their CORS field. For example:
+
+	{
+	  "publicPolicy": {
+		"type": "cors.Policy",
+		"AllowedOrigins": ["*"],
+		"AllowedMethods": ["GET"]
+	  },
+
+	  "artistHandler": {
+		"type": "handler.WsHandler",
+		"HTTPMethod": "GET",
+		"Logic": "ref:artistLogic",
+		"PathPattern": "^/artist/([\\d]+)[/]?$",
+		"CORS": "ref:publicPolicy"
+	  }
+	}
+
+An override replaces the default policy completely - settings are not merged.
+*/
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	originHeader           = "Origin"
+	varyHeader             = "Vary"
+	requestMethodHeader    = "Access-Control-Request-Method"
+	requestHeadersHeader   = "Access-Control-Request-Headers"
+	allowOriginHeader      = "Access-Control-Allow-Origin"
+	allowMethodsHeader     = "Access-Control-Allow-Methods"
+	allowHeadersHeader     = "Access-Control-Allow-Headers"
+	allowCredentialsHeader = "Access-Control-Allow-Credentials"
+	exposeHeadersHeader    = "Access-Control-Expose-Headers"
+	maxAgeHeader           = "Access-Control-Max-Age"
+	anyValue               = "*"
+)
+
+// PolicyProvider is implemented by types (normally handler.WsHandler) that can supply a Policy that should be used in
+// preference to the server's default policy.
+type PolicyProvider interface {
+	// CORSPolicy returns the policy to apply to requests for this provider or nil if the default policy should be used.
+	CORSPolicy() *Policy
+}
+
+// Policy describes which cross-origin requests are allowed and which headers should be sent to the client.
+type Policy struct {
+	// The origins (scheme, host and optional port, e.g. https://www.example.com) that are allowed to make cross-origin
+	// requests. A single * allows any origin. A * in the host portion of an origin (e.g. https://*.example.com) matches
+	// one or more characters.
+	AllowedOrigins []string
+
+	// The HTTP methods clients are told they may use in a cross-origin request. If empty, the methods supported for the
+	// requested path are used.
+	AllowedMethods []string
+
+	// The request headers clients are told they may send. A single * allows any header requested by the client.
+	AllowedHeaders []string
+
+	// The response headers (beyond the CORS safe-listed headers) that browsers should make available to client code.
+	ExposedHeaders []string
+
+	// Whether or not browsers should include credentials (cookies, HTTP authentication) with cross-origin requests.
+	AllowCredentials bool
+
+	// How long (in seconds) browsers may cache the result of a preflight request. Zero or less means the header is not sent.
+	MaxAgeSeconds int
+
+	// If true, no CORS headers will be added to responses and preflight requests will not be answered.
+	Disabled bool
+
+	anyOrigin    bool
+	anyHeader    bool
+	exact        map[string]bool
+	wildcards    []wildcardOrigin
+	allowMethods string
+	allowHeaders string
+	exposed      string
+	prepared     sync.Once
+}
+
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func (wo wildcardOrigin) matches(origin string) bool {
+	return len(origin) > len(wo.prefix)+len(wo.suffix) && strings.HasPrefix(origin, wo.prefix) && strings.HasSuffix(origin, wo.suffix)
+}
+
+// StartComponent prepares the policy for use. Called automatically if the policy has been declared as a component,
+// otherwise the policy will be prepared the first time it is used.
+func (p *Policy) StartComponent() error {
+	p.prepare()
+
+	return nil
+}
+
+func (p *Policy) prepare() {
+	p.prepared.Do(func() {
+
+		p.exact = make(map[string]bool)
+
+		for _, o := range p.AllowedOrigins {
+
+			o = strings.TrimSpace(o)
+
+			if o == anyValue {
+				p.anyOrigin = true
+			} else if i := strings.Index(o, anyValue); i >= 0 {
+				p.wildcards = append(p.wildcards, wildcardOrigin{prefix: strings.ToLower(o[:i]), suffix: strings.ToLower(o[i+1:])})
+			} else {
+				p.exact[strings.ToLower(o)] = true
+			}
+		}
+
+		for _, h := range p.AllowedHeaders {
+			if strings.TrimSpace(h) == anyValue {
+				p.anyHeader = true
+			}
+		}
+
+		p.allowMethods = strings.Join(p.AllowedMethods, ", ")
+		p.allowHeaders = strings.Join(p.AllowedHeaders, ", ")
+		p.exposed = strings.Join(p.ExposedHeaders, ", ")
+	})
+}
+
+// AllowsOrigin returns true if the supplied origin is permitted to make cross-origin requests.
+func (p *Policy) AllowsOrigin(origin string) bool {
+
+	p.prepare()
+
+	if origin == "" {
+		return false
+	}
+
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+
+	if p.exact[origin] {
+		return true
+	}
+
+	for _, wo := range p.wildcards {
+		if wo.matches(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsMethod returns true if the supplied HTTP method is permitted for cross-origin requests. If the policy does
+// not explicitly list methods, the supplied list of methods supported by the requested path is checked instead.
+func (p *Policy) AllowsMethod(method string, supported []string) bool {
+
+	methods := p.AllowedMethods
+
+	if len(methods) == 0 {
+		methods = supported
+	}
+
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Processor answers CORS preflight requests and adds CORS headers to responses according to a default Policy or
+// a Policy supplied by the provider handling the request.
+type Processor struct {
+	// The policy to use unless a provider supplies its own.
+	DefaultPolicy *Policy
+}
+
+// StartComponent prepares the default policy for use.
+func (pr *Processor) StartComponent() error {
+
+	if pr.DefaultPolicy == nil {
+		pr.DefaultPolicy = new(Policy)
+	}
+
+	pr.DefaultPolicy.prepare()
+
+	return nil
+}
+
+// IsPreflight returns true if the request is a CORS preflight request (an OPTIONS request with Origin and
+// Access-Control-Request-Method headers).
+func (pr *Processor) IsPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get(originHeader) != "" && req.Header.Get(requestMethodHeader) != ""
+}
+
+// RequestedMethod returns the method the client intends to use, as declared in a preflight request.
+func (pr *Processor) RequestedMethod(req *http.Request) string {
+	return req.Header.Get(requestMethodHeader)
+}
+
+// Preflight sets the headers required to answer a preflight request. The supplied provider (which may be nil) is
+// checked to see if it implements PolicyProvider and supported is the list of HTTP methods available for the requested
+// path. The caller is responsible for writing the response status. If the request is not allowed by the policy no CORS
+// headers are set, causing the browser to block the request.
+func (pr *Processor) Preflight(h http.Header, req *http.Request, provider interface{}, supported []string) {
+
+	p := pr.policyFor(provider)
+
+	h.Add(varyHeader, originHeader)
+	h.Add(varyHeader, requestMethodHeader)
+	h.Add(varyHeader, requestHeadersHeader)
+
+	if p.Disabled {
+		return
+	}
+
+	origin := req.Header.Get(originHeader)
+	method := req.Header.Get(requestMethodHeader)
+
+	if !p.AllowsOrigin(origin) || !p.AllowsMethod(method, supported) {
+		return
+	}
+
+	pr.setOrigin(h, p, origin)
+
+	if p.allowMethods != "" {
+		h.Set(allowMethodsHeader, p.allowMethods)
+	} else {
+		h.Set(allowMethodsHeader, strings.Join(supported, ", "))
+	}
+
+	if requested := req.Header.Get(requestHeadersHeader); requested != "" {
+
+		if p.anyHeader {
+			h.Set(allowHeadersHeader, requested)
+		} else if p.allowHeaders != "" {
+			h.Set(allowHeadersHeader, p.allowHeaders)
+		}
+	}
+
+	if p.MaxAgeSeconds > 0 {
+		h.Set(maxAgeHeader, strconv.Itoa(p.MaxAgeSeconds))
+	}
+}
+
+// Decorate adds CORS headers to the response to a normal (non-preflight) request if the request includes an Origin
+// header allowed by the applicable policy. Must be called before the response's status is written.
+func (pr *Processor) Decorate(h http.Header, req *http.Request, provider interface{}) {
+
+	origin := req.Header.Get(originHeader)
+
+	if origin == "" {
+		return
+	}
+
+	p := pr.policyFor(provider)
+
+	if p.Disabled {
+		return
+	}
+
+	h.Add(varyHeader, originHeader)
+
+	if !p.AllowsOrigin(origin) {
+		return
+	}
+
+	pr.setOrigin(h, p, origin)
+
+	if p.exposed != "" {
+		h.Set(exposeHeadersHeader, p.exposed)
+	}
+}
+
+func (pr *Processor) setOrigin(h http.Header, p *Policy, origin string) {
+
+	if p.anyOrigin && !p.AllowCredentials {
+		h.Set(allowOriginHeader, anyValue)
+	} else {
+		// Browsers reject a wildcard origin on credentialed requests, so the request's origin is echoed back
+		h.Set(allowOriginHeader, origin)
+	}
+
+	if p.AllowCredentials {
+		h.Set(allowCredentialsHeader, "true")
+	}
+}
+
+func (pr *Processor) policyFor(provider interface{}) *Policy {
+
+	if pp, found := provider.(PolicyProvider); found {
+
+		if p := pp.CORSPolicy(); p != nil {
+			p.prepare()
+			return p
+		}
+	}
+
+	return pr.DefaultPolicy
+}
@@ -0,0 +1,124 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginMatching(t *testing.T) {
+
+	p := new(Policy)
+	p.AllowedOrigins = []string{"https://www.example.com", "https://*.example.org"}
+
+	for _, o := range []string{"https://www.example.com", "HTTPS://WWW.EXAMPLE.COM", "https://api.example.org", "https://a.b.example.org"} {
+		if !p.AllowsOrigin(o) {
+			t.Errorf("Expected %s to be allowed", o)
+		}
+	}
+
+	for _, o := range []string{"", "http://www.example.com", "https://example.org", "https://.example.org", "https://api.example.org.evil.com"} {
+		if p.AllowsOrigin(o) {
+			t.Errorf("Expected %s to be rejected", o)
+		}
+	}
+
+	p = new(Policy)
+	p.AllowedOrigins = []string{"*"}
+
+	if !p.AllowsOrigin("https://anywhere.example.com") {
+		t.Errorf("Expected any origin to be allowed")
+	}
+}
+
+func TestPreflight(t *testing.T) {
+
+	pr := new(Processor)
+	pr.DefaultPolicy = new(Policy)
+	pr.DefaultPolicy.AllowedOrigins = []string{"https://www.example.com"}
+	pr.DefaultPolicy.AllowedHeaders = []string{"Content-Type"}
+	pr.DefaultPolicy.MaxAgeSeconds = 60
+	pr.StartComponent()
+
+	req := httptest.NewRequest(http.MethodOptions, "/artist/1", nil)
+	req.Header.Set("Origin", "https://www.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+	if !pr.IsPreflight(req) {
+		t.Fatalf("Expected request to be identified as preflight")
+	}
+
+	h := make(http.Header)
+	pr.Preflight(h, req, nil, []string{"GET", "PUT"})
+
+	if h.Get("Access-Control-Allow-Origin") != "https://www.example.com" {
+		t.Errorf("Unexpected allowed origin %s", h.Get("Access-Control-Allow-Origin"))
+	}
+
+	if h.Get("Access-Control-Allow-Methods") != "GET, PUT" {
+		t.Errorf("Unexpected allowed methods %s", h.Get("Access-Control-Allow-Methods"))
+	}
+
+	if h.Get("Access-Control-Allow-Headers") != "Content-Type" || h.Get("Access-Control-Max-Age") != "60" {
+		t.Errorf("Unexpected headers %v", h)
+	}
+
+	// Method not supported by path
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	h = make(http.Header)
+	pr.Preflight(h, req, nil, []string{"GET", "PUT"})
+
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers for disallowed method")
+	}
+}
+
+func TestDecorateWithOverride(t *testing.T) {
+
+	pr := new(Processor)
+	pr.DefaultPolicy = new(Policy)
+	pr.StartComponent()
+
+	req := httptest.NewRequest(http.MethodGet, "/artist/1", nil)
+	req.Header.Set("Origin", "https://www.example.com")
+
+	h := make(http.Header)
+	pr.Decorate(h, req, nil)
+
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Default policy should not allow any origins")
+	}
+
+	override := new(Policy)
+	override.AllowedOrigins = []string{"*"}
+	override.AllowCredentials = true
+	override.ExposedHeaders = []string{"X-Total", "X-Page"}
+
+	h = make(http.Header)
+	pr.Decorate(h, req, &policyProvider{override})
+
+	if h.Get("Access-Control-Allow-Origin") != "https://www.example.com" {
+		t.Errorf("Expected origin to be echoed for credentialed requests, got %s", h.Get("Access-Control-Allow-Origin"))
+	}
+
+	if h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Access-Control-Expose-Headers") != "X-Total, X-Page" {
+		t.Errorf("Unexpected headers %v", h)
+	}
+
+	override.Disabled = true
+	h = make(http.Header)
+	pr.Decorate(h, req, &policyProvider{override})
+
+	if len(h) != 0 {
+		t.Errorf("Expected no headers from disabled policy")
+	}
+}
+
+type policyProvider struct {
+	p *Policy
+}
+
+func (pp *policyProvider) CORSPolicy() *Policy {
+	return pp.p
+}
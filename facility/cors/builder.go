@@ -0,0 +1,73 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package cors provides the CORS facility which allows the HTTPServer facility to support Cross-Origin Resource Sharing.
+
+When enabled, the HTTPServer facility will answer CORS preflight requests (OPTIONS requests with Origin and
+Access-Control-Request-Method headers) before attempting to find a handler for the request, and will add CORS headers
+to the responses to any request that includes an allowed Origin header.
+
+The default policy is defined in configuration:
+
+	{
+	  "CORS":{
+		"AllowedOrigins": ["https://www.example.com", "https://*.example.com"],
+		"AllowedMethods": [],
+		"AllowedHeaders": ["Content-Type", "Authorization"],
+		"ExposedHeaders": [],
+		"AllowCredentials": false,
+		"MaxAgeSeconds": 600
+	  }
+	}
+
+Individual handlers can use a different policy by injecting a component of type cors.Policy into their CORS field. See
+the cors package documentation for more details.
+*/
+package cors
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/cors"
+	"github.com/graniticio/granitic/v2/facility/httpserver"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+)
+
+const processorComponentName = instance.FrameworkPrefix + "CORSProcessor"
+
+// FacilityBuilder creates a cors.Processor and injects it into the HTTPServer facility's server
+type FacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	p := new(cors.Policy)
+
+	if err := ca.Populate("CORS", p); err != nil {
+		return err
+	}
+
+	pr := new(cors.Processor)
+	pr.DefaultPolicy = p
+
+	cn.WrapAndAddProto(processorComponentName, pr)
+
+	if !cn.ModifierExists(httpserver.HTTPServerComponentName, httpserver.HTTPServerCORSFieldName) {
+		cn.AddModifier(httpserver.HTTPServerComponentName, httpserver.HTTPServerCORSFieldName, processorComponentName)
+	}
+
+	return nil
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *FacilityBuilder) FacilityName() string {
+	return "CORS"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *FacilityBuilder) DependsOnFacilities() []string {
+	return []string{"HTTPServer"}
+}
@@ -0,0 +1,16 @@
+package cors
+
+import "testing"
+
+func TestFacilityNaming(t *testing.T) {
+
+	fb := new(FacilityBuilder)
+
+	if fb.FacilityName() != "CORS" {
+		t.Errorf("Unexpected facility name %s", fb.FacilityName())
+	}
+
+	if d := fb.DependsOnFacilities(); len(d) != 1 || d[0] != "HTTPServer" {
+		t.Errorf("Unexpected dependencies %v", d)
+	}
+}
@@ -22,15 +22,23 @@ which will look something like:
 	{
 	  "Facilities": {
 		"HTTPServer": false,
+		"CORS": false,
 		"JSONWs": false,
 		"XMLWs": false,
+		"MsgPackWs": false,
+		"CBORWs": false,
 		"FrameworkLogging": true,
 		"ApplicationLogging": true,
 		"QueryManager": false,
 		"RdbmsAccess": false,
 		"ServiceErrorManager": false,
 		"RuntimeCtl": false,
-		"TaskScheduler": false
+		"RateLimiter": false,
+		"HealthCheck": false,
+		"TaskScheduler": false,
+		"Metrics": false,
+		"Tracing": false,
+		"OpenAPI": false
 	  }
 	}
 
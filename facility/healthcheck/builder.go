@@ -0,0 +1,132 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package healthcheck provides the HealthCheck facility which allows orchestrators and load balancers to query the health
+and readiness of an application over HTTP.
+
+Two endpoints are registered with the HTTPServer facility:
+
+	/healthz - liveness. Checks that the application has not stopped. Components implementing health.LivenessReporter
+	           can opt in to being checked here as well.
+	/readyz  - readiness. Runs the CheckHealth method of every component that implements ioc.HealthReporter, the
+	           BlockAccess method of every component that implements ioc.AccessibilityBlocker and checks that the
+	           application is running (not starting, suspended or stopping).
+
+Each endpoint responds with 200 if all checks pass or 503 if any check fails, with a JSON body listing the status and
+latency of each check. The paths, the maximum time a check may take and the listeners the endpoints are registered with
+can be changed in configuration:
+
+	{
+	  "HealthCheck":{
+		"LivenessPath": "/healthz",
+		"ReadinessPath": "/readyz",
+		"CheckTimeoutMS": 2000,
+		"Listeners": ["internal"]
+	  }
+	}
+
+The endpoints continue to respond while the HTTP server is suspended. See the health package documentation for more details.
+*/
+package healthcheck
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/health"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+)
+
+const monitorComponentName = instance.FrameworkPrefix + "HealthMonitor"
+const livenessComponentName = instance.FrameworkPrefix + "HealthLivenessEndpoint"
+const readinessComponentName = instance.FrameworkPrefix + "HealthReadinessEndpoint"
+const decoratorComponentName = instance.FrameworkPrefix + "HealthCheckDecorator"
+
+type healthCheckConfig struct {
+	LivenessPath  string
+	ReadinessPath string
+	Listeners     []string
+}
+
+// FacilityBuilder creates the components required by the HealthCheck facility
+type FacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	cfg := new(healthCheckConfig)
+
+	if err := ca.Populate("HealthCheck", cfg); err != nil {
+		return err
+	}
+
+	m := new(health.Monitor)
+
+	if err := ca.Populate("HealthCheck", m); err != nil {
+		return err
+	}
+
+	cn.WrapAndAddProto(monitorComponentName, m)
+
+	live := new(health.Endpoint)
+	live.Monitor = m
+	live.Path = cfg.LivenessPath
+	live.Listeners = cfg.Listeners
+	cn.WrapAndAddProto(livenessComponentName, live)
+
+	ready := new(health.Endpoint)
+	ready.Monitor = m
+	ready.Path = cfg.ReadinessPath
+	ready.Readiness = true
+	ready.Listeners = cfg.Listeners
+	cn.WrapAndAddProto(readinessComponentName, ready)
+
+	d := new(healthCheckDecorator)
+	d.Monitor = m
+	cn.WrapAndAddProto(decoratorComponentName, d)
+
+	return nil
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *FacilityBuilder) FacilityName() string {
+	return "HealthCheck"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *FacilityBuilder) DependsOnFacilities() []string {
+	return []string{"HTTPServer"}
+}
+
+// healthCheckDecorator registers components that can report their health or block access with the Monitor
+type healthCheckDecorator struct {
+	FrameworkLogger logging.Logger
+	Monitor         *health.Monitor
+}
+
+// OfInterest returns true if the subject implements ioc.HealthReporter or ioc.AccessibilityBlocker
+func (d *healthCheckDecorator) OfInterest(subject *ioc.Component) bool {
+
+	switch subject.Instance.(type) {
+	case ioc.HealthReporter, ioc.AccessibilityBlocker:
+		return true
+	}
+
+	return false
+}
+
+// DecorateComponent adds the subject to the Monitor's checks
+func (d *healthCheckDecorator) DecorateComponent(subject *ioc.Component, cc *ioc.ComponentContainer) {
+
+	if hr, found := subject.Instance.(ioc.HealthReporter); found {
+		d.FrameworkLogger.LogDebugf("Adding %s to health checks", subject.Name)
+		d.Monitor.AddReporter(subject.Name, hr)
+	}
+
+	if ab, found := subject.Instance.(ioc.AccessibilityBlocker); found {
+		d.FrameworkLogger.LogDebugf("Adding %s to readiness checks", subject.Name)
+		d.Monitor.AddBlocker(subject.Name, ab)
+	}
+}
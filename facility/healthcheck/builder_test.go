@@ -0,0 +1,53 @@
+package healthcheck
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/health"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"testing"
+)
+
+func TestFacilityNaming(t *testing.T) {
+
+	fb := new(FacilityBuilder)
+
+	test.ExpectString(t, fb.FacilityName(), "HealthCheck")
+	test.ExpectString(t, fb.DependsOnFacilities()[0], "HTTPServer")
+}
+
+func TestDecorator(t *testing.T) {
+
+	m := new(health.Monitor)
+	m.FrameworkLogger = new(logging.ConsoleErrorLogger)
+
+	d := new(healthCheckDecorator)
+	d.FrameworkLogger = m.FrameworkLogger
+	d.Monitor = m
+
+	reporter := ioc.NewComponent("db", new(mockReporter))
+	blocker := ioc.NewComponent("cache", new(mockBlocker))
+
+	test.ExpectBool(t, d.OfInterest(reporter), true)
+	test.ExpectBool(t, d.OfInterest(blocker), true)
+	test.ExpectBool(t, d.OfInterest(ioc.NewComponent("other", new(FacilityBuilder))), false)
+
+	d.DecorateComponent(reporter, nil)
+	d.DecorateComponent(blocker, nil)
+
+	test.ExpectInt(t, len(m.Liveness(context.Background()).Checks), 1)
+	test.ExpectInt(t, len(m.Readiness(context.Background()).Checks), 3)
+}
+
+type mockReporter struct{}
+
+func (mr *mockReporter) CheckHealth(ctx context.Context) error {
+	return nil
+}
+
+type mockBlocker struct{}
+
+func (mb *mockBlocker) BlockAccess() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+type handlerNameKey string
+
+const handlerNameCtxKey handlerNameKey = "GRNCHANDLER"
+
+// withHandlerName records the name of the component that handled a request
+func withHandlerName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, handlerNameCtxKey, name)
+}
+
+// handlerName returns the name of the component that handled a request or an empty string if the request was not
+// matched to a handler.
+func handlerName(ctx context.Context) string {
+
+	if n, found := ctx.Value(handlerNameCtxKey).(string); found {
+		return n
+	}
+
+	return ""
+}
+
+// AccessLogFilter is a rule that decides whether or not a request is written to the access log. A rule matches a request
+// if every criterion that has been set matches. Criteria that have not been set (empty or zero) match every request.
+//
+// Filters are evaluated in the order they are declared and the first enabled filter that matches a request decides whether the
+// request is logged. Requests that do not match any filter are always logged.
+type AccessLogFilter struct {
+	// A name for the rule so that it can be referred to by the access-log-filters runtime command. Must be unique.
+	Name string
+
+	// A regular expression that the request's path must match.
+	PathPattern string
+
+	// The component names of the handlers (e.g. WsHandlers) that the request must have been served by.
+	Handlers []string
+
+	// The lowest response status code that matches.
+	MinStatus int
+
+	// The highest response status code that matches.
+	MaxStatus int
+
+	// Only match requests that took at least this many milliseconds to process.
+	SlowerThanMS int
+
+	// The proportion (between 0 and 1) of matching requests that are logged. Zero or one means every matching request is logged.
+	SampleRate float64
+
+	// If true, matching requests are never logged.
+	Exclude bool
+
+	// If true, the rule is ignored.
+	Disabled bool
+
+	pattern *regexp.Regexp
+}
+
+func (f *AccessLogFilter) compile() error {
+
+	if f.SampleRate < 0 || f.SampleRate > 1 {
+		return fmt.Errorf("access log filter %s has a SampleRate of %v. Must be between 0 and 1", f.Name, f.SampleRate)
+	}
+
+	if f.MaxStatus > 0 && f.MinStatus > f.MaxStatus {
+		return fmt.Errorf("access log filter %s has a MinStatus greater than its MaxStatus", f.Name)
+	}
+
+	if f.PathPattern == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile(f.PathPattern)
+
+	if err != nil {
+		return fmt.Errorf("access log filter %s has an invalid PathPattern: %s", f.Name, err.Error())
+	}
+
+	f.pattern = re
+
+	return nil
+}
+
+func (f *AccessLogFilter) matches(handler string, req *http.Request, status int, elapsed time.Duration) bool {
+
+	if f.pattern != nil && !f.pattern.MatchString(req.URL.Path) {
+		return false
+	}
+
+	if len(f.Handlers) > 0 && !containsString(f.Handlers, handler) {
+		return false
+	}
+
+	if status < f.MinStatus || (f.MaxStatus > 0 && status > f.MaxStatus) {
+		return false
+	}
+
+	return elapsed >= time.Duration(f.SlowerThanMS)*time.Millisecond
+}
+
+// sampled returns true if the rule allows a matching request to be logged
+func (f *AccessLogFilter) sampled(random func() float64) bool {
+
+	if f.Exclude {
+		return false
+	}
+
+	if f.SampleRate == 0 || f.SampleRate >= 1 {
+		return true
+	}
+
+	return random() < f.SampleRate
+}
+
+// shouldLog applies the writer's filters to the supplied request
+func (alw *AccessLogWriter) shouldLog(ctx context.Context, req *http.Request, status int, rec *time.Time, fin *time.Time) bool {
+
+	alw.filterMutex.RLock()
+	defer alw.filterMutex.RUnlock()
+
+	if len(alw.Filters) == 0 {
+		return true
+	}
+
+	if status == 0 {
+		// The response body was written without an explicit status
+		status = http.StatusOK
+	}
+
+	handler := handlerName(ctx)
+	elapsed := fin.Sub(*rec)
+
+	for _, f := range alw.Filters {
+
+		if !f.Disabled && f.matches(handler, req, status, elapsed) {
+			return f.sampled(alw.random)
+		}
+	}
+
+	return true
+}
+
+func (alw *AccessLogWriter) compileFilters() error {
+
+	names := make(map[string]bool)
+
+	for i, f := range alw.Filters {
+
+		if f.Name == "" {
+			f.Name = fmt.Sprintf("filter-%d", i)
+		}
+
+		if names[f.Name] {
+			return fmt.Errorf("more than one access log filter is named %s", f.Name)
+		}
+
+		names[f.Name] = true
+
+		if err := f.compile(); err != nil {
+			return err
+		}
+	}
+
+	if alw.random == nil {
+		alw.random = rand.Float64
+	}
+
+	return nil
+}
+
+// FilterRules returns a copy of the writer's filters in the order in which they are evaluated.
+func (alw *AccessLogWriter) FilterRules() []AccessLogFilter {
+
+	alw.filterMutex.RLock()
+	defer alw.filterMutex.RUnlock()
+
+	rules := make([]AccessLogFilter, len(alw.Filters))
+
+	for i, f := range alw.Filters {
+		rules[i] = *f
+	}
+
+	return rules
+}
+
+// AmendFilter allows the named filter to be modified while the application is running. The supplied function is called
+// with exclusive access to the filter. An error is returned if there is no filter with the supplied name or if the
+// modified filter is invalid (in which case the filter is left unchanged).
+func (alw *AccessLogWriter) AmendFilter(name string, amend func(f *AccessLogFilter)) error {
+
+	alw.filterMutex.Lock()
+	defer alw.filterMutex.Unlock()
+
+	for i, f := range alw.Filters {
+
+		if f.Name != name {
+			continue
+		}
+
+		amended := *f
+		amend(&amended)
+
+		if err := amended.compile(); err != nil {
+			return err
+		}
+
+		alw.Filters[i] = &amended
+
+		return nil
+	}
+
+	return fmt.Errorf("no access log filter named %s", name)
+}
+
+func containsString(s []string, v string) bool {
+
+	for _, c := range s {
+		if c == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,161 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/logging"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogFilterEvaluation(t *testing.T) {
+
+	alw := new(AccessLogWriter)
+	alw.Filters = []*AccessLogFilter{
+		{Name: "errors", MinStatus: 500},
+		{Name: "slow", SlowerThanMS: 500},
+		{Name: "health", PathPattern: "^/healthz$", MinStatus: 200, MaxStatus: 299, SampleRate: 0.01},
+		{Name: "admin", Handlers: []string{"adminHandler"}, Exclude: true},
+	}
+
+	if err := alw.compileFilters(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	roll := 0.5
+	alw.random = func() float64 { return roll }
+
+	ctx := context.Background()
+
+	check := func(path string, handler string, status int, elapsed time.Duration, expected bool) {
+		rec := time.Now()
+		fin := rec.Add(elapsed)
+
+		if logged := alw.shouldLog(withHandlerName(ctx, handler), httptest.NewRequest("GET", path, nil), status, &rec, &fin); logged != expected {
+			t.Errorf("%s %s %d %v: expected logged=%v", path, handler, status, elapsed, expected)
+		}
+	}
+
+	check("/healthz", "", 200, time.Millisecond, false)
+	check("/healthz", "", 0, time.Millisecond, false)
+	check("/healthz", "", 503, time.Millisecond, true)
+	check("/healthz", "", 200, time.Second, true)
+	check("/other", "", 200, time.Millisecond, true)
+	check("/admin", "adminHandler", 200, time.Millisecond, false)
+	check("/admin", "adminHandler", 500, time.Millisecond, true)
+
+	roll = 0.001
+	check("/healthz", "", 200, time.Millisecond, true)
+
+	if err := alw.AmendFilter("admin", func(f *AccessLogFilter) { f.Disabled = true }); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	check("/admin", "adminHandler", 200, time.Millisecond, true)
+
+	if err := alw.AmendFilter("health", func(f *AccessLogFilter) { f.SampleRate = 2 }); err == nil {
+		t.Errorf("Expected invalid sample rate to be rejected")
+	}
+
+	if alw.FilterRules()[2].SampleRate != 0.01 {
+		t.Errorf("Filter modified despite invalid amendment")
+	}
+
+	if err := alw.AmendFilter("missing", func(f *AccessLogFilter) {}); err == nil {
+		t.Errorf("Expected error amending unknown filter")
+	}
+}
+
+func TestInvalidAccessLogFilters(t *testing.T) {
+
+	invalid := [][]*AccessLogFilter{
+		{{PathPattern: "["}},
+		{{SampleRate: -0.5}},
+		{{MinStatus: 500, MaxStatus: 400}},
+		{{Name: "dup"}, {Name: "dup"}},
+	}
+
+	for i, f := range invalid {
+		alw := new(AccessLogWriter)
+		alw.Filters = f
+
+		if err := alw.compileFilters(); err == nil {
+			t.Errorf("Expected filter set %d to be rejected", i)
+		}
+	}
+}
+
+func TestAccessLogFiltersByHandler(t *testing.T) {
+
+	s := runningServer(t, &mockProvider{pattern: "^/a$", methods: []string{"GET"}}, &mockProvider{pattern: "^/b$", methods: []string{"GET"}})
+
+	alw, fs := logWriterWithBuffer(t, "%U")
+	alw.Filters = []*AccessLogFilter{{Name: "b", Handlers: []string{"1"}, Exclude: true}}
+	alw.compileFilters()
+
+	s.AccessLogging = true
+	s.AccessLogWriter = alw
+
+	s.handleAll(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	s.handleAll(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+
+	alw.PrepareToStop()
+	alw.Stop()
+
+	checkContents(t, fs, "/a")
+}
+
+func TestAccessLogFiltersCommand(t *testing.T) {
+
+	primary := new(AccessLogWriter)
+	primary.Filters = []*AccessLogFilter{{Name: "health", PathPattern: "^/healthz$", SampleRate: 0.01}}
+	primary.compileFilters()
+
+	admin := new(AccessLogWriter)
+	admin.Filters = []*AccessLogFilter{{Name: "health", Exclude: true}, {Name: "slow", SlowerThanMS: 100}}
+	admin.compileFilters()
+
+	c := new(accessLogFiltersCommand)
+	c.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	c.writers = map[string]*AccessLogWriter{DefaultListenerName: primary, "admin": admin}
+
+	co, errs := c.ExecuteCommand(nil, map[string]string{})
+
+	if len(errs) > 0 || len(co.OutputBody) != 3 {
+		t.Fatalf("Unexpected listing %v %v", co, errs)
+	}
+
+	if row := strings.Join(co.OutputBody[2], " "); row != "default health path ^/healthz$ log 1%" {
+		t.Errorf("Unexpected row %s", row)
+	}
+
+	_, errs = c.ExecuteCommand(nil, map[string]string{ruleArg: "health", listenerArg: DefaultListenerName, sampleArg: "0.5"})
+
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected error %s", errs[0].Message)
+	}
+
+	if primary.FilterRules()[0].SampleRate != 0.5 || admin.FilterRules()[0].Exclude != true {
+		t.Errorf("Amendment not limited to the requested listener")
+	}
+
+	c.ExecuteCommand(nil, map[string]string{ruleArg: "health", disabledArg: "true"})
+
+	if !primary.FilterRules()[0].Disabled || !admin.FilterRules()[0].Disabled {
+		t.Errorf("Expected rule to be disabled on all listeners")
+	}
+
+	invalid := []map[string]string{
+		{ruleArg: "missing", excludeArg: "true"},
+		{ruleArg: "health"},
+		{ruleArg: "health", sampleArg: "lots"},
+		{listenerArg: "unknown"},
+	}
+
+	for _, args := range invalid {
+		if _, errs := c.ExecuteCommand(nil, args); len(errs) == 0 {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package httpserver
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/graniticio/granitic/v2/httpendpoint"
@@ -16,6 +17,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,6 +33,10 @@ const PresetCombinedFormat = "%h %l %u %t \"%r\" %s %b \"%{Referer}i\" \"%{User-
 
 const presetFrameworkName = "framework"
 
+// JSONFormat is the value of AccessLogWriter.LogLineFormat that causes each request to be logged as a JSON object
+// rather than a formatted line.
+const JSONFormat = "json"
+
 // PresetFrameworkFormat is the log format used when AccessLogWriter.LogLinePreset is set to framework. Uses the X-Forwarded-For header to show all
 // IP addresses that the request has been proxied for (useful for services that sit behind multiple load-balancers and proxies) and logs
 // processing time in microseconds.
@@ -60,6 +66,7 @@ const (
 	query
 	processTimeMicro
 	processTime
+	clientIP
 )
 
 type logLineTokenType int
@@ -107,6 +114,9 @@ func newPlaceholderWithVarLineElement(phType logFormatPlaceHolder, variable stri
 
 // AccessLogWriter is a component able to asynchronously write an Apache HTTPD style access log. See the top of this GoDoc page for more information.
 type AccessLogWriter struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
 	logFile closableStringWriter
 
 	openFileFunc func() (closableStringWriter, error)
@@ -130,16 +140,53 @@ type AccessLogWriter struct {
 	// A component able to extract information from a context.Context into a loggable format
 	ContextFilter logging.ContextFilter
 
-	elements []*logLineToken
-	lines    chan string
-	state    ioc.ComponentState
+	// The names of the request headers included in each line when LogLineFormat is json.
+	JSONHeaders []string
+
+	// Write lines to standard output instead of the file at LogPath.
+	LogToStdout bool
+
+	// If and when the log file should be rotated. Ignored if LogToStdout is true.
+	Rotation *LogRotation
+
+	// Rules deciding which requests are logged. See AccessLogFilter
+	Filters []*AccessLogFilter
+
+	elements    []*logLineToken
+	jsonFormat  bool
+	lines       chan string
+	state       ioc.ComponentState
+	filterMutex sync.RWMutex
+	random      func() float64
+}
+
+// jsonLogLine contains the information recorded about a request when LogLineFormat is json
+type jsonLogLine struct {
+	Received     string            `json:"received"`
+	RemoteHost   string            `json:"remoteHost"`
+	ClientIP     string            `json:"clientIP"`
+	User         string            `json:"user"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	Query        string            `json:"query,omitempty"`
+	Protocol     string            `json:"protocol"`
+	RequestURI   string            `json:"requestURI"`
+	Status       int               `json:"status"`
+	Bytes        int               `json:"bytes"`
+	ProcessingUS int64             `json:"processingUS"`
+	RequestID    string            `json:"requestID,omitempty"`
+	TraceID      string            `json:"traceID,omitempty"`
+	SpanID       string            `json:"spanID,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Context      map[string]string `json:"context,omitempty"`
 }
 
 // LogRequest generates an access log line according the configured format. As long as the number of log lines waiting to
 // be written to the file does not exceed the value of AccessLogWriter.LineBufferSize, this method will return immediately.
+// Requests excluded by the writer's Filters are not logged.
 func (alw *AccessLogWriter) LogRequest(ctx context.Context, req *http.Request, res *httpendpoint.HTTPResponseWriter, rec *time.Time, fin *time.Time) {
 
-	if alw.state != ioc.RunningState {
+	if alw.state != ioc.RunningState || !alw.shouldLog(ctx, req, res.Status, rec, fin) {
 		return
 	}
 
@@ -165,6 +212,10 @@ func (alw *AccessLogWriter) buildLine(ctx context.Context, req *http.Request, re
 		fin = &utcFin
 	}
 
+	if alw.jsonFormat {
+		return alw.buildJSONLine(ctx, cv, req, res, rec, fin)
+	}
+
 	for _, e := range alw.elements {
 
 		switch e.tokenType {
@@ -183,6 +234,51 @@ func (alw *AccessLogWriter) buildLine(ctx context.Context, req *http.Request, re
 
 }
 
+func (alw *AccessLogWriter) buildJSONLine(ctx context.Context, cd logging.FilteredContextData, req *http.Request, res *httpendpoint.HTTPResponseWriter, rec *time.Time, fin *time.Time) string {
+
+	l := jsonLogLine{
+		Received:     rec.Format(time.RFC3339Nano),
+		RemoteHost:   alw.remoteHost(ctx, req),
+		ClientIP:     httpendpoint.ClientIP(ctx, req),
+		User:         alw.userID(ctx),
+		Method:       req.Method,
+		Path:         req.URL.Path,
+		Query:        req.URL.RawQuery,
+		Protocol:     req.Proto,
+		RequestURI:   req.RequestURI,
+		Status:       res.Status,
+		Bytes:        res.BytesServed,
+		ProcessingUS: int64(fin.Sub(*rec) / time.Microsecond),
+	}
+
+	if ids := logging.CorrelationIDs(ctx); ids != nil {
+		l.RequestID = ids[logging.RequestIDField]
+		l.TraceID = ids[logging.TraceIDField]
+		l.SpanID = ids[logging.SpanIDField]
+	}
+
+	for _, h := range alw.JSONHeaders {
+
+		if v := req.Header.Get(h); v != "" {
+
+			if l.Headers == nil {
+				l.Headers = make(map[string]string)
+			}
+
+			l.Headers[h] = v
+		}
+	}
+
+	if len(cd) > 0 {
+		l.Context = cd
+	}
+
+	// Marshalling cannot fail as the line only contains strings, numbers and maps of strings
+	b, _ := json.Marshal(l)
+
+	return string(b) + "\n"
+}
+
 // StartComponent parses the specified log format, sets up a channel to buffer lines for asynchrnous writing and opens the log file. An error
 // is returned if any of these steps fails.
 func (alw *AccessLogWriter) StartComponent() error {
@@ -209,6 +305,10 @@ func (alw *AccessLogWriter) StartComponent() error {
 		return err
 	}
 
+	if err = alw.compileFilters(); err != nil {
+		return err
+	}
+
 	alw.logFile, err = alw.openFileFunc()
 
 	if err != nil {
@@ -237,12 +337,21 @@ func (alw *AccessLogWriter) watchLineBuffer() {
 }
 
 func (alw *AccessLogWriter) openFile() (closableStringWriter, error) {
+
+	if alw.LogToStdout {
+		return &stdoutWriter{out: os.Stdout}, nil
+	}
+
 	logPath := alw.LogPath
 
 	if len(strings.TrimSpace(logPath)) == 0 {
 		return nil, errors.New("HTTP server access log is enabled, but no path to a log file specified")
 	}
 
+	if alw.Rotation.enabled() {
+		return newRotatingFile(logPath, alw.Rotation, time.Now, alw.FrameworkLogger)
+	}
+
 	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 
 	if err != nil {
@@ -254,9 +363,20 @@ func (alw *AccessLogWriter) openFile() (closableStringWriter, error) {
 
 func (alw *AccessLogWriter) configureLogFormat() error {
 
+	if alw.Rotation != nil {
+		if err := alw.Rotation.validate(); err != nil {
+			return err
+		}
+	}
+
 	f := alw.LogLineFormat
 	pre := alw.LogLinePreset
 
+	if strings.EqualFold(f, JSONFormat) {
+		alw.jsonFormat = true
+		return nil
+	}
+
 	if f == "" && pre == "" {
 		return errors.New("you must specify either a format for access log lines or the name of a preset format (neither has been provided)")
 	}
@@ -410,6 +530,8 @@ func (alw *AccessLogWriter) mapPlaceholder(ph string) logFormatPlaceHolder {
 		return bytesReturned
 	case "D":
 		return processTimeMicro
+	case "a":
+		return clientIP
 	case "h":
 		return remoteHost
 	case "i":
@@ -460,7 +582,7 @@ func (alw *AccessLogWriter) findValueWithVar(ctx context.Context, cd logging.Fil
 
 		}
 	case ctxValue:
-		return alw.ctxValue(cd, element.variable)
+		return alw.ctxValue(ctx, cd, element.variable)
 
 	default:
 		return unsupportedPlaceholder
@@ -486,7 +608,10 @@ func (alw *AccessLogWriter) findValue(ctx context.Context, element *logLineToken
 		return (strconv.Itoa(res.BytesServed))
 
 	case remoteHost:
-		return req.RemoteAddr
+		return alw.remoteHost(ctx, req)
+
+	case clientIP:
+		return httpendpoint.ClientIP(ctx, req)
 
 	case clientID:
 		return hyphen
@@ -525,13 +650,17 @@ func (alw *AccessLogWriter) findValue(ctx context.Context, element *logLineToken
 
 }
 
-func (alw *AccessLogWriter) ctxValue(cd logging.FilteredContextData, key string) string {
+func (alw *AccessLogWriter) ctxValue(ctx context.Context, cd logging.FilteredContextData, key string) string {
 
-	if cd == nil || cd[key] == "" {
-		return hyphen
+	if cd[key] != "" {
+		return cd[key]
+	}
+
+	if id := logging.CorrelationIDs(ctx)[key]; id != "" {
+		return id
 	}
 
-	return cd[key]
+	return hyphen
 
 }
 
@@ -569,6 +698,17 @@ func (alw *AccessLogWriter) requestLine(req *http.Request) string {
 	return fmt.Sprintf("%s %s %s", req.Method, req.RequestURI, req.Proto)
 }
 
+// remoteHost returns the client address resolved by the HTTP server (if the server is configured to resolve client
+// addresses) or the address of the connected host
+func (alw *AccessLogWriter) remoteHost(ctx context.Context, req *http.Request) string {
+
+	if ip := httpendpoint.ClientIP(ctx, nil); ip != "" {
+		return ip
+	}
+
+	return req.RemoteAddr
+}
+
 func (alw *AccessLogWriter) userID(ctx context.Context) string {
 	return hyphen
 }
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -106,10 +107,53 @@ func TestContextValueLogging(t *testing.T) {
 	checkContents(t, fs, "EXPOSED -")
 }
 
+func TestJSONLogLines(t *testing.T) {
+
+	var key ctxKey = "tenant"
+
+	cxf := new(contextFilter)
+	cxf.mappings = map[string]ctxKey{"tenant": key}
+
+	alw, fs := logWriterWithBuffer(t, "json")
+	alw.ContextFilter = cxf
+	alw.JSONHeaders = []string{"User-Agent", "Referer"}
+	alw.UtcTimes = true
+
+	ctx := context.WithValue(context.Background(), key, "acme")
+
+	req := new(http.Request)
+	req.Method = "GET"
+	req.Proto = "HTTP/1.1"
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.RequestURI = "/artist/1?verbose=true"
+	req.URL, _ = url.Parse("http://localhost:80/artist/1?verbose=true")
+	req.Header = http.Header{"User-Agent": []string{"curl"}}
+
+	start := time.Date(2019, 10, 9, 14, 59, 55, 0, time.UTC)
+	end := start.Add(1500 * time.Microsecond)
+
+	rw := responseWriter(true, 200)
+	rw.BytesServed = 312
+
+	alw.LogRequest(ctx, req, rw, &start, &end)
+	alw.PrepareToStop()
+	alw.Stop()
+
+	checkContents(t, fs, `{"received":"2019-10-09T14:59:55Z","remoteHost":"127.0.0.1:1234","clientIP":"127.0.0.1","user":"-","method":"GET","path":"/artist/1",`+
+		`"query":"verbose=true","protocol":"HTTP/1.1","requestURI":"/artist/1?verbose=true","status":200,"bytes":312,"processingUS":1500,`+
+		`"headers":{"User-Agent":"curl"},"context":{"tenant":"acme"}}`)
+}
+
 func checkContents(t *testing.T, fs *fileSimulator, ex string) {
 
 	check := ex + "\n"
-	actual := fs.buffer.String()
+	actual := fs.contents()
+
+	// Lines are written to the file asynchronously
+	for deadline := time.Now().Add(time.Second); actual != check && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		actual = fs.contents()
+	}
 
 	if actual != check {
 		t.Errorf("Unexpected log line. Expected %s Got %s", check, actual)
@@ -146,29 +190,40 @@ func logWriterWithBuffer(t *testing.T, pattern string) (*AccessLogWriter, *fileS
 	return alw, fs
 }
 
+// fileSimulator stands in for an access log file. It is written to by the AccessLogWriter's goroutine and read by
+// tests, so access is synchronised.
 type fileSimulator struct {
-	buffer  bytes.Buffer
-	Closed  bool
-	writing bool
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	closed bool
 }
 
 func (fs *fileSimulator) WriteString(s string) (n int, err error) {
 
-	fs.writing = true
-
-	n, err = fs.buffer.WriteString(s)
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
 
-	fs.writing = false
-
-	return n, err
+	return fs.buffer.WriteString(s)
 }
 
 func (fs *fileSimulator) Close() error {
-	fs.Closed = true
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.closed = true
 
 	return nil
 }
 
+func (fs *fileSimulator) contents() string {
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.buffer.String()
+}
+
 type contextFilter struct {
 	mappings map[string]ctxKey
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/graniticio/granitic/v2/logging"
 	"github.com/graniticio/granitic/v2/uuid"
 	"net/http"
+	"regexp"
 )
 
 // HTTPServerComponentName is the name of the HTTPServer component as stored in the IoC framework.
@@ -27,7 +28,12 @@ const instrumentationDecoratorName = instance.FrameworkPrefix + "RequestInstrume
 // If this behaviour is undesirable, an alternative AbnormalStatusWriter can set by using the frameworkModifiers mechanism
 // (see https://granitic.io/ref/component-definition-files )
 const HTTPServerAbnormalStatusFieldName = "AbnormalStatusWriter"
+
+// HTTPServerCORSFieldName is the field on the HTTPServer component into which the CORS facility injects its cors.Processor
+const HTTPServerCORSFieldName = "CORS"
 const accessLogWriterName = instance.FrameworkPrefix + "AccessLogWriter"
+const reloadTLSCommandComponentName = instance.FrameworkPrefix + "CommandReloadTLS"
+const accessLogFiltersCommandComponentName = instance.FrameworkPrefix + "CommandAccessLogFilters"
 
 // FacilityBuilder creates the components that make up the HTTPServer facility (the server and an access log writer).
 type FacilityBuilder struct {
@@ -39,19 +45,56 @@ func (hsfb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager
 	log := lm.CreateLogger(instance.FrameworkPrefix + "FacilityBuilder")
 
 	httpServer := new(HTTPServer)
-	ca.Populate("HTTPServer", httpServer)
+
+	if err := ca.Populate("HTTPServer", httpServer); err != nil {
+		return err
+	}
 
 	cn.WrapAndAddProto(HTTPServerComponentName, httpServer)
 
 	if httpServer.AccessLogging {
 		accessLogWriter := new(AccessLogWriter)
-		ca.Populate("HTTPServer.AccessLog", accessLogWriter)
+
+		if err := ca.Populate("HTTPServer.AccessLog", accessLogWriter); err != nil {
+			return err
+		}
 
 		httpServer.AccessLogWriter = accessLogWriter
 
 		cn.WrapAndAddProto(accessLogWriterName, accessLogWriter)
 	}
 
+	servers, err := buildListeners(ca, cn, httpServer)
+
+	if err != nil {
+		return err
+	}
+
+	rc := new(reloadTLSCommand)
+
+	for _, s := range servers {
+		if s.TLS != nil && s.TLS.Enabled {
+			rc.servers = append(rc.servers, s)
+		}
+	}
+
+	if len(rc.servers) > 0 {
+		cn.WrapAndAddProto(reloadTLSCommandComponentName, rc)
+	}
+
+	fc := new(accessLogFiltersCommand)
+	fc.writers = make(map[string]*AccessLogWriter)
+
+	for _, s := range servers {
+		if s.AccessLogging {
+			fc.writers[s.listenerName()] = s.AccessLogWriter
+		}
+	}
+
+	if len(fc.writers) > 0 {
+		cn.WrapAndAddProto(accessLogFiltersCommandComponentName, fc)
+	}
+
 	idbd := new(contextBuilderDecorator)
 	idbd.Server = httpServer
 	cn.WrapAndAddProto(contextIDDecoratorName, idbd)
@@ -85,7 +128,11 @@ func configureRequestIDGeneration(ca *config.Accessor, log logging.Logger, s *HT
 
 	if err := ca.Populate(basePath, cfg); err != nil {
 		return fmt.Errorf("Unable to read configuration for request ID generation %s", err.Error())
-	} else if !cfg.Enabled {
+	}
+
+	s.requestIDHeader = cfg.ResponseHeader
+
+	if !cfg.Enabled {
 		return nil
 	}
 
@@ -113,12 +160,102 @@ func configureRequestIDGeneration(ca *config.Accessor, log logging.Logger, s *HT
 	rcb.encoder = encodingFunc
 	rcb.idGen = uuid.GenerateCryptoRand
 
+	if cfg.TrustInbound {
+
+		if cfg.InboundHeader == "" {
+			return fmt.Errorf("%s.InboundHeader must be set if %s.TrustInbound is true", basePath, basePath)
+		}
+
+		re, err := regexp.Compile(cfg.InboundPattern)
+
+		if err != nil {
+			return fmt.Errorf("%s.InboundPattern is not a valid regular expression: %s", basePath, err.Error())
+		}
+
+		log.LogDebugf("Request IDs will be taken from the %s header if present", cfg.InboundHeader)
+
+		rcb.inboundHeader = cfg.InboundHeader
+		rcb.inboundFormat = re
+	}
+
 	s.IDContextBuilder = rcb
 
 	return nil
 
 }
 
+// buildListeners creates an additional HTTPServer for each listener defined under HTTPServer.Listeners. Each listener's
+// configuration is overlaid on the default HTTPServer configuration. Returns all of the application's servers, starting
+// with the default server.
+func buildListeners(ca *config.Accessor, cn *ioc.ComponentContainer, primary *HTTPServer) ([]*HTTPServer, error) {
+
+	servers := []*HTTPServer{primary}
+
+	names, err := listenerNames(ca)
+
+	if err != nil {
+		return nil, err
+	}
+
+	la := newListenerAssignment()
+	primary.assignment = la
+
+	for _, n := range names {
+
+		path := listenersConfigPath + "." + n
+
+		// Listeners start with the default server's configuration and override it with their own
+		s := new(HTTPServer)
+
+		if err := ca.Populate("HTTPServer", s); err != nil {
+			return nil, err
+		}
+
+		if err := ca.Populate(path, s); err != nil {
+			return nil, fmt.Errorf("unable to read configuration for listener %s: %s", n, err.Error())
+		}
+
+		rules := new(listenerRules)
+
+		if err := ca.Populate(path, rules); err != nil {
+			return nil, fmt.Errorf("unable to read handler assignments for listener %s: %s", n, err.Error())
+		}
+
+		if err := la.addListener(n, rules); err != nil {
+			return nil, err
+		}
+
+		s.name = n
+		s.assignment = la
+		s.primary = primary
+
+		cn.WrapAndAddProto(ListenerComponentName(n), s)
+
+		if s.AccessLogging {
+			alw := new(AccessLogWriter)
+
+			if err := ca.Populate("HTTPServer.AccessLog", alw); err != nil {
+				return nil, err
+			}
+
+			if alp := path + ".AccessLog"; ca.PathExists(alp) {
+
+				if err := ca.Populate(alp, alw); err != nil {
+					return nil, fmt.Errorf("unable to read access log configuration for listener %s: %s", n, err.Error())
+				}
+			}
+
+			s.AccessLogWriter = alw
+
+			cn.WrapAndAddProto(accessLogWriterName+"-"+n, alw)
+		}
+
+		servers = append(servers, s)
+	}
+
+	return servers, nil
+}
+
 // FacilityName implements FacilityBuilder.FacilityName
 func (hsfb *FacilityBuilder) FacilityName() string {
 	return "HTTPServer"
@@ -152,13 +289,14 @@ func (id *instrumentationDecorator) DecorateComponent(subject *ioc.Component, cc
 
 	im := subject.Instance.(instrument.RequestInstrumentationManager)
 
-	if id.Server.InstrumentationManager != nil {
-		id.Log.LogWarnf("Multiple components implementing instrument.RequestInstrumentationManager found. Using %s", subject.Name)
+	id.Log.LogDebugf("HTTP server using %s for instrumentation", subject.Name)
 
+	if id.Server.InstrumentationManager != nil {
+		// Several instrumentation managers (e.g. metrics and tracing) - pass each request to all of them
+		id.Server.InstrumentationManager = instrument.Combine(id.Server.InstrumentationManager, im)
+		return
 	}
 
-	id.Log.LogDebugf("HTTP server using %s for instrumentation", subject.Name)
-
 	id.Server.InstrumentationManager = im
 }
 
@@ -168,11 +306,19 @@ type requestIDConfig struct {
 	UUID    struct {
 		Encoding string
 	}
+	TrustInbound   bool
+	InboundHeader  string
+	InboundPattern string
+	ResponseHeader string
 }
 
 type requestContextBuilder struct {
 	idGen   uuid.Generate16Byte
 	encoder uuid.EncodeFrom16Byte
+
+	// If set, IDs are taken from this request header if present and matching inboundFormat
+	inboundHeader string
+	inboundFormat *regexp.Regexp
 }
 
 type idKey string
@@ -181,6 +327,13 @@ const ridKey idKey = "GRNCREQID"
 
 func (rcb *requestContextBuilder) WithIdentity(ctx context.Context, req *http.Request) (context.Context, error) {
 
+	if rcb.inboundHeader != "" {
+
+		if id := req.Header.Get(rcb.inboundHeader); id != "" && rcb.inboundFormat.MatchString(id) {
+			return context.WithValue(ctx, ridKey, id), nil
+		}
+	}
+
 	id := uuid.V4Custom(rcb.idGen, rcb.encoder)
 
 	return context.WithValue(ctx, ridKey, id), nil
@@ -1,6 +1,13 @@
 package httpserver
 
-import "testing"
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"net/http/httptest"
+	"testing"
+)
 
 func TestFacilityNaming(t *testing.T) {
 
@@ -11,3 +18,34 @@ func TestFacilityNaming(t *testing.T) {
 	}
 
 }
+
+func TestMultipleInstrumentationManagers(t *testing.T) {
+
+	s := new(HTTPServer)
+
+	id := new(instrumentationDecorator)
+	id.Server = s
+	id.Log = new(logging.NullLogger)
+
+	first := new(recordingInstrumentationManager)
+	second := new(recordingInstrumentationManager)
+
+	for n, m := range map[string]*recordingInstrumentationManager{"first": first, "second": second} {
+
+		c := ioc.NewComponent(n, m)
+
+		if !id.OfInterest(c) {
+			t.Fatalf("Instrumentation manager not of interest to decorator")
+		}
+
+		id.DecorateComponent(c, nil)
+	}
+
+	ctx, _, end := s.InstrumentationManager.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+	instrument.Event(ctx, "event")()
+	end()
+
+	if len(first.ri.events) != 1 || len(second.ri.events) != 1 {
+		t.Errorf("Expected both instrumentation managers to be used")
+	}
+}
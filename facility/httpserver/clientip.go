@@ -0,0 +1,202 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	forwardedHeader     = "Forwarded"
+	xForwardedForHeader = "X-Forwarded-For"
+	xRealIPHeader       = "X-Real-IP"
+)
+
+// ClientIPConfig controls how the IP address of the client that made a request is determined when the server is
+// behind one or more proxies or load balancers.
+type ClientIPConfig struct {
+	// Whether or not client addresses should be resolved
+	Enabled bool
+
+	// Addresses (in CIDR notation, e.g. 10.0.0.0/8) of proxies that are trusted to report the address of the client
+	// they are forwarding requests for. If empty, the address of the connected host is always used.
+	TrustedProxies []string
+
+	// The headers (in order of preference) that are examined for client addresses. Supported values are Forwarded,
+	// X-Forwarded-For and X-Real-IP.
+	Headers []string
+
+	// If true, trusted proxies must begin each connection with a PROXY protocol (v1 or v2) header identifying
+	// the client.
+	ProxyProtocol bool
+
+	trusted []*net.IPNet
+}
+
+func (cc *ClientIPConfig) enabled() bool {
+	return cc != nil && cc.Enabled
+}
+
+func (cc *ClientIPConfig) configure() error {
+
+	cc.trusted = nil
+
+	for _, cidr := range cc.TrustedProxies {
+
+		if !strings.Contains(cidr, "/") {
+			// Allow single addresses
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			return fmt.Errorf("%s is not a valid trusted proxy address: %s", cidr, err.Error())
+		}
+
+		cc.trusted = append(cc.trusted, n)
+	}
+
+	for _, h := range cc.Headers {
+
+		switch http.CanonicalHeaderKey(h) {
+		case forwardedHeader, http.CanonicalHeaderKey(xForwardedForHeader), http.CanonicalHeaderKey(xRealIPHeader):
+		default:
+			return fmt.Errorf("%s is not a supported client IP header. Must be one of Forwarded, X-Forwarded-For, X-Real-IP", h)
+		}
+	}
+
+	return nil
+}
+
+func (cc *ClientIPConfig) isTrusted(ip net.IP) bool {
+
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range cc.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve determines the address of the client that made the request. If the connected host is a trusted proxy, the
+// first of the configured headers present in the request is examined from right (nearest) to left and the first address
+// that is not a trusted proxy is used.
+func (cc *ClientIPConfig) resolve(req *http.Request) string {
+
+	peer := hostOnly(req.RemoteAddr)
+	peerIP := net.ParseIP(peer)
+
+	if !cc.enabled() || !cc.isTrusted(peerIP) {
+		return peer
+	}
+
+	for _, h := range cc.Headers {
+
+		values := req.Header[http.CanonicalHeaderKey(h)]
+
+		if len(values) == 0 {
+			continue
+		}
+
+		var chain []string
+
+		switch http.CanonicalHeaderKey(h) {
+		case forwardedHeader:
+			chain = forwardedFor(values)
+		case http.CanonicalHeaderKey(xRealIPHeader):
+			chain = values[len(values)-1:]
+		default:
+			chain = commaSeparated(values)
+		}
+
+		return cc.walk(chain, peer)
+	}
+
+	return peer
+}
+
+// walk examines the addresses in a forwarding chain from right to left, returning the first address that is not trusted.
+// If an invalid entry is found, the last valid address examined is returned.
+func (cc *ClientIPConfig) walk(chain []string, peer string) string {
+
+	client := peer
+
+	for i := len(chain) - 1; i >= 0; i-- {
+
+		ip := net.ParseIP(hostOnly(chain[i]))
+
+		if ip == nil {
+			break
+		}
+
+		client = ip.String()
+
+		if !cc.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+func commaSeparated(values []string) []string {
+
+	var entries []string
+
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			entries = append(entries, strings.TrimSpace(e))
+		}
+	}
+
+	return entries
+}
+
+// forwardedFor extracts the for= parameter of each element of RFC 7239 Forwarded headers.
+func forwardedFor(values []string) []string {
+
+	var entries []string
+
+	for _, element := range commaSeparated(values) {
+
+		found := ""
+
+		for _, pair := range strings.Split(element, ";") {
+
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+
+			if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+				found = strings.Trim(kv[1], "\"")
+			}
+		}
+
+		// Elements without a for parameter (or with an obfuscated identifier) end the walk when they are reached
+		entries = append(entries, found)
+	}
+
+	return entries
+}
+
+// hostOnly strips any port (and IPv6 brackets) from an address
+func hostOnly(addr string) string {
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
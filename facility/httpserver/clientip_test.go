@@ -0,0 +1,191 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/test"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIPResolution(t *testing.T) {
+
+	cc := &ClientIPConfig{
+		Enabled:        true,
+		TrustedProxies: []string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"},
+		Headers:        []string{"Forwarded", "x-forwarded-for", "X-Real-IP"},
+	}
+
+	test.ExpectNil(t, cc.configure())
+
+	resolve := func(remote string, headers map[string]string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		return cc.resolve(req)
+	}
+
+	xff := map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.1.1.1"}
+
+	// Headers from untrusted hosts are ignored
+	test.ExpectString(t, resolve("8.8.8.8:1000", xff), "8.8.8.8")
+
+	// Trusted proxies are skipped from right to left, so spoofed entries on the left are never used
+	test.ExpectString(t, resolve("10.0.0.1:1000", xff), "1.2.3.4")
+	test.ExpectString(t, resolve("192.168.1.10:1000", xff), "1.2.3.4")
+
+	// All trusted - use the leftmost
+	test.ExpectString(t, resolve("10.0.0.1:1000", map[string]string{"X-Forwarded-For": "10.2.2.2, 10.1.1.1"}), "10.2.2.2")
+
+	// Invalid entries end the walk
+	test.ExpectString(t, resolve("10.0.0.1:1000", map[string]string{"X-Forwarded-For": "1.2.3.4, garbage, 10.1.1.1"}), "10.1.1.1")
+
+	// Forwarded is preferred to X-Forwarded-For
+	fwd := map[string]string{
+		"Forwarded":       `for=1.2.3.4;proto=https, for="[2001:db8::1]:4711";by=10.0.0.1`,
+		"X-Forwarded-For": "9.9.9.9",
+	}
+
+	test.ExpectString(t, resolve("[fd00::1]:1000", fwd), "2001:db8::1")
+	test.ExpectString(t, resolve("10.0.0.1:1000", map[string]string{"Forwarded": "for=_hidden, for=10.9.9.9"}), "10.9.9.9")
+	test.ExpectString(t, resolve("10.0.0.1:1000", map[string]string{"X-Real-IP": "5.5.5.5"}), "5.5.5.5")
+	test.ExpectString(t, resolve("10.0.0.1:1000", nil), "10.0.0.1")
+
+	invalid := []*ClientIPConfig{
+		{TrustedProxies: []string{"10.0.0.0/33"}},
+		{Headers: []string{"X-Client"}},
+	}
+
+	for _, c := range invalid {
+		if err := c.configure(); err == nil {
+			t.Errorf("Expected configuration %v to be rejected", c)
+		}
+	}
+}
+
+func TestClientIPStoredInContext(t *testing.T) {
+
+	var seen string
+
+	p := &contextCapturingProvider{mockProvider: mockProvider{pattern: "^/a$", methods: []string{"GET"}}}
+	p.capture = func(ctx context.Context) { seen = httpendpoint.ClientIP(ctx, nil) }
+
+	s := runningServer(t, p)
+
+	req := httptest.NewRequest("GET", "/a", nil)
+	req.RemoteAddr = "10.0.0.1:1000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+
+	s.handleAll(httptest.NewRecorder(), req)
+	test.ExpectString(t, seen, "")
+
+	s.ClientIP = &ClientIPConfig{Enabled: true, TrustedProxies: []string{"10.0.0.0/8"}, Headers: []string{"X-Forwarded-For"}}
+	s.ClientIP.configure()
+
+	s.handleAll(httptest.NewRecorder(), req)
+	test.ExpectString(t, seen, "1.2.3.4")
+}
+
+func TestProxyProtocolHeaders(t *testing.T) {
+
+	v2 := func(cmd, family byte, addr []byte) string {
+		h := append([]byte{}, proxyV2Signature...)
+		h = append(h, 0x20|cmd, family, 0, byte(len(addr)))
+
+		return string(append(h, addr...))
+	}
+
+	ipv4 := []byte{1, 2, 3, 4, 10, 0, 0, 1, 0x1F, 0x90, 0x00, 0x50}
+
+	valid := map[string]string{
+		"PROXY TCP4 1.2.3.4 10.0.0.1 8080 80\r\n":             "1.2.3.4:8080",
+		"PROXY TCP6 2001:db8::1 fd00::1 8080 80\r\n":          "[2001:db8::1]:8080",
+		"PROXY UNKNOWN\r\n":                                   "",
+		v2(proxyV2CommandProxy, proxyV2FamilyTCP4<<4|1, ipv4): "1.2.3.4:8080",
+		v2(proxyV2CommandLocal, 0, nil):                       "",
+	}
+
+	for h, expected := range valid {
+
+		r := bufio.NewReader(strings.NewReader(h + "GET / HTTP/1.1\r\n"))
+		addr, err := readProxyHeader(r)
+
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", h, err.Error())
+			continue
+		}
+
+		if (addr == nil && expected != "") || (addr != nil && addr.String() != expected) {
+			t.Errorf("Unexpected address %v for %q", addr, h)
+		}
+
+		if rest, _ := r.ReadString('\n'); rest != "GET / HTTP/1.1\r\n" {
+			t.Errorf("Header not fully consumed for %q", h)
+		}
+	}
+
+	invalid := []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 1.2.3.4 10.0.0.1 8080\r\n",
+		"PROXY TCP4 nonsense 10.0.0.1 8080 80\r\n",
+		"PROXY TCP4 1.2.3.4 10.0.0.1 8080 80" + strings.Repeat(" ", 100) + "\r\n",
+		v2(proxyV2CommandProxy, proxyV2FamilyTCP4<<4|1, ipv4[:6]),
+	}
+
+	for _, h := range invalid {
+		if _, err := readProxyHeader(bufio.NewReader(strings.NewReader(h))); err == nil {
+			t.Errorf("Expected error for %q", h)
+		}
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cc := &ClientIPConfig{Enabled: true, TrustedProxies: []string{"127.0.0.0/8"}}
+	cc.configure()
+
+	pl := &proxyProtocolListener{Listener: ln, trusted: cc.isTrusted}
+	defer pl.Close()
+
+	go func() {
+		c, _ := net.Dial("tcp", ln.Addr().String())
+		c.Write([]byte("PROXY TCP4 1.2.3.4 127.0.0.1 5000 80\r\nhello\n"))
+		c.Close()
+	}()
+
+	c, err := pl.Accept()
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	test.ExpectString(t, c.RemoteAddr().String(), "1.2.3.4:5000")
+
+	line, _ := bufio.NewReader(c).ReadString('\n')
+	test.ExpectString(t, line, "hello\n")
+}
+
+type contextCapturingProvider struct {
+	mockProvider
+	capture func(ctx context.Context)
+}
+
+func (cp *contextCapturingProvider) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+	cp.capture(ctx)
+
+	return cp.mockProvider.ServeHTTP(ctx, w, req)
+}
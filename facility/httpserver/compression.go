@@ -0,0 +1,430 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	gzipEncoding          = "gzip"
+	deflateEncoding       = "deflate"
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+	contentTypeHeader     = "Content-Type"
+	contentLengthHeader   = "Content-Length"
+	varyHeader            = "Vary"
+	eventStreamType       = "text/event-stream"
+)
+
+// CompressionConfig controls whether and how an HTTPServer compresses the bodies of responses. It is normally populated
+// from the HTTPServer.Compression section of configuration.
+type CompressionConfig struct {
+	// Whether or not responses should be compressed when the client indicates it can accept compressed responses.
+	Enabled bool
+
+	// Responses with bodies smaller than this number of bytes are sent uncompressed.
+	MinSizeBytes int
+
+	// The media types (e.g. application/json) of responses that may be compressed. A type ending in /* (e.g. text/*)
+	// matches any subtype.
+	ContentTypes []string
+
+	// The compression level to use, from 1 (fastest) to 9 (smallest). -1 uses the default level.
+	Level int
+
+	// The encodings (gzip and/or deflate) the server supports, in order of preference.
+	Encodings []string
+}
+
+// responseCompressor negotiates an encoding with each request and creates compressingWriters. Compressors are pooled
+// as creating a new compressor for each request is expensive.
+type responseCompressor struct {
+	config      *CompressionConfig
+	exactTypes  map[string]bool
+	typePrefix  []string
+	preference  map[string]int
+	gzipPool    sync.Pool
+	deflatePool sync.Pool
+}
+
+func newResponseCompressor(c *CompressionConfig) (*responseCompressor, error) {
+
+	if _, err := gzip.NewWriterLevel(nil, c.Level); err != nil {
+		return nil, fmt.Errorf("%d is not a valid compression level. Must be -1 or between 0 and 9", c.Level)
+	}
+
+	rc := new(responseCompressor)
+	rc.config = c
+	rc.exactTypes = make(map[string]bool)
+	rc.preference = make(map[string]int)
+
+	for _, t := range c.ContentTypes {
+
+		t = strings.ToLower(strings.TrimSpace(t))
+
+		if strings.HasSuffix(t, "/*") {
+			rc.typePrefix = append(rc.typePrefix, strings.TrimSuffix(t, "*"))
+		} else {
+			rc.exactTypes[t] = true
+		}
+	}
+
+	for i, e := range c.Encodings {
+
+		e = strings.ToLower(strings.TrimSpace(e))
+
+		if e != gzipEncoding && e != deflateEncoding {
+			return nil, fmt.Errorf("%s is not a supported compression encoding. Must be one of gzip, deflate", e)
+		}
+
+		rc.preference[e] = i
+	}
+
+	level := c.Level
+
+	rc.gzipPool.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, level)
+		return w
+	}
+
+	rc.deflatePool.New = func() interface{} {
+		w, _ := zlib.NewWriterLevel(nil, level)
+		return w
+	}
+
+	return rc, nil
+}
+
+// wrap returns a compressingWriter over the supplied response if the request's Accept-Encoding header allows one of
+// the encodings supported by the server, or nil if the response should not be compressed.
+func (rc *responseCompressor) wrap(res http.ResponseWriter, req *http.Request) *compressingWriter {
+
+	if req.Method == http.MethodHead {
+		return nil
+	}
+
+	encoding := rc.negotiate(req.Header.Get(acceptEncodingHeader))
+
+	if encoding == "" {
+		return nil
+	}
+
+	cw := new(compressingWriter)
+	cw.rw = res
+	cw.body = &countingWriter{w: res}
+	cw.compressor = rc
+	cw.encoding = encoding
+
+	return cw
+}
+
+// negotiate chooses the most acceptable encoding from an Accept-Encoding header, using the order of the server's
+// Encodings to break ties. Returns an empty string if none of the server's encodings are acceptable.
+func (rc *responseCompressor) negotiate(header string) string {
+
+	if header == "" {
+		return ""
+	}
+
+	best := ""
+	bestQ := 0.0
+	wildcardQ := -1.0
+	explicit := make(map[string]bool)
+
+	consider := func(enc string, q float64) {
+
+		if q <= 0 {
+			return
+		}
+
+		if best == "" || q > bestQ || (q == bestQ && rc.preference[enc] < rc.preference[best]) {
+			best = enc
+			bestQ = q
+		}
+	}
+
+	for _, part := range strings.Split(header, ",") {
+
+		enc, q := httpendpoint.ParseQualityValue(part)
+
+		if enc == "*" {
+			wildcardQ = q
+			continue
+		}
+
+		if _, supported := rc.preference[enc]; supported {
+			explicit[enc] = true
+			consider(enc, q)
+		}
+	}
+
+	if wildcardQ > 0 {
+		for enc := range rc.preference {
+			if !explicit[enc] {
+				consider(enc, wildcardQ)
+			}
+		}
+	}
+
+	return best
+}
+
+func (rc *responseCompressor) compressibleType(contentType string) bool {
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	if mediaType == eventStreamType {
+		// Events must reach the caller as soon as they are flushed, which a compressor's buffering would prevent
+		return false
+	}
+
+	if rc.exactTypes[mediaType] {
+		return true
+	}
+
+	for _, p := range rc.typePrefix {
+		if strings.HasPrefix(mediaType, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rc *responseCompressor) compressorFor(encoding string, w io.Writer) io.WriteCloser {
+
+	if encoding == gzipEncoding {
+		gw := rc.gzipPool.Get().(*gzip.Writer)
+		gw.Reset(w)
+		return gw
+	}
+
+	zw := rc.deflatePool.Get().(*zlib.Writer)
+	zw.Reset(w)
+	return zw
+}
+
+func (rc *responseCompressor) release(encoding string, c io.WriteCloser) {
+
+	if encoding == gzipEncoding {
+		rc.gzipPool.Put(c)
+	} else {
+		rc.deflatePool.Put(c)
+	}
+}
+
+// compressingWriter is placed between an httpendpoint.HTTPResponseWriter and the underlying http.ResponseWriter. The
+// status and the start of the body are held back until enough of the body has been written to decide whether or not
+// it should be compressed.
+type compressingWriter struct {
+	rw         http.ResponseWriter
+	compressor *responseCompressor
+	encoding   string
+	status     int
+	buffer     []byte
+	decided    bool
+	compressed io.WriteCloser
+	body       *countingWriter
+	hijacked   bool
+}
+
+func (cw *compressingWriter) Header() http.Header {
+	return cw.rw.Header()
+}
+
+func (cw *compressingWriter) WriteHeader(status int) {
+
+	if cw.status != 0 {
+		return
+	}
+
+	// Informational responses (e.g. 103 Early Hints) precede the real status and have no bearing on compression
+	if httpendpoint.Informational(status) {
+		cw.rw.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+
+	if !bodyAllowed(status) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressingWriter) Write(b []byte) (int, error) {
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+
+		cw.buffer = append(cw.buffer, b...)
+
+		if len(cw.buffer) < cw.compressor.config.MinSizeBytes {
+			return len(b), nil
+		}
+
+		return len(b), cw.decide(true)
+	}
+
+	if cw.compressed != nil {
+		return cw.compressed.Write(b)
+	}
+
+	return cw.body.Write(b)
+}
+
+// decide sends the status and any buffered data to the underlying response, compressing it if the response is large
+// enough and of a type that should be compressed.
+func (cw *compressingWriter) decide(largeEnough bool) error {
+
+	cw.decided = true
+
+	h := cw.rw.Header()
+
+	if largeEnough && h.Get(contentEncodingHeader) == "" {
+
+		ct := h.Get(contentTypeHeader)
+
+		if ct == "" {
+			ct = http.DetectContentType(cw.buffer)
+			h.Set(contentTypeHeader, ct)
+		}
+
+		if cw.compressor.compressibleType(ct) {
+			h.Set(contentEncodingHeader, cw.encoding)
+			h.Add(varyHeader, acceptEncodingHeader)
+			h.Del(contentLengthHeader)
+
+			cw.compressed = cw.compressor.compressorFor(cw.encoding, cw.body)
+		}
+	}
+
+	cw.rw.WriteHeader(cw.status)
+
+	buffered := cw.buffer
+	cw.buffer = nil
+
+	if len(buffered) == 0 {
+		return nil
+	}
+
+	var err error
+
+	if cw.compressed != nil {
+		_, err = cw.compressed.Write(buffered)
+	} else {
+		_, err = cw.body.Write(buffered)
+	}
+
+	return err
+}
+
+// Close sends any data that has been held back and finishes the compressed stream. Must be called once the provider
+// handling the request has finished writing.
+func (cw *compressingWriter) Close() error {
+
+	if !cw.decided {
+
+		if cw.status == 0 {
+			// Nothing was written to the response
+			return nil
+		}
+
+		if err := cw.decide(len(cw.buffer) >= cw.compressor.config.MinSizeBytes && len(cw.buffer) > 0); err != nil {
+			return err
+		}
+	}
+
+	if cw.compressed == nil {
+		return nil
+	}
+
+	err := cw.compressed.Close()
+	cw.compressor.release(cw.encoding, cw.compressed)
+	cw.compressed = nil
+
+	return err
+}
+
+// Flush sends any data that has been held back (deciding whether or not to compress the response using the data
+// written so far) and flushes the compressed stream and the underlying response. Allows streamed responses (like
+// Server-Sent Events) to reach the client while the response is still being written.
+func (cw *compressingWriter) Flush() {
+
+	if !cw.decided {
+
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+
+		if err := cw.decide(len(cw.buffer) >= cw.compressor.config.MinSizeBytes && len(cw.buffer) > 0); err != nil {
+			return
+		}
+	}
+
+	if f, found := cw.compressed.(flusher); found {
+		if f.Flush() != nil {
+			return
+		}
+	}
+
+	if f, found := cw.rw.(http.Flusher); found {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying response so that providers can switch protocols. Nothing is written to
+// the response once it has been hijacked, so it is never compressed.
+func (cw *compressingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+
+	if h, found := cw.rw.(http.Hijacker); found && !cw.decided && cw.status == 0 {
+
+		c, rw, err := h.Hijack()
+		cw.hijacked = err == nil
+
+		return c, rw, err
+	}
+
+	return nil, nil, errors.New("response does not support taking over the connection")
+}
+
+// flusher is implemented by the gzip and zlib writers
+type flusher interface {
+	Flush() error
+}
+
+// BytesWritten returns the number of bytes (after any compression) written to the underlying response
+func (cw *compressingWriter) BytesWritten() int {
+	return cw.body.written
+}
+
+// countingWriter records how many bytes have been written to the underlying response
+type countingWriter struct {
+	w       io.Writer
+	written int
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.written += n
+
+	return n, err
+}
+
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,269 @@
+package httpserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/test"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncodingNegotiation(t *testing.T) {
+
+	rc := testCompressor(t)
+
+	tests := map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"deflate, gzip":             "gzip",
+		"deflate;q=1, gzip;q=0.5":   "deflate",
+		"gzip;q=0, deflate;q=0.1":   "deflate",
+		"br":                        "",
+		"*":                         "gzip",
+		"gzip;q=0, *":               "deflate",
+		"identity, gzip;q=0":        "",
+		"GZIP;Q=0.8, deflate;q=0.8": "gzip",
+	}
+
+	for header, expected := range tests {
+		if actual := rc.negotiate(header); actual != expected {
+			t.Errorf("Expected %q for Accept-Encoding %q, got %q", expected, header, actual)
+		}
+	}
+}
+
+func TestCompressedResponses(t *testing.T) {
+
+	large := strings.Repeat(`{"name":"Granitic"},`, 200)
+
+	bp := &bodyProvider{pattern: "^/large$", body: large, contentType: "application/json"}
+	sp := &bodyProvider{pattern: "^/small$", body: "{}", contentType: "application/json"}
+	ip := &bodyProvider{pattern: "^/image$", body: large, contentType: "image/png"}
+	ep := &bodyProvider{pattern: "^/encoded$", body: large, contentType: "application/json", encoding: "br"}
+	ev := &bodyProvider{pattern: "^/events$", body: large, contentType: "text/event-stream; charset=utf-8"}
+
+	s := runningServer(t, bp, sp, ip, ep, ev)
+	s.compressor = testCompressor(t)
+
+	alw, fs := logWriterWithBuffer(t, "%b")
+	s.AccessLogging = true
+	s.AccessLogWriter = alw
+
+	res := compressedRequest(s, "/large", "gzip")
+
+	alw.PrepareToStop()
+	alw.Stop()
+	s.AccessLogging = false
+
+	// The access log must record the number of bytes sent, not the uncompressed size
+	checkContents(t, fs, strconv.Itoa(res.Body.Len()))
+
+	if res.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip response")
+	}
+
+	gr, _ := gzip.NewReader(bytes.NewReader(res.Body.Bytes()))
+
+	if b, _ := ioutil.ReadAll(gr); string(b) != large {
+		t.Errorf("Decompressed body does not match")
+	}
+
+	res = compressedRequest(s, "/large", "deflate")
+	zr, err := zlib.NewReader(bytes.NewReader(res.Body.Bytes()))
+
+	if err != nil || res.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected deflate response")
+	}
+
+	if b, _ := ioutil.ReadAll(zr); string(b) != large {
+		t.Errorf("Decompressed body does not match")
+	}
+
+	for _, path := range []string{"/small", "/image", "/encoded", "/events"} {
+
+		res = compressedRequest(s, path, "gzip")
+
+		if res.Header().Get("Content-Encoding") == "gzip" {
+			t.Errorf("Response to %s should not have been compressed", path)
+		}
+
+		if res.Code != http.StatusOK || res.Body.String() != s.router.match("GET", path)[0].Provider.(*bodyProvider).body {
+			t.Errorf("Unexpected uncompressed response for %s", path)
+		}
+	}
+}
+
+func TestFlushedCompressedResponse(t *testing.T) {
+
+	var flushedBody string
+
+	fp := &flushingProvider{mockProvider: mockProvider{pattern: "^/stream$", methods: []string{"GET"}}}
+
+	s := runningServer(t, fp)
+	s.compressor = testCompressor(t)
+
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res := httptest.NewRecorder()
+
+	fp.serve = func(w *httpendpoint.HTTPResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: a\n\n"))
+		w.Flush()
+
+		test.ExpectBool(t, res.Flushed, true)
+		flushedBody = res.Body.String()
+
+		w.Write([]byte("data: b\n\n"))
+	}
+
+	s.handleAll(res, req)
+
+	// Data written before the first flush is too small to compress, so it must have been sent as-is
+	test.ExpectString(t, flushedBody, "data: a\n\n")
+	test.ExpectString(t, res.Body.String(), "data: a\n\ndata: b\n\n")
+	test.ExpectString(t, res.Header().Get("Content-Encoding"), "")
+}
+
+func TestInformationalStatusBeforeCompressedResponse(t *testing.T) {
+
+	large := strings.Repeat(`{"name":"Granitic"},`, 200)
+
+	fp := &flushingProvider{mockProvider: mockProvider{pattern: "^/hints$", methods: []string{"GET"}}}
+
+	s := runningServer(t, fp)
+	s.compressor = testCompressor(t)
+
+	fp.serve = func(w *httpendpoint.HTTPResponseWriter) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(large))
+	}
+
+	req := httptest.NewRequest("GET", "/hints", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res := &informationalRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	s.handleAll(res, req)
+
+	if len(res.informational) != 1 || res.informational[0] != http.StatusEarlyHints {
+		t.Errorf("Expected 103 to be sent before the response, got %v", res.informational)
+	}
+
+	test.ExpectInt(t, res.Code, http.StatusCreated)
+	test.ExpectString(t, res.Header().Get("Content-Encoding"), "gzip")
+
+	gr, _ := gzip.NewReader(bytes.NewReader(res.Body.Bytes()))
+
+	if b, _ := ioutil.ReadAll(gr); string(b) != large {
+		t.Errorf("Decompressed body does not match")
+	}
+}
+
+// informationalRecorder records 1xx statuses separately, as httptest.ResponseRecorder treats them as the final status
+type informationalRecorder struct {
+	*httptest.ResponseRecorder
+	informational []int
+}
+
+func (ir *informationalRecorder) WriteHeader(status int) {
+
+	if httpendpoint.Informational(status) {
+		ir.informational = append(ir.informational, status)
+		return
+	}
+
+	ir.ResponseRecorder.WriteHeader(status)
+}
+
+type flushingProvider struct {
+	mockProvider
+	serve func(w *httpendpoint.HTTPResponseWriter)
+}
+
+func (fp *flushingProvider) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+	fp.serve(w)
+
+	return ctx
+}
+
+func testCompressor(t *testing.T) *responseCompressor {
+
+	c := new(CompressionConfig)
+	c.Enabled = true
+	c.MinSizeBytes = 1024
+	c.Level = -1
+	c.Encodings = []string{"gzip", "deflate"}
+	c.ContentTypes = []string{"application/json", "text/*"}
+
+	rc, err := newResponseCompressor(c)
+
+	if err != nil {
+		t.Fatalf("Unable to create compressor: %s", err.Error())
+	}
+
+	return rc
+}
+
+func compressedRequest(s *HTTPServer, path, encoding string) *httptest.ResponseRecorder {
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Accept-Encoding", encoding)
+
+	res := httptest.NewRecorder()
+	s.handleAll(res, req)
+
+	return res
+}
+
+type bodyProvider struct {
+	mockProvider
+	pattern     string
+	body        string
+	contentType string
+	encoding    string
+}
+
+func (bp *bodyProvider) RegexPattern() string {
+	return bp.pattern
+}
+
+func (bp *bodyProvider) SupportedHTTPMethods() []string {
+	return []string{"GET"}
+}
+
+func (bp *bodyProvider) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+
+	w.Header().Set("Content-Type", bp.contentType)
+
+	if bp.encoding != "" {
+		w.Header().Set("Content-Encoding", bp.encoding)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write in small chunks to exercise buffering
+	for i := 0; i < len(bp.body); i += 100 {
+		end := i + 100
+
+		if end > len(bp.body) {
+			end = len(bp.body)
+		}
+
+		w.Write([]byte(bp.body[i:end]))
+	}
+
+	return ctx
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/tracecontext"
+	"net/http"
+)
+
+// TraceContextConfig controls whether W3C Trace Context headers (traceparent and tracestate) are parsed from incoming
+// requests. See the tracecontext package for more information.
+type TraceContextConfig struct {
+	// Whether or not the headers should be parsed
+	Enabled bool
+
+	// Start a new trace if a request does not have a valid traceparent header
+	StartIfAbsent bool
+
+	// If set, a traceparent identifying this application's span is written to the response using a header with this name
+	ResponseHeader string
+}
+
+// correlate records the request's ID and trace context as correlation IDs (so they can be logged) and writes them as
+// response headers if the server is configured to do so.
+func (h *HTTPServer) correlate(ctx context.Context, req *http.Request, wrw *httpendpoint.HTTPResponseWriter, instrumentor instrument.Instrumentor, requestID string) context.Context {
+
+	if requestID != "" {
+		ctx = logging.AddCorrelationID(ctx, logging.RequestIDField, requestID)
+
+		if h.requestIDHeader != "" {
+			wrw.Header().Set(h.requestIDHeader, requestID)
+		}
+	}
+
+	tc := h.TraceContext
+
+	if tc == nil || !tc.Enabled {
+		return ctx
+	}
+
+	trace := tracecontext.FromRequest(req, tc.StartIfAbsent)
+
+	if trace == nil {
+		return ctx
+	}
+
+	ctx = tracecontext.NewContext(ctx, trace)
+	ctx = logging.AddCorrelationID(ctx, logging.TraceIDField, trace.TraceID)
+	ctx = logging.AddCorrelationID(ctx, logging.SpanIDField, trace.SpanID)
+
+	if trace.ParentSpanID != "" {
+		ctx = logging.AddCorrelationID(ctx, logging.ParentSpanIDField, trace.ParentSpanID)
+	}
+
+	instrumentor.Amend(instrument.Trace, trace)
+
+	if tc.ResponseHeader != "" {
+		wrw.Header().Set(tc.ResponseHeader, trace.TraceParent())
+	}
+
+	return ctx
+}
@@ -0,0 +1,88 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/tracecontext"
+	"github.com/graniticio/granitic/v2/uuid"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInboundRequestIDs(t *testing.T) {
+
+	rcb := new(requestContextBuilder)
+	rcb.encoder = uuid.StandardEncoder
+	rcb.idGen = uuid.GenerateCryptoRand
+	rcb.inboundHeader = "X-Request-ID"
+	rcb.inboundFormat = regexp.MustCompile("^[A-Za-z0-9._:\\-]{1,128}$")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "edge-1234")
+
+	ctx, _ := rcb.WithIdentity(context.Background(), req)
+	test.ExpectString(t, rcb.ID(ctx), "edge-1234")
+
+	req.Header.Set("X-Request-ID", "<script>")
+
+	ctx, _ = rcb.WithIdentity(context.Background(), req)
+	test.ExpectInt(t, len(rcb.ID(ctx)), 36)
+
+	req.Header.Del("X-Request-ID")
+
+	ctx, _ = rcb.WithIdentity(context.Background(), req)
+	test.ExpectInt(t, len(rcb.ID(ctx)), 36)
+}
+
+func TestRequestAndTraceCorrelation(t *testing.T) {
+
+	s := runningServer(t, &mockProvider{pattern: "^/a$", methods: []string{"GET"}})
+
+	rcb := new(requestContextBuilder)
+	rcb.inboundHeader = "X-Request-ID"
+	rcb.inboundFormat = regexp.MustCompile(".+")
+
+	s.IDContextBuilder = rcb
+	s.requestIDHeader = "X-Request-ID"
+	s.TraceContext = &TraceContextConfig{Enabled: true, ResponseHeader: "traceresponse"}
+
+	req := httptest.NewRequest("GET", "/a", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	req.Header.Set(tracecontext.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	res := loggedRequest(t, s, req, "abc 4bf92f3577b34da6a3ce929d0e0e4736 00f067aa0ba902b7")
+
+	// No traceparent and StartIfAbsent is false
+	req = httptest.NewRequest("GET", "/a", nil)
+	req.Header.Set("X-Request-ID", "def")
+
+	loggedRequest(t, s, req, "def - -")
+
+	test.ExpectString(t, res.Header().Get("X-Request-ID"), "abc")
+
+	tr := res.Header().Get("traceresponse")
+
+	if !strings.HasPrefix(tr, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || strings.Contains(tr, "00f067aa0ba902b7") {
+		t.Errorf("Unexpected traceresponse header %s", tr)
+	}
+}
+
+func loggedRequest(t *testing.T, s *HTTPServer, req *http.Request, expectedLine string) *httptest.ResponseRecorder {
+
+	alw, fs := logWriterWithBuffer(t, "%{requestID}X %{traceID}X %{parentSpanID}X")
+	s.AccessLogging = true
+	s.AccessLogWriter = alw
+
+	res := httptest.NewRecorder()
+	s.handleAll(res, req)
+
+	alw.PrepareToStop()
+	alw.Stop()
+
+	checkContents(t, fs, expectedLine)
+
+	return res
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// serverDrain tracks the progress of an http.Server's graceful shutdown.
+type serverDrain struct {
+	done     chan struct{}
+	deadline time.Time
+	err      error
+}
+
+// beginDrain stops the server accepting new connections and starts a graceful shutdown in the background. Idle
+// connections are closed immediately and active connections are closed once their current request is complete. If the
+// drain has not finished after DrainDeadlineMS, any remaining connections are forcibly closed.
+func (h *HTTPServer) beginDrain() {
+
+	if h.server == nil || h.drain != nil {
+		return
+	}
+
+	d := new(serverDrain)
+	d.done = make(chan struct{})
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if h.DrainDeadlineMS > 0 {
+		d.deadline = time.Now().Add(time.Duration(h.DrainDeadlineMS) * time.Millisecond)
+		ctx, cancel = context.WithDeadline(context.Background(), d.deadline)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	h.drain = d
+	sv := h.server
+
+	go func() {
+		defer cancel()
+		defer close(d.done)
+
+		if err := sv.Shutdown(ctx); err != nil {
+			d.err = err
+
+			h.FrameworkLogger.LogWarnf("%s did not drain before the deadline. Closing %d remaining request(s)", h.serverDescription(), atomic.LoadInt64(&h.ActiveRequests))
+			sv.Close()
+		}
+	}()
+}
+
+// drained returns true if the server's graceful shutdown has finished (or was never started) and an error describing
+// the outstanding work if not.
+func (h *HTTPServer) drained() (bool, error) {
+
+	active := atomic.LoadInt64(&h.ActiveRequests)
+
+	if d := h.drain; d != nil {
+
+		select {
+		case <-d.done:
+		default:
+
+			if d.deadline.IsZero() {
+				return false, fmt.Errorf("%s is draining and still serving %d request(s)", h.serverDescription(), active)
+			}
+
+			remaining := time.Until(d.deadline).Truncate(time.Millisecond)
+
+			return false, fmt.Errorf("%s is draining and still serving %d request(s) (%v until connections are forcibly closed)", h.serverDescription(), active, remaining)
+		}
+	}
+
+	if active > 0 {
+		return false, fmt.Errorf("%s is still serving %d request(s)", h.serverDescription(), active)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/ctl"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	accessFiltersCommandName = "access-log-filters"
+	accessFiltersSummary     = "Shows or modifies the rules that decide which requests are written to the access log."
+	accessFiltersUsage       = "access-log-filters [-listener name] [-rule name [-sample rate] [-exclude true|false] [-disabled true|false]]"
+	accessFiltersHelp        = "With no '-rule' argument, lists the access log filters of each HTTP listener in the order they are evaluated. " +
+		"If '-listener' is supplied, only that listener's filters are shown or modified."
+	accessFiltersHelpTwo = "If '-rule' is supplied, the named filter is modified. '-sample' sets the proportion (0-1) of matching requests " +
+		"that are logged, '-exclude' prevents matching requests from being logged and '-disabled' causes the filter to be ignored."
+	accessFiltersHelpThree = "Changes are lost when the application is restarted."
+	listenerArg            = "listener"
+	ruleArg                = "rule"
+	sampleArg              = "sample"
+	excludeArg             = "exclude"
+	disabledArg            = "disabled"
+)
+
+type accessLogFiltersCommand struct {
+	FrameworkLogger logging.Logger
+	writers         map[string]*AccessLogWriter
+}
+
+func (c *accessLogFiltersCommand) ExecuteCommand(qualifiers []string, args map[string]string) (*ctl.CommandOutput, []*ws.CategorisedError) {
+
+	listeners, err := c.selectListeners(args[listenerArg])
+
+	if err != nil {
+		return nil, []*ws.CategorisedError{ctl.NewCommandClientError(err.Error())}
+	}
+
+	if rule := args[ruleArg]; rule != "" {
+		if err := c.amend(listeners, rule, args); err != nil {
+			return nil, []*ws.CategorisedError{ctl.NewCommandClientError(err.Error())}
+		}
+	}
+
+	rows := make([][]string, 0)
+
+	for _, l := range listeners {
+		for _, f := range c.writers[l].FilterRules() {
+			rows = append(rows, []string{l, f.Name, describeFilterCriteria(f), describeFilterAction(f)})
+		}
+	}
+
+	co := new(ctl.CommandOutput)
+	co.OutputHeader = fmt.Sprintf("%d filter(s) (listener, rule, criteria, action)", len(rows))
+	co.OutputBody = rows
+	co.RenderHint = ctl.Columns
+
+	return co, nil
+}
+
+func (c *accessLogFiltersCommand) selectListeners(name string) ([]string, error) {
+
+	if name != "" {
+
+		if c.writers[name] == nil {
+			return nil, fmt.Errorf("no listener named %s with access logging enabled", name)
+		}
+
+		return []string{name}, nil
+	}
+
+	names := make([]string, 0, len(c.writers))
+
+	for n := range c.writers {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (c *accessLogFiltersCommand) amend(listeners []string, rule string, args map[string]string) error {
+
+	var amendments []func(f *AccessLogFilter)
+
+	if v, found := args[sampleArg]; found {
+
+		rate, err := strconv.ParseFloat(v, 64)
+
+		if err != nil {
+			return fmt.Errorf("%s is not a valid sample rate", v)
+		}
+
+		amendments = append(amendments, func(f *AccessLogFilter) { f.SampleRate = rate })
+	}
+
+	if v, found := args[excludeArg]; found {
+
+		exclude, err := strconv.ParseBool(v)
+
+		if err != nil {
+			return fmt.Errorf("-%s must be true or false", excludeArg)
+		}
+
+		amendments = append(amendments, func(f *AccessLogFilter) { f.Exclude = exclude })
+	}
+
+	if v, found := args[disabledArg]; found {
+
+		disabled, err := strconv.ParseBool(v)
+
+		if err != nil {
+			return fmt.Errorf("-%s must be true or false", disabledArg)
+		}
+
+		amendments = append(amendments, func(f *AccessLogFilter) { f.Disabled = disabled })
+	}
+
+	if len(amendments) == 0 {
+		return fmt.Errorf("-%s requires at least one of -%s, -%s or -%s", ruleArg, sampleArg, excludeArg, disabledArg)
+	}
+
+	amended := 0
+
+	for _, l := range listeners {
+
+		alw := c.writers[l]
+
+		if !hasFilter(alw, rule) {
+			continue
+		}
+
+		err := alw.AmendFilter(rule, func(f *AccessLogFilter) {
+			for _, a := range amendments {
+				a(f)
+			}
+		})
+
+		if err != nil {
+			return err
+		}
+
+		c.FrameworkLogger.LogInfof("Access log filter %s amended for listener %s (runtime command)", rule, l)
+		amended++
+	}
+
+	if amended == 0 {
+		return fmt.Errorf("no access log filter named %s", rule)
+	}
+
+	return nil
+}
+
+func hasFilter(alw *AccessLogWriter, name string) bool {
+
+	for _, f := range alw.FilterRules() {
+		if f.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func describeFilterCriteria(f AccessLogFilter) string {
+
+	var c []string
+
+	if f.PathPattern != "" {
+		c = append(c, "path "+f.PathPattern)
+	}
+
+	if len(f.Handlers) > 0 {
+		c = append(c, "handler "+strings.Join(f.Handlers, "|"))
+	}
+
+	if f.MinStatus > 0 || f.MaxStatus > 0 {
+		max := "*"
+
+		if f.MaxStatus > 0 {
+			max = strconv.Itoa(f.MaxStatus)
+		}
+
+		c = append(c, fmt.Sprintf("status %d-%s", f.MinStatus, max))
+	}
+
+	if f.SlowerThanMS > 0 {
+		c = append(c, fmt.Sprintf(">= %dms", f.SlowerThanMS))
+	}
+
+	if len(c) == 0 {
+		return "all requests"
+	}
+
+	return strings.Join(c, ", ")
+}
+
+func describeFilterAction(f AccessLogFilter) string {
+
+	var a string
+
+	switch {
+	case f.Exclude:
+		a = "exclude"
+	case f.SampleRate > 0 && f.SampleRate < 1:
+		a = fmt.Sprintf("log %g%%", f.SampleRate*100)
+	default:
+		a = "log"
+	}
+
+	if f.Disabled {
+		a += " (disabled)"
+	}
+
+	return a
+}
+
+func (c *accessLogFiltersCommand) Name() string {
+	return accessFiltersCommandName
+}
+
+func (c *accessLogFiltersCommand) Summmary() string {
+	return accessFiltersSummary
+}
+
+func (c *accessLogFiltersCommand) Usage() string {
+	return accessFiltersUsage
+}
+
+func (c *accessLogFiltersCommand) Help() []string {
+	return []string{accessFiltersHelp, accessFiltersHelpTwo, accessFiltersHelpThree}
+}
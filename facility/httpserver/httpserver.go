@@ -18,14 +18,14 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
+	"github.com/graniticio/granitic/v2/cors"
 	"github.com/graniticio/granitic/v2/httpendpoint"
 	"github.com/graniticio/granitic/v2/instrument"
 	"github.com/graniticio/granitic/v2/ioc"
 	"github.com/graniticio/granitic/v2/logging"
 	"github.com/graniticio/granitic/v2/ws"
-	"net"
 	"net/http"
 	"regexp"
 	"sync/atomic"
@@ -35,13 +35,15 @@ import (
 type registeredProvider struct {
 	Provider httpendpoint.Provider
 	Pattern  *regexp.Regexp
+	name     string
+	index    int
 }
 
 // HTTPServer is the server that accepts incoming HTTP requests and maps them to handlers to process them.
 type HTTPServer struct {
-	registeredProvidersByMethod map[string][]*registeredProvider
-	unregisteredProviders       map[string]httpendpoint.Provider
-	componentContainer          *ioc.ComponentContainer
+	router                *providerRouter
+	unregisteredProviders map[string]httpendpoint.Provider
+	componentContainer    *ioc.ComponentContainer
 
 	// Logger used by Granitic framework components. Automatically injected.
 	FrameworkLogger logging.Logger
@@ -59,6 +61,13 @@ type HTTPServer struct {
 	// The TCP port on which the HTTP server should listen for requests.
 	Port int
 
+	// If set, the server listens on a unix domain socket instead of Address and Port.
+	UnixSocket *UnixSocketConfig
+
+	// If set and enabled, the server uses a listening socket inherited from the process that started the application
+	// (e.g. systemd) instead of opening its own. Takes precedence over UnixSocket, Address and Port.
+	SocketActivation *SocketActivationConfig
+
 	// The IP/hostname this server should listen on, follows standard Go net package syntax. Empty string means listen on all.
 	Address string
 
@@ -91,8 +100,55 @@ type HTTPServer struct {
 	// A component able to use data in an HTTP request's headers to populate a context
 	IDContextBuilder IdentifiedRequestContextBuilder
 
-	state  ioc.ComponentState
-	server *http.Server
+	// If true, the server will not automatically answer OPTIONS requests, serve HEAD requests using GET handlers or
+	// return 405 (Method Not Allowed) when a path is supported but not with the request's method.
+	DisableAutoMethodHandling bool
+
+	// A component able to answer CORS preflight requests and add CORS headers to responses. Automatically injected
+	// if the CORS facility is enabled.
+	CORS *cors.Processor
+
+	// Settings for serving requests over HTTPS. If nil or not enabled, the server will listen for plain HTTP requests.
+	TLS *TLSConfig
+
+	// The maximum time (in milliseconds) the server will wait for in-flight requests to complete when the application
+	// is stopping. Connections still open after this time are forcibly closed. Zero or less means wait indefinitely
+	// (subject to the application's StopRetries setting).
+	DrainDeadlineMS int
+
+	// If true, requests received on existing connections while the server is draining receive a TooBusyStatus
+	// response with a Connection: close header. If false, they are processed normally.
+	RejectDuringDrain bool
+
+	// Settings for compressing response bodies. If nil or not enabled, responses are never compressed.
+	Compression *CompressionConfig
+
+	// If true, panics recovered while a Provider is handling a request are re-raised once the error response and access log
+	// line have been written. Intended for use during development - net/http will log the panic and close the connection.
+	RepanicAfterRecovery bool
+
+	// Settings for parsing W3C Trace Context headers. If nil or not enabled, the headers are ignored.
+	TraceContext *TraceContextConfig
+
+	// Settings for determining the address of the client that made a request when the server is behind proxies. If nil
+	// or not enabled, the address of the connected host is used.
+	ClientIP *ClientIPConfig
+
+	state        ioc.ComponentState
+	server       *http.Server
+	certificates *certificateReloader
+	compressor   *responseCompressor
+	drain        *serverDrain
+	name         string
+	listeningOn  string
+	assignment   *listenerAssignment
+	primary      *HTTPServer
+
+	// The response header the request's ID is written to (if any)
+	requestIDHeader string
+
+	// Providers that take over connections and must close them when the server is suspended or stopped
+	connectionClosers []httpendpoint.ConnectionCloser
 }
 
 // Container allows Granitic to inject a reference to the IOC container
@@ -100,7 +156,11 @@ func (h *HTTPServer) Container(container *ioc.ComponentContainer) {
 	h.componentContainer = container
 }
 
-func (h *HTTPServer) registerProvider(endPointProvider httpendpoint.Provider) {
+func (h *HTTPServer) registerProvider(name string, endPointProvider httpendpoint.Provider) {
+
+	if cc, found := endPointProvider.(httpendpoint.ConnectionCloser); found {
+		h.connectionClosers = append(h.connectionClosers, cc)
+	}
 
 	for _, method := range endPointProvider.SupportedHTTPMethods() {
 		var compiledRegex *regexp.Regexp
@@ -110,21 +170,17 @@ func (h *HTTPServer) registerProvider(endPointProvider httpendpoint.Provider) {
 
 		if compiledRegex, err = regexp.Compile(pattern); err != nil {
 			h.FrameworkLogger.LogErrorf("Unable to compile regular expression from pattern %s: %s", pattern, err.Error())
+			continue
 		}
 
 		h.FrameworkLogger.LogTracef("Registering %s %s", pattern, method)
 
-		rp := registeredProvider{endPointProvider, compiledRegex}
+		rp := new(registeredProvider)
+		rp.Provider = endPointProvider
+		rp.Pattern = compiledRegex
+		rp.name = name
 
-		providersForMethod := h.registeredProvidersByMethod[method]
-
-		if providersForMethod == nil {
-			providersForMethod = make([]*registeredProvider, 1)
-			providersForMethod[0] = &rp
-			h.registeredProvidersByMethod[method] = providersForMethod
-		} else {
-			h.registeredProvidersByMethod[method] = append(providersForMethod, &rp)
-		}
+		h.router.add(method, rp)
 	}
 
 }
@@ -139,23 +195,31 @@ func (h *HTTPServer) StartComponent() error {
 	}
 
 	h.state = ioc.StartingState
-	h.registeredProvidersByMethod = make(map[string][]*registeredProvider)
+	h.router = newProviderRouter()
+
+	if h.primary != nil {
+		h.inheritFrom(h.primary)
+	}
+
+	if err := h.claimFiles(); err != nil {
+		return err
+	}
 
 	if h.AutoFindHandlers {
 		for _, component := range h.componentContainer.AllComponents() {
 
 			name := component.Name
 
-			if provider, found := component.Instance.(httpendpoint.Provider); found && provider.AutoWireable() {
+			if provider, found := component.Instance.(httpendpoint.Provider); found && provider.AutoWireable() && h.assigned(name, provider) {
 				h.FrameworkLogger.LogDebugf("Found Provider %s", name)
-				h.registerProvider(provider)
+				h.registerProvider(name, provider)
 			}
 		}
 	} else if h.unregisteredProviders != nil {
 
-		for _, provider := range h.unregisteredProviders {
+		for name, provider := range h.unregisteredProviders {
 
-			h.registerProvider(provider)
+			h.registerProvider(name, provider)
 
 		}
 
@@ -174,12 +238,42 @@ func (h *HTTPServer) StartComponent() error {
 		h.InstrumentationManager = new(noopRequestInstrumentationManager)
 	}
 
+	if h.TLS != nil && h.TLS.Enabled {
+
+		cr, err := newCertificateReloader(h.TLS, h.FrameworkLogger)
+
+		if err != nil {
+			return err
+		}
+
+		h.certificates = cr
+	}
+
+	if h.Compression != nil && h.Compression.Enabled {
+
+		rc, err := newResponseCompressor(h.Compression)
+
+		if err != nil {
+			return err
+		}
+
+		h.compressor = rc
+	}
+
+	if h.ClientIP.enabled() {
+
+		if err := h.ClientIP.configure(); err != nil {
+			return err
+		}
+	}
+
 	h.state = ioc.AwaitingAccessState
 
 	return nil
 }
 
-// Suspend causes all subsequent new HTTP requests to receive a 'too busy' response until Resume is called.
+// Suspend causes all subsequent new HTTP requests to receive a 'too busy' response until Resume is called. Connections
+// that have been taken over by providers (e.g. WebSockets) are closed.
 func (h *HTTPServer) Suspend() error {
 
 	if h.state != ioc.RunningState {
@@ -188,6 +282,8 @@ func (h *HTTPServer) Suspend() error {
 
 	h.state = ioc.SuspendedState
 
+	h.closeProviderConnections()
+
 	return nil
 }
 
@@ -203,7 +299,8 @@ func (h *HTTPServer) Resume() error {
 	return nil
 }
 
-// AllowAccess starts the server listening on the configured address and port. Returns an error if the port is already in use.
+// AllowAccess starts the server listening on the configured address and port (or unix socket or inherited socket).
+// Returns an error if the port is already in use. If TLS is enabled, the server will only accept HTTPS connections.
 func (h *HTTPServer) AllowAccess() error {
 
 	if h.state != ioc.AwaitingAccessState {
@@ -216,22 +313,31 @@ func (h *HTTPServer) AllowAccess() error {
 	sv := new(http.Server)
 	sv.Handler = sm
 
-	listenAddress := fmt.Sprintf("%s:%d", h.Address, h.Port)
+	ln, where, err := h.listen()
 
-	//Check if the address is already in use
-	if ln, err := net.Listen("tcp", listenAddress); err == nil {
-		ln.Close()
-	} else {
+	if err != nil {
 		return err
 	}
 
-	sv.Addr = listenAddress
+	sv.Addr = ln.Addr().String()
+	h.listeningOn = where
 
-	go sv.ListenAndServe()
+	if h.ClientIP.enabled() && h.ClientIP.ProxyProtocol {
+		ln = &proxyProtocolListener{Listener: ln, trusted: h.ClientIP.isTrusted}
+	}
 
-	h.server = sv
+	if h.certificates != nil {
+		ln = tls.NewListener(ln, h.certificates.TLSConfig())
+		h.certificates.Watch()
+
+		h.FrameworkLogger.LogInfof("%s on %s (HTTPS)", h.listeningDescription(), where)
+	} else {
+		h.FrameworkLogger.LogInfof("%s on %s", h.listeningDescription(), where)
+	}
+
+	go sv.Serve(ln)
 
-	h.FrameworkLogger.LogInfof("Listening on %d", h.Port)
+	h.server = sv
 
 	h.state = ioc.RunningState
 
@@ -243,12 +349,19 @@ func (h *HTTPServer) SetProvidersManually(p map[string]httpendpoint.Provider) {
 	h.unregisteredProviders = p
 }
 
-func (h *HTTPServer) writeAbnormal(ctx context.Context, status int, wrw *httpendpoint.HTTPResponseWriter, err ...error) {
+func (h *HTTPServer) writeAbnormal(ctx context.Context, status int, wrw *httpendpoint.HTTPResponseWriter, req *http.Request, err ...error) {
 
 	if len(err) > 0 {
 		h.FrameworkLogger.LogErrorf(err[0].Error())
 	}
 
+	if cn, found := h.AbnormalStatusWriter.(ws.ContentNegotiator); found {
+		// Respond in the caller's preferred format. If none are acceptable, the writer's default format is used
+		if nctx, rejected := cn.Negotiate(ctx, req); rejected == 0 {
+			ctx = nctx
+		}
+	}
+
 	state := ws.NewAbnormalState(status, wrw)
 	if err := h.AbnormalStatusWriter.WriteAbnormalStatus(ctx, state); err != nil {
 		h.FrameworkLogger.LogErrorfCtx(ctx, err.Error())
@@ -265,14 +378,26 @@ func (h *HTTPServer) handleAll(res http.ResponseWriter, req *http.Request) {
 
 	if h.AllowEarlyInstrumentation {
 		ctx, instrumentor, endInstrumentation = h.InstrumentationManager.Begin(ctx, res, req)
-		defer endInstrumentation()
 	}
 
 	wrw := httpendpoint.NewHTTPResponseWriter(res)
 
-	if h.state != ioc.RunningState {
+	defer func() {
+		if instrumentor != nil {
+			h.endInstrumentation(instrumentor, endInstrumentation, wrw)
+		}
+	}()
+
+	if h.state == ioc.StoppingState && h.RejectDuringDrain {
+		// The HTTP server is draining - reject the request and ask the client not to reuse the connection
+		wrw.Header().Set("Connection", "close")
+		h.writeAbnormal(ctx, h.TooBusyStatus, wrw, req)
+		return
+	}
+
+	if h.state != ioc.RunningState && h.state != ioc.StoppingState && !h.availableWhileSuspended(req) {
 		// The HTTP server is suspended - reject the request
-		h.writeAbnormal(ctx, h.TooBusyStatus, wrw)
+		h.writeAbnormal(ctx, h.TooBusyStatus, wrw, req)
 		return
 	}
 
@@ -281,13 +406,12 @@ func (h *HTTPServer) handleAll(res http.ResponseWriter, req *http.Request) {
 
 	if h.MaxConcurrent > 0 && rCount > h.MaxConcurrent {
 		// Too many requests already being processed
-		h.writeAbnormal(ctx, h.TooBusyStatus, wrw)
+		h.writeAbnormal(ctx, h.TooBusyStatus, wrw, req)
 		return
 	}
 
 	if instrumentor == nil {
 		ctx, instrumentor, endInstrumentation = h.InstrumentationManager.Begin(ctx, res, req)
-		defer endInstrumentation()
 	}
 
 	var requestID string
@@ -310,39 +434,89 @@ func (h *HTTPServer) handleAll(res http.ResponseWriter, req *http.Request) {
 		} else {
 
 			//Something went wrong trying to use HTTP data to identify a context - treat as a bad request (400)
-			h.writeAbnormal(ctx, http.StatusBadRequest, wrw, err)
+			h.writeAbnormal(ctx, http.StatusBadRequest, wrw, req, err)
 
 			return
 
 		}
 	}
 
-	matched := false
+	if h.ClientIP.enabled() {
+		ctx = httpendpoint.WithClientIP(ctx, h.ClientIP.resolve(req))
+	}
 
-	providersByMethod := h.registeredProvidersByMethod[req.Method]
+	ctx = h.correlate(ctx, req, wrw, instrumentor, requestID)
+
+	matched := false
 
 	path := req.URL.Path
 
-	h.FrameworkLogger.LogTracef("Finding provider to handle %s %s from %d providers", path, req.Method, len(providersByMethod))
+	var cw *compressingWriter
+
+	if h.compressor != nil {
+		if cw = h.compressor.wrap(res, req); cw != nil {
+			wrw = httpendpoint.NewHTTPResponseWriter(cw)
+		}
+	}
+
+	// CORS preflight requests are answered by the server rather than a provider
+	preflight := h.CORS != nil && h.CORS.IsPreflight(req) && h.answerPreflight(wrw, req)
+
+	var providers []*registeredProvider
 
-	for _, handlerPattern := range providersByMethod {
+	if !preflight {
+		h.FrameworkLogger.LogTracef("Finding provider to handle %s %s from %d providers", path, req.Method, h.router.providerCount(req.Method))
 
-		pattern := handlerPattern.Pattern
+		providers = h.router.match(req.Method, path)
 
-		h.FrameworkLogger.LogTracef("Testing %s", pattern.String())
+		if len(providers) == 0 && req.Method == http.MethodHead && !h.DisableAutoMethodHandling {
+			// No explicit HEAD provider - use any GET provider but suppress the response body
+			providers = h.router.match(http.MethodGet, path)
+			wrw = httpendpoint.NewHTTPResponseWriter(&bodylessResponseWriter{res})
+		}
+	}
+
+	var recovered *recoveredPanic
+
+	for _, handlerPattern := range providers {
+
+		if h.versionMatch(instrumentor, req, handlerPattern.Provider) {
+			h.FrameworkLogger.LogTracef("Matches %s", handlerPattern.Pattern.String())
+
+			if h.CORS != nil && !matched {
+				h.CORS.Decorate(wrw.Header(), req, handlerPattern.Provider)
+			}
+
+			if !matched {
+				// Record which provider handled the request so access log filters can refer to it
+				ctx = withHandlerName(ctx, handlerPattern.name)
+			}
 
-		if pattern.MatchString(path) && h.versionMatch(instrumentor, req, handlerPattern.Provider) {
-			h.FrameworkLogger.LogTracef("Matches %s", pattern.String())
 			matched = true
-			ctx = handlerPattern.Provider.ServeHTTP(ctx, wrw, req)
+
+			if ctx, recovered = h.serveRecovering(ctx, handlerPattern.Provider, wrw, req, instrumentor, requestID); recovered != nil {
+				break
+			}
+		}
+	}
+
+	if !matched && !preflight {
+		if h.CORS != nil && !h.CORS.IsPreflight(req) {
+			// Allow cross-origin callers to see error responses
+			h.CORS.Decorate(wrw.Header(), req, nil)
 		}
+
+		h.handleUnmatched(ctx, wrw, req)
 	}
 
-	if !matched {
-		state := ws.NewAbnormalState(http.StatusNotFound, wrw)
+	if cw != nil {
+		if err := cw.Close(); err != nil {
+			h.FrameworkLogger.LogErrorfCtx(ctx, "Unable to complete compressed response: %s", err.Error())
+		}
 
-		if err := h.AbnormalStatusWriter.WriteAbnormalStatus(ctx, state); err != nil {
-			h.FrameworkLogger.LogErrorfCtx(ctx, err.Error())
+		// Access logs should record the number of bytes actually sent to the client
+		if !cw.hijacked {
+			wrw.BytesServed = cw.BytesWritten()
 		}
 	}
 
@@ -351,6 +525,44 @@ func (h *HTTPServer) handleAll(res http.ResponseWriter, req *http.Request) {
 		h.AccessLogWriter.LogRequest(ctx, req, wrw, &received, &finished)
 	}
 
+	if recovered != nil && h.RepanicAfterRecovery {
+		// Allow the panic to reach net/http (useful during development)
+		panic(recovered.value)
+	}
+
+}
+
+// endInstrumentation tells the instrumentor which status was sent to the caller, then ends instrumentation of the request
+func (h *HTTPServer) endInstrumentation(instrumentor instrument.Instrumentor, end func(), wrw *httpendpoint.HTTPResponseWriter) {
+
+	status := wrw.Status
+
+	if status == 0 {
+		// Nothing was written, so net/http will send a 200
+		status = http.StatusOK
+	}
+
+	instrumentor.Amend(instrument.ResponseStatus, status)
+
+	end()
+}
+
+// availableWhileSuspended returns true if the server is suspended and the request would be handled by a Provider that
+// has asked to keep serving requests while the server is suspended.
+func (h *HTTPServer) availableWhileSuspended(req *http.Request) bool {
+
+	if h.state != ioc.SuspendedState {
+		return false
+	}
+
+	for _, rp := range h.router.match(req.Method, req.URL.Path) {
+
+		if aws, found := rp.Provider.(httpendpoint.AvailableWhileSuspended); found && aws.ServeWhileSuspended() {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (h *HTTPServer) versionMatch(ri instrument.Instrumentor, r *http.Request, p httpendpoint.Provider) bool {
@@ -367,38 +579,55 @@ func (h *HTTPServer) versionMatch(ri instrument.Instrumentor, r *http.Request, p
 
 }
 
-// PrepareToStop sets state to Stopping. Any subsequent requests will receive a 'too busy response'
+// PrepareToStop sets state to Stopping, stops the server accepting new connections and begins draining existing
+// connections. If RejectDuringDrain is set, requests received on existing connections while the server is draining
+// will receive a 'too busy' response with the status set in TooBusyStatus.
 func (h *HTTPServer) PrepareToStop() {
 	h.state = ioc.StoppingState
 
-	if h.server != nil {
-		h.server.Shutdown(context.Background())
-	}
-
+	h.closeProviderConnections()
+	h.beginDrain()
 }
 
-// ReadyToStop returns false is the server is currently handling any requests.
+// ReadyToStop returns false if the server is still draining connections or is currently handling any requests.
 func (h *HTTPServer) ReadyToStop() (bool, error) {
-	a := h.ActiveRequests
-	ready := a <= 0
-
-	if ready {
-		return true, nil
-	}
-
-	return false, fmt.Errorf("HTTP server listening on %d is still serving %d request(s)", h.Port, a)
-
+	return h.drained()
 }
 
-// Stop sets state to Stopped. Any subsequent requests will receive a 'too busy response'. Note that the HTTP
-// server is still listening on its configured port and address.
+// Stop sets state to Stopped, closes any connections taken over by providers and closes the HTTP server. The server
+// stops listening on its configured port, address or socket and any connections that are still open are closed
+// immediately.
 func (h *HTTPServer) Stop() error {
 
 	h.state = ioc.StoppedState
 
+	h.closeProviderConnections()
+
+	if h.certificates != nil {
+		h.certificates.StopWatching()
+	}
+
 	if h.server != nil {
 		h.server.Close()
 	}
 
 	return nil
 }
+
+// closeProviderConnections asks providers that have taken over connections from the server (e.g. WebSockets) to close them.
+func (h *HTTPServer) closeProviderConnections() {
+	for _, cc := range h.connectionClosers {
+		cc.CloseConnections()
+	}
+}
+
+// reloadCertificates causes the certificate and key files to be re-read from disk. Connections that are already
+// established continue to use the previous certificates.
+func (h *HTTPServer) reloadCertificates() error {
+
+	if h.certificates == nil {
+		return errors.New("TLS is not enabled for this server")
+	}
+
+	return h.certificates.Reload()
+}
@@ -2,10 +2,19 @@ package httpserver
 
 import (
 	"context"
+	"github.com/graniticio/granitic/v2/cors"
 	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/ioc"
 	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
 	"github.com/graniticio/granitic/v2/ws"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestServerStart(t *testing.T) {
@@ -37,3 +46,353 @@ type mockAsw struct {
 func (a *mockAsw) WriteAbnormalStatus(ctx context.Context, state *ws.ProcessState) error {
 	return nil
 }
+
+func TestMethodNotAllowedOptionsAndHead(t *testing.T) {
+
+	get := &mockProvider{pattern: "^/artist/([\\d]+)$", methods: []string{"GET"}}
+	put := &mockProvider{pattern: "^/artist/([\\d]+)$", methods: []string{"PUT"}}
+
+	s := runningServer(t, get, put)
+
+	res := httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("DELETE", "/artist/1", nil))
+
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", res.Code)
+	}
+
+	if a := res.Header().Get("Allow"); a != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Unexpected Allow header %s", a)
+	}
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("OPTIONS", "/artist/1", nil))
+
+	if res.Code != http.StatusNoContent || res.Header().Get("Allow") == "" {
+		t.Errorf("Unexpected OPTIONS response %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("HEAD", "/artist/1", nil))
+
+	if !get.served || res.Code != http.StatusOK || res.Body.Len() != 0 {
+		t.Errorf("HEAD request not served by GET provider without a body")
+	}
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("DELETE", "/record/1", nil))
+
+	if res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", res.Code)
+	}
+
+	s.DisableAutoMethodHandling = true
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("DELETE", "/artist/1", nil))
+
+	if res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with automatic method handling disabled, got %d", res.Code)
+	}
+}
+
+func runningServer(t *testing.T, providers ...httpendpoint.Provider) *HTTPServer {
+
+	s := new(HTTPServer)
+	s.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	s.AbnormalStatusWriter = new(statusOnlyAsw)
+
+	pm := make(map[string]httpendpoint.Provider)
+
+	for i, p := range providers {
+		pm[strconv.Itoa(i)] = p
+	}
+
+	s.SetProvidersManually(pm)
+
+	if err := s.StartComponent(); err != nil {
+		t.Fatalf("Unable to start server: %s", err.Error())
+	}
+
+	s.state = ioc.RunningState
+
+	return s
+}
+
+type statusOnlyAsw struct {
+}
+
+func (a *statusOnlyAsw) WriteAbnormalStatus(ctx context.Context, state *ws.ProcessState) error {
+	state.HTTPResponseWriter.WriteHeader(state.Status)
+	return nil
+}
+
+func TestAbnormalStatusNegotiation(t *testing.T) {
+
+	s := runningServer(t, &mockProvider{pattern: "^/artist$", methods: []string{"GET"}})
+
+	s.AbnormalStatusWriter = &ws.NegotiatingResponseWriter{Formats: []*ws.NegotiatedFormat{
+		{Name: "JSON", MediaTypes: []string{"application/json"}, ResponseWriter: &namedAsw{name: "JSON"}},
+		{Name: "XML", MediaTypes: []string{"application/xml"}, ResponseWriter: &namedAsw{name: "XML"}},
+	}}
+
+	for accept, expected := range map[string]string{"application/xml": "XML", "": "JSON", "image/png": "JSON"} {
+
+		req := httptest.NewRequest("GET", "/album", nil)
+		req.Header.Set("Accept", accept)
+
+		res := httptest.NewRecorder()
+		s.handleAll(res, req)
+
+		test.ExpectInt(t, res.Code, http.StatusNotFound)
+		test.ExpectString(t, res.Body.String(), expected)
+	}
+}
+
+type namedAsw struct {
+	name string
+}
+
+func (a *namedAsw) Write(ctx context.Context, state *ws.ProcessState, outcome ws.Outcome) error {
+	return a.WriteAbnormalStatus(ctx, state)
+}
+
+func (a *namedAsw) WriteAbnormalStatus(ctx context.Context, state *ws.ProcessState) error {
+	state.HTTPResponseWriter.WriteHeader(state.Status)
+	state.HTTPResponseWriter.Write([]byte(a.name))
+	return nil
+}
+
+func TestCORSPreflightAndDecoration(t *testing.T) {
+
+	get := &mockProvider{pattern: "^/artist/([\\d]+)$", methods: []string{"GET"}}
+	put := &mockProvider{pattern: "^/artist/([\\d]+)$", methods: []string{"PUT"}}
+
+	s := runningServer(t, get, put)
+
+	s.CORS = new(cors.Processor)
+	s.CORS.DefaultPolicy = new(cors.Policy)
+	s.CORS.DefaultPolicy.AllowedOrigins = []string{"https://*.example.com"}
+	s.CORS.StartComponent()
+
+	req := httptest.NewRequest("OPTIONS", "/artist/1", nil)
+	req.Header.Set("Origin", "https://www.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+
+	res := httptest.NewRecorder()
+	s.handleAll(res, req)
+
+	if res.Code != http.StatusNoContent || put.served {
+		t.Errorf("Preflight not answered by server")
+	}
+
+	if res.Header().Get("Access-Control-Allow-Origin") != "https://www.example.com" {
+		t.Errorf("Missing allowed origin header on preflight response")
+	}
+
+	if m := res.Header().Get("Access-Control-Allow-Methods"); m != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Unexpected allowed methods %s", m)
+	}
+
+	req = httptest.NewRequest("GET", "/artist/1", nil)
+	req.Header.Set("Origin", "https://www.example.com")
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, req)
+
+	if !get.served || res.Header().Get("Access-Control-Allow-Origin") != "https://www.example.com" {
+		t.Errorf("Response not decorated with CORS headers")
+	}
+
+	// Preflight for an unsupported method is treated as a normal OPTIONS request
+	req = httptest.NewRequest("OPTIONS", "/artist/1", nil)
+	req.Header.Set("Origin", "https://www.example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, req)
+
+	if res.Header().Get("Access-Control-Allow-Origin") != "" || res.Header().Get("Allow") == "" {
+		t.Errorf("Unexpected response to preflight for unsupported method")
+	}
+}
+
+func TestGracefulDrain(t *testing.T) {
+
+	release := make(chan bool)
+	started := make(chan bool)
+
+	bp := &blockingProvider{release: release, started: started}
+	bp.pattern = "^/slow$"
+	bp.methods = []string{"GET"}
+
+	s := runningServer(t, bp)
+	s.DrainDeadlineMS = 5000
+	s.RejectDuringDrain = true
+	s.TooBusyStatus = http.StatusTooManyRequests
+	s.name = "public"
+	s.listeningOn = "unix socket /tmp/public.sock"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+
+	s.server = &http.Server{Handler: http.HandlerFunc(s.handleAll)}
+	go s.server.Serve(ln)
+
+	url := "http://" + ln.Addr().String() + "/slow"
+
+	result := make(chan int)
+
+	go func() {
+		res, err := http.Get(url)
+
+		if err != nil {
+			result <- 0
+			return
+		}
+
+		res.Body.Close()
+		result <- res.StatusCode
+	}()
+
+	<-started
+
+	s.PrepareToStop()
+
+	if ready, err := s.ReadyToStop(); ready || err == nil {
+		t.Errorf("Server should not be ready to stop while a request is in flight")
+	} else if !strings.Contains(err.Error(), "listener public listening on unix socket /tmp/public.sock") {
+		t.Errorf("Drain message does not describe the listener: %s", err.Error())
+	}
+
+	// Requests arriving on existing connections during the drain are rejected
+	res := httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("GET", "/slow", nil))
+
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Connection") != "close" {
+		t.Errorf("Unexpected response during drain %d %v", res.Code, res.Header())
+	}
+
+	// New connections are refused
+	if _, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second); err == nil {
+		t.Errorf("Expected new connections to be refused while draining")
+	}
+
+	release <- true
+
+	if status := <-result; status != http.StatusOK {
+		t.Errorf("In-flight request did not complete normally, got %d", status)
+	}
+
+	<-s.drain.done
+
+	if ready, err := s.ReadyToStop(); !ready {
+		t.Errorf("Server should be ready to stop after draining: %v", err)
+	}
+
+	s.Stop()
+}
+
+func TestDrainDeadline(t *testing.T) {
+
+	release := make(chan bool)
+	started := make(chan bool)
+
+	bp := &blockingProvider{release: release, started: started}
+	bp.pattern = "^/slow$"
+	bp.methods = []string{"GET"}
+
+	s := runningServer(t, bp)
+	s.DrainDeadlineMS = 50
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	s.server = &http.Server{Handler: http.HandlerFunc(s.handleAll)}
+	go s.server.Serve(ln)
+
+	go http.Get("http://" + ln.Addr().String() + "/slow")
+
+	<-started
+
+	s.PrepareToStop()
+
+	<-s.drain.done
+
+	if s.drain.err == nil {
+		t.Errorf("Expected drain to exceed its deadline")
+	}
+
+	close(release)
+}
+
+type blockingProvider struct {
+	mockProvider
+	started chan bool
+	release chan bool
+}
+
+func (bp *blockingProvider) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+	bp.started <- true
+	<-bp.release
+
+	w.WriteHeader(http.StatusOK)
+
+	return ctx
+}
+
+func TestProvidersAvailableWhileSuspended(t *testing.T) {
+
+	health := &suspensionExemptProvider{mockProvider: mockProvider{pattern: "^/healthz$", methods: []string{"GET"}}}
+	normal := &mockProvider{pattern: "^/artist$", methods: []string{"GET"}}
+
+	s := runningServer(t, health, normal)
+	s.TooBusyStatus = http.StatusServiceUnavailable
+	s.Suspend()
+
+	res := httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("GET", "/artist", nil))
+
+	if res.Code != http.StatusServiceUnavailable || normal.served {
+		t.Errorf("Expected normal provider to be unavailable while suspended")
+	}
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("GET", "/healthz", nil))
+
+	if res.Code != http.StatusOK || !health.served {
+		t.Errorf("Expected exempt provider to serve requests while suspended")
+	}
+}
+
+type suspensionExemptProvider struct {
+	mockProvider
+}
+
+func (sp *suspensionExemptProvider) ServeWhileSuspended() bool {
+	return true
+}
+
+func TestProviderConnectionsClosed(t *testing.T) {
+
+	cp := &connectionOwningProvider{mockProvider: mockProvider{pattern: "^/socket$", methods: []string{"GET"}}}
+
+	s := runningServer(t, cp)
+
+	s.Suspend()
+	test.ExpectInt(t, cp.closed, 1)
+
+	s.Resume()
+	s.PrepareToStop()
+	test.ExpectInt(t, cp.closed, 2)
+}
+
+type connectionOwningProvider struct {
+	mockProvider
+	closed int
+}
+
+func (cp *connectionOwningProvider) CloseConnections() {
+	cp.closed++
+}
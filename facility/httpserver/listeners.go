@@ -0,0 +1,306 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultListenerName is the name of the HTTP server configured directly under the HTTPServer configuration element.
+// Handlers that are not assigned to any other listener are registered with this server.
+const DefaultListenerName = "default"
+
+const listenersConfigPath = "HTTPServer.Listeners"
+
+// listenerRules are the settings in a listener's configuration that decide which handlers are registered with it.
+type listenerRules struct {
+	// Regular expressions matched against the component names of handlers.
+	Handlers []string
+
+	// Handlers whose path pattern must start with one of these literal paths (e.g. /admin/) are assigned to the listener.
+	PathPrefixes []string
+}
+
+type listenerRule struct {
+	name         string
+	handlers     []*regexp.Regexp
+	pathPrefixes []string
+}
+
+// listenerAssignment decides which of an application's HTTP servers each Provider should be registered with. It is
+// shared by all of the servers created by this facility.
+type listenerAssignment struct {
+	names   map[string]bool
+	rules   []*listenerRule
+	claimed map[string]string
+	mutex   sync.Mutex
+}
+
+func newListenerAssignment() *listenerAssignment {
+	la := new(listenerAssignment)
+	la.names = map[string]bool{DefaultListenerName: true}
+	la.claimed = make(map[string]string)
+
+	return la
+}
+
+// claim records that the named listener uses the file at the supplied path, returning an error if a different
+// listener already uses it.
+func (la *listenerAssignment) claim(listener, use, path string) error {
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	key := use + ":" + path
+
+	if other := la.claimed[key]; other != "" && other != listener {
+		return fmt.Errorf("listeners %s and %s are both configured to use %s as their %s. Each listener must use a different path", other, listener, path, use)
+	}
+
+	la.claimed[key] = listener
+
+	return nil
+}
+
+func (la *listenerAssignment) addListener(name string, lr *listenerRules) error {
+
+	la.names[name] = true
+
+	r := new(listenerRule)
+	r.name = name
+	r.pathPrefixes = lr.PathPrefixes
+
+	for _, h := range lr.Handlers {
+
+		re, err := regexp.Compile(h)
+
+		if err != nil {
+			return fmt.Errorf("unable to compile handler rule %s for listener %s: %s", h, name, err.Error())
+		}
+
+		r.handlers = append(r.handlers, re)
+	}
+
+	la.rules = append(la.rules, r)
+	sort.Slice(la.rules, func(i, j int) bool { return la.rules[i].name < la.rules[j].name })
+
+	return nil
+}
+
+// listenersFor returns the names of the listeners a Provider should be registered with. A Provider that explicitly
+// names its listeners is registered with those listeners. Otherwise it is registered with every listener whose rules
+// match the Provider's component name or path pattern, or with the default listener if no rules match.
+func (la *listenerAssignment) listenersFor(componentName string, p httpendpoint.Provider) []string {
+
+	if ap, found := p.(httpendpoint.ListenerAssigned); found {
+		if l := ap.AssignedListeners(); len(l) > 0 {
+			return l
+		}
+	}
+
+	var matched []string
+
+	prefix, _ := anchoredPrefix(p.RegexPattern())
+
+	for _, r := range la.rules {
+		if r.matches(componentName, prefix) {
+			matched = append(matched, r.name)
+		}
+	}
+
+	if len(matched) == 0 {
+		return []string{DefaultListenerName}
+	}
+
+	return matched
+}
+
+// unknownListeners returns any of the supplied listener names that have not been configured
+func (la *listenerAssignment) unknownListeners(names []string) []string {
+
+	var unknown []string
+
+	for _, n := range names {
+		if !la.names[n] {
+			unknown = append(unknown, n)
+		}
+	}
+
+	return unknown
+}
+
+func (r *listenerRule) matches(componentName, pathPrefix string) bool {
+
+	for _, re := range r.handlers {
+		if re.MatchString(componentName) {
+			return true
+		}
+	}
+
+	for _, p := range r.pathPrefixes {
+		if strings.HasPrefix(pathPrefix, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listenerNames returns the names of the additional listeners defined under HTTPServer.Listeners, in alphabetical order.
+func listenerNames(ca *config.Accessor) ([]string, error) {
+
+	if !ca.PathExists(listenersConfigPath) {
+		return nil, nil
+	}
+
+	lc, err := ca.ObjectVal(listenersConfigPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(lc))
+
+	for n := range lc {
+
+		if n == DefaultListenerName {
+			return nil, fmt.Errorf("%s is reserved and cannot be used as the name of a listener in %s", n, listenersConfigPath)
+		}
+
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// ListenerComponentName returns the name of the component representing the HTTP server for the named listener.
+func ListenerComponentName(listener string) string {
+
+	if listener == DefaultListenerName || listener == "" {
+		return HTTPServerComponentName
+	}
+
+	return HTTPServerComponentName + "-" + listener
+}
+
+// assigned returns true if the Provider should be registered with this server. Servers that were not created by this
+// facility's builder accept all Providers.
+func (h *HTTPServer) assigned(componentName string, p httpendpoint.Provider) bool {
+
+	if h.assignment == nil {
+		return true
+	}
+
+	listeners := h.assignment.listenersFor(componentName, p)
+
+	if unknown := h.assignment.unknownListeners(listeners); len(unknown) > 0 && h.primary == nil {
+		h.FrameworkLogger.LogWarnf("%s is assigned to listener(s) %v which have not been configured in %s", componentName, unknown, listenersConfigPath)
+	}
+
+	for _, l := range listeners {
+		if l == h.listenerName() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inheritFrom copies components injected into the default server that have not been explicitly set on this server.
+// Configuration (TraceContext, ClientIP etc.) is not copied here - the builder populates each listener from the
+// default server's configuration before applying the listener's own.
+func (h *HTTPServer) inheritFrom(p *HTTPServer) {
+
+	if h.AbnormalStatusWriter == nil {
+		h.AbnormalStatusWriter = p.AbnormalStatusWriter
+	}
+
+	if h.InstrumentationManager == nil && !h.DisableInstrumentationAutoWire {
+		h.InstrumentationManager = p.InstrumentationManager
+	}
+
+	if h.VersionExtractor == nil {
+		h.VersionExtractor = p.VersionExtractor
+	}
+
+	if h.IDContextBuilder == nil {
+		h.IDContextBuilder = p.IDContextBuilder
+	}
+
+	if h.requestIDHeader == "" {
+		h.requestIDHeader = p.requestIDHeader
+	}
+
+	if h.CORS == nil {
+		h.CORS = p.CORS
+	}
+}
+
+// claimFiles checks that this server does not share its access log file or unix socket with another listener
+func (h *HTTPServer) claimFiles() error {
+
+	if h.assignment == nil {
+		return nil
+	}
+
+	if alw := h.AccessLogWriter; h.AccessLogging && alw != nil && !alw.LogToStdout {
+
+		if err := h.assignment.claim(h.listenerName(), "access log", alw.LogPath); err != nil {
+			return err
+		}
+	}
+
+	if us := h.UnixSocket; us.enabled() {
+		return h.assignment.claim(h.listenerName(), "unix socket", us.Path)
+	}
+
+	return nil
+}
+
+func (h *HTTPServer) listenerName() string {
+
+	if h.name == "" {
+		return DefaultListenerName
+	}
+
+	return h.name
+}
+
+func (h *HTTPServer) listeningDescription() string {
+
+	if h.name == "" {
+		return "Listening"
+	}
+
+	return fmt.Sprintf("Listener %s listening", h.name)
+}
+
+// serverDescription identifies the server, and where it is listening, in log and error messages
+func (h *HTTPServer) serverDescription() string {
+
+	d := "HTTP server"
+
+	if h.name != "" {
+		d = fmt.Sprintf("HTTP server for listener %s", h.name)
+	}
+
+	if h.listeningOn != "" {
+		d += " listening on " + h.listeningOn
+	}
+
+	return d
+}
@@ -0,0 +1,239 @@
+package httpserver
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"reflect"
+	"testing"
+)
+
+func TestListenerAssignment(t *testing.T) {
+
+	la := newListenerAssignment()
+
+	if err := la.addListener("internal", &listenerRules{Handlers: []string{"^admin"}, PathPrefixes: []string{"/admin/"}}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err := la.addListener("metrics", &listenerRules{PathPrefixes: []string{"/metrics"}}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	public := &mockProvider{pattern: "^/artist/([\\d]+)$"}
+	admin := &mockProvider{pattern: "^/admin/users$"}
+	unanchored := &mockProvider{pattern: "/admin/"}
+
+	check := func(name string, p *mockProvider, expected []string) {
+		if l := la.listenersFor(name, p); !reflect.DeepEqual(l, expected) {
+			t.Errorf("Expected %s to be assigned to %v, was assigned to %v", name, expected, l)
+		}
+	}
+
+	check("artistHandler", public, []string{DefaultListenerName})
+	check("artistHandler", admin, []string{"internal"})
+	check("adminArtistHandler", public, []string{"internal"})
+	check("otherHandler", unanchored, []string{DefaultListenerName})
+
+	explicit := &assignedProvider{mockProvider: mockProvider{pattern: "^/admin/users$"}, listeners: []string{"metrics", "public"}}
+
+	if l := la.listenersFor("usersHandler", explicit); !reflect.DeepEqual(l, []string{"metrics", "public"}) {
+		t.Errorf("Explicit assignment ignored: %v", l)
+	}
+
+	if u := la.unknownListeners([]string{"metrics", "public", DefaultListenerName}); !reflect.DeepEqual(u, []string{"public"}) {
+		t.Errorf("Unexpected unknown listeners %v", u)
+	}
+
+	if err := la.addListener("bad", &listenerRules{Handlers: []string{"(["}}); err == nil {
+		t.Errorf("Expected an error for an invalid handler rule")
+	}
+}
+
+func TestServerOnlyRegistersAssignedProviders(t *testing.T) {
+
+	la := newListenerAssignment()
+	la.addListener("internal", &listenerRules{PathPrefixes: []string{"/admin/"}})
+
+	primary := new(HTTPServer)
+	primary.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	primary.assignment = la
+
+	internal := new(HTTPServer)
+	internal.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	internal.assignment = la
+	internal.name = "internal"
+	internal.primary = primary
+
+	admin := &mockProvider{pattern: "^/admin/users$"}
+	public := &mockProvider{pattern: "^/artist$"}
+
+	if primary.assigned("adminHandler", admin) || !primary.assigned("publicHandler", public) {
+		t.Errorf("Default listener registered the wrong providers")
+	}
+
+	if !internal.assigned("adminHandler", admin) || internal.assigned("publicHandler", public) {
+		t.Errorf("Named listener registered the wrong providers")
+	}
+
+	if !new(HTTPServer).assigned("adminHandler", admin) {
+		t.Errorf("Server without an assignment should accept all providers")
+	}
+}
+
+func TestNamedListenerInheritsFromPrimary(t *testing.T) {
+
+	primary := new(HTTPServer)
+	primary.AbnormalStatusWriter = new(statusOnlyAsw)
+	primary.IDContextBuilder = new(mockIrb)
+	primary.InstrumentationManager = new(namedInstrumentationManager)
+
+	s := new(HTTPServer)
+	s.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	s.name = "internal"
+	s.primary = primary
+	s.DisableInstrumentationAutoWire = true
+	s.SetProvidersManually(map[string]httpendpoint.Provider{})
+
+	if err := s.StartComponent(); err != nil {
+		t.Fatalf("Unable to start named listener: %s", err.Error())
+	}
+
+	if s.AbnormalStatusWriter != primary.AbnormalStatusWriter || s.IDContextBuilder != primary.IDContextBuilder {
+		t.Errorf("Components not inherited from default listener")
+	}
+
+	if _, inherited := s.InstrumentationManager.(*namedInstrumentationManager); inherited {
+		t.Errorf("Instrumentation manager should not be inherited when auto-wiring is disabled")
+	}
+}
+
+func TestSharedFilesRejected(t *testing.T) {
+
+	la := newListenerAssignment()
+
+	server := func(name, logPath, socketPath string) *HTTPServer {
+		s := &HTTPServer{name: name, assignment: la, AccessLogging: true}
+		s.AccessLogWriter = &AccessLogWriter{LogPath: logPath}
+		s.UnixSocket = &UnixSocketConfig{Path: socketPath}
+
+		return s
+	}
+
+	test.ExpectNil(t, server("", "./access.log", "").claimFiles())
+	test.ExpectNil(t, server("internal", "./internal.log", "/tmp/internal.sock").claimFiles())
+
+	// Claiming again (e.g. after a restart) is allowed
+	test.ExpectNil(t, server("internal", "./internal.log", "").claimFiles())
+
+	test.ExpectNotNil(t, server("admin", "access.log", "").claimFiles())
+	test.ExpectNotNil(t, server("admin", "./admin.log", "/tmp/internal.sock").claimFiles())
+
+	stdout := server("admin", "./access.log", "")
+	stdout.AccessLogWriter.LogToStdout = true
+
+	test.ExpectNil(t, stdout.claimFiles())
+}
+
+func TestBuildListeners(t *testing.T) {
+
+	ca := new(config.Accessor)
+	ca.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	ca.JSONData = map[string]interface{}{
+		"HTTPServer": map[string]interface{}{
+			"Port":          8080,
+			"MaxConcurrent": 100,
+			"AccessLogging": true,
+			"TraceContext": map[string]interface{}{
+				"Enabled": true,
+			},
+			"AccessLog": map[string]interface{}{
+				"LogPath":  "./access.log",
+				"UtcTimes": true,
+			},
+			"Listeners": map[string]interface{}{
+				"internal": map[string]interface{}{
+					"Port":          8081,
+					"MaxConcurrent": 5,
+					"PathPrefixes":  []interface{}{"/admin/"},
+					"AccessLog": map[string]interface{}{
+						"LogPath": "./internal-access.log",
+					},
+				},
+			},
+		},
+	}
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+	cn := ioc.NewComponentContainer(fm, ca, new(instance.System))
+
+	primary := new(HTTPServer)
+	ca.Populate("HTTPServer", primary)
+
+	servers, err := buildListeners(ca, cn, primary)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(servers) != 2 || servers[0] != primary {
+		t.Fatalf("Expected the default server and one named listener, got %d servers", len(servers))
+	}
+
+	internal := servers[1]
+
+	if internal.Port != 8081 || internal.MaxConcurrent != 5 || !internal.AccessLogging {
+		t.Errorf("Listener configuration not overlaid on default configuration")
+	}
+
+	if internal.TraceContext == nil || !internal.TraceContext.Enabled {
+		t.Errorf("Default configuration not inherited by listener")
+	}
+
+	if internal.AccessLogWriter == nil || internal.AccessLogWriter.LogPath != "./internal-access.log" || !internal.AccessLogWriter.UtcTimes {
+		t.Errorf("Listener access log configuration not overlaid on default configuration")
+	}
+
+	if cn.ProtoComponents()[ListenerComponentName("internal")] == nil || cn.ProtoComponents()[accessLogWriterName+"-internal"] == nil {
+		t.Errorf("Listener components not registered")
+	}
+
+	if primary.assignment == nil || primary.assignment != internal.assignment {
+		t.Errorf("Listeners do not share an assignment")
+	}
+
+	// Mistyped configuration is reported rather than ignored
+	for _, invalid := range []map[string]interface{}{
+		{"Port": "internal"},
+		{"PathPrefixes": "/admin/"},
+		{"AccessLog": map[string]interface{}{"UtcTimes": "yes"}},
+	} {
+		ca.JSONData["HTTPServer"].(map[string]interface{})["Listeners"] = map[string]interface{}{"internal": invalid}
+
+		if _, err := buildListeners(ca, cn, new(HTTPServer)); err == nil {
+			t.Errorf("Expected an error for listener configuration %v", invalid)
+		}
+	}
+
+	ca.JSONData["HTTPServer"].(map[string]interface{})["Listeners"] = map[string]interface{}{DefaultListenerName: map[string]interface{}{}}
+
+	if _, err := buildListeners(ca, cn, new(HTTPServer)); err == nil {
+		t.Errorf("Expected an error for a listener using the reserved name")
+	}
+}
+
+type assignedProvider struct {
+	mockProvider
+	listeners []string
+}
+
+func (ap *assignedProvider) AssignedListeners() []string {
+	return ap.listeners
+}
+
+type namedInstrumentationManager struct {
+	noopRequestInstrumentationManager
+}
@@ -0,0 +1,334 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/logging"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RotateNever means the access log file is never rotated
+	RotateNever = "NEVER"
+	// RotateBySize means the access log file is rotated when it reaches LogRotation.MaxSizeMB
+	RotateBySize = "SIZE"
+	// RotateDaily means the access log file is rotated when the first line is written on a new day
+	RotateDaily = "DAILY"
+
+	dailySuffixFormat = "2006-01-02"
+	sizeSuffixFormat  = "2006-01-02T15-04-05.000"
+	bytesPerMB        = 1024 * 1024
+
+	// How long to wait before trying again after a rotation fails
+	rotationRetryInterval = time.Minute
+)
+
+// LogRotation controls if and when an access log file is rotated. When a file is rotated, it is renamed with a suffix
+// indicating when it was rotated (or for daily rotation, the day the lines in it were written) and a new file is created
+// at the original path.
+type LogRotation struct {
+	// When the file should be rotated: NEVER, SIZE or DAILY
+	Mode string
+
+	// The size (in megabytes) at which the file is rotated if Mode is SIZE
+	MaxSizeMB int
+
+	// The number of rotated files to keep. Older files are deleted. Zero or less means rotated files are never deleted.
+	RetainFiles int
+}
+
+func (lr *LogRotation) validate() error {
+
+	lr.Mode = strings.ToUpper(lr.Mode)
+
+	switch lr.Mode {
+	case "", RotateNever, RotateDaily:
+		return nil
+	case RotateBySize:
+
+		if lr.MaxSizeMB <= 0 {
+			return fmt.Errorf("access log rotation by size requires MaxSizeMB to be greater than zero")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%s is not a supported access log rotation mode. Must be one of NEVER, SIZE, DAILY", lr.Mode)
+}
+
+func (lr *LogRotation) enabled() bool {
+	return lr != nil && lr.Mode != "" && lr.Mode != RotateNever
+}
+
+// rotatingFile is a closableStringWriter that rotates the underlying file according to a LogRotation. If a rotation
+// fails, lines continue to be written to the file at the original path (reopening it on later writes if necessary).
+type rotatingFile struct {
+	path     string
+	rotation *LogRotation
+	file     *os.File
+	size     int64
+	day      string
+	now      func() time.Time
+	log      logging.Logger
+	failing  bool
+	retryAt  time.Time
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func newRotatingFile(path string, lr *LogRotation, now func() time.Time, log logging.Logger) (*rotatingFile, error) {
+
+	rf := new(rotatingFile)
+	rf.path = path
+	rf.rotation = lr
+	rf.now = now
+	rf.log = log
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.file = f
+	rf.size = fi.Size()
+	rf.day = rf.now().Format(dailySuffixFormat)
+
+	if rf.size > 0 {
+		// Lines already in the file were written on the day the file was last modified
+		rf.day = fi.ModTime().In(rf.now().Location()).Format(dailySuffixFormat)
+	}
+
+	return nil
+}
+
+// WriteString writes the string to the current file, first rotating the file if required
+func (rf *rotatingFile) WriteString(s string) (int, error) {
+
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+
+	if rf.file != nil && (!rf.failing || !rf.now().Before(rf.retryAt)) {
+
+		if suffix, due := rf.rotationDue(len(s)); due {
+			rf.recordOutcome(rf.rotate(suffix))
+		}
+	}
+
+	if rf.file == nil {
+		// An earlier rotation was unable to reopen the file
+		if err := rf.open(); err != nil {
+			rf.recordOutcome(err)
+			return 0, err
+		}
+
+		rf.recordOutcome(nil)
+	}
+
+	n, err := rf.file.WriteString(s)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+func (rf *rotatingFile) rotationDue(pending int) (string, bool) {
+
+	now := rf.now()
+
+	switch rf.rotation.Mode {
+	case RotateDaily:
+		return rf.day, now.Format(dailySuffixFormat) != rf.day && rf.size > 0
+	case RotateBySize:
+		return now.Format(sizeSuffixFormat), rf.size > 0 && rf.size+int64(pending) > int64(rf.rotation.MaxSizeMB)*bytesPerMB
+	}
+
+	return "", false
+}
+
+// rotate renames the current file and opens a new file at the original path. If the file cannot be renamed, the
+// original file is reopened and appended to.
+func (rf *rotatingFile) rotate(suffix string) error {
+
+	closeErr := rf.file.Close()
+	rf.file = nil
+
+	var renameErr error
+
+	if closeErr == nil {
+		renameErr = os.Rename(rf.path, rf.uniqueName(rf.path+"."+suffix))
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	switch {
+	case closeErr != nil:
+		return closeErr
+	case renameErr != nil:
+		return renameErr
+	}
+
+	return rf.prune()
+}
+
+// recordOutcome logs the first of a series of failures to rotate or reopen the file
+func (rf *rotatingFile) recordOutcome(err error) {
+
+	if err == nil {
+		rf.failing = false
+		return
+	}
+
+	if !rf.failing && rf.log != nil {
+		rf.log.LogErrorf("Unable to rotate access log %s (will retry): %s", rf.path, err.Error())
+	}
+
+	rf.failing = true
+	rf.retryAt = rf.now().Add(rotationRetryInterval)
+}
+
+func (rf *rotatingFile) uniqueName(name string) string {
+
+	candidate := name
+
+	for i := 1; ; i++ {
+
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+
+		candidate = fmt.Sprintf("%s.%d", name, i)
+	}
+}
+
+// prune deletes the oldest rotated files so that no more than RetainFiles remain
+func (rf *rotatingFile) prune() error {
+
+	keep := rf.rotation.RetainFiles
+
+	if keep <= 0 {
+		return nil
+	}
+
+	candidates, err := filepath.Glob(escapeGlob(rf.path) + ".*")
+
+	if err != nil {
+		return err
+	}
+
+	var rotated []string
+
+	for _, c := range candidates {
+		if rf.isRotatedName(c) {
+			rotated = append(rotated, c)
+		}
+	}
+
+	if len(rotated) <= keep {
+		return nil
+	}
+
+	// Suffixes are timestamps, so lexical order is chronological order
+	sort.Strings(rotated)
+
+	for _, old := range rotated[:len(rotated)-keep] {
+
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRotatedName returns true if the supplied name is one that could have been created by rotate: the original path
+// followed by a timestamp suffix and an optional number added by uniqueName
+func (rf *rotatingFile) isRotatedName(name string) bool {
+
+	suffix := strings.TrimPrefix(name, rf.path+".")
+	suffixes := []string{suffix}
+
+	if i := strings.LastIndex(suffix, "."); i >= 0 {
+
+		if _, err := strconv.Atoi(suffix[i+1:]); err == nil {
+			suffixes = append(suffixes, suffix[:i])
+		}
+	}
+
+	for _, s := range suffixes {
+		for _, format := range []string{dailySuffixFormat, sizeSuffixFormat} {
+			if _, err := time.Parse(format, s); err == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Close closes the current file
+func (rf *rotatingFile) Close() error {
+
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	rf.closed = true
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+
+	return err
+}
+
+func escapeGlob(path string) string {
+
+	r := strings.NewReplacer("*", "\\*", "?", "\\?", "[", "\\[")
+
+	return r.Replace(path)
+}
+
+// stdoutWriter writes access log lines to standard output. Closing it has no effect.
+type stdoutWriter struct {
+	out *os.File
+}
+
+func (sw *stdoutWriter) WriteString(s string) (int, error) {
+	return sw.out.WriteString(s)
+}
+
+func (sw *stdoutWriter) Close() error {
+	return nil
+}
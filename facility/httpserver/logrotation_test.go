@@ -0,0 +1,207 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotationBySize(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "grnc-rotate")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2019, 10, 9, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	rf, err := newRotatingFile(path, &LogRotation{Mode: RotateBySize, MaxSizeMB: 1, RetainFiles: 2}, clock, nil)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Files that were not created by rotation must not be pruned
+	ioutil.WriteFile(path+".bak", []byte("backup"), 0600)
+
+	line := strings.Repeat("x", 1023) + "\n"
+
+	for i := 0; i < 4; i++ {
+
+		for j := 0; j < 1024; j++ {
+			if _, err := rf.WriteString(line); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+
+		now = now.Add(time.Second)
+	}
+
+	rf.WriteString(line)
+	rf.Close()
+
+	if err := os.Remove(path + ".bak"); err != nil {
+		t.Errorf("Expected unrelated file to be kept: %s", err.Error())
+	}
+
+	rotated := rotatedFiles(t, path)
+
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 retained files, found %v", rotated)
+	}
+
+	if rotated[1] != "access.log.2019-10-09T12-00-04.000" {
+		t.Errorf("Unexpected name for most recent rotated file %s", rotated[1])
+	}
+
+	if fi, _ := os.Stat(path); fi.Size() != int64(len(line)) {
+		t.Errorf("Expected current file to only contain the last line, was %d bytes", fi.Size())
+	}
+}
+
+func TestDailyRotation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "grnc-rotate")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	rf, err := newRotatingFile(path, &LogRotation{Mode: RotateDaily}, clock, nil)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	rf.WriteString("day one\n")
+
+	now = now.Add(time.Hour * 24)
+	rf.WriteString("day two\n")
+	rf.WriteString("day two again\n")
+
+	rf.Close()
+
+	rotated := rotatedFiles(t, path)
+
+	if len(rotated) != 1 || rotated[0] != "access.log."+now.Add(time.Hour*-24).Format("2006-01-02") {
+		t.Fatalf("Unexpected rotated files %v", rotated)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+
+	if string(b) != "day two\nday two again\n" {
+		t.Errorf("Unexpected contents of current file %s", b)
+	}
+}
+
+func TestRotationFailure(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "grnc-rotate")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	rf, err := newRotatingFile(path, &LogRotation{Mode: RotateDaily}, clock, nil)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer rf.Close()
+
+	rf.WriteString("day one\n")
+
+	// The file can be neither renamed nor reopened
+	os.RemoveAll(dir)
+	now = now.Add(time.Hour * 24)
+
+	if _, err := rf.WriteString("lost\n"); err == nil {
+		t.Fatalf("Expected an error when the log directory has been removed")
+	}
+
+	// Writing resumes as soon as the file can be reopened
+	os.MkdirAll(dir, 0700)
+
+	if _, err := rf.WriteString("day two\n"); err != nil {
+		t.Fatalf("Expected file to be reopened: %s", err.Error())
+	}
+
+	if b, _ := ioutil.ReadFile(path); string(b) != "day two\n" {
+		t.Errorf("Unexpected contents of current file %s", b)
+	}
+}
+
+func TestRotatedNames(t *testing.T) {
+
+	rf := &rotatingFile{path: "/logs/access.log"}
+
+	for _, name := range []string{"access.log.2019-10-09", "access.log.2019-10-09.2", "access.log.2019-10-09T12-00-04.000", "access.log.2019-10-09T12-00-04.000.1"} {
+		if !rf.isRotatedName("/logs/" + name) {
+			t.Errorf("Expected %s to be recognised as a rotated file", name)
+		}
+	}
+
+	for _, name := range []string{"access.log.bak", "access.log.1", "access.log.2019-10-09.bak", "access.log.old.2019-10-09"} {
+		if rf.isRotatedName("/logs/" + name) {
+			t.Errorf("Did not expect %s to be recognised as a rotated file", name)
+		}
+	}
+}
+
+func TestRotationValidation(t *testing.T) {
+
+	if err := (&LogRotation{Mode: "size"}).validate(); err == nil {
+		t.Errorf("Expected error when MaxSizeMB not set")
+	}
+
+	if err := (&LogRotation{Mode: "hourly"}).validate(); err == nil {
+		t.Errorf("Expected error for unsupported mode")
+	}
+
+	lr := &LogRotation{Mode: "daily"}
+
+	if err := lr.validate(); err != nil || !lr.enabled() {
+		t.Errorf("Expected daily rotation to be valid and enabled")
+	}
+}
+
+func rotatedFiles(t *testing.T, path string) []string {
+
+	matches, err := filepath.Glob(path + ".*")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	names := make([]string, len(matches))
+
+	for i, m := range matches {
+		names[i] = filepath.Base(m)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
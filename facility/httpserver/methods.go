@@ -0,0 +1,120 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const allowHeader = "Allow"
+
+// handleUnmatched is called when no provider has been found to handle the request's method and path. If the path is
+// supported by providers using other methods the server responds to OPTIONS requests with a list of allowed methods
+// and to other requests with 405 Method Not Allowed. Otherwise a 404 is returned.
+func (h *HTTPServer) handleUnmatched(ctx context.Context, wrw *httpendpoint.HTTPResponseWriter, req *http.Request) {
+
+	var allowed []string
+
+	if !h.DisableAutoMethodHandling {
+		allowed = h.allowedMethods(req.URL.Path)
+	}
+
+	if len(allowed) == 0 {
+		h.writeAbnormal(ctx, http.StatusNotFound, wrw, req)
+		return
+	}
+
+	wrw.Header().Set(allowHeader, strings.Join(allowed, ", "))
+
+	if req.Method == http.MethodOptions {
+		wrw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	for _, m := range allowed {
+		if m == req.Method {
+			// The method is supported for this path, but not for the version requested
+			h.writeAbnormal(ctx, http.StatusNotFound, wrw, req)
+			return
+		}
+	}
+
+	h.writeAbnormal(ctx, http.StatusMethodNotAllowed, wrw, req)
+}
+
+// allowedMethods returns the HTTP methods that can be used with the supplied path, including the methods that are
+// automatically supported by the server (HEAD for paths that support GET, and OPTIONS). Returns an empty slice if no
+// provider matches the path.
+func (h *HTTPServer) allowedMethods(path string) []string {
+
+	methods := h.router.methodsMatching(path)
+
+	if len(methods) == 0 {
+		return methods
+	}
+
+	has := make(map[string]bool)
+
+	for _, m := range methods {
+		has[m] = true
+	}
+
+	if has[http.MethodGet] && !has[http.MethodHead] {
+		methods = append(methods, http.MethodHead)
+	}
+
+	if !has[http.MethodOptions] {
+		methods = append(methods, http.MethodOptions)
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
+
+// bodylessResponseWriter discards anything written to the body of a response, allowing GET providers to be used
+// to answer HEAD requests.
+type bodylessResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Write discards the supplied data but reports it as written
+func (bw *bodylessResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Flush sends the response headers to the client if the underlying response supports flushing
+func (bw *bodylessResponseWriter) Flush() {
+
+	if f, found := bw.ResponseWriter.(http.Flusher); found {
+		f.Flush()
+	}
+}
+
+// answerPreflight responds to a CORS preflight request if a provider is registered for the method and path the client
+// intends to use. Returns false (leaving the request to be handled as a normal OPTIONS request) if no such provider exists.
+func (h *HTTPServer) answerPreflight(wrw *httpendpoint.HTTPResponseWriter, req *http.Request) bool {
+
+	method := h.CORS.RequestedMethod(req)
+	path := req.URL.Path
+
+	providers := h.router.match(method, path)
+
+	if len(providers) == 0 && method == http.MethodHead && !h.DisableAutoMethodHandling {
+		providers = h.router.match(http.MethodGet, path)
+	}
+
+	if len(providers) == 0 {
+		return false
+	}
+
+	h.CORS.Preflight(wrw.Header(), req, providers[0].Provider, h.allowedMethods(path))
+	wrw.WriteHeader(http.StatusNoContent)
+
+	return true
+}
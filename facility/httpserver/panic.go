@@ -0,0 +1,58 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/instrument"
+	"net/http"
+	"runtime/debug"
+)
+
+// RecoveredPanicEvent is the ID of the instrumentation event started when the HTTPServer recovers from a panic in a
+// Provider. The recovered value is passed as the event's metadata.
+const RecoveredPanicEvent = "RecoveredPanic"
+
+// recoveredPanic records a panic in a Provider that was recovered by the server
+type recoveredPanic struct {
+	value interface{}
+}
+
+// serveRecovering calls the Provider's ServeHTTP method, recovering from any panic. The panic is logged (with a stack
+// trace and the request's ID) and, if the Provider has not already started writing a response, a 500 response is
+// written via the server's AbnormalStatusWriter.
+func (h *HTTPServer) serveRecovering(ctx context.Context, p httpendpoint.Provider, wrw *httpendpoint.HTTPResponseWriter, req *http.Request, ri instrument.Instrumentor, requestID string) (rc context.Context, rp *recoveredPanic) {
+
+	rc = ctx
+
+	defer func() {
+
+		r := recover()
+
+		if r == nil {
+			return
+		}
+
+		if r == http.ErrAbortHandler {
+			// Deliberate aborts are handled by net/http
+			panic(r)
+		}
+
+		rp = &recoveredPanic{value: r}
+
+		h.FrameworkLogger.LogErrorfCtx(ctx, "Recovered from panic while serving %s %s (request ID %s): %v\n%s", req.Method, req.URL.Path, requestID, r, debug.Stack())
+
+		ri.StartEvent(RecoveredPanicEvent, r)()
+
+		if wrw.DataSent || wrw.Status != 0 {
+			h.FrameworkLogger.LogWarnfCtx(ctx, "Response already started before panic - unable to send an error response")
+			return
+		}
+
+		h.writeAbnormal(ctx, http.StatusInternalServerError, wrw, req)
+	}()
+
+	return p.ServeHTTP(ctx, wrw, req), nil
+}
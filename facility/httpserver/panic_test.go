@@ -0,0 +1,121 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/instrument"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPanicRecovery(t *testing.T) {
+
+	pp := &panickingProvider{mockProvider: mockProvider{pattern: "^/panic$", methods: []string{"GET"}}}
+	ok := &mockProvider{pattern: "^/ok$", methods: []string{"GET"}}
+
+	s := runningServer(t, pp, ok)
+
+	im := new(recordingInstrumentationManager)
+	s.InstrumentationManager = im
+
+	alw, fs := logWriterWithBuffer(t, "%s %U")
+	s.AccessLogging = true
+	s.AccessLogWriter = alw
+
+	res := httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("GET", "/panic", nil))
+
+	alw.PrepareToStop()
+	alw.Stop()
+
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", res.Code)
+	}
+
+	checkContents(t, fs, "500 /panic")
+
+	if len(im.ri.events) != 1 || im.ri.events[0] != RecoveredPanicEvent {
+		t.Errorf("Expected a %s instrumentation event, got %v", RecoveredPanicEvent, im.ri.events)
+	}
+
+	if im.ri.status != http.StatusInternalServerError {
+		t.Errorf("Expected instrumentor to be told the response status was 500, got %d", im.ri.status)
+	}
+
+	if s.ActiveRequests != 0 {
+		t.Errorf("Active request count not decremented after panic")
+	}
+
+	// Responses that have already started cannot be replaced
+	pp.writeFirst = true
+	s.AccessLogging = false
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("GET", "/panic", nil))
+
+	if res.Code != http.StatusAccepted {
+		t.Errorf("Expected original status to be preserved, got %d", res.Code)
+	}
+
+	s.RepanicAfterRecovery = true
+
+	func() {
+		defer func() {
+			if r := recover(); r != "deliberate" {
+				t.Errorf("Expected panic to be re-raised, got %v", r)
+			}
+		}()
+
+		s.handleAll(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	}()
+
+	res = httptest.NewRecorder()
+	s.handleAll(res, httptest.NewRequest("GET", "/ok", nil))
+
+	if res.Code != http.StatusOK {
+		t.Errorf("Server not usable after panic")
+	}
+}
+
+type panickingProvider struct {
+	mockProvider
+	writeFirst bool
+}
+
+func (pp *panickingProvider) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+
+	if pp.writeFirst {
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	panic("deliberate")
+}
+
+type recordingInstrumentationManager struct {
+	ri *recordingInstrumentor
+}
+
+func (rm *recordingInstrumentationManager) Begin(ctx context.Context, res http.ResponseWriter, req *http.Request) (context.Context, instrument.Instrumentor, func()) {
+	rm.ri = new(recordingInstrumentor)
+
+	return instrument.AddInstrumentorToContext(ctx, rm.ri), rm.ri, func() {}
+}
+
+type recordingInstrumentor struct {
+	noopRequestInstrumentor
+	events []string
+	status int
+}
+
+func (ri *recordingInstrumentor) Amend(additional instrument.Additional, value interface{}) {
+	if additional == instrument.ResponseStatus {
+		ri.status = value.(int)
+	}
+}
+
+func (ri *recordingInstrumentor) StartEvent(id string, metadata ...interface{}) instrument.EndEvent {
+	ri.events = append(ri.events, id)
+
+	return func() {}
+}
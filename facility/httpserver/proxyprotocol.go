@@ -0,0 +1,213 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+	proxyHeaderWait  = 5 * time.Second
+
+	proxyV2CommandLocal = 0x0
+	proxyV2CommandProxy = 0x1
+	proxyV2FamilyTCP4   = 0x1
+	proxyV2FamilyTCP6   = 0x2
+)
+
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyProtocolListener wraps connections from trusted proxies so that the PROXY protocol header the proxy sends
+// is consumed and the client address it contains is reported as the connection's remote address.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted func(ip net.IP) bool
+}
+
+func (pl *proxyProtocolListener) Accept() (net.Conn, error) {
+
+	c, err := pl.Listener.Accept()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ta, ok := c.RemoteAddr().(*net.TCPAddr); !ok || !pl.trusted(ta.IP) {
+		// Connections from untrusted hosts are used as-is
+		return c, nil
+	}
+
+	return &proxyProtocolConn{Conn: c, reader: bufio.NewReaderSize(c, 256)}, nil
+}
+
+// proxyProtocolConn reads the PROXY protocol header the first time the connection is read from or its remote address
+// is requested (net/http does both from the connection's own goroutine, so the listener is never blocked).
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (pc *proxyProtocolConn) init() {
+
+	pc.once.Do(func() {
+		pc.Conn.SetReadDeadline(time.Now().Add(proxyHeaderWait))
+		pc.remote, pc.err = readProxyHeader(pc.reader)
+		pc.Conn.SetReadDeadline(time.Time{})
+
+		if pc.err != nil {
+			// The proxy is misbehaving - the rest of the connection cannot be trusted
+			pc.Conn.Close()
+		}
+	})
+}
+
+func (pc *proxyProtocolConn) Read(b []byte) (int, error) {
+
+	if pc.init(); pc.err != nil {
+		return 0, pc.err
+	}
+
+	return pc.reader.Read(b)
+}
+
+func (pc *proxyProtocolConn) RemoteAddr() net.Addr {
+
+	if pc.init(); pc.remote != nil {
+		return pc.remote
+	}
+
+	return pc.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a v1 or v2 PROXY protocol header. A nil address is returned if the header is valid but does
+// not identify a client (e.g. LOCAL or UNKNOWN connections such as proxy health checks).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+
+	start, err := r.Peek(len(proxyV2Signature))
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PROXY protocol header: %s", err.Error())
+	}
+
+	if bytes.Equal(start, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+
+	if string(start[:len(proxyV1Prefix)]) == proxyV1Prefix {
+		return readProxyV1(r)
+	}
+
+	return nil, errors.New("connection from trusted proxy did not start with a PROXY protocol header")
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+
+	var line []byte
+
+	for len(line) < proxyV1MaxLength {
+
+		b, err := r.ReadByte()
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read PROXY protocol header: %s", err.Error())
+		}
+
+		line = append(line, b)
+
+		if b == '\n' {
+			break
+		}
+	}
+
+	l := string(line)
+
+	if !strings.HasSuffix(l, "\r\n") {
+		return nil, errors.New("PROXY protocol v1 header too long or not terminated")
+	}
+
+	fields := strings.Fields(l)
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY protocol v1 header %q", strings.TrimSpace(l))
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("malformed PROXY protocol v1 header %q", strings.TrimSpace(l))
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+
+	header := make([]byte, 16)
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("unable to read PROXY protocol header: %s", err.Error())
+	}
+
+	verCmd, family := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+
+	if verCmd>>4 != 2 {
+		return nil, errors.New("unsupported PROXY protocol v2 version")
+	}
+
+	payload := make([]byte, length)
+
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("unable to read PROXY protocol header: %s", err.Error())
+	}
+
+	switch verCmd & 0xF {
+	case proxyV2CommandLocal:
+		return nil, nil
+	case proxyV2CommandProxy:
+	default:
+		return nil, errors.New("unsupported PROXY protocol v2 command")
+	}
+
+	switch family >> 4 {
+	case proxyV2FamilyTCP4:
+
+		if length < 12 {
+			return nil, errors.New("PROXY protocol v2 IPv4 address block too short")
+		}
+
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+
+	case proxyV2FamilyTCP6:
+
+		if length < 36 {
+			return nil, errors.New("PROXY protocol v2 IPv6 address block too short")
+		}
+
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+
+	// Unix sockets and unspecified families do not identify an IP client
+	return nil, nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"regexp/syntax"
+	"sort"
+)
+
+// providerRouter finds the registered providers whose path regex matches a request path. Rather than testing every
+// provider's regex, patterns are indexed by the literal text they require at the start of the path:
+//
+// Patterns of the form ^literal$ are stored in a map and matched without evaluating a regex.
+//
+// Patterns anchored with ^ are stored in a prefix tree under their literal prefix, so only providers whose prefix
+// matches the start of the path have their regex evaluated.
+//
+// All other patterns (unanchored, alternations etc) are always evaluated.
+//
+// Matches are always returned in the order in which providers were registered, preserving the behaviour of a
+// simple linear scan.
+type providerRouter struct {
+	byMethod map[string]*methodRoutes
+	count    int
+}
+
+func newProviderRouter() *providerRouter {
+	r := new(providerRouter)
+	r.byMethod = make(map[string]*methodRoutes)
+
+	return r
+}
+
+type methodRoutes struct {
+	exact      map[string][]*registeredProvider
+	prefixes   *prefixNode
+	unindexed  []*registeredProvider
+	registered int
+}
+
+type prefixNode struct {
+	children  map[byte]*prefixNode
+	providers []*registeredProvider
+}
+
+// add registers a provider for the supplied HTTP method. The provider's Pattern must already be compiled.
+func (r *providerRouter) add(method string, rp *registeredProvider) {
+
+	mr := r.byMethod[method]
+
+	if mr == nil {
+		mr = new(methodRoutes)
+		mr.exact = make(map[string][]*registeredProvider)
+		mr.prefixes = new(prefixNode)
+		r.byMethod[method] = mr
+	}
+
+	rp.index = r.count
+	r.count++
+	mr.registered++
+
+	pattern := rp.Pattern.String()
+
+	if literal, exact := exactLiteral(pattern); exact {
+		mr.exact[literal] = append(mr.exact[literal], rp)
+		return
+	}
+
+	if prefix, anchored := anchoredPrefix(pattern); anchored {
+		mr.prefixes.insert(prefix, rp)
+		return
+	}
+
+	mr.unindexed = append(mr.unindexed, rp)
+}
+
+// match returns, in registration order, all of the providers registered for the method whose regex matches the path.
+func (r *providerRouter) match(method, path string) []*registeredProvider {
+
+	mr := r.byMethod[method]
+
+	if mr == nil {
+		return nil
+	}
+
+	exact := mr.exact[path]
+	exactCount := len(exact)
+
+	// Copy exact matches so the slice stored in the map is never appended to
+	candidates := make([]*registeredProvider, exactCount, exactCount+len(mr.unindexed)+4)
+	copy(candidates, exact)
+
+	candidates = mr.prefixes.collect(path, candidates)
+	candidates = append(candidates, mr.unindexed...)
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	matched := make([]*registeredProvider, 0, len(candidates))
+
+	for i, c := range candidates {
+		// Exact literal matches don't need their regex testing
+		if i < exactCount || c.Pattern.MatchString(path) {
+			matched = append(matched, c)
+		}
+	}
+
+	if len(matched) > 1 {
+		sort.Slice(matched, func(i, j int) bool { return matched[i].index < matched[j].index })
+	}
+
+	return matched
+}
+
+// providerCount returns the number of providers registered for the supplied HTTP method
+func (r *providerRouter) providerCount(method string) int {
+
+	if mr := r.byMethod[method]; mr != nil {
+		return mr.registered
+	}
+
+	return 0
+}
+
+func (n *prefixNode) insert(prefix string, rp *registeredProvider) {
+
+	current := n
+
+	for i := 0; i < len(prefix); i++ {
+
+		if current.children == nil {
+			current.children = make(map[byte]*prefixNode)
+		}
+
+		b := prefix[i]
+		next := current.children[b]
+
+		if next == nil {
+			next = new(prefixNode)
+			current.children[b] = next
+		}
+
+		current = next
+	}
+
+	current.providers = append(current.providers, rp)
+}
+
+// collect walks the tree along the supplied path, appending every provider whose prefix is a prefix of the path
+func (n *prefixNode) collect(path string, found []*registeredProvider) []*registeredProvider {
+
+	current := n
+	found = append(found, current.providers...)
+
+	for i := 0; i < len(path); i++ {
+
+		if current.children == nil {
+			break
+		}
+
+		if current = current.children[path[i]]; current == nil {
+			break
+		}
+
+		found = append(found, current.providers...)
+	}
+
+	return found
+}
+
+// exactLiteral returns the literal string matched by patterns of the form ^literal$
+func exactLiteral(pattern string) (string, bool) {
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+
+	if err != nil {
+		return "", false
+	}
+
+	re = re.Simplify()
+
+	if re.Op != syntax.OpConcat || len(re.Sub) != 3 {
+		return "", false
+	}
+
+	start, lit, end := re.Sub[0], re.Sub[1], re.Sub[2]
+
+	if start.Op != syntax.OpBeginText || end.Op != syntax.OpEndText || lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+
+	return string(lit.Rune), true
+}
+
+// anchoredPrefix returns true if every possible match of the pattern must start at the beginning of the input, along
+// with the literal text every match must start with (which may be empty).
+func anchoredPrefix(pattern string) (string, bool) {
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+
+	if err != nil {
+		return "", false
+	}
+
+	re = re.Simplify()
+
+	switch re.Op {
+	case syntax.OpBeginText:
+		return "", true
+	case syntax.OpConcat:
+
+		if len(re.Sub) == 0 || re.Sub[0].Op != syntax.OpBeginText {
+			return "", false
+		}
+
+	default:
+		return "", false
+	}
+
+	var prefix []rune
+
+	for _, sub := range re.Sub[1:] {
+
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+
+		prefix = append(prefix, sub.Rune...)
+	}
+
+	return string(prefix), true
+}
+
+// methodsMatching returns, in alphabetical order, the HTTP methods that have at least one provider whose regex matches the path
+func (r *providerRouter) methodsMatching(path string) []string {
+
+	methods := make([]string, 0)
+
+	for m := range r.byMethod {
+		if len(r.match(m, path)) > 0 {
+			methods = append(methods, m)
+		}
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
@@ -0,0 +1,194 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestRouterMatchesInRegistrationOrder(t *testing.T) {
+
+	r := newProviderRouter()
+
+	patterns := []string{
+		"^/artist/([\\d]+)[/]?$",
+		"artist",
+		"^/artist/1$",
+		"^/artist",
+		"(?i)^/ARTIST/1$",
+		"^/record/([\\d]+)$",
+	}
+
+	for _, p := range patterns {
+		r.add("GET", testRegisteredProvider(p))
+	}
+
+	m := r.match("GET", "/artist/1")
+
+	expected := []string{patterns[0], patterns[1], patterns[2], patterns[3], patterns[4]}
+
+	if len(m) != len(expected) {
+		t.Fatalf("Expected %d matches, got %d", len(expected), len(m))
+	}
+
+	for i, rp := range m {
+		if rp.Pattern.String() != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, rp.Pattern.String())
+		}
+	}
+
+	if m = r.match("GET", "/record/x"); len(m) != 0 {
+		t.Errorf("Unexpected match %v", m)
+	}
+
+	if m = r.match("POST", "/artist/1"); len(m) != 0 {
+		t.Errorf("Unexpected match for method with no providers")
+	}
+
+	if r.providerCount("GET") != len(patterns) {
+		t.Errorf("Unexpected provider count %d", r.providerCount("GET"))
+	}
+
+}
+
+func TestPatternClassification(t *testing.T) {
+
+	if l, ok := exactLiteral("^/health$"); !ok || l != "/health" {
+		t.Errorf("Expected /health to be an exact literal")
+	}
+
+	for _, p := range []string{"^/health", "/health$", "^/health/?$", "(?i)^/health$"} {
+		if _, ok := exactLiteral(p); ok {
+			t.Errorf("%s incorrectly identified as exact literal", p)
+		}
+	}
+
+	prefixes := map[string]string{
+		"^/a":                    "/a",
+		"^/a/(\\d+)$":            "/a/",
+		"^":                      "",
+		"^/api/v1/users/.*":      "/api/v1/users/",
+		"^/abc/\\d+":             "/abc/",
+		"^/artist/([\\d]+)[/]?$": "/artist/",
+		"^/(?i:ab)c":             "/",
+		"^[/]?x":                 "",
+	}
+
+	for p, expected := range prefixes {
+		if prefix, ok := anchoredPrefix(p); !ok || prefix != expected {
+			t.Errorf("Expected %s to be anchored with prefix %q, got %q", p, expected, prefix)
+		}
+	}
+
+	for _, p := range []string{"/a", "^/a|^/b", ".*^/a"} {
+		if _, ok := anchoredPrefix(p); ok {
+			t.Errorf("%s should not be anchored", p)
+		}
+	}
+}
+
+// Compares the indexed router with the linear regex scan it replaced, using a set of handlers typical of a large
+// application. Like the indexed router, the linear scan tested every provider's regex against the path.
+func BenchmarkLinearScan(b *testing.B) {
+
+	providers, paths := benchmarkProviders()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		path := paths[i%len(paths)]
+
+		var matched []*registeredProvider
+
+		for _, rp := range providers {
+			if rp.Pattern.MatchString(path) {
+				matched = append(matched, rp)
+			}
+		}
+	}
+}
+
+func BenchmarkIndexedRouter(b *testing.B) {
+
+	providers, paths := benchmarkProviders()
+
+	r := newProviderRouter()
+
+	for _, rp := range providers {
+		r.add("GET", rp)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r.match("GET", paths[i%len(paths)])
+	}
+}
+
+func benchmarkProviders() ([]*registeredProvider, []string) {
+
+	var providers []*registeredProvider
+	var paths []string
+
+	for i := 0; i < 40; i++ {
+		providers = append(providers, testRegisteredProvider(fmt.Sprintf("^/resource%d$", i)))
+		providers = append(providers, testRegisteredProvider(fmt.Sprintf("^/resource%d/([\\d]+)[/]?$", i)))
+		providers = append(providers, testRegisteredProvider(fmt.Sprintf("^/resource%d/([\\d]+)/children$", i)))
+		providers = append(providers, testRegisteredProvider(fmt.Sprintf("^/v2/resource%d/([a-z0-9-]+)$", i)))
+
+		// Patterns without a trailing $
+		providers = append(providers, testRegisteredProvider(fmt.Sprintf("^/files%d/.*", i)))
+		providers = append(providers, testRegisteredProvider(fmt.Sprintf("^/search%d/\\d+", i)))
+
+		paths = append(paths, fmt.Sprintf("/resource%d", i), fmt.Sprintf("/resource%d/123", i), fmt.Sprintf("/v2/resource%d/abc-123", i))
+		paths = append(paths, fmt.Sprintf("/files%d/a/b.txt", i), fmt.Sprintf("/search%d/42", i))
+	}
+
+	paths = append(paths, "/not/found")
+
+	return providers, paths
+}
+
+func testRegisteredProvider(pattern string) *registeredProvider {
+	rp := new(registeredProvider)
+	rp.Pattern = regexp.MustCompile(pattern)
+	rp.Provider = &mockProvider{pattern: pattern, methods: []string{"GET"}}
+
+	return rp
+}
+
+type mockProvider struct {
+	pattern string
+	methods []string
+	served  bool
+}
+
+func (mp *mockProvider) SupportedHTTPMethods() []string {
+	return mp.methods
+}
+
+func (mp *mockProvider) RegexPattern() string {
+	return mp.pattern
+}
+
+func (mp *mockProvider) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+	mp.served = true
+	w.WriteHeader(http.StatusOK)
+
+	return ctx
+}
+
+func (mp *mockProvider) VersionAware() bool {
+	return false
+}
+
+func (mp *mockProvider) SupportsVersion(version httpendpoint.RequiredVersion) bool {
+	return true
+}
+
+func (mp *mockProvider) AutoWireable() bool {
+	return true
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// The first file descriptor passed by systemd (after stdin, stdout and stderr)
+	listenFDsStart = 3
+
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+)
+
+// UnixSocketConfig causes a server to listen on a unix domain socket instead of a TCP port.
+type UnixSocketConfig struct {
+	// The path of the socket file. If empty, the server listens on a TCP port.
+	Path string
+
+	// The file permissions of the socket as an octal string (e.g. 0660). If empty, the permissions are determined
+	// by the process's umask.
+	Mode string
+}
+
+func (uc *UnixSocketConfig) enabled() bool {
+	return uc != nil && uc.Path != ""
+}
+
+func (uc *UnixSocketConfig) fileMode() (os.FileMode, error) {
+
+	m, err := strconv.ParseUint(uc.Mode, 8, 32)
+
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("%s is not a valid unix socket mode. Must be an octal string like 0660", uc.Mode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+// SocketActivationConfig causes a server to use a listening socket inherited from the process that started the
+// application (systemd style socket activation using the LISTEN_FDS, LISTEN_PID and LISTEN_FDNAMES environment variables)
+// rather than opening its own.
+type SocketActivationConfig struct {
+	// Whether or not an inherited socket should be used
+	Enabled bool
+
+	// The name of the socket to use (set with FileDescriptorName= in a systemd socket unit). If empty, the first
+	// inherited socket that has not been claimed by another server is used.
+	Name string
+}
+
+// listen creates (or inherits) the listener the server will accept connections on and returns a description of where
+// it is listening.
+func (h *HTTPServer) listen() (net.Listener, string, error) {
+
+	if sa := h.SocketActivation; sa != nil && sa.Enabled {
+
+		ln, err := inheritedSockets.claim(sa.Name)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return ln, "inherited socket " + ln.Addr().String(), nil
+	}
+
+	if us := h.UnixSocket; us.enabled() {
+		ln, err := listenUnix(us)
+
+		return ln, "unix socket " + us.Path, err
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", h.Address, h.Port))
+
+	return ln, strconv.Itoa(h.Port), err
+}
+
+func listenUnix(uc *UnixSocketConfig) (net.Listener, error) {
+
+	var mode os.FileMode
+	var err error
+
+	if uc.Mode != "" {
+		if mode, err = uc.fileMode(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Remove a socket file left behind by a previous instance that did not shut down cleanly
+	if fi, err := os.Lstat(uc.Path); err == nil {
+
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unable to listen on %s: file exists and is not a socket", uc.Path)
+		}
+
+		if c, err := net.Dial("unix", uc.Path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("unable to listen on %s: another process is already listening on this socket", uc.Path)
+		}
+
+		if err := os.Remove(uc.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if uc.Mode == "" {
+		return net.Listen("unix", uc.Path)
+	}
+
+	return listenUnixWithMode(uc.Path, mode)
+}
+
+// listenUnixWithMode creates the socket inside a private (0700) directory, sets its permissions and then moves it to
+// the requested path, so the socket can never be connected to while it has the permissions implied by the umask.
+func listenUnixWithMode(path string, mode os.FileMode) (net.Listener, error) {
+
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".grnc-socket")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+
+	ln, err := net.Listen("unix", tmp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ul := ln.(*net.UnixListener)
+
+	// The socket file will have moved by the time the listener is closed, so it is removed by unixSocketListener instead
+	ul.SetUnlinkOnClose(false)
+
+	if err = os.Chmod(tmp, mode); err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		ul.Close()
+		return nil, err
+	}
+
+	return &unixSocketListener{UnixListener: ul, path: path}, nil
+}
+
+// unixSocketListener removes its socket file when it is closed.
+type unixSocketListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+// Close stops listening and removes the socket file.
+func (l *unixSocketListener) Close() error {
+
+	err := l.UnixListener.Close()
+
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+
+	return err
+}
+
+// socketInheritance tracks the sockets passed to the process by a socket activation manager (e.g. systemd) so that each
+// socket is only used by one server.
+type socketInheritance struct {
+	getenv   func(string) string
+	unsetenv func(string) error
+	pid      func() int
+	newFile  func(fd uintptr, name string) *os.File
+
+	once    sync.Once
+	mutex   sync.Mutex
+	names   []string
+	claimed []bool
+	err     error
+}
+
+var inheritedSockets = &socketInheritance{getenv: os.Getenv, unsetenv: os.Unsetenv, pid: os.Getpid, newFile: os.NewFile}
+
+func (si *socketInheritance) load() {
+
+	if pid, err := strconv.Atoi(si.getenv(listenPIDEnv)); err != nil || pid != si.pid() {
+		si.err = fmt.Errorf("socket activation is enabled but %s does not match this process", listenPIDEnv)
+		return
+	}
+
+	count, err := strconv.Atoi(si.getenv(listenFDsEnv))
+
+	if err != nil || count < 1 {
+		si.err = fmt.Errorf("socket activation is enabled but %s does not specify any sockets", listenFDsEnv)
+		return
+	}
+
+	si.names = make([]string, count)
+	si.claimed = make([]bool, count)
+
+	if n := si.getenv(listenFDNamesEnv); n != "" {
+		copy(si.names, strings.Split(n, ":"))
+	}
+
+	// Prevent child processes from believing the sockets were passed to them
+	for _, v := range []string{listenPIDEnv, listenFDsEnv, listenFDNamesEnv} {
+		si.unsetenv(v)
+	}
+}
+
+// claim returns a listener for the named inherited socket (or the first unclaimed socket if name is empty)
+func (si *socketInheritance) claim(name string) (net.Listener, error) {
+
+	si.once.Do(si.load)
+
+	if si.err != nil {
+		return nil, si.err
+	}
+
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	for i, n := range si.names {
+
+		if si.claimed[i] || (name != "" && n != name) {
+			continue
+		}
+
+		f := si.newFile(uintptr(listenFDsStart+i), n)
+
+		if f == nil {
+			return nil, fmt.Errorf("inherited file descriptor %d is not valid", listenFDsStart+i)
+		}
+
+		// FileListener duplicates the descriptor, so the original can be closed
+		ln, err := net.FileListener(f)
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("inherited file descriptor %d is not a listening socket: %s", listenFDsStart+i, err.Error())
+		}
+
+		si.claimed[i] = true
+
+		return ln, nil
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("all %d inherited sockets are already in use", len(si.names))
+	}
+
+	return nil, fmt.Errorf("no unused inherited socket named %s", name)
+}
@@ -0,0 +1,165 @@
+package httpserver
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/ioc"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "grnc-socket")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "http.sock")
+
+	s := runningServer(t, &mockProvider{pattern: "^/a$", methods: []string{"GET"}})
+	s.UnixSocket = &UnixSocketConfig{Path: path, Mode: "0660"}
+	s.state = ioc.AwaitingAccessState
+
+	if err := s.AllowAccess(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fi, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fi.Mode().Perm() != 0660 {
+		t.Errorf("Unexpected socket permissions %v", fi.Mode().Perm())
+	}
+
+	c := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial("unix", path)
+	}}}
+
+	res, err := c.Get("http://unix/a")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", res.StatusCode)
+	}
+
+	// A socket that is still being listened on is never removed
+	if _, err := listenUnix(&UnixSocketConfig{Path: path}); err == nil {
+		t.Errorf("Expected error listening on a socket that is in use")
+	}
+
+	s.server.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected socket file to be removed when the server closed")
+	}
+
+	// A stale socket file is replaced
+	stale, _ := net.Listen("unix", path)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(&UnixSocketConfig{Path: path})
+
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced: %s", err.Error())
+	}
+
+	ln.Close()
+
+	// Regular files are never removed
+	regular := filepath.Join(dir, "file")
+	ioutil.WriteFile(regular, []byte("data"), 0600)
+
+	if _, err := listenUnix(&UnixSocketConfig{Path: regular}); err == nil {
+		t.Errorf("Expected error listening on a regular file")
+	}
+
+	if _, err := listenUnix(&UnixSocketConfig{Path: filepath.Join(dir, "other.sock"), Mode: "rw"}); err == nil {
+		t.Errorf("Expected error for invalid mode")
+	}
+}
+
+func TestSocketActivation(t *testing.T) {
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer tcp.Close()
+
+	f, err := tcp.(*net.TCPListener).File()
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	env := map[string]string{
+		listenPIDEnv:     strconv.Itoa(os.Getpid()),
+		listenFDsEnv:     "2",
+		listenFDNamesEnv: "admin:http",
+	}
+
+	si := &socketInheritance{
+		getenv:   func(k string) string { return env[k] },
+		unsetenv: func(k string) error { delete(env, k); return nil },
+		pid:      os.Getpid,
+		newFile: func(fd uintptr, name string) *os.File {
+			if fd == listenFDsStart+1 && name == "http" {
+				return f
+			}
+
+			return nil
+		},
+	}
+
+	ln, err := si.claim("http")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ln.Addr().String() != tcp.Addr().String() {
+		t.Errorf("Inherited listener has address %s, expected %s", ln.Addr(), tcp.Addr())
+	}
+
+	ln.Close()
+
+	if len(env) != 0 {
+		t.Errorf("Expected socket activation variables to be removed from the environment")
+	}
+
+	if _, err := si.claim("http"); err == nil {
+		t.Errorf("Expected error claiming socket twice")
+	}
+
+	if _, err := si.claim("missing"); err == nil {
+		t.Errorf("Expected error claiming unknown socket")
+	}
+
+	wrongPID := &socketInheritance{
+		getenv: func(k string) string { return map[string]string{listenPIDEnv: "1", listenFDsEnv: "1"}[k] },
+		pid:    os.Getpid,
+	}
+
+	if _, err := wrongPID.claim(""); err == nil {
+		t.Errorf("Expected error when sockets were passed to another process")
+	}
+}
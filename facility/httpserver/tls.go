@@ -0,0 +1,303 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/logging"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig contains the settings required for an HTTPServer to serve requests over HTTPS. It is normally populated
+// from the HTTPServer.TLS section of configuration.
+type TLSConfig struct {
+	// Whether or not the server should serve HTTPS instead of plain HTTP.
+	Enabled bool
+
+	// Path to a PEM encoded certificate (or certificate chain) file.
+	CertFile string
+
+	// Path to the PEM encoded private key that matches the certificate in CertFile.
+	KeyFile string
+
+	// The minimum version of TLS that clients are allowed to negotiate. One of 1.0, 1.1, 1.2 or 1.3
+	MinVersion string
+
+	// The names (as defined in Go's crypto/tls package e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) of the cipher suites
+	// the server will accept. An empty list means Go's defaults will be used. Ignored for TLS 1.3 connections.
+	CipherSuites []string
+
+	// Path to a PEM encoded file of CA certificates. If set, clients must present a certificate signed by one of these
+	// CAs (mutual TLS).
+	ClientCAFile string
+
+	// How often (in milliseconds) the certificate, key and client CA files are checked for modification. Zero or less
+	// disables checking and certificates will only be reloaded using the reload-tls runtime command.
+	ReloadCheckIntervalMS int
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificateReloader holds the currently active certificate and client CA pool for a TLS enabled server and is
+// able to replace them from disk without the server's listener being closed.
+type certificateReloader struct {
+	config     *TLSConfig
+	log        logging.Logger
+	base       *tls.Config
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+	lastMod    map[string]time.Time
+	mutex      sync.RWMutex
+	stopSignal chan bool
+}
+
+func newCertificateReloader(c *TLSConfig, log logging.Logger) (*certificateReloader, error) {
+
+	if strings.TrimSpace(c.CertFile) == "" || strings.TrimSpace(c.KeyFile) == "" {
+		return nil, errors.New("TLS is enabled but CertFile and/or KeyFile have not been set")
+	}
+
+	cr := new(certificateReloader)
+	cr.config = c
+	cr.log = log
+
+	base := new(tls.Config)
+
+	if c.MinVersion != "" {
+
+		v, found := tlsVersions[c.MinVersion]
+
+		if !found {
+			return nil, fmt.Errorf("%s is not a supported value for TLS MinVersion. Must be one of 1.0, 1.1, 1.2, 1.3", c.MinVersion)
+		}
+
+		base.MinVersion = v
+	}
+
+	if len(c.CipherSuites) > 0 {
+		suites, err := parseCipherSuites(c.CipherSuites)
+
+		if err != nil {
+			return nil, err
+		}
+
+		base.CipherSuites = suites
+	}
+
+	if c.ClientCAFile != "" {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	cr.base = base
+
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// Reload reads the certificate, key and (if configured) client CA files from disk and makes them available to new
+// TLS connections. Existing connections are unaffected. If any of the files cannot be read or parsed, the previously
+// loaded certificates remain in use.
+func (cr *certificateReloader) Reload() error {
+
+	c := cr.config
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate and key: %s", err.Error())
+	}
+
+	var pool *x509.CertPool
+
+	if c.ClientCAFile != "" {
+
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+
+		if err != nil {
+			return fmt.Errorf("unable to read client CA file: %s", err.Error())
+		}
+
+		pool = x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid PEM encoded certificates found in client CA file %s", c.ClientCAFile)
+		}
+	}
+
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	cr.cert = &cert
+	cr.clientCAs = pool
+	cr.lastMod = cr.modTimes()
+
+	return nil
+}
+
+// TLSConfig returns a tls.Config suitable for wrapping a listener. Certificates are resolved per-connection so
+// that reloaded certificates are used without needing to rebuild the listener.
+func (cr *certificateReloader) TLSConfig() *tls.Config {
+
+	cfg := cr.base.Clone()
+	cfg.GetConfigForClient = cr.configForClient
+
+	return cfg
+}
+
+func (cr *certificateReloader) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	cfg := cr.base.Clone()
+	cfg.Certificates = []tls.Certificate{*cr.cert}
+	cfg.ClientCAs = cr.clientCAs
+
+	return cfg, nil
+}
+
+// CertificateExpiry returns the NotAfter time of the leaf certificate currently in use
+func (cr *certificateReloader) CertificateExpiry() (time.Time, error) {
+
+	cr.mutex.RLock()
+	cert := cr.cert
+	cr.mutex.RUnlock()
+
+	if len(cert.Certificate) == 0 {
+		return time.Time{}, errors.New("no certificate loaded")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return leaf.NotAfter, nil
+}
+
+// Watch starts a goroutine that periodically checks whether any of the certificate files have been modified and
+// reloads them if they have. Does nothing if ReloadCheckIntervalMS is zero or less.
+func (cr *certificateReloader) Watch() {
+
+	interval := cr.config.ReloadCheckIntervalMS
+
+	if interval <= 0 {
+		return
+	}
+
+	cr.stopSignal = make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cr.stopSignal:
+				return
+			case <-ticker.C:
+				cr.reloadIfModified()
+			}
+		}
+	}()
+}
+
+// StopWatching halts the goroutine started by Watch
+func (cr *certificateReloader) StopWatching() {
+	if cr.stopSignal != nil {
+		close(cr.stopSignal)
+		cr.stopSignal = nil
+	}
+}
+
+func (cr *certificateReloader) reloadIfModified() {
+
+	cr.mutex.RLock()
+	previous := cr.lastMod
+	cr.mutex.RUnlock()
+
+	current := cr.modTimes()
+	changed := false
+
+	for k, v := range current {
+		if !previous[k].Equal(v) {
+			changed = true
+			break
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := cr.Reload(); err != nil {
+		cr.log.LogErrorf("TLS certificate files have changed but could not be reloaded (continuing to use previous certificates): %s", err.Error())
+		return
+	}
+
+	cr.log.LogInfof("Reloaded TLS certificates")
+}
+
+func (cr *certificateReloader) modTimes() map[string]time.Time {
+
+	c := cr.config
+	times := make(map[string]time.Time)
+
+	for _, f := range []string{c.CertFile, c.KeyFile, c.ClientCAFile} {
+
+		if f == "" {
+			continue
+		}
+
+		if fi, err := os.Stat(f); err == nil {
+			times[f] = fi.ModTime()
+		}
+	}
+
+	return times
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+
+	known := make(map[string]uint16)
+
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	for _, cs := range tls.InsecureCipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, len(names))
+
+	for i, n := range names {
+
+		id, found := known[n]
+
+		if !found {
+			return nil, fmt.Errorf("%s is not a recognised TLS cipher suite", n)
+		}
+
+		ids[i] = id
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,145 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/graniticio/granitic/v2/logging"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertificateLoadAndReload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "grnc-tls")
+
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := new(TLSConfig)
+	c.CertFile = filepath.Join(dir, "cert.pem")
+	c.KeyFile = filepath.Join(dir, "key.pem")
+	c.MinVersion = "1.2"
+
+	firstExpiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	writeTestCertificate(t, c.CertFile, c.KeyFile, firstExpiry)
+
+	cr, err := newCertificateReloader(c, new(logging.ConsoleErrorLogger))
+
+	if err != nil {
+		t.Fatalf("Unexpected error loading certificates: %s", err.Error())
+	}
+
+	if cr.base.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Unexpected min TLS version %d", cr.base.MinVersion)
+	}
+
+	if exp, _ := cr.CertificateExpiry(); !exp.Equal(firstExpiry) {
+		t.Errorf("Unexpected expiry %v", exp)
+	}
+
+	secondExpiry := firstExpiry.Add(time.Hour)
+	writeTestCertificate(t, c.CertFile, c.KeyFile, secondExpiry)
+
+	if err := cr.Reload(); err != nil {
+		t.Fatalf("Unexpected error reloading certificates: %s", err.Error())
+	}
+
+	if exp, _ := cr.CertificateExpiry(); !exp.Equal(secondExpiry) {
+		t.Errorf("Certificate not reloaded. Expiry is %v", exp)
+	}
+
+	cfg, _ := cr.configForClient(nil)
+
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("Expected one certificate in per-connection config")
+	}
+
+	//A broken file must not replace the working certificate
+	ioutil.WriteFile(c.CertFile, []byte("not a cert"), 0600)
+
+	if err := cr.Reload(); err == nil {
+		t.Errorf("Expected error reloading invalid certificate")
+	}
+
+	if exp, _ := cr.CertificateExpiry(); !exp.Equal(secondExpiry) {
+		t.Errorf("Certificate replaced after failed reload")
+	}
+}
+
+func TestInvalidTLSConfig(t *testing.T) {
+
+	l := new(logging.ConsoleErrorLogger)
+
+	c := new(TLSConfig)
+
+	if _, err := newCertificateReloader(c, l); err == nil {
+		t.Errorf("Expected error with missing files")
+	}
+
+	c.CertFile = "cert.pem"
+	c.KeyFile = "key.pem"
+	c.MinVersion = "0.9"
+
+	if _, err := newCertificateReloader(c, l); err == nil {
+		t.Errorf("Expected error with invalid version")
+	}
+
+	c.MinVersion = ""
+	c.CipherSuites = []string{"TLS_ROT13"}
+
+	if _, err := newCertificateReloader(c, l); err == nil {
+		t.Errorf("Expected error with invalid cipher suite")
+	}
+
+}
+
+func TestCipherSuiteParsing(t *testing.T) {
+
+	ids, err := parseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+
+	if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Unexpected result parsing cipher suites %v %v", ids, err)
+	}
+}
+
+func writeTestCertificate(t *testing.T, certPath, keyPath string, notAfter time.Time) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Unable to generate key: %s", err.Error())
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %s", err.Error())
+	}
+
+	kb, _ := x509.MarshalECPrivateKey(key)
+
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpserver
+
+import (
+	"github.com/graniticio/granitic/v2/ctl"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+)
+
+const (
+	reloadTLSCommandName = "reload-tls"
+	reloadTLSSummary     = "Reloads the HTTP servers' TLS certificate, key and client CA files from disk."
+	reloadTLSUsage       = "reload-tls"
+	reloadTLSHelp        = "Causes the HTTPServer facility to re-read the files specified in HTTPServer.TLS (and the TLS settings of any additional listeners). New connections will use the reloaded " +
+		"certificates; existing connections and the server's listener are unaffected."
+	reloadTLSHelpTwo = "If the files cannot be read or are invalid, an error is returned and the previously loaded certificates remain in use."
+)
+
+type reloadTLSCommand struct {
+	FrameworkLogger logging.Logger
+	servers         []*HTTPServer
+}
+
+func (c *reloadTLSCommand) ExecuteCommand(qualifiers []string, args map[string]string) (*ctl.CommandOutput, []*ws.CategorisedError) {
+
+	for _, s := range c.servers {
+		if err := s.reloadCertificates(); err != nil {
+			return nil, []*ws.CategorisedError{ctl.NewCommandUnexpectedError(err.Error())}
+		}
+	}
+
+	c.FrameworkLogger.LogInfof("Reloaded TLS certificates (runtime command)")
+
+	co := new(ctl.CommandOutput)
+	co.OutputHeader = "TLS certificates reloaded"
+	co.RenderHint = ctl.Columns
+
+	for _, s := range c.servers {
+		if exp, err := s.certificates.CertificateExpiry(); err == nil {
+			co.OutputBody = append(co.OutputBody, []string{"Certificate expires (" + s.listenerName() + ")", exp.UTC().Format("2006-01-02 15:04:05 MST")})
+		}
+	}
+
+	return co, nil
+}
+
+func (c *reloadTLSCommand) Name() string {
+	return reloadTLSCommandName
+}
+
+func (c *reloadTLSCommand) Summmary() string {
+	return reloadTLSSummary
+}
+
+func (c *reloadTLSCommand) Usage() string {
+	return reloadTLSUsage
+}
+
+func (c *reloadTLSCommand) Help() []string {
+	return []string{reloadTLSHelp, reloadTLSHelpTwo}
+}
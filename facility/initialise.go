@@ -7,13 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/facility/cors"
+	"github.com/graniticio/granitic/v2/facility/healthcheck"
 	"github.com/graniticio/granitic/v2/facility/httpserver"
 	"github.com/graniticio/granitic/v2/facility/logger"
+	"github.com/graniticio/granitic/v2/facility/metrics"
+	"github.com/graniticio/granitic/v2/facility/openapi"
 	"github.com/graniticio/granitic/v2/facility/querymanager"
+	"github.com/graniticio/granitic/v2/facility/ratelimit"
 	"github.com/graniticio/granitic/v2/facility/rdbms"
 	"github.com/graniticio/granitic/v2/facility/runtimectl"
 	"github.com/graniticio/granitic/v2/facility/serviceerror"
 	"github.com/graniticio/granitic/v2/facility/taskscheduler"
+	"github.com/graniticio/granitic/v2/facility/tracing"
 	"github.com/graniticio/granitic/v2/facility/ws"
 	"github.com/graniticio/granitic/v2/instance"
 	"github.com/graniticio/granitic/v2/ioc"
@@ -129,12 +135,20 @@ func (fi *FacilitiesInitialisor) Initialise(ca *config.Accessor) error {
 
 	fi.addFacility(new(querymanager.FacilityBuilder))
 	fi.addFacility(new(httpserver.FacilityBuilder))
+	fi.addFacility(new(cors.FacilityBuilder))
 	fi.addFacility(new(ws.JSONFacilityBuilder))
 	fi.addFacility(new(ws.XMLFacilityBuilder))
+	fi.addFacility(new(ws.MsgPackFacilityBuilder))
+	fi.addFacility(new(ws.CBORFacilityBuilder))
 	fi.addFacility(new(serviceerror.FacilityBuilder))
 	fi.addFacility(new(rdbms.FacilityBuilder))
+	fi.addFacility(new(ratelimit.FacilityBuilder))
+	fi.addFacility(new(healthcheck.FacilityBuilder))
 	fi.addFacility(new(runtimectl.FacilityBuilder))
 	fi.addFacility(new(taskscheduler.FacilityBuilder))
+	fi.addFacility(new(metrics.FacilityBuilder))
+	fi.addFacility(new(tracing.FacilityBuilder))
+	fi.addFacility(new(openapi.FacilityBuilder))
 
 	if fc["ApplicationLogging"].(bool) || fc["HTTPServer"].(bool) {
 		//Facilties are required that might need a logging.ContextFilter
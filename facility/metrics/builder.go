@@ -0,0 +1,154 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package metrics provides the Metrics facility which records metrics about web service requests (and any metrics your
+application defines) and serves them in the Prometheus text exposition format.
+
+The facility creates a metrics.Registry and a metrics.RequestMetrics component, which is automatically used by the
+HTTPServer facility to instrument every request (see the instrument package). The following metrics are recorded:
+
+	http_requests_total            (counter)   labelled by handler, method and status
+	http_request_duration_seconds  (histogram) labelled by handler, method and status
+	http_requests_in_flight        (gauge)     labelled by handler and method
+
+The contents of the Registry are served on the path set in configuration. The default configuration is:
+
+	{
+	  "Metrics":{
+		"Path": "/metrics",
+		"Listeners": [],
+		"InstrumentRequests": true,
+		"DurationBuckets": [],
+		"InjectFieldNames": ["MetricsRegistry"]
+	  }
+	}
+
+Listeners can be used to serve metrics on an internal HTTP listener rather than the listener used by your web services.
+Setting InstrumentRequests to false stops the facility recording request metrics (for example if your application
+provides its own implementation of instrument.RequestInstrumentationManager).
+
+The Registry is injected into any component with a nil field of type *metrics.Registry named in InjectFieldNames so your
+components can define their own metrics. See the metrics package documentation for details.
+*/
+package metrics
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/metrics"
+	"github.com/graniticio/granitic/v2/reflecttools"
+	"reflect"
+)
+
+// RegistryComponentName is the name of the metrics.Registry component created by this facility
+const RegistryComponentName = instance.FrameworkPrefix + "MetricsRegistry"
+
+const endpointComponentName = instance.FrameworkPrefix + "MetricsEndpoint"
+const requestMetricsComponentName = instance.FrameworkPrefix + "RequestMetrics"
+const decoratorComponentName = instance.FrameworkPrefix + "MetricsRegistryDecorator"
+
+type metricsConfig struct {
+	Path               string
+	Listeners          []string
+	InstrumentRequests bool
+	DurationBuckets    []float64
+	InjectFieldNames   []string
+}
+
+// FacilityBuilder creates the components required by the Metrics facility
+type FacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	cfg := new(metricsConfig)
+
+	if err := ca.Populate("Metrics", cfg); err != nil {
+		return err
+	}
+
+	r := metrics.NewRegistry()
+	cn.WrapAndAddProto(RegistryComponentName, r)
+
+	e := new(metrics.Endpoint)
+	e.Registry = r
+	e.Path = cfg.Path
+	e.Listeners = cfg.Listeners
+	cn.WrapAndAddProto(endpointComponentName, e)
+
+	if cfg.InstrumentRequests {
+		rm := new(metrics.RequestMetrics)
+		rm.Registry = r
+		rm.DurationBuckets = cfg.DurationBuckets
+		cn.WrapAndAddProto(requestMetricsComponentName, rm)
+	}
+
+	d := new(registryDecorator)
+	d.Registry = r
+	d.FieldNames = cfg.InjectFieldNames
+	cn.WrapAndAddProto(decoratorComponentName, d)
+
+	return nil
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *FacilityBuilder) FacilityName() string {
+	return "Metrics"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *FacilityBuilder) DependsOnFacilities() []string {
+	return []string{"HTTPServer"}
+}
+
+// registryDecorator injects the Registry into components that have a nil field of a suitable type and name
+type registryDecorator struct {
+	FrameworkLogger logging.Logger
+	Registry        *metrics.Registry
+	FieldNames      []string
+}
+
+// OfInterest returns true if the subject has a nil field that the Registry can be injected into
+func (d *registryDecorator) OfInterest(subject *ioc.Component) bool {
+	return len(d.targetFields(subject.Instance)) > 0
+}
+
+// DecorateComponent injects the Registry
+func (d *registryDecorator) DecorateComponent(subject *ioc.Component, cc *ioc.ComponentContainer) {
+
+	for _, field := range d.targetFields(subject.Instance) {
+		d.FrameworkLogger.LogTracef("Injecting metrics registry into %s.%s", subject.Name, field)
+
+		reflect.ValueOf(subject.Instance).Elem().FieldByName(field).Set(reflect.ValueOf(d.Registry))
+	}
+}
+
+func (d *registryDecorator) targetFields(i interface{}) []string {
+
+	var fields []string
+
+	if !reflecttools.IsPointerToStruct(i) {
+		return fields
+	}
+
+	rt := reflect.TypeOf(d.Registry)
+
+	for _, field := range d.FieldNames {
+
+		if !reflecttools.HasWritableFieldOfName(i, field) {
+			continue
+		}
+
+		v := reflect.ValueOf(i).Elem().FieldByName(field)
+
+		if rt.AssignableTo(v.Type()) && reflecttools.NilPointer(v) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/metrics"
+	"github.com/graniticio/granitic/v2/test"
+	"testing"
+)
+
+func TestFacilityNaming(t *testing.T) {
+
+	fb := new(FacilityBuilder)
+
+	test.ExpectString(t, fb.FacilityName(), "Metrics")
+	test.ExpectString(t, fb.DependsOnFacilities()[0], "HTTPServer")
+}
+
+func TestRegistryDecorator(t *testing.T) {
+
+	r := metrics.NewRegistry()
+
+	d := new(registryDecorator)
+	d.FrameworkLogger = new(logging.NullLogger)
+	d.Registry = r
+	d.FieldNames = []string{"MetricsRegistry"}
+
+	target := new(metricsTarget)
+	c := ioc.NewComponent("target", target)
+
+	test.ExpectBool(t, d.OfInterest(c), true)
+
+	d.DecorateComponent(c, nil)
+
+	test.ExpectBool(t, target.MetricsRegistry == r, true)
+
+	// Already set
+	test.ExpectBool(t, d.OfInterest(c), false)
+
+	test.ExpectBool(t, d.OfInterest(ioc.NewComponent("wrongType", new(wrongTypeTarget))), false)
+	test.ExpectBool(t, d.OfInterest(ioc.NewComponent("notStruct", new(string))), false)
+}
+
+type metricsTarget struct {
+	MetricsRegistry *metrics.Registry
+}
+
+type wrongTypeTarget struct {
+	MetricsRegistry string
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package openapi provides the OpenAPI facility which generates an OpenAPI 3 document describing the web service
+endpoints (handler.WsHandler components) hosted by your application.
+
+The document is generated from each handler's configuration (see the ws/openapi package for details of how handlers
+are described) and is served as JSON on the path set in configuration. The default configuration is:
+
+	{
+	  "OpenAPI":{
+		"Path": "/openapi.json",
+		"Listeners": [],
+		"Title": "",
+		"Description": "",
+		"Version": "1.0.0",
+		"Servers": [],
+		"ContentTypes": ["application/json"]
+	  }
+	}
+
+If Title is empty, the application's instance ID is used. Listeners can be used to serve the document on an internal
+HTTP listener rather than the listener used by your web services.
+
+If the RuntimeCtl facility is enabled, the document is also available via the grnc-ctl command openapi.
+*/
+package openapi
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws/openapi"
+)
+
+// GeneratorComponentName is the name of the openapi.Generator component created by this facility
+const GeneratorComponentName = instance.FrameworkPrefix + "OpenAPIGenerator"
+
+const endpointComponentName = instance.FrameworkPrefix + "OpenAPIEndpoint"
+const commandComponentName = instance.FrameworkPrefix + "CommandOpenAPI"
+
+type openAPIConfig struct {
+	Path         string
+	Listeners    []string
+	Title        string
+	Description  string
+	Version      string
+	Servers      []string
+	ContentTypes []string
+}
+
+// FacilityBuilder creates the components required by the OpenAPI facility
+type FacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	cfg := new(openAPIConfig)
+
+	if err := ca.Populate("OpenAPI", cfg); err != nil {
+		return err
+	}
+
+	g := new(openapi.Generator)
+	g.Title = cfg.Title
+	g.Description = cfg.Description
+	g.Version = cfg.Version
+	g.Servers = cfg.Servers
+	g.ContentTypes = cfg.ContentTypes
+	cn.WrapAndAddProto(GeneratorComponentName, g)
+
+	e := new(openapi.Endpoint)
+	e.Generator = g
+	e.Path = cfg.Path
+	e.Listeners = cfg.Listeners
+	cn.WrapAndAddProto(endpointComponentName, e)
+
+	c := new(openAPICommand)
+	c.Generator = g
+	cn.WrapAndAddProto(commandComponentName, c)
+
+	return nil
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *FacilityBuilder) FacilityName() string {
+	return "OpenAPI"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *FacilityBuilder) DependsOnFacilities() []string {
+	return []string{"HTTPServer"}
+}
@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws/handler"
+	"github.com/graniticio/granitic/v2/ws/openapi"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFacilityNaming(t *testing.T) {
+
+	fb := new(FacilityBuilder)
+
+	test.ExpectString(t, fb.FacilityName(), "OpenAPI")
+	test.ExpectString(t, fb.DependsOnFacilities()[0], "HTTPServer")
+}
+
+func TestCommand(t *testing.T) {
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+	cc := ioc.NewComponentContainer(fm, new(config.Accessor), new(instance.System))
+
+	h := new(handler.WsHandler)
+	h.HTTPMethod = http.MethodGet
+	h.PathPattern = "^/status$"
+	cc.WrapAndAddProto("statusHandler", h)
+
+	test.ExpectNil(t, cc.Populate())
+
+	g := new(openapi.Generator)
+	g.FrameworkLogger = new(logging.NullLogger)
+	g.Container(cc)
+
+	c := new(openAPICommand)
+	c.Generator = g
+
+	test.ExpectString(t, c.Name(), "openapi")
+
+	co, errs := c.ExecuteCommand(nil, map[string]string{})
+	test.ExpectInt(t, len(errs), 0)
+
+	d := new(openapi.Document)
+	test.ExpectNil(t, json.Unmarshal([]byte(co.OutputBody[0][0]), d))
+	test.ExpectNotNil(t, d.Paths["/status"])
+
+	dir, err := ioutil.TempDir("", "openapi")
+	test.ExpectNil(t, err)
+	defer os.RemoveAll(dir)
+
+	f := filepath.Join(dir, "openapi.json")
+
+	co, errs = c.ExecuteCommand(nil, map[string]string{"file": f})
+	test.ExpectInt(t, len(errs), 0)
+	test.ExpectInt(t, len(co.OutputBody), 0)
+
+	b, err := ioutil.ReadFile(f)
+	test.ExpectNil(t, err)
+	test.ExpectNil(t, json.Unmarshal(b, d))
+
+	_, errs = c.ExecuteCommand(nil, map[string]string{"file": filepath.Join(dir, "missing", "openapi.json")})
+	test.ExpectInt(t, len(errs), 1)
+}
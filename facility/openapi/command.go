@@ -0,0 +1,83 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/graniticio/granitic/v2/ctl"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/openapi"
+	"io/ioutil"
+)
+
+const (
+	oaCommandName = "openapi"
+	oaSummary     = "Shows an OpenAPI 3 document describing the application's web service endpoints."
+	oaUsage       = "openapi [-file path]"
+	oaHelp        = "Generates an OpenAPI 3 document (in JSON) describing every web service handler in the application."
+	oaHelpTwo     = "If the '-file' argument is supplied, the document is written (indented) to that path on the server instead of being displayed."
+	oaFileArg     = "file"
+)
+
+type openAPICommand struct {
+	FrameworkLogger logging.Logger
+	Generator       *openapi.Generator
+}
+
+func (c *openAPICommand) ExecuteCommand(qualifiers []string, args map[string]string) (*ctl.CommandOutput, []*ws.CategorisedError) {
+
+	d, err := c.Generator.Generate()
+
+	if err != nil {
+		return nil, []*ws.CategorisedError{ctl.NewCommandClientError(fmt.Sprintf("Unable to generate OpenAPI document: %s", err.Error()))}
+	}
+
+	co := new(ctl.CommandOutput)
+	co.RenderHint = ctl.Paragraph
+
+	if path := args[oaFileArg]; path != "" {
+
+		b, err := json.MarshalIndent(d, "", "  ")
+
+		if err == nil {
+			err = ioutil.WriteFile(path, b, 0644)
+		}
+
+		if err != nil {
+			return nil, []*ws.CategorisedError{ctl.NewCommandClientError(fmt.Sprintf("Unable to write OpenAPI document to %s: %s", path, err.Error()))}
+		}
+
+		co.OutputHeader = fmt.Sprintf("OpenAPI document written to %s", path)
+
+		return co, nil
+	}
+
+	b, err := json.Marshal(d)
+
+	if err != nil {
+		return nil, []*ws.CategorisedError{ctl.NewCommandClientError(fmt.Sprintf("Unable to serialise OpenAPI document: %s", err.Error()))}
+	}
+
+	co.OutputBody = [][]string{{string(b)}}
+
+	return co, nil
+}
+
+func (c *openAPICommand) Name() string {
+	return oaCommandName
+}
+
+func (c *openAPICommand) Summmary() string {
+	return oaSummary
+}
+
+func (c *openAPICommand) Usage() string {
+	return oaUsage
+}
+
+func (c *openAPICommand) Help() []string {
+	return []string{oaHelp, oaHelpTwo}
+}
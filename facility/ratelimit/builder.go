@@ -0,0 +1,106 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package ratelimit provides the RateLimiter facility which limits the rate at which callers can make requests to web service handlers.
+
+Limits are defined in configuration and applied to handlers by their component names. For example:
+
+	{
+	  "RateLimiter":{
+		"IdleBucketExpirySeconds": 300,
+		"Limits": {
+		  "catalogue": {
+			"Handlers": ["artistHandler", "recordHandler"],
+			"RequestsPerSecond": 5,
+			"Burst": 20,
+			"KeyedBy": "USER"
+		  }
+		}
+	  }
+	}
+
+This facility injects a ratelimit.Manager into the RateLimiter field of any handler.WsHandler covered by a limit (unless
+that field has already been set). Requests that exceed a limit receive a 429 (Too Many Requests) response with a
+Retry-After header.
+
+If the RuntimeCtl facility is enabled, the rate-limits command shows the state of each caller's bucket. See the
+ratelimit package documentation for more details on how limits are applied.
+*/
+package ratelimit
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ratelimit"
+	"github.com/graniticio/granitic/v2/ws/handler"
+)
+
+const managerComponentName = instance.FrameworkPrefix + "RateLimiter"
+const decoratorComponentName = instance.FrameworkPrefix + "RateLimiterDecorator"
+const commandComponentName = instance.FrameworkPrefix + "CommandRateLimits"
+
+// FacilityBuilder creates the components required by the RateLimiter facility
+type FacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	m := new(ratelimit.Manager)
+
+	if err := ca.Populate("RateLimiter", m); err != nil {
+		return err
+	}
+
+	cn.WrapAndAddProto(managerComponentName, m)
+
+	d := new(rateLimitDecorator)
+	d.Manager = m
+	cn.WrapAndAddProto(decoratorComponentName, d)
+
+	c := new(rateLimitsCommand)
+	c.manager = m
+	cn.WrapAndAddProto(commandComponentName, c)
+
+	return nil
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *FacilityBuilder) FacilityName() string {
+	return "RateLimiter"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *FacilityBuilder) DependsOnFacilities() []string {
+	return []string{}
+}
+
+// rateLimitDecorator injects the Manager into handlers covered by at least one limit
+type rateLimitDecorator struct {
+	FrameworkLogger logging.Logger
+	Manager         *ratelimit.Manager
+}
+
+// OfInterest returns true if the subject is a handler.WsHandler
+func (d *rateLimitDecorator) OfInterest(subject *ioc.Component) bool {
+	_, found := subject.Instance.(*handler.WsHandler)
+
+	return found
+}
+
+// DecorateComponent injects the Manager into the handler if a limit applies to it
+func (d *rateLimitDecorator) DecorateComponent(subject *ioc.Component, cc *ioc.ComponentContainer) {
+
+	h := subject.Instance.(*handler.WsHandler)
+
+	if h.RateLimiter != nil || !d.Manager.Covers(subject.Name) {
+		return
+	}
+
+	d.FrameworkLogger.LogDebugf("Applying rate limits to %s", subject.Name)
+
+	h.RateLimiter = d.Manager
+}
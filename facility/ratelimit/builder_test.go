@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ratelimit"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws/handler"
+	"testing"
+)
+
+func TestFacilityNaming(t *testing.T) {
+
+	fb := new(FacilityBuilder)
+
+	if fb.FacilityName() != "RateLimiter" {
+		t.Errorf("Unexpected facility name %s", fb.FacilityName())
+	}
+}
+
+func TestDecoratorAndCommand(t *testing.T) {
+
+	m := new(ratelimit.Manager)
+	m.Limits = map[string]*ratelimit.Limit{
+		"catalogue": {Handlers: []string{"artistHandler"}, RequestsPerSecond: 1, Burst: 1, KeyedBy: "IP"},
+	}
+
+	d := new(rateLimitDecorator)
+	d.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	d.Manager = m
+
+	covered := ioc.NewComponent("artistHandler", new(handler.WsHandler))
+	uncovered := ioc.NewComponent("recordHandler", new(handler.WsHandler))
+
+	test.ExpectBool(t, d.OfInterest(covered), true)
+	test.ExpectBool(t, d.OfInterest(ioc.NewComponent("other", new(FacilityBuilder))), false)
+
+	d.DecorateComponent(covered, nil)
+	d.DecorateComponent(uncovered, nil)
+
+	test.ExpectNotNil(t, covered.Instance.(*handler.WsHandler).RateLimiter)
+	test.ExpectNil(t, uncovered.Instance.(*handler.WsHandler).RateLimiter)
+
+	test.ExpectNil(t, m.StartComponent())
+
+	c := new(rateLimitsCommand)
+	c.manager = m
+
+	if _, errs := c.ExecuteCommand(nil, map[string]string{"limit": "unknown"}); len(errs) != 1 {
+		t.Errorf("Expected error for unknown limit")
+	}
+
+	co, errs := c.ExecuteCommand(nil, map[string]string{})
+
+	test.ExpectInt(t, len(errs), 0)
+	test.ExpectInt(t, len(co.OutputBody), 0)
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/ctl"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ratelimit"
+	"github.com/graniticio/granitic/v2/ws"
+)
+
+const (
+	rlCommandName = "rate-limits"
+	rlSummary     = "Shows the number of requests each caller can currently make before being rate limited."
+	rlUsage       = "rate-limits [-limit name]"
+	rlHelp        = "Lists every bucket maintained by the RateLimiter facility, showing the limit it belongs to, the key identifying the caller, " +
+		"the number of tokens (requests) currently available and the time the caller last made a request."
+	rlHelpTwo = "If the '-limit' argument is supplied, only buckets belonging to the named limit are shown."
+	limitArg  = "limit"
+)
+
+type rateLimitsCommand struct {
+	FrameworkLogger logging.Logger
+	manager         *ratelimit.Manager
+}
+
+func (c *rateLimitsCommand) ExecuteCommand(qualifiers []string, args map[string]string) (*ctl.CommandOutput, []*ws.CategorisedError) {
+
+	name := args[limitArg]
+
+	if name != "" && c.manager.Limits[name] == nil {
+		return nil, []*ws.CategorisedError{ctl.NewCommandClientError(fmt.Sprintf("No rate limit named %s", name))}
+	}
+
+	rows := make([][]string, 0)
+
+	for _, s := range c.manager.BucketStates(name) {
+		rows = append(rows, []string{s.Limit, s.Key, fmt.Sprintf("%.1f", s.Tokens), s.LastRequest.Format("2006-01-02 15:04:05")})
+	}
+
+	co := new(ctl.CommandOutput)
+	co.OutputHeader = fmt.Sprintf("%d bucket(s) (limit, key, available tokens, last request)", len(rows))
+	co.OutputBody = rows
+	co.RenderHint = ctl.Columns
+
+	return co, nil
+}
+
+func (c *rateLimitsCommand) Name() string {
+	return rlCommandName
+}
+
+func (c *rateLimitsCommand) Summmary() string {
+	return rlSummary
+}
+
+func (c *rateLimitsCommand) Usage() string {
+	return rlUsage
+}
+
+func (c *rateLimitsCommand) Help() []string {
+	return []string{rlHelp, rlHelpTwo}
+}
@@ -27,6 +27,22 @@ different port. The listen port defaults to 9099 but can be changed with the fol
 
 Note that by default the server only listens on the IPV4 localhost. To listen on all interfaces, change address to ""
 
+The server can instead listen on a unix domain socket (readable and writable only by the application's user unless Mode
+is changed) or use a socket inherited via systemd socket activation (see the HTTPServer facility's documentation):
+
+	{
+	  "RuntimeCtl": {
+		"Server":{
+		  "UnixSocket": {
+			"Path": "/var/run/myapp/ctl.sock",
+			"Mode": "0600"
+		  }
+		}
+	  }
+	}
+
+Use grnc-ctl's --socket option to issue commands to an application listening on a unix socket.
+
 Disabling individual commands
 
 You can disable individual commands (either builtin commands or your own application commands) with configuration. For
@@ -79,6 +95,7 @@ const (
 	stopCommandComp            = instance.FrameworkPrefix + "CommandStop"
 	suspendCommandComp         = instance.FrameworkPrefix + "CommandSuspend"
 	resumeCommandComp          = instance.FrameworkPrefix + "CommandResume"
+	occupancyCommandComp       = instance.FrameworkPrefix + "CommandOccupancy"
 	defaultValidationCode      = "INV_CTL_REQUEST"
 )
 
@@ -225,6 +242,9 @@ func (fb *FacilityBuilder) createBuiltinCommands(lm *logging.ComponentLoggerMana
 	resumec := newResumeCommand()
 	fb.addCommand(cc, resumeCommandName, resumec)
 
+	oc := new(occupancyCommand)
+	fb.addCommand(cc, occupancyCommandComp, oc)
+
 }
 
 func (fb *FacilityBuilder) addCommand(cc *ioc.ComponentContainer, name string, c ctl.Command) {
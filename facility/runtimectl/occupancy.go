@@ -0,0 +1,120 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package runtimectl
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/ctl"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/handler"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	occCommandName = "occupancy"
+	occSummary     = "Shows how many requests each concurrency-limited handler is currently processing."
+	occUsage       = "occupancy [-handler name]"
+	occHelp        = "Lists every bulkhead (a handler's MaxConcurrent limit or a handler.Bulkhead component shared between handlers), showing the " +
+		"handlers it applies to, the number of requests being processed and waiting, the limit and the number of requests rejected since the application started."
+	occHelpTwo    = "If the '-handler' argument is supplied, only the bulkhead applying to the named handler is shown."
+	occHandlerArg = "handler"
+)
+
+type occupancyCommand struct {
+	FrameworkLogger logging.Logger
+	container       *ioc.ComponentContainer
+}
+
+func (c *occupancyCommand) Container(container *ioc.ComponentContainer) {
+	c.container = container
+}
+
+func (c *occupancyCommand) ExecuteCommand(qualifiers []string, args map[string]string) (*ctl.CommandOutput, []*ws.CategorisedError) {
+
+	filter := args[occHandlerArg]
+
+	handlers := make(map[*handler.Bulkhead][]string)
+	var bulkheads []*handler.Bulkhead
+
+	add := func(b *handler.Bulkhead) {
+		if _, found := handlers[b]; !found {
+			handlers[b] = []string{}
+			bulkheads = append(bulkheads, b)
+		}
+	}
+
+	for _, comp := range c.container.AllComponents() {
+
+		switch i := comp.Instance.(type) {
+		case *handler.WsHandler:
+			if i.Bulkhead != nil {
+				add(i.Bulkhead)
+				handlers[i.Bulkhead] = append(handlers[i.Bulkhead], comp.Name)
+			}
+		case *handler.Bulkhead:
+			add(i)
+		}
+	}
+
+	rows := make([][]string, 0)
+
+	for _, b := range bulkheads {
+
+		h := handlers[b]
+		sort.Strings(h)
+
+		if filter != "" && !containsName(h, filter) {
+			continue
+		}
+
+		o := b.Occupancy()
+
+		rows = append(rows, []string{b.ComponentName(), strings.Join(h, ","), strconv.Itoa(o.Active), strconv.Itoa(o.Waiting),
+			strconv.Itoa(o.MaxConcurrent), strconv.FormatUint(o.Rejected, 10)})
+	}
+
+	if filter != "" && len(rows) == 0 {
+		return nil, []*ws.CategorisedError{ctl.NewCommandClientError(fmt.Sprintf("No concurrency-limited handler named %s", filter))}
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+
+	co := new(ctl.CommandOutput)
+	co.OutputHeader = fmt.Sprintf("%d bulkhead(s) (name, handlers, active, waiting, limit, rejected)", len(rows))
+	co.OutputBody = rows
+	co.RenderHint = ctl.Columns
+
+	return co, nil
+}
+
+func containsName(names []string, name string) bool {
+
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *occupancyCommand) Name() string {
+	return occCommandName
+}
+
+func (c *occupancyCommand) Summmary() string {
+	return occSummary
+}
+
+func (c *occupancyCommand) Usage() string {
+	return occUsage
+}
+
+func (c *occupancyCommand) Help() []string {
+	return []string{occHelp, occHelpTwo}
+}
@@ -0,0 +1,50 @@
+package runtimectl
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws/handler"
+	"testing"
+)
+
+func TestOccupancyCommand(t *testing.T) {
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{"grncComp": "FATAL"}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+
+	cc := ioc.NewComponentContainer(fm, new(config.Accessor), new(instance.System))
+
+	shared := &handler.Bulkhead{MaxConcurrent: 2}
+
+	cc.WrapAndAddProto("sharedBulkhead", shared)
+	cc.WrapAndAddProto("reportB", &handler.WsHandler{Bulkhead: shared})
+	cc.WrapAndAddProto("reportA", &handler.WsHandler{Bulkhead: shared})
+	cc.WrapAndAddProto("unlimited", new(handler.WsHandler))
+
+	test.ExpectNil(t, cc.Populate())
+
+	release, _ := shared.Acquire(context.Background())
+	defer release()
+
+	oc := new(occupancyCommand)
+	oc.Container(cc)
+
+	co, errs := oc.ExecuteCommand([]string{}, map[string]string{})
+
+	test.ExpectInt(t, len(errs), 0)
+	test.ExpectInt(t, len(co.OutputBody), 1)
+
+	row := co.OutputBody[0]
+
+	test.ExpectString(t, row[0], "sharedBulkhead")
+	test.ExpectString(t, row[1], "reportA,reportB")
+	test.ExpectString(t, row[2], "1")
+	test.ExpectString(t, row[4], "2")
+
+	_, errs = oc.ExecuteCommand([]string{}, map[string]string{occHandlerArg: "unlimited"})
+
+	test.ExpectInt(t, len(errs), 1)
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package tracing provides the Tracing facility which records a trace of each web service request and exports the
+resulting spans to an OpenTelemetry collector or a file.
+
+The facility creates a tracing.Tracer component, which is automatically used by the HTTPServer facility to instrument
+every request (see the instrument package). A root span is created for each request and a child span for each
+instrument.Event or instrument.Method call made while the request is processed. See the tracing package documentation
+for more details.
+
+The default configuration is:
+
+	{
+	  "Tracing":{
+		"ServiceName": "",
+		"SampleRate": 1.0,
+		"MaxAttributes": 128,
+		"MaxAttributeLength": 1024,
+		"MaxSpans": 1000,
+		"BatchSize": 512,
+		"QueueSize": 2048,
+		"FlushIntervalMS": 5000,
+		"Export": {
+		  "To": "otlp",
+		  "OTLP": {
+			"Endpoint": "http://localhost:4318/v1/traces",
+			"Headers": {},
+			"TimeoutMS": 10000
+		  },
+		  "File": {
+			"Path": "traces.jsonl"
+		  }
+		}
+	  }
+	}
+
+Export.To may be set to otlp (spans are sent as OTLP/JSON over HTTP to Export.OTLP.Endpoint) or file (spans are
+appended to Export.File.Path, one OTLP/JSON export request per line).
+
+To join traces started by the services calling your application, enable trace context propagation in the HTTPServer
+facility (HTTPServer.TraceContext.Enabled).
+*/
+package tracing
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/tracing"
+)
+
+// TracerComponentName is the name of the tracing.Tracer component created by this facility
+const TracerComponentName = instance.FrameworkPrefix + "Tracer"
+
+const exporterComponentName = instance.FrameworkPrefix + "TraceExporter"
+
+const (
+	otlpExport = "otlp"
+	fileExport = "file"
+)
+
+// FacilityBuilder creates the components required by the Tracing facility
+type FacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *FacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	t := new(tracing.Tracer)
+
+	if err := ca.Populate("Tracing", t); err != nil {
+		return err
+	}
+
+	to, err := ca.StringVal("Tracing.Export.To")
+
+	if err != nil {
+		return err
+	}
+
+	var e tracing.Exporter
+
+	switch to {
+	case otlpExport:
+		oe := new(tracing.OTLPExporter)
+
+		if err := ca.Populate("Tracing.Export.OTLP", oe); err != nil {
+			return err
+		}
+
+		e = oe
+
+	case fileExport:
+		fe := new(tracing.FileExporter)
+
+		if err := ca.Populate("Tracing.Export.File", fe); err != nil {
+			return err
+		}
+
+		e = fe
+
+	default:
+		return fmt.Errorf("Tracing.Export.To must be %s or %s (was %s)", otlpExport, fileExport, to)
+	}
+
+	cn.WrapAndAddProto(exporterComponentName, e)
+
+	t.Exporter = e
+	cn.WrapAndAddProto(TracerComponentName, t)
+
+	return nil
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *FacilityBuilder) FacilityName() string {
+	return "Tracing"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *FacilityBuilder) DependsOnFacilities() []string {
+	return []string{"HTTPServer"}
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/tracing"
+	"reflect"
+	"testing"
+)
+
+func TestFacilityNaming(t *testing.T) {
+
+	fb := new(FacilityBuilder)
+
+	test.ExpectString(t, fb.FacilityName(), "Tracing")
+	test.ExpectString(t, fb.DependsOnFacilities()[0], "HTTPServer")
+}
+
+func TestExporterSelection(t *testing.T) {
+
+	for to, expected := range map[string]interface{}{"otlp": new(tracing.OTLPExporter), "file": new(tracing.FileExporter), "zipkin": nil} {
+
+		ca := new(config.Accessor)
+		ca.FrameworkLogger = new(logging.NullLogger)
+		ca.JSONData = map[string]interface{}{
+			"Tracing": map[string]interface{}{
+				"SampleRate": 0.5,
+				"Export": map[string]interface{}{
+					"To":   to,
+					"OTLP": map[string]interface{}{"Endpoint": "http://collector:4318/v1/traces"},
+					"File": map[string]interface{}{"Path": "traces.jsonl"},
+				},
+			},
+		}
+
+		fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+		cn := ioc.NewComponentContainer(fm, ca, new(instance.System))
+
+		err := new(FacilityBuilder).BuildAndRegister(fm, ca, cn)
+
+		if expected == nil {
+
+			if err == nil {
+				t.Errorf("Expected error for unsupported exporter %s", to)
+			}
+
+			continue
+		}
+
+		test.ExpectNil(t, err)
+
+		tr := cn.ProtoComponents()[TracerComponentName].Component.Instance.(*tracing.Tracer)
+
+		if tr.SampleRate != 0.5 {
+			t.Errorf("Tracer not configured")
+		}
+
+		test.ExpectBool(t, reflect.TypeOf(tr.Exporter) == reflect.TypeOf(expected), true)
+
+		switch e := tr.Exporter.(type) {
+		case *tracing.OTLPExporter:
+			test.ExpectString(t, e.Endpoint, "http://collector:4318/v1/traces")
+		case *tracing.FileExporter:
+			test.ExpectString(t, e.Path, "traces.jsonl")
+		}
+	}
+}
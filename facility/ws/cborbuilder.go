@@ -0,0 +1,50 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ws
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws/cbor"
+)
+
+const cborResponseWriterComponentName = instance.FrameworkPrefix + "CBORResponseWriter"
+const cborUnmarshallerComponentName = instance.FrameworkPrefix + "CBORUnmarshaller"
+
+// CBORFacilityBuilder creates the components required to support the CBORWs facility and adds them the IoC container.
+type CBORFacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *CBORFacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	wc, err := buildAndRegisterWsCommon(lm, ca, cn)
+
+	if err != nil {
+		return err
+	}
+
+	mf := &marshallingFormat{
+		name:               "CBOR",
+		configPath:         "CBORWs",
+		responseWriterName: cborResponseWriterComponentName,
+		unmarshallerName:   cborUnmarshallerComponentName,
+		unmarshaller:       new(cbor.Unmarshaller),
+		marshalingWriter:   new(cbor.MarshalingWriter),
+	}
+
+	return buildAndRegisterMarshallingFormat(lm, ca, cn, wc, mf)
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *CBORFacilityBuilder) FacilityName() string {
+	return "CBORWs"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *CBORFacilityBuilder) DependsOnFacilities() []string {
+	return []string{}
+}
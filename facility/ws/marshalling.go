@@ -0,0 +1,86 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/json"
+)
+
+const modeWrap = "WRAP"
+const modeBody = "BODY"
+
+// marshallingFormat describes a web service format (JSON, MessagePack or CBOR) whose responses are written by a
+// ws.MarshallingResponseWriter and share the JSONWs facility's response wrappers and error formatter.
+type marshallingFormat struct {
+	// The name of the format for content negotiation
+	name string
+
+	// The path in configuration of the facility's settings (e.g. JSONWs)
+	configPath string
+
+	responseWriterName string
+	unmarshallerName   string
+	unmarshaller       ws.Unmarshaller
+	marshalingWriter   ws.MarshalingWriter
+}
+
+func buildAndRegisterMarshallingFormat(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer, wc *wsCommon, mf *marshallingFormat) error {
+
+	cn.WrapAndAddProto(mf.unmarshallerName, mf.unmarshaller)
+
+	rw := new(ws.MarshallingResponseWriter)
+	ca.Populate(mf.configPath+".ResponseWriter", rw)
+	cn.WrapAndAddProto(mf.responseWriterName, rw)
+
+	rw.StatusDeterminer = wc.StatusDeterminer
+	rw.FrameworkErrors = wc.FrameworkErrors
+
+	f := &ws.NegotiatedFormat{Name: mf.name, ResponseWriter: rw, Unmarshaller: mf.unmarshaller}
+	ca.SetField("MediaTypes", mf.configPath+".MediaTypes", f)
+
+	buildRegisterWsDecorator(cn, f, wc, lm)
+
+	if !cn.ModifierExists(mf.responseWriterName, "ErrorFormatter") {
+		rw.ErrorFormatter = new(json.GraniticJSONErrorFormatter)
+	}
+
+	if !cn.ModifierExists(mf.responseWriterName, "ResponseWrapper") {
+
+		// User hasn't defined their own wrapper for responses, use one of the defaults
+		if mode, err := ca.StringVal(mf.configPath + ".WrapMode"); err == nil {
+			var wrap ws.ResponseWrapper
+
+			switch mode {
+			case modeBody:
+				wrap = new(json.BodyOrErrorWrapper)
+			case modeWrap:
+				wrap = new(json.GraniticJSONResponseWrapper)
+			default:
+				m := fmt.Sprintf("%s.WrapMode must be either %s or %s", mf.configPath, modeWrap, modeBody)
+
+				return errors.New(m)
+			}
+
+			ca.Populate(mf.configPath+".ResponseWrapper", wrap)
+			rw.ResponseWrapper = wrap
+		} else {
+			return err
+		}
+
+	}
+
+	if !cn.ModifierExists(mf.responseWriterName, "MarshalingWriter") {
+		rw.MarshalingWriter = mf.marshalingWriter
+	}
+
+	offerAbnormalStatusWriter(rw, cn, mf.responseWriterName)
+
+	return nil
+}
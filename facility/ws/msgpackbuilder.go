@@ -0,0 +1,50 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ws
+
+import (
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws/msgpack"
+)
+
+const msgPackResponseWriterComponentName = instance.FrameworkPrefix + "MsgPackResponseWriter"
+const msgPackUnmarshallerComponentName = instance.FrameworkPrefix + "MsgPackUnmarshaller"
+
+// MsgPackFacilityBuilder creates the components required to support the MsgPackWs facility and adds them the IoC container.
+type MsgPackFacilityBuilder struct {
+}
+
+// BuildAndRegister implements FacilityBuilder.BuildAndRegister
+func (fb *MsgPackFacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) error {
+
+	wc, err := buildAndRegisterWsCommon(lm, ca, cn)
+
+	if err != nil {
+		return err
+	}
+
+	mf := &marshallingFormat{
+		name:               "MessagePack",
+		configPath:         "MsgPackWs",
+		responseWriterName: msgPackResponseWriterComponentName,
+		unmarshallerName:   msgPackUnmarshallerComponentName,
+		unmarshaller:       new(msgpack.Unmarshaller),
+		marshalingWriter:   new(msgpack.MarshalingWriter),
+	}
+
+	return buildAndRegisterMarshallingFormat(lm, ca, cn, wc, mf)
+}
+
+// FacilityName implements FacilityBuilder.FacilityName
+func (fb *MsgPackFacilityBuilder) FacilityName() string {
+	return "MsgPackWs"
+}
+
+// DependsOnFacilities implements FacilityBuilder.DependsOnFacilities
+func (fb *MsgPackFacilityBuilder) DependsOnFacilities() []string {
+	return []string{}
+}
@@ -2,13 +2,14 @@
 // Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
 
 /*
-Package ws provides the JSONWs and XMLWs facilities which support JSON and XML web services.
+Package ws provides the JSONWs, XMLWs, MsgPackWs and CBORWs facilities which support JSON, XML, MessagePack and CBOR
+web services.
 
 This facility is documented in detail at https://granitic.io/ref/web-services
 
 Web-services
 
-Enabling the JSONWs or XMLWs facility allows the creation of web service endpoints where inbound and outbound data is automatically converted from and to JSON/XML.
+Enabling the JSONWs, XMLWs, MsgPackWs or CBORWs facility allows the creation of web service endpoints where inbound and outbound data is automatically converted from and to JSON/XML/MessagePack/CBOR.
 
 An endpoint is created by adding an instance of handler.WsHandler with a corresponding implementation of handler.WsPostProcessor
 (generally referred to as handler logic) to your component definition file. For example:
@@ -54,6 +55,59 @@ Refer to https://granitic.io/ref/xml-web-services for more information.
 
 Many aspects of the parsing and rendering process (including content types and formatting of errors) is configurable.
 Refer to https://granitic.io/ref/xml-web-services for more details.
+
+MessagePack and CBOR
+
+The MsgPackWs and CBORWs facilities support the compact binary formats MessagePack and CBOR using the encoders in the
+ws/msgpack and ws/cbor packages. Fields are named using the same rules (and json struct tags) as JSON, and responses are
+wrapped and errors formatted by the same components as the JSONWs facility, so the same types can be used for all
+three formats. The WrapMode and ResponseWrapper settings of each facility work in the same way as the JSONWs settings.
+
+Content negotiation
+
+Any combination of the JSONWs, XMLWs, MsgPackWs and CBORWs facilities can be enabled at the same time. Handlers are then
+given a ws.NegotiatingResponseWriter and ws.NegotiatingUnmarshaller which choose a format for each request based on
+its Accept and Content-Type headers (rejecting the request with HTTP 406 or 415 if no format is suitable). The media
+types associated with each format are set in configuration:
+
+	{
+	  "JSONWs": {
+		"MediaTypes": ["application/json"]
+	  },
+	  "XMLWs": {
+		"MediaTypes": ["application/xml", "text/xml"]
+	  },
+	  "MsgPackWs": {
+		"MediaTypes": ["application/msgpack", "application/x-msgpack", "application/vnd.msgpack"]
+	  },
+	  "CBORWs": {
+		"MediaTypes": ["application/cbor"]
+	  }
+	}
+
+When a request expresses no preference, formats are preferred in the order JSON, XML, MessagePack and CBOR (of those
+that are enabled). The ws.NegotiatingResponseWriter is also used by the HTTP server to write responses for requests it
+rejects itself (404, 503 etc), so those responses also respect the Accept header.
+
+Forms
+
+Enabling any of these facilities also creates a form.Unmarshaller called grncFormUnmarshaller which can be set as the
+Unmarshaller of handlers that accept application/x-www-form-urlencoded or multipart/form-data requests (including file
+uploads). See the ws/form package documentation for details. Limits on uploads are set in configuration:
+
+	{
+	  "WS": {
+		"FormUnmarshaller": {
+		  "MaxFileBytes": 10485760,
+		  "SpillThresholdBytes": 1048576,
+		  "MaxFieldBytes": 1048576,
+		  "MaxFields": 1000,
+		  "MaxFiles": 20,
+		  "MaxBodyBytes": 52428800,
+		  "TempDir": ""
+		}
+	  }
+	}
 */
 package ws
 
@@ -64,6 +118,7 @@ import (
 	"github.com/graniticio/granitic/v2/ioc"
 	"github.com/graniticio/granitic/v2/logging"
 	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/form"
 	"github.com/graniticio/granitic/v2/ws/handler"
 )
 
@@ -71,17 +126,35 @@ const wsHTTPStatusDeterminerComponentName = instance.FrameworkPrefix + "HTTPStat
 const wsParamBinderComponentName = instance.FrameworkPrefix + "ParamBinder"
 const wsFrameworkErrorGenerator = instance.FrameworkPrefix + "FrameworkErrorGenerator"
 const wsHandlerDecoratorName = instance.FrameworkPrefix + "WsHandlerDecorator"
+const wsNegotiatingResponseWriterName = instance.FrameworkPrefix + "NegotiatingResponseWriter"
+const wsNegotiatingUnmarshallerName = instance.FrameworkPrefix + "NegotiatingUnmarshaller"
+const wsFormUnmarshallerName = instance.FrameworkPrefix + "FormUnmarshaller"
 
 func offerAbnormalStatusWriter(arw ws.AbnormalStatusWriter, cc *ioc.ComponentContainer, name string) {
 
-	if !cc.ModifierExists(httpserver.HTTPServerComponentName, httpserver.HTTPServerAbnormalStatusFieldName) {
-		//The HTTP server does not have an AbnormalStatusWriter defined
+	d := existingDecorator(cc)
+
+	if len(d.formats) > 1 {
+		// More than one web service facility is enabled - respond in whichever format the caller prefers
+		name = wsNegotiatingResponseWriterName
+	}
+
+	current := cc.Modifiers(httpserver.HTTPServerComponentName)[httpserver.HTTPServerAbnormalStatusFieldName]
+
+	if current == "" || current == d.abnormalStatusWriter {
+		//The HTTP server does not have an AbnormalStatusWriter defined, or is using one offered by another facility
 		cc.AddModifier(httpserver.HTTPServerComponentName, httpserver.HTTPServerAbnormalStatusFieldName, name)
+		d.abnormalStatusWriter = name
 	}
 }
 
 func buildAndRegisterWsCommon(lm *logging.ComponentLoggerManager, ca *config.Accessor, cn *ioc.ComponentContainer) (*wsCommon, error) {
 
+	if d := existingDecorator(cn); d != nil {
+		// Another web service facility has already created the common components
+		return d.common, nil
+	}
+
 	scd := new(ws.GraniticHTTPStatusCodeDeterminer)
 
 	if err := ca.Populate("WS.HTTPStatus", scd); err != nil {
@@ -102,7 +175,23 @@ func buildAndRegisterWsCommon(lm *logging.ComponentLoggerManager, ca *config.Acc
 
 	pb.FrameworkErrors = feg
 
-	return newWsCommon(pb, feg, scd), nil
+	fu := new(form.Unmarshaller)
+
+	if err := ca.Populate("WS.FormUnmarshaller", fu); err != nil {
+		return nil, err
+	}
+
+	fu.ParamBinder = pb
+	cn.WrapAndAddProto(wsFormUnmarshallerName, fu)
+
+	wc := newWsCommon(pb, feg, scd)
+
+	if status, err := ca.IntVal("HTTPServer.TooBusyStatus"); err == nil {
+		// Handlers rejecting requests because they are too busy should behave the same way as the HTTP server
+		wc.TooBusyStatus = status
+	}
+
+	return wc, nil
 
 }
 
@@ -121,21 +210,73 @@ type wsCommon struct {
 	ParamBinder      *ws.ParamBinder
 	FrameworkErrors  *ws.FrameworkErrorGenerator
 	StatusDeterminer *ws.GraniticHTTPStatusCodeDeterminer
+	TooBusyStatus    int
 }
 
-func buildRegisterWsDecorator(cc *ioc.ComponentContainer, rw ws.ResponseWriter, um ws.Unmarshaller, wc *wsCommon, lm *logging.ComponentLoggerManager) {
+func buildRegisterWsDecorator(cc *ioc.ComponentContainer, f *ws.NegotiatedFormat, wc *wsCommon, lm *logging.ComponentLoggerManager) {
 
-	decoratorLogger := lm.CreateLogger(wsHandlerDecoratorName)
-	decorator := wsHandlerDecorator{decoratorLogger, rw, um, wc.ParamBinder, wc.FrameworkErrors}
-	cc.WrapAndAddProto(wsHandlerDecoratorName, &decorator)
+	if d := existingDecorator(cc); d != nil {
+		// More than one web service facility is enabled - choose between their formats for each request
+		d.addFormat(cc, f)
+		return
+	}
+
+	decorator := new(wsHandlerDecorator)
+	decorator.FrameworkLogger = lm.CreateLogger(wsHandlerDecoratorName)
+	decorator.ResponseWriter = f.ResponseWriter
+	decorator.Unmarshaller = f.Unmarshaller
+	decorator.QueryBinder = wc.ParamBinder
+	decorator.FrameworkErrors = wc.FrameworkErrors
+	decorator.TooBusyStatus = wc.TooBusyStatus
+	decorator.common = wc
+	decorator.formats = []*ws.NegotiatedFormat{f}
+
+	cc.WrapAndAddProto(wsHandlerDecoratorName, decorator)
+}
+
+// existingDecorator returns the decorator created by a web service facility that has already been built (or nil)
+func existingDecorator(cc *ioc.ComponentContainer) *wsHandlerDecorator {
+
+	if p := cc.ProtoComponents()[wsHandlerDecoratorName]; p != nil {
+		return p.Component.Instance.(*wsHandlerDecorator)
+	}
+
+	return nil
 }
 
 type wsHandlerDecorator struct {
-	FrameworkLogger logging.Logger
-	ResponseWriter  ws.ResponseWriter
-	Unmarshaller    ws.Unmarshaller
-	QueryBinder     *ws.ParamBinder
-	FrameworkErrors *ws.FrameworkErrorGenerator
+	FrameworkLogger      logging.Logger
+	ResponseWriter       ws.ResponseWriter
+	Unmarshaller         ws.Unmarshaller
+	QueryBinder          *ws.ParamBinder
+	FrameworkErrors      *ws.FrameworkErrorGenerator
+	TooBusyStatus        int
+	common               *wsCommon
+	formats              []*ws.NegotiatedFormat
+	abnormalStatusWriter string
+}
+
+// addFormat replaces the decorator's ResponseWriter and Unmarshaller with components that negotiate between the
+// formats of all enabled web service facilities.
+func (jwhd *wsHandlerDecorator) addFormat(cc *ioc.ComponentContainer, f *ws.NegotiatedFormat) {
+
+	jwhd.formats = append(jwhd.formats, f)
+
+	rw, found := jwhd.ResponseWriter.(*ws.NegotiatingResponseWriter)
+
+	if !found {
+		rw = new(ws.NegotiatingResponseWriter)
+		cc.WrapAndAddProto(wsNegotiatingResponseWriterName, rw)
+
+		um := new(ws.NegotiatingUnmarshaller)
+		cc.WrapAndAddProto(wsNegotiatingUnmarshallerName, um)
+
+		jwhd.ResponseWriter = rw
+		jwhd.Unmarshaller = um
+	}
+
+	rw.Formats = jwhd.formats
+	jwhd.Unmarshaller.(*ws.NegotiatingUnmarshaller).Formats = jwhd.formats
 }
 
 func (jwhd *wsHandlerDecorator) OfInterest(component *ioc.Component) bool {
@@ -145,10 +286,22 @@ func (jwhd *wsHandlerDecorator) OfInterest(component *ioc.Component) bool {
 		return false
 	case *handler.WsHandler:
 		return h.AutoWireable()
+	case *handler.WsSocketHandler:
+		return h.AutoWireable()
 	}
 }
 
 func (jwhd *wsHandlerDecorator) DecorateComponent(component *ioc.Component, container *ioc.ComponentContainer) {
+
+	if sh, found := component.Instance.(*handler.WsSocketHandler); found {
+		// WebSocket handlers only need to write error responses if a connection is refused
+		if sh.ResponseWriter == nil {
+			sh.ResponseWriter = jwhd.ResponseWriter
+		}
+
+		return
+	}
+
 	h := component.Instance.(*handler.WsHandler)
 	l := jwhd.FrameworkLogger
 	l.LogTracef("Decorating component %s", component.Name)
@@ -170,4 +323,8 @@ func (jwhd *wsHandlerDecorator) DecorateComponent(component *ioc.Component, cont
 		h.FrameworkErrors = jwhd.FrameworkErrors
 	}
 
+	if h.TooBusyStatus == 0 {
+		h.TooBusyStatus = jwhd.TooBusyStatus
+	}
+
 }
@@ -2,11 +2,20 @@ package ws
 
 import (
 	"context"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/facility/httpserver"
+	"github.com/graniticio/granitic/v2/instance"
 	"github.com/graniticio/granitic/v2/ioc"
 	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
 	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/cbor"
+	"github.com/graniticio/granitic/v2/ws/form"
 	"github.com/graniticio/granitic/v2/ws/handler"
+	"github.com/graniticio/granitic/v2/ws/json"
+	"github.com/graniticio/granitic/v2/ws/msgpack"
 	"net/http"
+	"path/filepath"
 	"testing"
 )
 
@@ -52,6 +61,124 @@ func TestWsHandlerDecorator_DecorateComponent(t *testing.T) {
 
 }
 
+func TestJSONAndXMLEnabled(t *testing.T) {
+
+	ca := loadConfig(t, "ws.json", "jsonws.json", "xmlws.json", "serviceerror.json")
+	ca.JSONData["XMLWs"].(map[string]interface{})["ResponseMode"] = marshalMode
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+	cn := ioc.NewComponentContainer(fm, ca, new(instance.System))
+
+	test.ExpectNil(t, new(JSONFacilityBuilder).BuildAndRegister(fm, ca, cn))
+	test.ExpectNil(t, new(XMLFacilityBuilder).BuildAndRegister(fm, ca, cn))
+
+	d := existingDecorator(cn)
+	test.ExpectNotNil(t, d)
+
+	rw, found := d.ResponseWriter.(*ws.NegotiatingResponseWriter)
+	test.ExpectBool(t, found, true)
+	test.ExpectInt(t, len(rw.Formats), 2)
+	test.ExpectString(t, rw.Formats[0].Name, "JSON")
+	test.ExpectString(t, rw.Formats[1].MediaTypes[1], "text/xml")
+
+	um, found := d.Unmarshaller.(*ws.NegotiatingUnmarshaller)
+	test.ExpectBool(t, found, true)
+	test.ExpectInt(t, len(um.Formats), 2)
+
+	test.ExpectNotNil(t, cn.ProtoComponents()[wsNegotiatingResponseWriterName])
+	test.ExpectNotNil(t, cn.ProtoComponents()[wsNegotiatingUnmarshallerName])
+
+	// The HTTP server's abnormal responses are negotiated too
+	test.ExpectString(t, cn.Modifiers(httpserver.HTTPServerComponentName)[httpserver.HTTPServerAbnormalStatusFieldName], wsNegotiatingResponseWriterName)
+
+	// Common components are shared
+	test.ExpectBool(t, rw.Formats[1].ResponseWriter.(*ws.MarshallingResponseWriter).FrameworkErrors == d.FrameworkErrors, true)
+
+	fu := cn.ProtoComponents()[wsFormUnmarshallerName].Component.Instance.(*form.Unmarshaller)
+	test.ExpectInt(t, int(fu.MaxFileBytes), 10485760)
+	test.ExpectInt(t, int(fu.MaxBodyBytes), 52428800)
+	test.ExpectInt(t, fu.MaxFields, 1000)
+	test.ExpectBool(t, fu.ParamBinder == d.QueryBinder, true)
+}
+
+func TestUserAbnormalStatusWriterKept(t *testing.T) {
+
+	ca := loadConfig(t, "ws.json", "jsonws.json", "xmlws.json", "serviceerror.json")
+	ca.JSONData["XMLWs"].(map[string]interface{})["ResponseMode"] = marshalMode
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+	cn := ioc.NewComponentContainer(fm, ca, new(instance.System))
+	cn.AddModifier(httpserver.HTTPServerComponentName, httpserver.HTTPServerAbnormalStatusFieldName, "myStatusWriter")
+
+	test.ExpectNil(t, new(JSONFacilityBuilder).BuildAndRegister(fm, ca, cn))
+	test.ExpectNil(t, new(XMLFacilityBuilder).BuildAndRegister(fm, ca, cn))
+
+	test.ExpectString(t, cn.Modifiers(httpserver.HTTPServerComponentName)[httpserver.HTTPServerAbnormalStatusFieldName], "myStatusWriter")
+}
+
+func TestBinaryFormatsEnabled(t *testing.T) {
+
+	ca := loadConfig(t, "ws.json", "jsonws.json", "msgpackws.json", "cborws.json", "serviceerror.json")
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+	cn := ioc.NewComponentContainer(fm, ca, new(instance.System))
+
+	// MessagePack on its own
+	test.ExpectNil(t, new(MsgPackFacilityBuilder).BuildAndRegister(fm, ca, cn))
+
+	d := existingDecorator(cn)
+	test.ExpectNotNil(t, d)
+
+	rw, found := d.ResponseWriter.(*ws.MarshallingResponseWriter)
+	test.ExpectBool(t, found, true)
+
+	_, found = rw.MarshalingWriter.(*msgpack.MarshalingWriter)
+	test.ExpectBool(t, found, true)
+
+	_, found = rw.ResponseWrapper.(*json.BodyOrErrorWrapper)
+	test.ExpectBool(t, found, true)
+
+	_, found = rw.ErrorFormatter.(*json.GraniticJSONErrorFormatter)
+	test.ExpectBool(t, found, true)
+
+	test.ExpectString(t, rw.DefaultHeaders["Content-Type"], "application/msgpack")
+
+	// Adding CBOR and JSON results in negotiation between all three
+	test.ExpectNil(t, new(CBORFacilityBuilder).BuildAndRegister(fm, ca, cn))
+	test.ExpectNil(t, new(JSONFacilityBuilder).BuildAndRegister(fm, ca, cn))
+
+	nrw, found := d.ResponseWriter.(*ws.NegotiatingResponseWriter)
+	test.ExpectBool(t, found, true)
+	test.ExpectInt(t, len(nrw.Formats), 3)
+	test.ExpectString(t, nrw.Formats[1].Name, "CBOR")
+	test.ExpectString(t, nrw.Formats[1].MediaTypes[0], "application/cbor")
+	test.ExpectString(t, nrw.Formats[0].MediaTypes[1], "application/x-msgpack")
+
+	_, found = nrw.Formats[1].Unmarshaller.(*cbor.Unmarshaller)
+	test.ExpectBool(t, found, true)
+
+	// An invalid wrap mode is reported
+	ca.JSONData["CBORWs"].(map[string]interface{})["WrapMode"] = "NONE"
+	cn = ioc.NewComponentContainer(fm, ca, new(instance.System))
+
+	test.ExpectNotNil(t, new(CBORFacilityBuilder).BuildAndRegister(fm, ca, cn))
+}
+
+func loadConfig(t *testing.T, names ...string) *config.Accessor {
+
+	var files []string
+
+	for _, f := range names {
+		files = append(files, filepath.Join("..", "config", f))
+	}
+
+	jm := config.NewJSONMergerWithDirectLogging(new(logging.ConsoleErrorLogger), new(config.JSONContentParser))
+	merged, err := jm.LoadAndMergeConfig(files)
+	test.ExpectNil(t, err)
+
+	return &config.Accessor{JSONData: merged, FrameworkLogger: new(logging.NullLogger)}
+}
+
 type mrw struct{}
 
 func (m *mrw) Write(ctx context.Context, state *ws.ProcessState, outcome ws.Outcome) error {
@@ -49,7 +49,10 @@ func (fb *XMLFacilityBuilder) BuildAndRegister(lm *logging.ComponentLoggerManage
 		return errors.New("XMLWs.ResponseMode must be set to either TEMPLATE or MARSHAL")
 	}
 
-	buildRegisterWsDecorator(cc, rw, um, wc, lm)
+	f := &ws.NegotiatedFormat{Name: "XML", ResponseWriter: rw, Unmarshaller: um}
+	ca.SetField("MediaTypes", "XMLWs.MediaTypes", f)
+
+	buildRegisterWsDecorator(cc, f, wc, lm)
 	offerAbnormalStatusWriter(rw.(ws.AbnormalStatusWriter), cc, xmlResponseWriterName)
 
 	return nil
@@ -0,0 +1,97 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/logging"
+	"net/http"
+	"regexp"
+)
+
+// Endpoint is an httpendpoint.Provider that runs a Monitor's liveness or readiness checks and writes the resulting Report
+// as JSON. The response status is 200 if every check passed or 503 if any check failed.
+type Endpoint struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// The monitor that will run the checks.
+	Monitor *Monitor
+
+	// The exact path (e.g. /healthz) this endpoint responds to.
+	Path string
+
+	// If true, the Monitor's readiness checks are run. Otherwise its liveness checks are run.
+	Readiness bool
+
+	// The names of the HTTP listeners this endpoint should be registered with (see the HTTPServer facility). If empty,
+	// the endpoint is registered with the default listener.
+	Listeners []string
+}
+
+// SupportedHTTPMethods returns GET
+func (e *Endpoint) SupportedHTTPMethods() []string {
+	return []string{http.MethodGet}
+}
+
+// RegexPattern returns a pattern that only matches the endpoint's Path
+func (e *Endpoint) RegexPattern() string {
+	return "^" + regexp.QuoteMeta(e.Path) + "$"
+}
+
+// ServeHTTP runs the checks and writes the Report
+func (e *Endpoint) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+
+	var r *Report
+
+	if e.Readiness {
+		r = e.Monitor.Readiness(ctx)
+	} else {
+		r = e.Monitor.Liveness(ctx)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+
+	if r.Healthy() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		e.FrameworkLogger.LogErrorfCtx(ctx, "Unable to write health report: %s", err.Error())
+	}
+
+	return ctx
+}
+
+// VersionAware returns false
+func (e *Endpoint) VersionAware() bool {
+	return false
+}
+
+// SupportsVersion returns true
+func (e *Endpoint) SupportsVersion(version httpendpoint.RequiredVersion) bool {
+	return true
+}
+
+// AutoWireable returns true
+func (e *Endpoint) AutoWireable() bool {
+	return true
+}
+
+// AssignedListeners returns the endpoint's Listeners. Implements httpendpoint.ListenerAssigned
+func (e *Endpoint) AssignedListeners() []string {
+	return e.Listeners
+}
+
+// ServeWhileSuspended returns true so that the application's state can be reported while it is suspended. Implements
+// httpendpoint.AvailableWhileSuspended
+func (e *Endpoint) ServeWhileSuspended() bool {
+	return true
+}
@@ -0,0 +1,351 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package health provides types that report the health and readiness of an application to orchestrators and load balancers.
+
+Most applications will not use the types in this package directly. Instead they will enable the HealthCheck facility
+(see the facility/healthcheck package) which creates a Monitor and registers liveness and readiness endpoints with the
+HTTPServer facility.
+
+The Monitor runs two sets of checks:
+
+	Liveness  - Checks that the application has not stopped. Components that implement LivenessReporter and return
+	            true from AffectsLiveness are also checked.
+	Readiness - Calls CheckHealth on every component that implements ioc.HealthReporter, calls BlockAccess on every
+	            component that implements ioc.AccessibilityBlocker and checks that the application has finished
+	            starting and is not suspended or stopping.
+
+Liveness deliberately ignores the health of external dependencies (such as databases) so that an outage of a dependency
+causes the application to be taken out of service rather than restarted.
+
+Checks are run concurrently and each check is abandoned if it does not complete within the Monitor's CheckTimeoutMS.
+The results are returned as a Report which is serialised to JSON like:
+
+	{
+	  "status": "DOWN",
+	  "checks": [
+		{"name": "grncLifecycle", "status": "UP", "latencyMS": 0.002},
+		{"name": "grncRdbmsClientManager", "status": "DOWN", "latencyMS": 2000.4, "error": "timed out"}
+	  ]
+	}
+*/
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Up indicates that a check (or every check in a Report) passed
+	Up = "UP"
+	// Down indicates that a check (or at least one check in a Report) failed
+	Down = "DOWN"
+
+	// LifecycleCheckName is the name of the liveness and readiness checks that reflect the application's lifecycle state
+	LifecycleCheckName = instance.FrameworkPrefix + "Lifecycle"
+)
+
+// Check is the result of a single check.
+type Check struct {
+	// The name of the component that was checked.
+	Name string `json:"name"`
+
+	// UP or DOWN
+	Status string `json:"status"`
+
+	// How long the check took, in milliseconds.
+	LatencyMS float64 `json:"latencyMS"`
+
+	// The reason the check failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the combined result of a set of checks.
+type Report struct {
+	// UP if every check passed, otherwise DOWN
+	Status string `json:"status"`
+
+	// The individual results, ordered by name.
+	Checks []*Check `json:"checks"`
+}
+
+// Healthy returns true if every check in the report passed.
+func (r *Report) Healthy() bool {
+	return r.Status == Up
+}
+
+// LivenessReporter is implemented by health reporters whose failure means the application can only recover by being
+// restarted. Such reporters are included in liveness checks as well as readiness checks.
+type LivenessReporter interface {
+	ioc.HealthReporter
+
+	// AffectsLiveness returns true if the component should be included in liveness checks.
+	AffectsLiveness() bool
+}
+
+// ContextBlocker may be implemented by an ioc.AccessibilityBlocker that is able to abandon its BlockAccess check
+// when a context is cancelled. If implemented, readiness checks call BlockAccessContext instead of BlockAccess.
+type ContextBlocker interface {
+	// BlockAccessContext behaves like ioc.AccessibilityBlocker.BlockAccess but gives up if the supplied context is
+	// cancelled or its deadline passes.
+	BlockAccessContext(ctx context.Context) (bool, error)
+}
+
+type namedCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Monitor runs liveness and readiness checks against an application's components. A Monitor is also a lifecycle-aware
+// component so that readiness checks can reflect whether the application is starting, suspended or stopping.
+type Monitor struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// How long (in milliseconds) each check is allowed to run before it is considered to have failed. Zero or less
+	// means checks are never timed out.
+	CheckTimeoutMS int
+
+	liveness  []namedCheck
+	readiness []namedCheck
+	state     ioc.ComponentState
+	mutex     sync.RWMutex
+}
+
+// AddReporter includes the supplied component in readiness checks. The component is also included in liveness checks
+// if it implements LivenessReporter and its AffectsLiveness method returns true.
+func (m *Monitor) AddReporter(name string, hr ioc.HealthReporter) {
+
+	nc := namedCheck{name: name, check: hr.CheckHealth}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if lr, found := hr.(LivenessReporter); found && lr.AffectsLiveness() {
+		m.liveness = append(m.liveness, nc)
+	}
+
+	m.readiness = append(m.readiness, nc)
+}
+
+// AddBlocker includes the supplied component in readiness checks. The check fails while the component's BlockAccess
+// method returns true. If the component implements ContextBlocker, its BlockAccessContext method is called instead so that
+// the check can be abandoned when it times out.
+func (m *Monitor) AddBlocker(name string, ab ioc.AccessibilityBlocker) {
+
+	blockAccess := func(ctx context.Context) (bool, error) {
+		return ab.BlockAccess()
+	}
+
+	if cb, found := ab.(ContextBlocker); found {
+		blockAccess = cb.BlockAccessContext
+	}
+
+	nc := namedCheck{name: name, check: func(ctx context.Context) error {
+
+		block, err := blockAccess(ctx)
+
+		if !block {
+			return nil
+		}
+
+		if err == nil {
+			err = errors.New("blocking access (no reason given)")
+		}
+
+		return err
+	}}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.readiness = append(m.readiness, nc)
+}
+
+// Liveness runs every liveness check (including a check that the application has not stopped) and returns the results.
+func (m *Monitor) Liveness(ctx context.Context) *Report {
+
+	m.mutex.RLock()
+	checks := append([]namedCheck{{name: LifecycleCheckName, check: m.checkAlive}}, m.liveness...)
+	m.mutex.RUnlock()
+
+	return m.run(ctx, checks)
+}
+
+// Readiness runs every readiness check (including a check of the application's lifecycle state) and returns the results.
+func (m *Monitor) Readiness(ctx context.Context) *Report {
+
+	m.mutex.RLock()
+	checks := append([]namedCheck{{name: LifecycleCheckName, check: m.checkState}}, m.readiness...)
+	m.mutex.RUnlock()
+
+	return m.run(ctx, checks)
+}
+
+func (m *Monitor) checkAlive(ctx context.Context) error {
+
+	m.mutex.RLock()
+	state := m.state
+	m.mutex.RUnlock()
+
+	if state == ioc.StoppedState {
+		return errors.New("application has stopped")
+	}
+
+	return nil
+}
+
+func (m *Monitor) checkState(ctx context.Context) error {
+
+	m.mutex.RLock()
+	state := m.state
+	m.mutex.RUnlock()
+
+	switch state {
+	case ioc.RunningState:
+		return nil
+	case ioc.SuspendedState:
+		return errors.New("application is suspended")
+	case ioc.StoppingState, ioc.StoppedState:
+		return errors.New("application is stopping")
+	}
+
+	return errors.New("application is starting")
+}
+
+func (m *Monitor) run(ctx context.Context, checks []namedCheck) *Report {
+
+	r := new(Report)
+	r.Status = Up
+	r.Checks = make([]*Check, len(checks))
+
+	if m.CheckTimeoutMS > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(m.CheckTimeoutMS)*time.Millisecond)
+		defer cancel()
+	}
+
+	var wg sync.WaitGroup
+
+	for i, nc := range checks {
+
+		wg.Add(1)
+
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+			r.Checks[i] = m.runCheck(ctx, nc)
+		}(i, nc)
+	}
+
+	wg.Wait()
+
+	for _, c := range r.Checks {
+		if c.Status != Up {
+			r.Status = Down
+		}
+	}
+
+	sort.Slice(r.Checks, func(i, j int) bool { return r.Checks[i].Name < r.Checks[j].Name })
+
+	return r
+}
+
+func (m *Monitor) runCheck(ctx context.Context, nc namedCheck) *Check {
+
+	c := new(Check)
+	c.Name = nc.name
+
+	result := make(chan error, 1)
+	start := time.Now()
+
+	go func() {
+
+		defer func() {
+			if r := recover(); r != nil {
+				m.FrameworkLogger.LogErrorfWithTrace("Panic recovered while checking health of %s: %v", nc.name, r)
+				result <- errors.New("check panicked")
+			}
+		}()
+
+		result <- nc.check(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = errors.New("timed out")
+	}
+
+	c.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+
+	if err != nil {
+		c.Status = Down
+		c.Error = err.Error()
+	} else {
+		c.Status = Up
+	}
+
+	return c
+}
+
+func (m *Monitor) setState(s ioc.ComponentState) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.state = s
+}
+
+// StartComponent marks the application as starting. Readiness checks fail until AllowAccess is called.
+func (m *Monitor) StartComponent() error {
+	m.setState(ioc.StartingState)
+
+	return nil
+}
+
+// AllowAccess marks the application as running.
+func (m *Monitor) AllowAccess() error {
+	m.setState(ioc.RunningState)
+
+	return nil
+}
+
+// Suspend causes readiness checks to fail until Resume is called.
+func (m *Monitor) Suspend() error {
+	m.setState(ioc.SuspendedState)
+
+	return nil
+}
+
+// Resume marks the application as running.
+func (m *Monitor) Resume() error {
+	m.setState(ioc.RunningState)
+
+	return nil
+}
+
+// PrepareToStop causes readiness checks to fail for the remainder of the application's life.
+func (m *Monitor) PrepareToStop() {
+	m.setState(ioc.StoppingState)
+}
+
+// ReadyToStop always returns true, nil
+func (m *Monitor) ReadyToStop() (bool, error) {
+	return true, nil
+}
+
+// Stop causes liveness checks to fail. Always returns nil
+func (m *Monitor) Stop() error {
+	m.setState(ioc.StoppedState)
+
+	return nil
+}
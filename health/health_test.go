@@ -0,0 +1,216 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLivenessAndReadiness(t *testing.T) {
+
+	m := new(Monitor)
+	m.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	m.CheckTimeoutMS = 50
+
+	db := new(mockReporter)
+	blocker := &mockBlocker{block: true}
+
+	m.AddReporter("db", db)
+	m.AddBlocker("cache", blocker)
+
+	test.ExpectNil(t, m.StartComponent())
+
+	r := m.Liveness(context.Background())
+	test.ExpectString(t, r.Status, Up)
+	test.ExpectInt(t, len(r.Checks), 1)
+	test.ExpectString(t, r.Checks[0].Name, LifecycleCheckName)
+
+	r = m.Readiness(context.Background())
+	test.ExpectString(t, r.Status, Down)
+	test.ExpectInt(t, len(r.Checks), 3)
+
+	test.ExpectString(t, r.Checks[0].Name, "cache")
+	test.ExpectString(t, r.Checks[0].Error, "warming")
+	test.ExpectString(t, r.Checks[2].Name, LifecycleCheckName)
+	test.ExpectString(t, r.Checks[2].Error, "application is starting")
+
+	blocker.block = false
+	m.AllowAccess()
+
+	test.ExpectBool(t, m.Readiness(context.Background()).Healthy(), true)
+
+	m.Suspend()
+	test.ExpectBool(t, m.Readiness(context.Background()).Healthy(), false)
+	test.ExpectBool(t, m.Liveness(context.Background()).Healthy(), true)
+
+	m.Resume()
+	test.ExpectBool(t, m.Readiness(context.Background()).Healthy(), true)
+
+	db.err = errors.New("connection refused")
+	test.ExpectBool(t, m.Liveness(context.Background()).Healthy(), true)
+
+	r = m.Readiness(context.Background())
+	test.ExpectString(t, r.Status, Down)
+	test.ExpectString(t, r.Checks[1].Error, "connection refused")
+
+	db.err = nil
+	m.PrepareToStop()
+	test.ExpectBool(t, m.Readiness(context.Background()).Healthy(), false)
+	test.ExpectBool(t, m.Liveness(context.Background()).Healthy(), true)
+
+	m.Stop()
+	test.ExpectBool(t, m.Liveness(context.Background()).Healthy(), false)
+}
+
+func TestLivenessOptIn(t *testing.T) {
+
+	m := new(Monitor)
+	m.FrameworkLogger = new(logging.ConsoleErrorLogger)
+
+	m.AddReporter("db", &mockLivenessReporter{mockReporter{err: errors.New("connection refused")}, false})
+	m.AddReporter("pool", &mockLivenessReporter{mockReporter{err: errors.New("exhausted")}, true})
+
+	r := m.Liveness(context.Background())
+	test.ExpectString(t, r.Status, Down)
+	test.ExpectInt(t, len(r.Checks), 2)
+	test.ExpectString(t, r.Checks[1].Name, "pool")
+	test.ExpectString(t, r.Checks[1].Error, "exhausted")
+
+	test.ExpectInt(t, len(m.Readiness(context.Background()).Checks), 3)
+}
+
+func TestContextBlockerTimeout(t *testing.T) {
+
+	m := new(Monitor)
+	m.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	m.CheckTimeoutMS = 50
+
+	cb := &mockContextBlocker{abandoned: make(chan bool, 1)}
+	m.AddBlocker("db", cb)
+
+	r := m.Readiness(context.Background())
+	test.ExpectString(t, r.Checks[0].Name, "db")
+	test.ExpectString(t, r.Checks[0].Error, "timed out")
+
+	select {
+	case <-cb.abandoned:
+	case <-time.After(time.Second):
+		t.Errorf("BlockAccessContext was not abandoned when the check timed out")
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+
+	m := new(Monitor)
+	m.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	m.CheckTimeoutMS = 50
+
+	m.AddReporter("slow", &mockReporter{delay: time.Second})
+
+	r := m.Readiness(context.Background())
+	test.ExpectString(t, r.Checks[1].Name, "slow")
+	test.ExpectString(t, r.Checks[1].Error, "timed out")
+
+	if r.Checks[1].LatencyMS < 50 || r.Checks[0].LatencyMS > 500 {
+		t.Errorf("Unexpected latency %f", r.Checks[1].LatencyMS)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+
+	m := new(Monitor)
+	m.FrameworkLogger = new(logging.ConsoleErrorLogger)
+	m.AddReporter("db", new(mockReporter))
+
+	e := new(Endpoint)
+	e.FrameworkLogger = m.FrameworkLogger
+	e.Monitor = m
+	e.Path = "/readyz"
+	e.Readiness = true
+
+	test.ExpectString(t, e.RegexPattern(), "^/readyz$")
+	test.ExpectBool(t, e.ServeWhileSuspended(), true)
+
+	res := httptest.NewRecorder()
+	e.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(res), httptest.NewRequest("GET", "/readyz", nil))
+
+	test.ExpectInt(t, res.Code, http.StatusServiceUnavailable)
+
+	m.AllowAccess()
+
+	res = httptest.NewRecorder()
+	e.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(res), httptest.NewRequest("GET", "/readyz", nil))
+
+	test.ExpectInt(t, res.Code, http.StatusOK)
+
+	r := new(Report)
+
+	if err := json.Unmarshal(res.Body.Bytes(), r); err != nil {
+		t.Fatalf("Unable to parse response: %s", err.Error())
+	}
+
+	test.ExpectString(t, r.Status, Up)
+	test.ExpectInt(t, len(r.Checks), 2)
+}
+
+type mockReporter struct {
+	err   error
+	delay time.Duration
+}
+
+func (mr *mockReporter) CheckHealth(ctx context.Context) error {
+
+	if mr.delay > 0 {
+		select {
+		case <-time.After(mr.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return mr.err
+}
+
+type mockBlocker struct {
+	block bool
+}
+
+func (mb *mockBlocker) BlockAccess() (bool, error) {
+
+	if mb.block {
+		return true, errors.New("warming")
+	}
+
+	return false, nil
+}
+
+type mockLivenessReporter struct {
+	mockReporter
+	affectsLiveness bool
+}
+
+func (mr *mockLivenessReporter) AffectsLiveness() bool {
+	return mr.affectsLiveness
+}
+
+type mockContextBlocker struct {
+	abandoned chan bool
+}
+
+func (mb *mockContextBlocker) BlockAccess() (bool, error) {
+	return true, errors.New("BlockAccess should not be called")
+}
+
+func (mb *mockContextBlocker) BlockAccessContext(ctx context.Context) (bool, error) {
+	<-ctx.Done()
+	mb.abandoned <- true
+
+	return true, ctx.Err()
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpendpoint
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type clientIPKey int
+
+const clientIPCtxKey clientIPKey = 0
+
+// WithClientIP returns a copy of the supplied context that records the IP address of the client that made a request. The
+// HTTPServer facility stores the address of each request's client (resolved through any trusted proxies) in this way.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPCtxKey, ip)
+}
+
+// ClientIP returns the IP address of the client that made a request. If an address has been stored in the context
+// with WithClientIP it is returned, otherwise the address of the host connected to the server is taken from the request
+// (which may be nil).
+func ClientIP(ctx context.Context, req *http.Request) string {
+
+	if ip, found := ctx.Value(clientIPCtxKey).(string); found {
+		return ip
+	}
+
+	if req == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
@@ -52,6 +52,29 @@ type Provider interface {
 	AutoWireable() bool
 }
 
+// ListenerAssigned is implemented by Providers that should only be registered with particular named HTTP servers
+// (listeners) when an application runs more than one.
+type ListenerAssigned interface {
+	// AssignedListeners returns the names of the listeners this Provider should be registered with. An empty slice
+	// means the Provider has not been explicitly assigned.
+	AssignedListeners() []string
+}
+
+// AvailableWhileSuspended is implemented by Providers (like health check endpoints) that should continue to serve
+// requests while the HTTP server is suspended.
+type AvailableWhileSuspended interface {
+	// ServeWhileSuspended returns true if requests should be passed to this Provider while the server is suspended.
+	ServeWhileSuspended() bool
+}
+
+// ConnectionCloser is implemented by Providers (like WebSocket handlers) that take over connections from the HTTP server.
+// Those connections are not tracked by the server, so the server asks the Provider to close them when the server is
+// suspended or stopped.
+type ConnectionCloser interface {
+	// CloseConnections closes any connections the Provider has taken over from the HTTP server.
+	CloseConnections()
+}
+
 // RequiredVersion is a semi-structured type to allow applications flexibility in defining what a 'version' is.
 type RequiredVersion map[string]interface{}
 
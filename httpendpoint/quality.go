@@ -0,0 +1,42 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package httpendpoint
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseQualityValue splits an element of a header like Accept or Accept-Encoding into its lower-cased value and its
+// q-value (defaulting to 1). The q parameter's name is case-insensitive and its value is limited to the range 0 to 1,
+// with values that are not numbers treated as 0. Parameters other than q are discarded.
+func ParseQualityValue(part string) (string, float64) {
+
+	params := strings.Split(part, ";")
+	value := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+
+	for _, p := range params[1:] {
+
+		p = strings.TrimSpace(p)
+
+		if len(p) < 2 || !strings.EqualFold(p[:2], "q=") {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(p[2:], 64)
+
+		switch {
+		case err != nil || math.IsNaN(f) || f < 0:
+			q = 0
+		case f > 1:
+			q = 1
+		default:
+			q = f
+		}
+	}
+
+	return value, q
+}
@@ -0,0 +1,40 @@
+package httpendpoint
+
+import (
+	"github.com/graniticio/granitic/v2/test"
+	"testing"
+)
+
+func TestParseQualityValue(t *testing.T) {
+
+	v, q := ParseQualityValue(" Text/HTML ; level=1 ")
+	test.ExpectString(t, v, "text/html")
+	test.ExpectBool(t, q == 1, true)
+
+	v, q = ParseQualityValue("gzip;q=0.5")
+	test.ExpectString(t, v, "gzip")
+	test.ExpectBool(t, q == 0.5, true)
+
+	_, q = ParseQualityValue("gzip; Q=0.3")
+	test.ExpectBool(t, q == 0.3, true)
+}
+
+func TestParseQualityValueClamped(t *testing.T) {
+
+	for header, expected := range map[string]float64{
+		"gzip;q=5":      1,
+		"gzip;q=1.5":    1,
+		"gzip;q=-0.5":   0,
+		"gzip;q=abc":    0,
+		"gzip;q=":       0,
+		"gzip;q=NaN":    0,
+		"gzip;q=+Inf":   1,
+		"gzip;Q=-Inf":   0,
+		"gzip;q=0.001":  0.001,
+		"gzip;quux=0.1": 1,
+	} {
+		if _, q := ParseQualityValue(header); q != expected {
+			t.Errorf("Expected %s to have a q-value of %f, got %f", header, expected, q)
+		}
+	}
+}
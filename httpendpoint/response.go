@@ -3,7 +3,12 @@
 
 package httpendpoint
 
-import "net/http"
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
 
 // HTTPResponseWriter is a wrapper over http.ResponseWriter that provides Granitic with better visibility on the state of response writing.
 type HTTPResponseWriter struct {
@@ -33,18 +38,30 @@ func (w *HTTPResponseWriter) Write(b []byte) (int, error) {
 }
 
 // WriteHeader sets the HTTP status code of the HTTP response. If this method is called more than once,
-// only the first value is sent to the underlying HTTP response.
+// only the first value is sent to the underlying HTTP response. Informational (1xx) statuses other than
+// 101 Switching Protocols are sent straight to the underlying HTTP response and do not count as the response's status.
 func (w *HTTPResponseWriter) WriteHeader(i int) {
 
 	if w.DataSent {
 		return
 	}
 
+	if Informational(i) {
+		w.rw.WriteHeader(i)
+		return
+	}
+
 	w.Status = i
 	w.rw.WriteHeader(i)
 	w.DataSent = true
 }
 
+// Informational returns true if the supplied status is a 1xx status that may be followed by the final status of the
+// response (i.e. any 1xx status other than 101 Switching Protocols).
+func Informational(status int) bool {
+	return status >= http.StatusContinue && status < http.StatusOK && status != http.StatusSwitchingProtocols
+}
+
 // NewHTTPResponseWriter creates a new HTTPResponseWriter wrapping the supplied http.ResponseWriter
 func NewHTTPResponseWriter(rw http.ResponseWriter) *HTTPResponseWriter {
 	w := new(HTTPResponseWriter)
@@ -52,3 +69,35 @@ func NewHTTPResponseWriter(rw http.ResponseWriter) *HTTPResponseWriter {
 
 	return w
 }
+
+// Flush sends any buffered data to the client if the underlying http.ResponseWriter supports flushing (see http.Flusher).
+// If no status has been sent, the response is given a status of 200.
+func (w *HTTPResponseWriter) Flush() {
+
+	if !w.DataSent {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if f, found := w.rw.(http.Flusher); found {
+		f.Flush()
+	}
+}
+
+// Hijack allows the caller to take over the connection (see http.Hijacker) if the underlying http.ResponseWriter
+// supports it. Used by Providers that switch protocols (e.g. to WebSockets).
+func (w *HTTPResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+
+	h, found := w.rw.(http.Hijacker)
+
+	if !found {
+		return nil, nil, errors.New("the underlying response does not support taking over the connection")
+	}
+
+	c, rw, err := h.Hijack()
+
+	if err == nil {
+		w.DataSent = true
+	}
+
+	return c, rw, err
+}
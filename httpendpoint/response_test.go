@@ -29,8 +29,32 @@ func TestWritethrough(t *testing.T) {
 
 }
 
+func TestInformationalStatusPassedThrough(t *testing.T) {
+	rw := new(HTTPResponseWriter)
+
+	under := new(resWriter)
+	rw.rw = under
+
+	rw.WriteHeader(http.StatusEarlyHints)
+
+	if rw.DataSent || rw.Status != 0 {
+		t.Errorf("Informational status should not be recorded as the response status")
+	}
+
+	rw.WriteHeader(http.StatusCreated)
+
+	if rw.Status != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, rw.Status)
+	}
+
+	if len(under.statuses) != 2 || under.statuses[0] != http.StatusEarlyHints || under.statuses[1] != http.StatusCreated {
+		t.Errorf("Unexpected statuses sent %v", under.statuses)
+	}
+}
+
 type resWriter struct {
-	sw bytes.Buffer
+	sw       bytes.Buffer
+	statuses []int
 }
 
 func (rw *resWriter) Header() http.Header {
@@ -42,5 +66,5 @@ func (rw *resWriter) Write(b []byte) (int, error) {
 }
 
 func (rw *resWriter) WriteHeader(statusCode int) {
-
+	rw.statuses = append(rw.statuses, statusCode)
 }
@@ -0,0 +1,102 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package instrument
+
+import (
+	"context"
+	"net/http"
+)
+
+// Combine returns a RequestInstrumentationManager that passes each request to all of the supplied managers (in order).
+// The Instrumentor stored in the request's context passes events, forks and amendments to the Instrumentor created by
+// each manager.
+func Combine(managers ...RequestInstrumentationManager) RequestInstrumentationManager {
+
+	cm := new(combinedManager)
+
+	for _, m := range managers {
+
+		if c, found := m.(*combinedManager); found {
+			// Flatten previously combined managers
+			cm.managers = append(cm.managers, c.managers...)
+		} else if m != nil {
+			cm.managers = append(cm.managers, m)
+		}
+	}
+
+	return cm
+}
+
+type combinedManager struct {
+	managers []RequestInstrumentationManager
+}
+
+// Begin starts instrumentation with each manager in turn
+func (cm *combinedManager) Begin(ctx context.Context, res http.ResponseWriter, req *http.Request) (context.Context, Instrumentor, func()) {
+
+	ci := &combinedInstrumentor{make([]Instrumentor, len(cm.managers))}
+	ends := make([]func(), len(cm.managers))
+
+	for i, m := range cm.managers {
+		ctx, ci.instrumentors[i], ends[i] = m.Begin(ctx, res, req)
+	}
+
+	end := func() {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i]()
+		}
+	}
+
+	return AddInstrumentorToContext(ctx, ci), ci, end
+}
+
+type combinedInstrumentor struct {
+	instrumentors []Instrumentor
+}
+
+func (ci *combinedInstrumentor) StartEvent(id string, metadata ...interface{}) EndEvent {
+
+	ends := make([]EndEvent, len(ci.instrumentors))
+
+	for i, ri := range ci.instrumentors {
+		ends[i] = ri.StartEvent(id, metadata...)
+	}
+
+	return func() {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i]()
+		}
+	}
+}
+
+func (ci *combinedInstrumentor) Fork(ctx context.Context) (context.Context, Instrumentor) {
+
+	forked := &combinedInstrumentor{make([]Instrumentor, len(ci.instrumentors))}
+
+	for i, ri := range ci.instrumentors {
+		ctx, forked.instrumentors[i] = ri.Fork(ctx)
+	}
+
+	return AddInstrumentorToContext(ctx, forked), forked
+}
+
+func (ci *combinedInstrumentor) Integrate(instrumentor Instrumentor) {
+
+	forked, found := instrumentor.(*combinedInstrumentor)
+
+	if !found || len(forked.instrumentors) != len(ci.instrumentors) {
+		return
+	}
+
+	for i, ri := range ci.instrumentors {
+		ri.Integrate(forked.instrumentors[i])
+	}
+}
+
+func (ci *combinedInstrumentor) Amend(additional Additional, value interface{}) {
+
+	for _, ri := range ci.instrumentors {
+		ri.Amend(additional, value)
+	}
+}
@@ -0,0 +1,83 @@
+package instrument
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+
+	var log []string
+
+	a := &loggingManager{name: "a", log: &log}
+	b := &loggingManager{name: "b", log: &log}
+
+	m := Combine(Combine(a), nil, b)
+
+	ctx, ri, end := m.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+
+	test.ExpectBool(t, InstrumentorFromContext(ctx) == ri, true)
+
+	Event(ctx, "e")()
+
+	fctx, forked := ri.Fork(ctx)
+	Event(fctx, "f")()
+	ri.Integrate(forked)
+
+	ri.Amend(RequestID, "id")
+
+	end()
+
+	expected := []string{"a begin", "b begin", "a start e", "b start e", "b end e", "a end e", "a fork", "b fork",
+		"a start f", "b start f", "b end f", "a end f", "a integrate", "b integrate", "a amend", "b amend", "b end", "a end"}
+
+	test.ExpectInt(t, len(log), len(expected))
+
+	for i, e := range expected {
+		test.ExpectString(t, log[i], e)
+	}
+}
+
+type loggingManager struct {
+	name string
+	log  *[]string
+}
+
+func (lm *loggingManager) Begin(ctx context.Context, res http.ResponseWriter, req *http.Request) (context.Context, Instrumentor, func()) {
+	lm.add("begin")
+
+	li := &loggingInstrumentor{lm}
+
+	return AddInstrumentorToContext(ctx, li), li, func() { lm.add("end") }
+}
+
+func (lm *loggingManager) add(s string) {
+	*lm.log = append(*lm.log, lm.name+" "+s)
+}
+
+type loggingInstrumentor struct {
+	lm *loggingManager
+}
+
+func (li *loggingInstrumentor) StartEvent(id string, metadata ...interface{}) EndEvent {
+	li.lm.add("start " + id)
+
+	return func() { li.lm.add("end " + id) }
+}
+
+func (li *loggingInstrumentor) Fork(ctx context.Context) (context.Context, Instrumentor) {
+	li.lm.add("fork")
+
+	return ctx, li
+}
+
+func (li *loggingInstrumentor) Integrate(instrumentor Instrumentor) {
+	li.lm.add("integrate")
+}
+
+func (li *loggingInstrumentor) Amend(additional Additional, value interface{}) {
+	li.lm.add("amend")
+}
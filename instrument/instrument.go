@@ -22,6 +22,10 @@ const (
 	UserIdentity
 	//Handler is he handler that is processing the request (*ws.Handler)
 	Handler
+	//Trace marks the request's W3C trace context (*tracecontext.Context)
+	Trace
+	//ResponseStatus marks the HTTP status code (int) sent to the caller. Supplied just before instrumentation ends
+	ResponseStatus
 )
 
 // Instrumentor is implemented by types that can add additional information to a request that is being instrumented in
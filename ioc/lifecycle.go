@@ -4,6 +4,7 @@
 package ioc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/graniticio/granitic/v2/instance"
@@ -90,6 +91,17 @@ type AccessibilityBlocker interface {
 	BlockAccess() (bool, error)
 }
 
+/*
+HealthReporter is implemented by components that are able to report whether or not they are currently able to perform
+their primary function (for example a database client manager checking that its database can be reached). The results
+are made available to orchestrators and load balancers by the HealthCheck facility.
+*/
+type HealthReporter interface {
+	// CheckHealth returns an error describing the problem if the component is unhealthy, or nil if it is healthy.
+	// Implementations should abandon the check if the supplied context is cancelled or its deadline passes.
+	CheckHealth(ctx context.Context) error
+}
+
 /*
 Accessible is implemented by components that require a final phase of initialisation to make themselves outside of the application.
 Typically implemented by HTTP servers and message queue listeners to start listening on TCP ports.
@@ -0,0 +1,54 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package logging
+
+import "context"
+
+const (
+	// RequestIDField is the name under which a request's unique ID is stored as a correlation ID
+	RequestIDField = "requestID"
+
+	// TraceIDField is the name under which a request's W3C trace ID is stored as a correlation ID
+	TraceIDField = "traceID"
+
+	// SpanIDField is the name under which the ID of the span representing the application's handling of a request is stored
+	// as a correlation ID
+	SpanIDField = "spanID"
+
+	// ParentSpanIDField is the name under which the ID of the caller's span is stored as a correlation ID
+	ParentSpanIDField = "parentSpanID"
+)
+
+type correlationKey int
+
+const correlationCtxKey correlationKey = 0
+
+// AddCorrelationID returns a copy of the supplied context with an additional identifier (a request or trace ID, for example)
+// that allows log lines to be associated with a request. Correlation IDs are available to LogMessageFormatter and
+// access log formats using the %{name}X verb.
+func AddCorrelationID(ctx context.Context, name, value string) context.Context {
+
+	existing := CorrelationIDs(ctx)
+
+	ids := make(FilteredContextData, len(existing)+1)
+
+	for k, v := range existing {
+		ids[k] = v
+	}
+
+	ids[name] = value
+
+	return context.WithValue(ctx, correlationCtxKey, ids)
+}
+
+// CorrelationIDs returns the identifiers stored in the context with AddCorrelationID or nil if there are none. The
+// returned map must not be modified.
+func CorrelationIDs(ctx context.Context) FilteredContextData {
+
+	if ids, found := ctx.Value(correlationCtxKey).(FilteredContextData); found {
+		return ids
+	}
+
+	return nil
+}
@@ -185,6 +185,10 @@ func (lmf *LogMessageFormatter) ctxValue(ctx context.Context, fcd FilteredContex
 
 		result = fcd[key]
 
+	} else if id := CorrelationIDs(ctx)[key]; id != "" {
+
+		result = id
+
 	} else if v := ctx.Value(key); v != nil {
 
 		result = fmt.Sprintf("%v", v)
@@ -38,3 +38,19 @@ func TestPlaceHolders(t *testing.T) {
 	test.ExpectString(t, m, "INFO  INFO I NAME % - MESSAGE\n")
 
 }
+
+func TestCorrelationIDPlaceholders(t *testing.T) {
+
+	lf := new(LogMessageFormatter)
+	lf.Unset = "-"
+	lf.PrefixFormat = "[%{requestID}X %{traceID}X] "
+
+	err := lf.Init()
+	test.ExpectNil(t, err)
+
+	ctx := AddCorrelationID(context.Background(), RequestIDField, "REQ1")
+	traced := AddCorrelationID(ctx, TraceIDField, "TRACE1")
+
+	test.ExpectString(t, lf.Format(ctx, "INFO", "NAME", "MESSAGE"), "[REQ1 -] MESSAGE\n")
+	test.ExpectString(t, lf.Format(traced, "INFO", "NAME", "MESSAGE"), "[REQ1 TRACE1] MESSAGE\n")
+}
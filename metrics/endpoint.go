@@ -0,0 +1,80 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package metrics
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/logging"
+	"net/http"
+	"regexp"
+)
+
+// Endpoint is an httpendpoint.Provider that writes the contents of a Registry in the Prometheus text exposition format.
+type Endpoint struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// The registry whose metrics will be written.
+	Registry *Registry
+
+	// The exact path (e.g. /metrics) this endpoint responds to.
+	Path string
+
+	// The names of the HTTP listeners this endpoint should be registered with (see the HTTPServer facility). If empty,
+	// the endpoint is registered with the default listener.
+	Listeners []string
+}
+
+// SupportedHTTPMethods returns GET
+func (e *Endpoint) SupportedHTTPMethods() []string {
+	return []string{http.MethodGet}
+}
+
+// RegexPattern returns a pattern that only matches the endpoint's Path
+func (e *Endpoint) RegexPattern() string {
+	return "^" + regexp.QuoteMeta(e.Path) + "$"
+}
+
+// ServeHTTP writes the Registry's metrics
+func (e *Endpoint) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("Cache-Control", "no-store")
+
+	w.WriteHeader(http.StatusOK)
+
+	if err := e.Registry.Write(w); err != nil {
+		e.FrameworkLogger.LogErrorfCtx(ctx, "Unable to write metrics: %s", err.Error())
+	}
+
+	return ctx
+}
+
+// VersionAware returns false
+func (e *Endpoint) VersionAware() bool {
+	return false
+}
+
+// SupportsVersion returns true
+func (e *Endpoint) SupportsVersion(version httpendpoint.RequiredVersion) bool {
+	return true
+}
+
+// AutoWireable returns true
+func (e *Endpoint) AutoWireable() bool {
+	return true
+}
+
+// AssignedListeners returns the endpoint's Listeners. Implements httpendpoint.ListenerAssigned
+func (e *Endpoint) AssignedListeners() []string {
+	return e.Listeners
+}
+
+// ServeWhileSuspended returns true so that metrics can still be collected while the application is suspended. Implements
+// httpendpoint.AvailableWhileSuspended
+func (e *Endpoint) ServeWhileSuspended() bool {
+	return true
+}
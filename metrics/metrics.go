@@ -0,0 +1,429 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package metrics provides counters, gauges and histograms that can be exported in the Prometheus text exposition format.
+
+Most applications will not create the types in this package directly. Instead they will enable the Metrics facility (see
+the facility/metrics package) which creates a Registry, records the count, latency and concurrency of every web service
+request and serves the contents of the Registry over HTTP for a Prometheus server (or compatible agent) to scrape.
+
+Application metrics
+
+Components can record their own metrics by declaring a field of type *metrics.Registry named MetricsRegistry (the
+Metrics facility injects its Registry into fields with this name) and creating metrics when they start:
+
+	type StockChecker struct {
+		MetricsRegistry *metrics.Registry
+		lookups         *metrics.Counter
+	}
+
+	func (sc *StockChecker) StartComponent() error {
+		c, err := sc.MetricsRegistry.Counter("stock_lookups_total", "Stock lookups by warehouse and outcome.", "warehouse", "outcome")
+
+		sc.lookups = c
+
+		return err
+	}
+
+	func (sc *StockChecker) check(warehouse string) {
+		...
+		sc.lookups.Inc(warehouse, "found")
+	}
+
+Label values are supplied (in the same order as the label names the metric was created with) each time a metric is
+updated. Supplying the wrong number of label values is a programming error and causes a panic.
+
+Each distinct combination of label values creates a new time series, so label values should be taken from a small,
+fixed set (never user IDs, request IDs or raw paths).
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	counterType   = "counter"
+	gaugeType     = "gauge"
+	histogramType = "histogram"
+
+	// Separates label values when they are combined into a key
+	keySeparator = "\xff"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the buckets used by histograms that record durations when no
+// other buckets are specified.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var validName = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+var validLabel = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// Registry holds a set of uniquely named metrics and writes their current values in the Prometheus text exposition
+// format. A Registry is safe for concurrent use.
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	r := new(Registry)
+	r.families = make(map[string]*family)
+
+	return r
+}
+
+// Counter creates (or returns the existing) counter with the supplied name. A counter's value can only increase. An
+// error is returned if the name or label names are invalid or if a different type of metric (or a counter with
+// different label names) has already been registered with the same name.
+func (r *Registry) Counter(name, help string, labelNames ...string) (*Counter, error) {
+
+	f, err := r.register(name, help, counterType, nil, labelNames)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Counter{f}, nil
+}
+
+// Gauge creates (or returns the existing) gauge with the supplied name. A gauge's value can increase and decrease. An
+// error is returned under the same conditions as Counter.
+func (r *Registry) Gauge(name, help string, labelNames ...string) (*Gauge, error) {
+
+	f, err := r.register(name, help, gaugeType, nil, labelNames)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Gauge{f}, nil
+}
+
+// Histogram creates (or returns the existing) histogram with the supplied name. Observations are counted in buckets
+// with the supplied upper bounds, which must be in increasing order. If buckets is empty, DefaultBuckets are used. An
+// error is returned under the same conditions as Counter or if the buckets are not in increasing order.
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) (*Histogram, error) {
+
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	for i, b := range buckets {
+
+		if math.IsNaN(b) || (i > 0 && b <= buckets[i-1]) {
+			return nil, fmt.Errorf("buckets for histogram %s must be in increasing order", name)
+		}
+	}
+
+	if buckets[len(buckets)-1] != math.Inf(1) {
+		buckets = append(append([]float64{}, buckets...), math.Inf(1))
+	}
+
+	for _, l := range labelNames {
+		if l == "le" {
+			return nil, fmt.Errorf("histogram %s cannot use the reserved label name le", name)
+		}
+	}
+
+	f, err := r.register(name, help, histogramType, buckets, labelNames)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Histogram{f}, nil
+}
+
+func (r *Registry) register(name, help, kind string, buckets []float64, labelNames []string) (*family, error) {
+
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("%s is not a valid metric name", name)
+	}
+
+	for _, l := range labelNames {
+		if !validLabel.MatchString(l) || strings.HasPrefix(l, "__") {
+			return nil, fmt.Errorf("%s is not a valid label name for metric %s", l, name)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.families == nil {
+		r.families = make(map[string]*family)
+	}
+
+	if f := r.families[name]; f != nil {
+
+		if f.kind != kind || strings.Join(f.labelNames, ",") != strings.Join(labelNames, ",") {
+			return nil, fmt.Errorf("a %s named %s with labels %v is already registered", f.kind, name, f.labelNames)
+		}
+
+		return f, nil
+	}
+
+	f := new(family)
+	f.name = name
+	f.help = help
+	f.kind = kind
+	f.buckets = buckets
+	f.labelNames = append([]string{}, labelNames...)
+	f.series = make(map[string]*series)
+
+	r.families[name] = f
+
+	return f, nil
+}
+
+// Write writes the current value of every metric in the Registry to the supplied Writer in the Prometheus text exposition
+// format. Metrics are written in name order.
+func (r *Registry) Write(w io.Writer) error {
+
+	r.mutex.Lock()
+
+	families := make([]*family, 0, len(r.families))
+
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+
+	r.mutex.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		f.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Counter is a metric whose value only increases (e.g. the number of requests processed).
+type Counter struct {
+	f *family
+}
+
+// Inc adds one to the counter with the supplied label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the supplied value to the counter with the supplied label values. Negative values are ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+
+	if v < 0 {
+		return
+	}
+
+	c.f.update(labelValues, func(s *series) {
+		s.value += v
+	})
+}
+
+// Gauge is a metric whose value can increase and decrease (e.g. the number of requests currently being processed).
+type Gauge struct {
+	f *family
+}
+
+// Set sets the value of the gauge with the supplied label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) {
+		s.value = v
+	})
+}
+
+// Add adds the supplied (possibly negative) value to the gauge with the supplied label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) {
+		s.value += v
+	})
+}
+
+// Inc adds one to the gauge with the supplied label values.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec subtracts one from the gauge with the supplied label values.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations (e.g. request durations) in configurable buckets and keeps a running total of the
+// observed values.
+type Histogram struct {
+	f *family
+}
+
+// Observe records a value in the histogram with the supplied label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+
+	i := sort.SearchFloat64s(h.f.buckets, v)
+
+	h.f.update(labelValues, func(s *series) {
+
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+
+		if i < len(s.counts) {
+			s.counts[i]++
+		}
+
+		s.count++
+		s.sum += v
+	})
+}
+
+// family is all of the time series (one per distinct combination of label values) for one metric
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+
+	// Counters and gauges
+	value float64
+
+	// Histograms - counts holds the number of observations in each bucket (not cumulative)
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (f *family) update(labelValues []string, op func(s *series)) {
+
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s requires %d label values but %d were supplied", f.name, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, keySeparator)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	s := f.series[key]
+
+	if s == nil {
+		s = new(series)
+		s.labelValues = append([]string{}, labelValues...)
+		f.series[key] = s
+	}
+
+	op(s)
+}
+
+func (f *family) write(w *bufio.Writer) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.help != "" {
+		w.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	}
+
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+
+	keys := make([]string, 0, len(f.series))
+
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		s := f.series[k]
+
+		if f.kind != histogramType {
+			w.WriteString(f.name + labelPairs(f.labelNames, s.labelValues, "") + " " + formatFloat(s.value) + "\n")
+			continue
+		}
+
+		var cumulative uint64
+
+		for i, b := range f.buckets {
+
+			if s.counts != nil {
+				cumulative += s.counts[i]
+			}
+
+			le := "le=\"" + formatFloat(b) + "\""
+
+			w.WriteString(f.name + "_bucket" + labelPairs(f.labelNames, s.labelValues, le) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+
+		l := labelPairs(f.labelNames, s.labelValues, "")
+
+		w.WriteString(f.name + "_sum" + l + " " + formatFloat(s.sum) + "\n")
+		w.WriteString(f.name + "_count" + l + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+func labelPairs(names, values []string, extra string) string {
+
+	if len(names) == 0 && extra == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+
+	for i, n := range names {
+		pairs = append(pairs, n+"=\""+escapeLabelValue(values[i])+"\"")
+	}
+
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+
+	r := NewRegistry()
+
+	c, err := r.Counter("jobs_total", "Jobs run.\nBy outcome.", "outcome")
+	test.ExpectNil(t, err)
+
+	g, err := r.Gauge("queue_depth", "")
+	test.ExpectNil(t, err)
+
+	h, err := r.Histogram("job_seconds", "Job duration.", []float64{0.5, 1}, "queue")
+	test.ExpectNil(t, err)
+
+	c.Inc("ok")
+	c.Add(2.5, "ok")
+	c.Add(-1, "ok")
+	c.Inc("say \"hi\"\\")
+
+	g.Set(7)
+	g.Dec()
+
+	h.Observe(0.2, "a")
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+
+	var b bytes.Buffer
+	test.ExpectNil(t, r.Write(&b))
+
+	expected := `# HELP job_seconds Job duration.
+# TYPE job_seconds histogram
+job_seconds_bucket{queue="a",le="0.5"} 2
+job_seconds_bucket{queue="a",le="1"} 2
+job_seconds_bucket{queue="a",le="+Inf"} 3
+job_seconds_sum{queue="a"} 3.7
+job_seconds_count{queue="a"} 3
+# HELP jobs_total Jobs run.\nBy outcome.
+# TYPE jobs_total counter
+jobs_total{outcome="ok"} 3.5
+jobs_total{outcome="say \"hi\"\\"} 1
+# TYPE queue_depth gauge
+queue_depth 6
+`
+
+	test.ExpectString(t, b.String(), expected)
+}
+
+func TestRegistration(t *testing.T) {
+
+	r := NewRegistry()
+
+	c1, err := r.Counter("requests", "", "a")
+	test.ExpectNil(t, err)
+
+	// Registering the same metric again returns the same series
+	c2, err := r.Counter("requests", "", "a")
+	test.ExpectNil(t, err)
+
+	c1.Inc("x")
+	c2.Inc("x")
+
+	var b bytes.Buffer
+	r.Write(&b)
+
+	if !strings.Contains(b.String(), `requests{a="x"} 2`) {
+		t.Errorf("Expected shared counter, got %s", b.String())
+	}
+
+	invalid := []func() error{
+		func() error { _, err := r.Gauge("requests", "", "a"); return err },
+		func() error { _, err := r.Counter("requests", "", "b"); return err },
+		func() error { _, err := r.Counter("2fast", ""); return err },
+		func() error { _, err := r.Counter("ok", "", "bad-label"); return err },
+		func() error { _, err := r.Counter("ok", "", "__reserved"); return err },
+		func() error { _, err := r.Histogram("hist", "", []float64{1, 0.5}); return err },
+		func() error { _, err := r.Histogram("hist", "", nil, "le"); return err },
+	}
+
+	for i, f := range invalid {
+		if f() == nil {
+			t.Errorf("Expected error from invalid registration %d", i)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic when wrong number of label values supplied")
+		}
+	}()
+
+	c1.Inc()
+}
+
+func TestRequestMetrics(t *testing.T) {
+
+	rm := new(RequestMetrics)
+	test.ExpectNil(t, rm.StartComponent())
+
+	ctx, ri, end := rm.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+
+	test.ExpectBool(t, instrument.InstrumentorFromContext(ctx) == ri, true)
+
+	ri.Amend(instrument.Handler, &namedHandler{"artistHandler"})
+
+	var b bytes.Buffer
+	rm.Registry.Write(&b)
+
+	expectLine(t, b.String(), `http_requests_in_flight{handler="",method="GET"} 0`)
+	expectLine(t, b.String(), `http_requests_in_flight{handler="artistHandler",method="GET"} 1`)
+
+	ri.Amend(instrument.ResponseStatus, http.StatusNotFound)
+	end()
+	end()
+
+	_, _, end = rm.Begin(context.Background(), nil, httptest.NewRequest("BREW", "/", nil))
+	end()
+
+	b.Reset()
+	rm.Registry.Write(&b)
+
+	expectLine(t, b.String(), `http_requests_in_flight{handler="artistHandler",method="GET"} 0`)
+	expectLine(t, b.String(), `http_requests_total{handler="artistHandler",method="GET",status="404"} 1`)
+	expectLine(t, b.String(), `http_requests_total{handler="",method="OTHER",status="200"} 1`)
+	expectLine(t, b.String(), `http_request_duration_seconds_count{handler="artistHandler",method="GET",status="404"} 1`)
+}
+
+func TestEndpoint(t *testing.T) {
+
+	r := NewRegistry()
+	g, _ := r.Gauge("up", "")
+	g.Set(1)
+
+	e := &Endpoint{Registry: r, Path: "/metrics"}
+
+	test.ExpectString(t, e.RegexPattern(), "^/metrics$")
+	test.ExpectBool(t, e.ServeWhileSuspended(), true)
+
+	res := httptest.NewRecorder()
+	e.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(res), httptest.NewRequest("GET", "/metrics", nil))
+
+	test.ExpectInt(t, res.Code, http.StatusOK)
+	test.ExpectString(t, res.Header().Get("Content-Type"), ContentType)
+	test.ExpectString(t, res.Body.String(), "# TYPE up gauge\nup 1\n")
+}
+
+func expectLine(t *testing.T, exposition, line string) {
+
+	for _, l := range strings.Split(exposition, "\n") {
+		if l == line {
+			return
+		}
+	}
+
+	t.Errorf("Expected line %s in\n%s", line, exposition)
+}
+
+type namedHandler struct {
+	name string
+}
+
+func (nh *namedHandler) ComponentName() string {
+	return nh.name
+}
+
+func (nh *namedHandler) SetComponentName(name string) {
+	nh.name = name
+}
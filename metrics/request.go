@@ -0,0 +1,167 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package metrics
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/ioc"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RequestsMetric is the name of the counter recording the number of requests processed
+	RequestsMetric = "http_requests_total"
+
+	// DurationMetric is the name of the histogram recording how long requests took to process (in seconds)
+	DurationMetric = "http_request_duration_seconds"
+
+	// InFlightMetric is the name of the gauge recording how many requests are currently being processed
+	InFlightMetric = "http_requests_in_flight"
+
+	otherMethod = "OTHER"
+)
+
+// RequestMetrics is an implementation of instrument.RequestInstrumentationManager that records the number of requests
+// processed, how long they took and how many are currently being processed in a Registry.
+//
+// Requests are labelled with the name of the handler that processed them (see instrument.Handler), the HTTP method and
+// (once processing has finished) the HTTP status code sent to the caller. Requests that were not processed by a handler
+// that identifies itself have an empty handler label.
+type RequestMetrics struct {
+	// The Registry that metrics will be recorded in.
+	Registry *Registry
+
+	// The upper bounds (in seconds) of the buckets used by the duration histogram. If empty, DefaultBuckets are used.
+	DurationBuckets []float64
+
+	requests *Counter
+	duration *Histogram
+	inFlight *Gauge
+}
+
+// Begin starts timing the request and stores an Instrumentor in the returned context. The returned function must be
+// called when the request has been processed.
+func (rm *RequestMetrics) Begin(ctx context.Context, res http.ResponseWriter, req *http.Request) (context.Context, instrument.Instrumentor, func()) {
+
+	ri := new(requestInstrumentor)
+	ri.metrics = rm
+	ri.method = knownMethod(req.Method)
+	ri.status = http.StatusOK
+	ri.started = time.Now()
+
+	rm.inFlight.Inc(ri.handler, ri.method)
+
+	return instrument.AddInstrumentorToContext(ctx, ri), ri, ri.end
+}
+
+// StartComponent creates the metrics that requests are recorded in.
+func (rm *RequestMetrics) StartComponent() error {
+
+	if rm.requests != nil {
+		return nil
+	}
+
+	if rm.Registry == nil {
+		rm.Registry = NewRegistry()
+	}
+
+	var err error
+
+	if rm.requests, err = rm.Registry.Counter(RequestsMetric, "The number of HTTP requests processed.", "handler", "method", "status"); err != nil {
+		return err
+	}
+
+	if rm.duration, err = rm.Registry.Histogram(DurationMetric, "How long HTTP requests took to process, in seconds.", rm.DurationBuckets, "handler", "method", "status"); err != nil {
+		return err
+	}
+
+	rm.inFlight, err = rm.Registry.Gauge(InFlightMetric, "The number of HTTP requests currently being processed.", "handler", "method")
+
+	return err
+}
+
+// knownMethod stops callers creating a new time series for each made-up method they send
+func knownMethod(m string) string {
+
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+
+	return otherMethod
+}
+
+// requestInstrumentor records the outcome of a single request. Sub-events are not recorded.
+type requestInstrumentor struct {
+	metrics *RequestMetrics
+	started time.Time
+	method  string
+
+	mutex   sync.Mutex
+	handler string
+	status  int
+	ended   bool
+}
+
+func (ri *requestInstrumentor) StartEvent(id string, metadata ...interface{}) instrument.EndEvent {
+	return func() {}
+}
+
+func (ri *requestInstrumentor) Fork(ctx context.Context) (context.Context, instrument.Instrumentor) {
+	return ctx, ri
+}
+
+func (ri *requestInstrumentor) Integrate(instrumentor instrument.Instrumentor) {
+}
+
+func (ri *requestInstrumentor) Amend(additional instrument.Additional, value interface{}) {
+
+	ri.mutex.Lock()
+	defer ri.mutex.Unlock()
+
+	if ri.ended {
+		return
+	}
+
+	switch additional {
+	case instrument.Handler:
+
+		if cn, found := value.(ioc.ComponentNamer); found && cn.ComponentName() != ri.handler {
+			// Move the request to the in-flight count for the handler that is now processing it
+			ri.metrics.inFlight.Dec(ri.handler, ri.method)
+			ri.handler = cn.ComponentName()
+			ri.metrics.inFlight.Inc(ri.handler, ri.method)
+		}
+
+	case instrument.ResponseStatus:
+
+		if s, found := value.(int); found {
+			ri.status = s
+		}
+	}
+}
+
+func (ri *requestInstrumentor) end() {
+
+	ri.mutex.Lock()
+	defer ri.mutex.Unlock()
+
+	if ri.ended {
+		return
+	}
+
+	ri.ended = true
+
+	m := ri.metrics
+	status := strconv.Itoa(ri.status)
+
+	m.inFlight.Dec(ri.handler, ri.method)
+	m.requests.Inc(ri.handler, ri.method, status)
+	m.duration.Observe(time.Since(ri.started).Seconds(), ri.handler, ri.method, status)
+}
@@ -0,0 +1,335 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package ratelimit provides token-bucket rate limiting for web service handlers.
+
+Most applications will not use the types in this package directly. Instead they will enable the RateLimiter facility
+(see the facility/ratelimit package) and define limits in configuration.
+
+Each Limit applies to one or more handlers (identified by their component names). Handlers that share a Limit also share
+its buckets, so a Limit can be used to restrict the combined rate of requests to a group of related endpoints.
+
+A separate bucket is maintained for each caller, identified according to the Limit's KeyedBy setting:
+
+	USER    - The LoggableUserID of the caller's iam.ClientIdentity. Anonymous callers are keyed by IP address.
+	IP      - The IP address of the caller (see ws.Request.ClientIP).
+	HEADER  - The value of the request header named in KeyHeader. Requests without the header are keyed by IP address.
+
+Each bucket holds up to Burst tokens and is refilled at RequestsPerSecond. A request consumes one token and is rejected
+if no tokens are available.
+*/
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/ws"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// KeyByUser identifies callers by the LoggableUserID of their iam.ClientIdentity
+	KeyByUser = "USER"
+	// KeyByIP identifies callers by their IP address
+	KeyByIP = "IP"
+	// KeyByHeader identifies callers by the value of a request header
+	KeyByHeader = "HEADER"
+
+	anonymousUserID = "-"
+)
+
+// Limit defines the rate at which callers may make requests to a handler or group of handlers.
+type Limit struct {
+	// The component names of the handlers this limit applies to.
+	Handlers []string
+
+	// The rate at which tokens are added to each caller's bucket.
+	RequestsPerSecond float64
+
+	// The maximum number of tokens a bucket can hold (the number of requests that can be made in quick succession).
+	Burst int
+
+	// How callers are identified: USER, IP or HEADER
+	KeyedBy string
+
+	// The name of the request header used to identify callers if KeyedBy is HEADER.
+	KeyHeader string
+
+	buckets map[string]*bucket
+	mutex   sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// BucketState is a snapshot of a caller's bucket.
+type BucketState struct {
+	// The name of the Limit the bucket belongs to.
+	Limit string
+
+	// The value identifying the caller.
+	Key string
+
+	// The number of tokens (requests) currently available to the caller.
+	Tokens float64
+
+	// When the caller last made a request.
+	LastRequest time.Time
+}
+
+// Manager applies a set of named Limits to requests. Implements ws.RateLimiter
+type Manager struct {
+	// Named limits.
+	Limits map[string]*Limit
+
+	// Buckets that have not been used for this many seconds are discarded.
+	IdleBucketExpirySeconds int
+
+	byHandler map[string][]*Limit
+	lastSweep time.Time
+	sweepLock sync.Mutex
+	now       func() time.Time
+}
+
+// Covers returns true if at least one Limit applies to the named handler.
+func (m *Manager) Covers(handlerName string) bool {
+
+	for _, l := range m.Limits {
+		for _, h := range l.Handlers {
+			if h == handlerName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// StartComponent checks that each Limit is valid and indexes the Limits by handler name.
+func (m *Manager) StartComponent() error {
+
+	if m.now == nil {
+		m.now = time.Now
+	}
+
+	m.byHandler = make(map[string][]*Limit)
+	m.lastSweep = m.now()
+
+	var names []string
+
+	for name := range m.Limits {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		l := m.Limits[name]
+
+		if l.RequestsPerSecond <= 0 || l.Burst < 1 {
+			return fmt.Errorf("rate limit %s must have a RequestsPerSecond greater than zero and a Burst of at least 1", name)
+		}
+
+		l.KeyedBy = strings.ToUpper(l.KeyedBy)
+
+		switch l.KeyedBy {
+		case KeyByUser, KeyByIP:
+		case KeyByHeader:
+			if l.KeyHeader == "" {
+				return fmt.Errorf("rate limit %s is keyed by HEADER but no KeyHeader has been set", name)
+			}
+		default:
+			return fmt.Errorf("rate limit %s has an unsupported KeyedBy value %s. Must be one of USER, IP, HEADER", name, l.KeyedBy)
+		}
+
+		l.buckets = make(map[string]*bucket)
+
+		for _, h := range l.Handlers {
+			m.byHandler[h] = append(m.byHandler[h], l)
+		}
+	}
+
+	return nil
+}
+
+// Allow consumes a token from the caller's bucket for each Limit that applies to the handler serving the request. The
+// request is allowed only if every applicable Limit has a token available - if any Limit rejects the request, no
+// tokens are consumed from the others.
+func (m *Manager) Allow(ctx context.Context, r *ws.Request, req *http.Request) (bool, time.Duration) {
+
+	limits := m.byHandler[r.ServingHandler]
+
+	if len(limits) == 0 {
+		return true, 0
+	}
+
+	now := m.now()
+	m.sweepIfDue(now)
+
+	// Limits are always locked in the same (name) order so requests to handlers sharing Limits cannot deadlock
+	for _, l := range limits {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+	}
+
+	buckets := make([]*bucket, len(limits))
+
+	var wait time.Duration
+	allowed := true
+
+	for i, l := range limits {
+
+		b := l.refill(callerKey(l, r, req), now)
+		buckets[i] = b
+
+		if b.tokens < 1 {
+			allowed = false
+
+			if w := l.wait(b); w > wait {
+				wait = w
+			}
+		}
+	}
+
+	if !allowed {
+		return false, wait
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	return true, 0
+}
+
+// BucketStates returns a snapshot of all of the buckets belonging to the named Limit (or all Limits if name is empty),
+// ordered by Limit name then key.
+func (m *Manager) BucketStates(name string) []BucketState {
+
+	now := m.now()
+	states := make([]BucketState, 0)
+
+	for n, l := range m.Limits {
+
+		if name != "" && n != name {
+			continue
+		}
+
+		l.mutex.Lock()
+
+		for k, b := range l.buckets {
+			states = append(states, BucketState{Limit: n, Key: k, Tokens: l.refilled(b, now), LastRequest: b.last})
+		}
+
+		l.mutex.Unlock()
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Limit == states[j].Limit {
+			return states[i].Key < states[j].Key
+		}
+
+		return states[i].Limit < states[j].Limit
+	})
+
+	return states
+}
+
+func (m *Manager) sweepIfDue(now time.Time) {
+
+	expiry := time.Duration(m.IdleBucketExpirySeconds) * time.Second
+
+	if expiry <= 0 {
+		return
+	}
+
+	m.sweepLock.Lock()
+
+	if now.Sub(m.lastSweep) < expiry {
+		m.sweepLock.Unlock()
+		return
+	}
+
+	m.lastSweep = now
+	m.sweepLock.Unlock()
+
+	for _, l := range m.Limits {
+		l.mutex.Lock()
+
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= expiry {
+				delete(l.buckets, k)
+			}
+		}
+
+		l.mutex.Unlock()
+	}
+}
+
+// refill finds (or creates) the bucket for the supplied key and brings its tokens up to date. Must be called with
+// the Limit's mutex held.
+func (l *Limit) refill(key string, now time.Time) *bucket {
+
+	b := l.buckets[key]
+
+	if b == nil {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refilled(b, now)
+	b.last = now
+
+	return b
+}
+
+// wait is how long until the supplied (empty) bucket will have a token available
+func (l *Limit) wait(b *bucket) time.Duration {
+
+	w := (1 - b.tokens) / l.RequestsPerSecond
+
+	return time.Duration(w * float64(time.Second))
+}
+
+func (l *Limit) refilled(b *bucket, now time.Time) float64 {
+
+	t := b.tokens + now.Sub(b.last).Seconds()*l.RequestsPerSecond
+
+	if max := float64(l.Burst); t > max {
+		t = max
+	}
+
+	return t
+}
+
+func callerKey(l *Limit, r *ws.Request, req *http.Request) string {
+
+	switch l.KeyedBy {
+	case KeyByUser:
+		if id := r.UserIdentity; id != nil {
+			// Anonymous identities share the loggable ID -, so they are keyed by IP address instead
+			if uid := id.LoggableUserID(); uid != "" && uid != anonymousUserID {
+				return uid
+			}
+		}
+	case KeyByHeader:
+		if v := req.Header.Get(l.KeyHeader); v != "" {
+			return v
+		}
+	}
+
+	if r.ClientIP != "" {
+		return r.ClientIP
+	}
+
+	return httpendpoint.ClientIP(context.Background(), req)
+}
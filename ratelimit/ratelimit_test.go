@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/iam"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+
+	m, clock := testManager(t, &Limit{Handlers: []string{"a", "b"}, RequestsPerSecond: 2, Burst: 3, KeyedBy: "ip"})
+
+	r := &ws.Request{ServingHandler: "a"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:4000"
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := m.Allow(context.Background(), r, req); !ok {
+			t.Fatalf("Request %d should have been allowed", i)
+		}
+	}
+
+	// Handlers in the same limit share buckets
+	r.ServingHandler = "b"
+	ok, wait := m.Allow(context.Background(), r, req)
+
+	test.ExpectBool(t, ok, false)
+
+	if wait != 500*time.Millisecond {
+		t.Errorf("Unexpected wait %v", wait)
+	}
+
+	*clock = clock.Add(500 * time.Millisecond)
+
+	ok, _ = m.Allow(context.Background(), r, req)
+	test.ExpectBool(t, ok, true)
+
+	// A different caller has their own bucket
+	req.RemoteAddr = "10.0.0.2:4000"
+	ok, _ = m.Allow(context.Background(), r, req)
+	test.ExpectBool(t, ok, true)
+
+	// Handlers not covered by a limit are not restricted
+	r.ServingHandler = "c"
+	ok, _ = m.Allow(context.Background(), r, req)
+	test.ExpectBool(t, ok, true)
+
+	states := m.BucketStates("")
+	test.ExpectInt(t, len(states), 2)
+	test.ExpectString(t, states[0].Key, "10.0.0.1")
+	test.ExpectFloat(t, states[0].Tokens, 0)
+	test.ExpectFloat(t, states[1].Tokens, 2)
+
+	// Idle buckets are discarded
+	*clock = clock.Add(time.Hour)
+	m.Allow(context.Background(), &ws.Request{ServingHandler: "a"}, req)
+
+	test.ExpectInt(t, len(m.BucketStates("test")), 1)
+}
+
+func TestCallerKeys(t *testing.T) {
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:4000"
+	req.Header.Set("X-API-Key", "abc")
+
+	r := new(ws.Request)
+	r.UserIdentity = iam.NewAnonymousIdentity()
+
+	test.ExpectString(t, callerKey(&Limit{KeyedBy: KeyByUser}, r, req), "10.0.0.1")
+	test.ExpectString(t, callerKey(&Limit{KeyedBy: KeyByHeader, KeyHeader: "X-API-Key"}, r, req), "abc")
+	test.ExpectString(t, callerKey(&Limit{KeyedBy: KeyByHeader, KeyHeader: "X-Other"}, r, req), "10.0.0.1")
+
+	r.UserIdentity = iam.NewAuthenticatedIdentity("user1")
+	test.ExpectString(t, callerKey(&Limit{KeyedBy: KeyByUser}, r, req), "user1")
+}
+
+func TestInvalidLimits(t *testing.T) {
+
+	for _, l := range []*Limit{
+		{RequestsPerSecond: 0, Burst: 1, KeyedBy: KeyByIP},
+		{RequestsPerSecond: 1, Burst: 0, KeyedBy: KeyByIP},
+		{RequestsPerSecond: 1, Burst: 1, KeyedBy: "COOKIE"},
+		{RequestsPerSecond: 1, Burst: 1, KeyedBy: KeyByHeader},
+	} {
+		m := new(Manager)
+		m.Limits = map[string]*Limit{"test": l}
+
+		if m.StartComponent() == nil {
+			t.Errorf("Expected error for %v", l)
+		}
+	}
+}
+
+func testManager(t *testing.T, l *Limit) (*Manager, *time.Time) {
+
+	clock := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := new(Manager)
+	m.Limits = map[string]*Limit{"test": l}
+	m.IdleBucketExpirySeconds = 60
+	m.now = func() time.Time { return clock }
+
+	if err := m.StartComponent(); err != nil {
+		t.Fatalf("Unable to start manager: %s", err.Error())
+	}
+
+	return m, &clock
+}
+
+func TestRejectionDoesNotConsumeOtherLimits(t *testing.T) {
+
+	clock := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := new(Manager)
+	m.Limits = map[string]*Limit{
+		"generous": {Handlers: []string{"a"}, RequestsPerSecond: 1, Burst: 5, KeyedBy: KeyByIP},
+		"strict":   {Handlers: []string{"a"}, RequestsPerSecond: 1, Burst: 1, KeyedBy: KeyByIP},
+	}
+	m.now = func() time.Time { return clock }
+
+	test.ExpectNil(t, m.StartComponent())
+
+	r := &ws.Request{ServingHandler: "a", ClientIP: "10.0.0.1"}
+	req := httptest.NewRequest("GET", "/", nil)
+
+	ok, _ := m.Allow(context.Background(), r, req)
+	test.ExpectBool(t, ok, true)
+
+	for i := 0; i < 3; i++ {
+		ok, _ = m.Allow(context.Background(), r, req)
+		test.ExpectBool(t, ok, false)
+	}
+
+	states := m.BucketStates("generous")
+	test.ExpectFloat(t, states[0].Tokens, 4)
+}
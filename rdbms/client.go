@@ -9,6 +9,7 @@ import (
 	"errors"
 	"github.com/graniticio/granitic/v2/dsquery"
 	"github.com/graniticio/granitic/v2/logging"
+	"time"
 )
 
 // Client provides access to methods for executing SQL queries and managing transactions
@@ -68,6 +69,7 @@ type ManagedClient struct {
 	emptyParams     map[string]interface{}
 	binder          *RowBinder
 	ctx             context.Context
+	slowQuery       time.Duration
 	FrameworkLogger logging.Logger
 }
 
@@ -93,7 +95,7 @@ func (rc *ManagedClient) BuildQueryFromQIDParams(qid string, p ...interface{}) (
 // DeleteQIDParams executes the supplied query with the expectation that it is a 'DELETE' query.
 func (rc *ManagedClient) DeleteQIDParams(qid string, params ...interface{}) (sql.Result, error) {
 
-	return rc.execQIDParams(qid, params...)
+	return rc.execQIDParams(qid, DeleteOperation, params...)
 
 }
 
@@ -103,7 +105,7 @@ func (rc *ManagedClient) DeleteQIDParam(qid string, name string, value interface
 	p := make(map[string]interface{})
 	p[name] = value
 
-	return rc.execQIDParams(qid, p)
+	return rc.execQIDParams(qid, DeleteOperation, p)
 
 }
 
@@ -134,7 +136,7 @@ func (rc *ManagedClient) ExistingIDOrInsertParams(checkQueryID, insertQueryID st
 // InsertQIDParams executes the supplied query with the expectation that it is an 'INSERT' query.
 func (rc *ManagedClient) InsertQIDParams(qid string, params ...interface{}) (sql.Result, error) {
 
-	return rc.execQIDParams(qid, params...)
+	return rc.execQIDParams(qid, InsertOperation, params...)
 
 }
 
@@ -149,7 +151,13 @@ func (rc *ManagedClient) InsertCaptureQIDParams(qid string, target *int64, param
 		return err
 	}
 
-	return rc.lastID(query, rc, target)
+	s := rc.startStatement(qid, InsertOperation)
+
+	err = rc.lastID(query, rc, target)
+
+	s.finish(1, err)
+
+	return err
 }
 
 // SelectBindSingleQID executes the supplied query with the expectation that it is a 'SELECT' query that returns 0 or 1 rows.
@@ -174,13 +182,32 @@ func (rc *ManagedClient) SelectBindSingleQIDParams(qid string, target interface{
 	var r *sql.Rows
 	var err error
 
-	if r, err = rc.SelectQIDParams(qid, params...); err != nil {
+	query, err := rc.buildQuery(qid, params...)
+
+	if err != nil {
+		return false, err
+	}
+
+	s := rc.startStatement(qid, SelectOperation)
+
+	if r, err = rc.Query(query); err != nil {
+		s.finish(-1, err)
 		return false, err
 	}
 
 	defer r.Close()
 
-	return rc.binder.BindRow(r, target)
+	found, err := rc.binder.BindRow(r, target)
+
+	var rows int64
+
+	if found {
+		rows = 1
+	}
+
+	s.finish(rows, err)
+
+	return found, err
 
 }
 
@@ -205,13 +232,26 @@ func (rc *ManagedClient) SelectBindQIDParams(qid string, template interface{}, p
 	var r *sql.Rows
 	var err error
 
-	if r, err = rc.SelectQIDParams(qid, params...); err != nil {
+	query, err := rc.buildQuery(qid, params...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := rc.startStatement(qid, SelectOperation)
+
+	if r, err = rc.Query(query); err != nil {
+		s.finish(-1, err)
 		return nil, err
 	}
 
 	defer r.Close()
 
-	return rc.binder.BindRows(r, template)
+	results, err := rc.binder.BindRows(r, template)
+
+	s.finish(int64(len(results)), err)
+
+	return results, err
 }
 
 // SelectQID executes the supplied query with the expectation that it is a 'SELECT' query.
@@ -236,14 +276,21 @@ func (rc *ManagedClient) SelectQIDParams(qid string, params ...interface{}) (*sq
 		return nil, err
 	}
 
-	return rc.Query(query)
+	s := rc.startStatement(qid, SelectOperation)
+
+	// The number of rows isn't known until the caller has read them
+	r, err := rc.Query(query)
+
+	s.finish(-1, err)
+
+	return r, err
 
 }
 
 // UpdateQIDParams executes the supplied query with the expectation that it is an 'UPDATE' query.
 func (rc *ManagedClient) UpdateQIDParams(qid string, params ...interface{}) (sql.Result, error) {
 
-	return rc.execQIDParams(qid, params...)
+	return rc.execQIDParams(qid, UpdateOperation, params...)
 
 }
 
@@ -253,11 +300,11 @@ func (rc *ManagedClient) UpdateQIDParam(qid string, name string, value interface
 	p := make(map[string]interface{})
 	p[name] = value
 
-	return rc.execQIDParams(qid, p)
+	return rc.execQIDParams(qid, UpdateOperation, p)
 
 }
 
-func (rc *ManagedClient) execQIDParams(qid string, params ...interface{}) (sql.Result, error) {
+func (rc *ManagedClient) execQIDParams(qid string, operation string, params ...interface{}) (sql.Result, error) {
 
 	var query string
 	var err error
@@ -266,7 +313,21 @@ func (rc *ManagedClient) execQIDParams(qid string, params ...interface{}) (sql.R
 		return nil, err
 	}
 
-	return rc.Exec(query)
+	s := rc.startStatement(qid, operation)
+
+	r, err := rc.Exec(query)
+
+	rows := int64(-1)
+
+	if err == nil {
+		if ra, raErr := r.RowsAffected(); raErr == nil {
+			rows = ra
+		}
+	}
+
+	s.finish(rows, err)
+
+	return r, err
 }
 
 func (rc *ManagedClient) buildQuery(qid string, p ...interface{}) (string, error) {
@@ -0,0 +1,93 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package rdbms
+
+import (
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/ws"
+	"time"
+)
+
+// Keys in the map[string]interface{} passed as metadata to the instrumentation event started for each statement
+// executed by a QID method.
+const (
+	// The QID of the statement (string)
+	QIDMetadata = "db.qid"
+
+	// The type of statement (one of the Operation constants below)
+	OperationMetadata = "db.operation"
+
+	// The number of rows returned or affected by the statement (int64). Set just before the event ends and only
+	// present if the statement succeeded and the number of rows is known.
+	RowsMetadata = "db.rows"
+)
+
+// Operation types recorded with each instrumented statement
+const (
+	SelectOperation = "SELECT"
+	InsertOperation = "INSERT"
+	UpdateOperation = "UPDATE"
+	DeleteOperation = "DELETE"
+)
+
+// statement tracks the execution of a single QID statement so that it can be instrumented and, if it takes longer
+// than the client's slow query threshold, logged.
+type statement struct {
+	rc       *ManagedClient
+	qid      string
+	start    time.Time
+	metadata map[string]interface{}
+	end      instrument.EndEvent
+}
+
+// startStatement starts an instrumentation event for the statement if the client was created with a context containing
+// an Instrumentor
+func (rc *ManagedClient) startStatement(qid string, operation string) *statement {
+
+	s := new(statement)
+	s.rc = rc
+	s.qid = qid
+	s.start = time.Now()
+
+	if rc.contextAware() {
+
+		if ri := instrument.InstrumentorFromContext(rc.ctx); ri != nil {
+			s.metadata = map[string]interface{}{QIDMetadata: qid, OperationMetadata: operation}
+			s.end = ri.StartEvent(qid, s.metadata)
+		}
+	}
+
+	return s
+}
+
+// finish records the number of rows returned or affected by the statement (a negative number if not known) and ends the
+// statement's instrumentation event.
+func (s *statement) finish(rows int64, err error) {
+
+	if s.end != nil {
+
+		if err == nil && rows >= 0 {
+			s.metadata[RowsMetadata] = rows
+		}
+
+		s.end()
+	}
+
+	rc := s.rc
+
+	if rc.slowQuery <= 0 {
+		return
+	}
+
+	if elapsed := time.Since(s.start); elapsed >= rc.slowQuery {
+
+		var rid string
+
+		if rc.contextAware() {
+			rid = ws.RequestID(rc.ctx)
+		}
+
+		rc.FrameworkLogger.LogWarnf("Slow query %s took %s (request ID: %s)", s.qid, elapsed, rid)
+	}
+}
@@ -0,0 +1,155 @@
+package rdbms
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatementInstrumentation(t *testing.T) {
+
+	ri := new(recordingInstrumentor)
+
+	c := newRdbmsClient(db, qm, DefaultInsertWithReturnedID, new(logging.NullLogger))
+	c.ctx = instrument.AddInstrumentorToContext(context.Background(), ri)
+
+	drv.colNames = []string{"Int64Result"}
+	drv.rowData = [][]driver.Value{{int64(45)}, {int64(32)}}
+
+	_, err := c.SelectBindQID("SBQ", new(testTarget))
+	test.ExpectNil(t, err)
+
+	_, err = c.UpdateQIDParam("UQ", "p1", "v1")
+	test.ExpectNil(t, err)
+
+	r, err := c.SelectQID("SQ")
+	test.ExpectNil(t, err)
+	r.Close()
+
+	var id int64
+	test.ExpectNil(t, c.InsertCaptureQIDParams("IQ", &id))
+
+	drv.forceError = true
+	_, err = c.DeleteQIDParams("DQ")
+	test.ExpectNotNil(t, err)
+
+	test.ExpectInt(t, len(ri.events), 5)
+
+	expected := []struct {
+		qid  string
+		op   string
+		rows int64
+	}{
+		{"SBQ", SelectOperation, 2},
+		{"UQ", UpdateOperation, 1},
+		{"SQ", SelectOperation, -1},
+		{"IQ", InsertOperation, 1},
+		{"DQ", DeleteOperation, -1},
+	}
+
+	for i, e := range expected {
+
+		ev := ri.events[i]
+
+		test.ExpectString(t, ev.id, e.qid)
+		test.ExpectBool(t, ev.ended, true)
+		test.ExpectString(t, ev.metadata[QIDMetadata].(string), e.qid)
+		test.ExpectString(t, ev.metadata[OperationMetadata].(string), e.op)
+
+		rows, found := ev.metadata[RowsMetadata]
+
+		if e.rows < 0 {
+			test.ExpectBool(t, found, false)
+		} else {
+			test.ExpectBool(t, rows.(int64) == e.rows, true)
+		}
+	}
+
+	// Clients without a context are not instrumented
+	c = newRdbmsClient(db, qm, DefaultInsertWithReturnedID, new(logging.NullLogger))
+	_, err = c.UpdateQIDParam("UQ", "p1", "v1")
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, len(ri.events), 5)
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+
+	log := new(warnRecordingLogger)
+
+	c := newRdbmsClient(db, qm, DefaultInsertWithReturnedID, log)
+
+	ctx := ws.StoreRequestIDFunction(context.Background(), func(context.Context) string { return "req-1" })
+	c.ctx = ctx
+
+	_, err := c.UpdateQIDParam("UQ", "p1", "v1")
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, len(log.warnings), 0)
+
+	c.slowQuery = time.Nanosecond
+
+	_, err = c.UpdateQIDParam("UQ", "p1", "v1")
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, len(log.warnings), 1)
+
+	w := log.warnings[0]
+
+	test.ExpectBool(t, strings.Contains(w, "UQ"), true)
+	test.ExpectBool(t, strings.Contains(w, "req-1"), true)
+
+	c.slowQuery = time.Hour
+
+	_, err = c.UpdateQIDParam("UQ", "p1", "v1")
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, len(log.warnings), 1)
+}
+
+type recordedEvent struct {
+	id       string
+	metadata map[string]interface{}
+	ended    bool
+}
+
+type recordingInstrumentor struct {
+	events []*recordedEvent
+}
+
+func (ri *recordingInstrumentor) StartEvent(id string, metadata ...interface{}) instrument.EndEvent {
+
+	e := &recordedEvent{id: id}
+
+	if len(metadata) > 0 {
+		e.metadata, _ = metadata[0].(map[string]interface{})
+	}
+
+	ri.events = append(ri.events, e)
+
+	return func() {
+		e.ended = true
+	}
+}
+
+func (ri *recordingInstrumentor) Fork(ctx context.Context) (context.Context, instrument.Instrumentor) {
+	return ctx, ri
+}
+
+func (ri *recordingInstrumentor) Integrate(instrumentor instrument.Instrumentor) {
+}
+
+func (ri *recordingInstrumentor) Amend(additional instrument.Additional, value interface{}) {
+}
+
+type warnRecordingLogger struct {
+	logging.NullLogger
+	warnings []string
+}
+
+func (l *warnRecordingLogger) LogWarnf(format string, a ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, a...))
+}
@@ -166,6 +166,25 @@ ManagedClient provides pass-through access to sql.DB's Exec, Query and QueryRow
 with Granitic's transaction pattern as described above.
 
 
+Instrumentation
+
+If a ManagedClient was obtained by calling ClientFromContext with a context containing an instrument.Instrumentor (as
+is the case for contexts passed to web service handlers when instrumentation is enabled), each statement executed by a
+QID method starts an instrumentation event. The event's ID is the QID and a map[string]interface{} is supplied as
+metadata containing the QID, the operation (SELECT, INSERT, UPDATE or DELETE) and, just before the event ends, the
+number of rows returned or affected by the statement (see QIDMetadata, OperationMetadata and RowsMetadata).
+
+Statements that take longer than the configured threshold are logged, along with their duration and the ID of the
+request being processed, at WARN level:
+
+	{
+	  "RdbmsAccess":{
+		"Default": {
+		  "SlowQueryThresholdMS": 500
+		}
+	  }
+	}
+
 Multiple databases
 
 This iteration of Granitic is optimised for the most common use-case for RDBMS access, where a particular Granitic
@@ -189,6 +208,7 @@ import (
 	"github.com/graniticio/granitic/v2/dsquery"
 	"github.com/graniticio/granitic/v2/ioc"
 	"github.com/graniticio/granitic/v2/logging"
+	"time"
 )
 
 /*
@@ -245,6 +265,10 @@ type ClientManagerConfig struct {
 
 	// Name that will be given to the ClientManager component that will be created. If not set, it will be set the value of ClientName + "Manager"
 	ManagerName string
+
+	// Statements executed via a QID method that take at least this many milliseconds are logged (with their QID,
+	// duration and request ID) at WARN level. Zero disables logging of slow queries.
+	SlowQueryThresholdMS int
 }
 
 /*
@@ -273,6 +297,12 @@ type GraniticRdbmsClientManager struct {
 // BlockAccess returns true if BlockUntilConnected is set to true and a connection to the underlying RDBMS
 // has not yet been established.
 func (cm *GraniticRdbmsClientManager) BlockAccess() (bool, error) {
+	return cm.BlockAccessContext(context.Background())
+}
+
+// BlockAccessContext behaves like BlockAccess but abandons the connection check if the supplied context is cancelled
+// or its deadline passes. Implements health.ContextBlocker
+func (cm *GraniticRdbmsClientManager) BlockAccessContext(ctx context.Context) (bool, error) {
 
 	if !cm.Configuration.BlockUntilConnected {
 		return false, nil
@@ -286,7 +316,7 @@ func (cm *GraniticRdbmsClientManager) BlockAccess() (bool, error) {
 		return true, errors.New("Unable to connect to database: " + err.Error())
 	}
 
-	if err = db.Ping(); err == nil {
+	if err = db.PingContext(ctx); err == nil {
 		return false, nil
 	}
 
@@ -294,6 +324,24 @@ func (cm *GraniticRdbmsClientManager) BlockAccess() (bool, error) {
 
 }
 
+// CheckHealth pings the underlying RDBMS. Implements ioc.HealthReporter
+func (cm *GraniticRdbmsClientManager) CheckHealth(ctx context.Context) error {
+
+	provider := cm.Configuration.Provider
+
+	db, err := provider.Database()
+
+	if err != nil {
+		return errors.New("Unable to connect to database: " + err.Error())
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		return errors.New("Unable to connect to database: " + err.Error())
+	}
+
+	return nil
+}
+
 // Client implements ClientManager.Client
 func (cm *GraniticRdbmsClientManager) Client() (Client, error) {
 
@@ -310,7 +358,7 @@ func (cm *GraniticRdbmsClientManager) Client() (Client, error) {
 		return nil, err
 	}
 
-	return newRdbmsClient(db, cm.QueryManager, cm.chooseInsertFunction(), cm.SharedLog), nil
+	return cm.newClient(db), nil
 }
 
 // ClientFromContext implements ClientManager.ClientFromContext
@@ -337,12 +385,20 @@ func (cm *GraniticRdbmsClientManager) ClientFromContext(ctx context.Context) (Cl
 		}
 	}
 
-	rc := newRdbmsClient(db, cm.QueryManager, cm.chooseInsertFunction(), cm.SharedLog)
+	rc := cm.newClient(db)
 	rc.ctx = ctx
 
 	return rc, nil
 }
 
+func (cm *GraniticRdbmsClientManager) newClient(db *sql.DB) *ManagedClient {
+
+	rc := newRdbmsClient(db, cm.QueryManager, cm.chooseInsertFunction(), cm.SharedLog)
+	rc.slowQuery = time.Duration(cm.Configuration.SlowQueryThresholdMS) * time.Millisecond
+
+	return rc
+}
+
 func (cm *GraniticRdbmsClientManager) chooseInsertFunction() InsertWithReturnedID {
 
 	if iwi, found := cm.Configuration.Provider.(NonStandardInsertProvider); found {
@@ -0,0 +1,279 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package tracecontext implements the propagation of distributed trace identifiers using the W3C Trace Context headers
+(https://www.w3.org/TR/trace-context/).
+
+An incoming request's traceparent header identifies the trace the request belongs to and the span (the caller's
+operation) that made the request:
+
+	traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+
+The tracestate header carries vendor-specific trace information and is propagated unchanged.
+
+Most applications will not use this package directly. Instead they enable trace context propagation in the HTTPServer
+facility, which parses the headers of each request and stores a Context (identifying the trace, the caller's span and a
+new span representing the work done by your application) in the request's context.Context. Use FromContext to recover it
+and Context.TraceParent to generate the header that should be sent with any requests your application makes to other services.
+*/
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// TraceParentHeader is the name of the HTTP header identifying the trace and calling span
+	TraceParentHeader = "traceparent"
+
+	// TraceStateHeader is the name of the HTTP header carrying vendor-specific trace information
+	TraceStateHeader = "tracestate"
+
+	// SampledFlag is the bit in a traceparent's flags indicating that the caller may have recorded trace data
+	SampledFlag byte = 0x01
+
+	supportedVersion  = "00"
+	traceIDLength     = 32
+	spanIDLength      = 16
+	maxStateMembers   = 32
+	maxStateLength    = 512
+	versionZeroLength = 55
+)
+
+var (
+	lowerHex        = regexp.MustCompile("^[0-9a-f]+$")
+	stateMemberForm = regexp.MustCompile("^[a-z0-9][_0-9a-z\\-*/@]{0,255}=[\\x20-\\x2b\\x2d-\\x3c\\x3e-\\x7e]{0,255}[\\x21-\\x2b\\x2d-\\x3c\\x3e-\\x7e]$")
+)
+
+// Context identifies the trace a request belongs to and the span representing the application's handling of the request.
+type Context struct {
+	// 32 lowercase hex characters identifying the whole trace.
+	TraceID string
+
+	// 16 lowercase hex characters identifying the caller's span. Empty if the trace was started by this application.
+	ParentSpanID string
+
+	// 16 lowercase hex characters identifying this application's span.
+	SpanID string
+
+	// Trace flags (see SampledFlag)
+	Flags byte
+
+	// The (validated) value of the tracestate header, propagated unchanged.
+	State string
+}
+
+// Sampled returns true if the sampled flag is set.
+func (c *Context) Sampled() bool {
+	return c.Flags&SampledFlag != 0
+}
+
+// TraceParent returns a traceparent header value identifying the trace and this application's span. This is the value that
+// should be sent to any service called while handling the request.
+func (c *Context) TraceParent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", supportedVersion, c.TraceID, c.SpanID, c.Flags)
+}
+
+// Child returns a new Context in the same trace whose parent is this Context's span.
+func (c *Context) Child() *Context {
+
+	return &Context{
+		TraceID:      c.TraceID,
+		ParentSpanID: c.SpanID,
+		SpanID:       NewSpanID(),
+		Flags:        c.Flags,
+		State:        c.State,
+	}
+}
+
+// Parent is a parsed traceparent header.
+type Parent struct {
+	Version string
+	TraceID string
+	SpanID  string
+	Flags   byte
+}
+
+// ParseTraceParent parses and validates the value of a traceparent header. Headers with a version newer than 00 are
+// accepted as long as the fields defined by version 00 are valid.
+func ParseTraceParent(v string) (*Parent, error) {
+
+	v = strings.TrimSpace(v)
+
+	if len(v) < versionZeroLength {
+		return nil, errors.New("traceparent too short")
+	}
+
+	parts := strings.SplitN(v, "-", 5)
+
+	if len(parts) < 4 {
+		return nil, errors.New("traceparent must have four fields")
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	if len(version) != 2 || !lowerHex.MatchString(version) || version == "ff" {
+		return nil, errors.New("invalid traceparent version")
+	}
+
+	if version == supportedVersion && len(v) != versionZeroLength {
+		return nil, errors.New("version 00 traceparent has unexpected trailing data")
+	}
+
+	if !validID(traceID, traceIDLength) {
+		return nil, errors.New("invalid trace-id in traceparent")
+	}
+
+	if !validID(spanID, spanIDLength) {
+		return nil, errors.New("invalid parent-id in traceparent")
+	}
+
+	if len(flags) != 2 || !lowerHex.MatchString(flags) {
+		return nil, errors.New("invalid trace-flags in traceparent")
+	}
+
+	fb, _ := hex.DecodeString(flags)
+
+	return &Parent{Version: version, TraceID: traceID, SpanID: spanID, Flags: fb[0]}, nil
+}
+
+// validID checks that the ID is lowercase hex of the expected length and is not all zeros
+func validID(id string, length int) bool {
+	return len(id) == length && lowerHex.MatchString(id) && strings.Trim(id, "0") != ""
+}
+
+// CleanTraceState combines the supplied tracestate header values and removes empty list members. An empty string is
+// returned if any member is malformed, if a key appears more than once or if the combined value is too long. Members
+// beyond the 32nd are discarded.
+func CleanTraceState(values []string) string {
+
+	var members []string
+	seen := make(map[string]bool)
+
+	for _, v := range values {
+
+		for _, m := range strings.Split(v, ",") {
+
+			m = strings.TrimSpace(m)
+
+			if m == "" {
+				continue
+			}
+
+			if !stateMemberForm.MatchString(m) {
+				return ""
+			}
+
+			key := m[:strings.Index(m, "=")]
+
+			if seen[key] {
+				return ""
+			}
+
+			seen[key] = true
+			members = append(members, m)
+		}
+	}
+
+	if len(members) > maxStateMembers {
+		members = members[:maxStateMembers]
+	}
+
+	s := strings.Join(members, ",")
+
+	if len(s) > maxStateLength {
+		return ""
+	}
+
+	return s
+}
+
+// FromRequest builds a Context from the request's traceparent and tracestate headers, allocating a new span ID for the
+// application's handling of the request. If the request does not have a valid traceparent header, a new trace is
+// started if startIfAbsent is true, otherwise nil is returned.
+func FromRequest(req *http.Request, startIfAbsent bool) *Context {
+
+	p, err := ParseTraceParent(req.Header.Get(TraceParentHeader))
+
+	if err != nil {
+
+		if !startIfAbsent {
+			return nil
+		}
+
+		// The tracestate header is meaningless without a valid traceparent
+		return &Context{TraceID: NewTraceID(), SpanID: NewSpanID(), Flags: SampledFlag}
+	}
+
+	return &Context{
+		TraceID:      p.TraceID,
+		ParentSpanID: p.SpanID,
+		SpanID:       NewSpanID(),
+		Flags:        p.Flags & SampledFlag,
+		State:        CleanTraceState(req.Header[http.CanonicalHeaderKey(TraceStateHeader)]),
+	}
+}
+
+// Inject sets the traceparent and (if there is any state) the tracestate headers on an outgoing request.
+func (c *Context) Inject(h http.Header) {
+
+	h.Set(TraceParentHeader, c.TraceParent())
+
+	if c.State != "" {
+		h.Set(TraceStateHeader, c.State)
+	}
+}
+
+// NewTraceID generates a random trace ID
+func NewTraceID() string {
+	return randomID(traceIDLength / 2)
+}
+
+// NewSpanID generates a random span ID
+func NewSpanID() string {
+	return randomID(spanIDLength / 2)
+}
+
+func randomID(size int) string {
+
+	b := make([]byte, size)
+
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("unable to generate random trace identifier: %s", err.Error()))
+		}
+
+		for _, v := range b {
+			if v != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+type ctxKey int
+
+const contextKey ctxKey = 0
+
+// NewContext returns a copy of the supplied context.Context containing the trace Context.
+func NewContext(ctx context.Context, tc *Context) context.Context {
+	return context.WithValue(ctx, contextKey, tc)
+}
+
+// FromContext returns the trace Context stored in the supplied context.Context or nil if there is none.
+func FromContext(ctx context.Context) *Context {
+
+	if tc, found := ctx.Value(contextKey).(*Context); found {
+		return tc
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package tracecontext
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+
+	p, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	test.ExpectNil(t, err)
+	test.ExpectString(t, p.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	test.ExpectString(t, p.SpanID, "00f067aa0ba902b7")
+	test.ExpectInt(t, int(p.Flags), 1)
+
+	// Future versions may append fields
+	p, err = ParseTraceParent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-09-extra")
+
+	test.ExpectNil(t, err)
+	test.ExpectString(t, p.Version, "cc")
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01extra",
+	}
+
+	for _, v := range invalid {
+		if _, err := ParseTraceParent(v); err == nil {
+			t.Errorf("Expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestCleanTraceState(t *testing.T) {
+
+	test.ExpectString(t, CleanTraceState([]string{"rojo=00f067aa0ba902b7, ,", "congo=t61rcWkgMzE"}), "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE")
+	test.ExpectString(t, CleanTraceState([]string{"vendor@tenant=abc"}), "vendor@tenant=abc")
+	test.ExpectString(t, CleanTraceState([]string{"Rojo=1"}), "")
+	test.ExpectString(t, CleanTraceState([]string{"rojo=1,rojo=2"}), "")
+	test.ExpectString(t, CleanTraceState([]string{"rojo=a,b"}), "")
+	test.ExpectString(t, CleanTraceState(nil), "")
+}
+
+func TestFromRequest(t *testing.T) {
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03")
+	req.Header.Add(TraceStateHeader, "rojo=00f067aa0ba902b7")
+	req.Header.Add(TraceStateHeader, "congo=t61rcWkgMzE")
+
+	tc := FromRequest(req, false)
+
+	test.ExpectNotNil(t, tc)
+	test.ExpectString(t, tc.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	test.ExpectString(t, tc.ParentSpanID, "00f067aa0ba902b7")
+	test.ExpectString(t, tc.State, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE")
+	test.ExpectBool(t, tc.Sampled(), true)
+	test.ExpectInt(t, len(tc.SpanID), 16)
+
+	if tc.SpanID == tc.ParentSpanID {
+		t.Errorf("Expected a new span ID")
+	}
+
+	// Unknown flags are not propagated
+	test.ExpectString(t, tc.TraceParent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-"+tc.SpanID+"-01")
+
+	out := make(http.Header)
+	tc.Inject(out)
+
+	test.ExpectString(t, out.Get(TraceParentHeader), tc.TraceParent())
+	test.ExpectString(t, out.Get(TraceStateHeader), tc.State)
+
+	child := tc.Child()
+
+	test.ExpectString(t, child.TraceID, tc.TraceID)
+	test.ExpectString(t, child.ParentSpanID, tc.SpanID)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceParentHeader, "invalid")
+	req.Header.Set(TraceStateHeader, "rojo=1")
+
+	if FromRequest(req, false) != nil {
+		t.Errorf("Expected no context without a valid traceparent")
+	}
+
+	tc = FromRequest(req, true)
+
+	test.ExpectInt(t, len(tc.TraceID), 32)
+	test.ExpectString(t, tc.ParentSpanID, "")
+	test.ExpectString(t, tc.State, "")
+
+	if _, err := ParseTraceParent(tc.TraceParent()); err != nil {
+		t.Errorf("Generated traceparent is invalid: %s", err.Error())
+	}
+}
+
+func TestContextStorage(t *testing.T) {
+
+	ctx := context.Background()
+
+	if FromContext(ctx) != nil {
+		t.Errorf("Expected nil from empty context")
+	}
+
+	tc := &Context{TraceID: NewTraceID(), SpanID: NewSpanID()}
+
+	if FromContext(NewContext(ctx, tc)) != tc {
+		t.Errorf("Context not recovered")
+	}
+}
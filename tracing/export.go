@@ -0,0 +1,285 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OTLPContentType is the content type of spans encoded by EncodeOTLP
+const OTLPContentType = "application/json"
+
+const (
+	scopeName             = "github.com/graniticio/granitic/v2/tracing"
+	unknownService        = "unknown_service"
+	defaultExportTimeout  = 10 * time.Second
+	statusCodeError       = 2
+	maxErrorResponseBytes = 512
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector (or any other system that accepts OTLP/JSON over HTTP).
+type OTLPExporter struct {
+	// The URL spans are POSTed to, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+
+	// Additional headers (e.g. for authentication) sent with each request.
+	Headers map[string]string
+
+	// How long (in milliseconds) to wait for the collector to respond. Defaults to 10000.
+	TimeoutMS int
+
+	client *http.Client
+	once   sync.Once
+}
+
+// Export POSTs the spans to the Endpoint and returns an error if the collector does not respond with a 2xx status.
+func (e *OTLPExporter) Export(resource Resource, spans []*Span) error {
+
+	e.once.Do(func() {
+		timeout := defaultExportTimeout
+
+		if e.TimeoutMS > 0 {
+			timeout = time.Duration(e.TimeoutMS) * time.Millisecond
+		}
+
+		e.client = &http.Client{Timeout: timeout}
+	})
+
+	body, err := EncodeOTLP(resource, spans)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", OTLPContentType)
+
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := e.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		detail, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorResponseBytes))
+
+		return fmt.Errorf("collector at %s responded with %d %s", e.Endpoint, res.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	io.Copy(ioutil.Discard, res.Body)
+
+	return nil
+}
+
+// FileExporter appends spans to a file. Each batch of spans is written as a single line containing an OTLP/JSON export
+// request (the format read by the OpenTelemetry collector's otlpjsonfile receiver).
+type FileExporter struct {
+	// The path of the file spans are written to. The file is created if it does not exist.
+	Path string
+
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// Export appends a line containing the spans to the file.
+func (e *FileExporter) Export(resource Resource, spans []*Span) error {
+
+	body, err := EncodeOTLP(resource, spans)
+
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.file == nil {
+
+		if e.file, err = os.OpenFile(e.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+			return err
+		}
+	}
+
+	_, err = e.file.Write(append(body, '\n'))
+
+	return err
+}
+
+// Close closes the file.
+func (e *FileExporter) Close() error {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.file == nil {
+		return nil
+	}
+
+	err := e.file.Close()
+	e.file = nil
+
+	return err
+}
+
+// EncodeOTLP converts the supplied spans to an OTLP/JSON ExportTraceServiceRequest.
+func EncodeOTLP(resource Resource, spans []*Span) ([]byte, error) {
+
+	service := resource.ServiceName
+
+	if service == "" {
+		service = unknownService
+	}
+
+	ra := map[string]interface{}{"service.name": service}
+
+	if resource.InstanceID != "" {
+		ra["service.instance.id"] = resource.InstanceID
+	}
+
+	encoded := make([]otlpSpan, len(spans))
+
+	for i, s := range spans {
+
+		o := otlpSpan{
+			TraceID:                s.TraceID,
+			SpanID:                 s.SpanID,
+			ParentSpanID:           s.ParentSpanID,
+			TraceState:             s.TraceState,
+			Name:                   s.Name,
+			Kind:                   int(s.Kind),
+			StartTimeUnixNano:      strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:        strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:             otlpAttributes(s.Attributes),
+			DroppedAttributesCount: s.DroppedAttributes,
+		}
+
+		if s.Error {
+			o.Status.Code = statusCodeError
+		}
+
+		encoded[i] = o
+	}
+
+	r := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: otlpAttributes(ra)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scopeName},
+				Spans: encoded,
+			}},
+		}},
+	}
+
+	return json.Marshal(r)
+}
+
+func otlpAttributes(a map[string]interface{}) []otlpKeyValue {
+
+	keys := make([]string, 0, len(a))
+
+	for k := range a {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+
+	for _, k := range keys {
+
+		var v otlpAnyValue
+
+		switch t := a[k].(type) {
+		case bool:
+			v.BoolValue = &t
+		case int64:
+			s := strconv.FormatInt(t, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &t
+		default:
+			s := fmt.Sprint(t)
+			v.StringValue = &s
+		}
+
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: v})
+	}
+
+	return kvs
+}
+
+// Types mirroring the JSON encoding of the OTLP ExportTraceServiceRequest message
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	TraceState             string         `json:"traceState,omitempty"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
@@ -0,0 +1,303 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/graniticio/granitic/v2/iam"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/tracecontext"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Attributes recorded on root spans
+const (
+	MethodAttribute         = "http.request.method"
+	PathAttribute           = "url.path"
+	StatusAttribute         = "http.response.status_code"
+	UserAgentAttribute      = "user_agent.original"
+	PeerAddressAttribute    = "network.peer.address"
+	RequestIDAttribute      = "granitic.request_id"
+	RequestVersionAttribute = "granitic.request_version"
+	HandlerAttribute        = "granitic.handler"
+	UserAttribute           = "enduser.id"
+	DroppedSpansAttribute   = "granitic.dropped_spans"
+)
+
+// Begin creates a root span for the request and stores an Instrumentor (which creates child spans) in the returned
+// context. The returned function ends the root span and queues the request's spans for export if the trace is sampled.
+func (t *Tracer) Begin(ctx context.Context, res http.ResponseWriter, req *http.Request) (context.Context, instrument.Instrumentor, func()) {
+
+	root := new(Span)
+	root.SpanID = tracecontext.NewSpanID()
+	root.Name = req.Method
+	root.Kind = ServerSpan
+	root.Start = time.Now()
+
+	t.setAttribute(root, MethodAttribute, req.Method)
+	t.setAttribute(root, PathAttribute, req.URL.Path)
+
+	if ua := req.UserAgent(); ua != "" {
+		t.setAttribute(root, UserAgentAttribute, ua)
+	}
+
+	if req.RemoteAddr != "" {
+		t.setAttribute(root, PeerAddressAttribute, req.RemoteAddr)
+	}
+
+	rt := new(requestTrace)
+	rt.tracer = t
+	rt.root = root
+	rt.method = req.Method
+
+	ri := &spanInstrumentor{trace: rt, open: []*Span{root}}
+
+	return instrument.AddInstrumentorToContext(ctx, ri), ri, rt.end
+}
+
+// requestTrace holds all of the spans recorded for a single request (shared between forked Instrumentors)
+type requestTrace struct {
+	tracer *Tracer
+	method string
+
+	mutex   sync.Mutex
+	root    *Span
+	trace   *tracecontext.Context
+	spans   []*Span
+	dropped int
+	ended   bool
+}
+
+func (rt *requestTrace) end() {
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	if rt.ended {
+		return
+	}
+
+	rt.ended = true
+	rt.root.End = time.Now()
+
+	t := rt.tracer
+
+	tc := rt.trace
+
+	if tc == nil {
+		// Trace context propagation is not enabled (or the request was rejected before it was parsed)
+		tc = &tracecontext.Context{TraceID: tracecontext.NewTraceID(), SpanID: rt.root.SpanID}
+	}
+
+	if !t.sampled(tc) || t.queue == nil {
+		return
+	}
+
+	if rt.dropped > 0 {
+		t.setAttribute(rt.root, DroppedSpansAttribute, rt.dropped)
+	}
+
+	spans := make([]*Span, 0, len(rt.spans)+1)
+	spans = append(spans, rt.root)
+	spans = append(spans, rt.spans...)
+
+	for _, s := range spans {
+
+		s.TraceID = tc.TraceID
+
+		if s.parent != nil {
+			s.ParentSpanID = s.parent.SpanID
+		}
+
+		if s.End.IsZero() {
+			// Still running when the request finished
+			s.End = rt.root.End
+		}
+	}
+
+	t.enqueue(spans)
+}
+
+// startSpan creates a child of the supplied parent, or returns nil if the request already has the maximum number of spans
+func (rt *requestTrace) startSpan(parent *Span, name string, metadata []interface{}) *Span {
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	t := rt.tracer
+
+	if rt.ended || (t.MaxSpans > 0 && len(rt.spans)+1 >= t.MaxSpans) {
+		rt.dropped++
+		return nil
+	}
+
+	s := new(Span)
+	s.SpanID = tracecontext.NewSpanID()
+	s.Name = name
+	s.Kind = InternalSpan
+	s.Start = time.Now()
+	s.parent = parent
+
+	rt.applyMetadata(s, metadata)
+
+	rt.spans = append(rt.spans, s)
+
+	return s
+}
+
+func (rt *requestTrace) applyMetadata(s *Span, metadata []interface{}) {
+
+	t := rt.tracer
+
+	for i, m := range metadata {
+
+		switch v := m.(type) {
+		case map[string]interface{}:
+			for k, a := range v {
+				t.setAttribute(s, k, a)
+			}
+		case map[string]string:
+			for k, a := range v {
+				t.setAttribute(s, k, a)
+			}
+		default:
+			t.setAttribute(s, "metadata."+strconv.Itoa(i), v)
+		}
+	}
+}
+
+// endSpan records the span's end time. The metadata is applied again as entries may have been added to metadata maps
+// while the event was running (e.g. the number of rows returned by a query).
+func (rt *requestTrace) endSpan(s *Span, metadata []interface{}) {
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	// Spans are handed to the exporter once the request has ended
+	if !rt.ended && s.End.IsZero() {
+		s.End = time.Now()
+		rt.applyMetadata(s, metadata)
+	}
+}
+
+func (rt *requestTrace) amend(additional instrument.Additional, value interface{}) {
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	if rt.ended {
+		return
+	}
+
+	t := rt.tracer
+	root := rt.root
+
+	switch additional {
+	case instrument.Trace:
+
+		if tc, found := value.(*tracecontext.Context); found {
+			// Join the caller's trace
+			rt.trace = tc
+			root.SpanID = tc.SpanID
+			root.ParentSpanID = tc.ParentSpanID
+			root.TraceState = tc.State
+		}
+
+	case instrument.RequestID:
+		t.setAttribute(root, RequestIDAttribute, value)
+
+	case instrument.RequestVersion:
+		t.setAttribute(root, RequestVersionAttribute, fmt.Sprint(value))
+
+	case instrument.UserIdentity:
+
+		if ci, found := value.(iam.ClientIdentity); found && ci.Authenticated() {
+			t.setAttribute(root, UserAttribute, ci.LoggableUserID())
+		}
+
+	case instrument.Handler:
+
+		if cn, found := value.(ioc.ComponentNamer); found {
+			t.setAttribute(root, HandlerAttribute, cn.ComponentName())
+			root.Name = rt.method + " " + cn.ComponentName()
+		}
+
+	case instrument.ResponseStatus:
+
+		if s, found := value.(int); found {
+			t.setAttribute(root, StatusAttribute, s)
+			root.Error = s >= http.StatusInternalServerError
+		}
+	}
+}
+
+// spanInstrumentor creates child spans for a single goroutine. open holds the spans started (and not yet ended) by
+// this Instrumentor, with the span that was open when the Instrumentor was forked at the bottom.
+type spanInstrumentor struct {
+	trace *requestTrace
+	mutex sync.Mutex
+	open  []*Span
+}
+
+func (si *spanInstrumentor) StartEvent(id string, metadata ...interface{}) instrument.EndEvent {
+
+	si.mutex.Lock()
+	parent := si.open[len(si.open)-1]
+	si.mutex.Unlock()
+
+	s := si.trace.startSpan(parent, id, metadata)
+
+	if s == nil {
+		return func() {}
+	}
+
+	si.mutex.Lock()
+	si.open = append(si.open, s)
+	si.mutex.Unlock()
+
+	return func() {
+		si.trace.endSpan(s, metadata)
+		si.closed(s)
+	}
+}
+
+// closed removes an ended span from the open spans (spans are normally, but not necessarily, ended in reverse order)
+func (si *spanInstrumentor) closed(s *Span) {
+
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+
+	for i := len(si.open) - 1; i > 0; i-- {
+
+		if si.open[i] == s {
+			si.open = append(si.open[:i], si.open[i+1:]...)
+			return
+		}
+	}
+}
+
+// Fork returns an Instrumentor whose spans are children of the span that is currently open
+func (si *spanInstrumentor) Fork(ctx context.Context) (context.Context, instrument.Instrumentor) {
+
+	si.mutex.Lock()
+	parent := si.open[len(si.open)-1]
+	si.mutex.Unlock()
+
+	fi := &spanInstrumentor{trace: si.trace, open: []*Span{parent}}
+
+	return instrument.AddInstrumentorToContext(ctx, fi), fi
+}
+
+// Integrate does nothing - spans created by forked Instrumentors are recorded as soon as they start
+func (si *spanInstrumentor) Integrate(instrumentor instrument.Instrumentor) {
+}
+
+func (si *spanInstrumentor) Amend(additional instrument.Additional, value interface{}) {
+	si.trace.amend(additional, value)
+}
@@ -0,0 +1,408 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package tracing records the work done while processing web service requests as spans and exports them to a distributed
+tracing system.
+
+Most applications will not use the types in this package directly. Instead they will enable the Tracing facility (see
+the facility/tracing package), which creates a Tracer that is automatically used by the HTTPServer facility to instrument
+every request.
+
+Spans
+
+A root span is created for each request. Each call to instrument.Event or instrument.Method (or any other use of
+Instrumentor.StartEvent) made while the request is being processed creates a child span of the span that was open when
+the call was made:
+
+	func (rl *RecordLogic) Process(ctx context.Context, req *ws.Request, res *ws.Response) {
+		defer instrument.Method(ctx)()
+		...
+	}
+
+Goroutines started while processing a request should use Instrumentor.Fork to obtain their own context so that their
+spans are attributed to the correct parent.
+
+If W3C trace context propagation is enabled in the HTTPServer facility, the root span joins the caller's trace (using
+the trace ID and span ID from the request's tracecontext.Context). Otherwise a new trace is started for each request.
+
+The root span carries the request's method, path, ID, version, user and status (as they become known) as attributes.
+
+Sampling
+
+Traces started by a caller that has decided whether or not the trace should be recorded (the sampled flag in the
+traceparent header) follow the caller's decision. Otherwise a proportion of traces (SampleRate) is recorded, based on
+the trace ID, so that every service in a trace makes the same decision.
+
+Exporting
+
+Finished traces are queued and exported in batches by a background goroutine so that requests are never delayed by
+the tracing system. Traces are dropped if the queue is full. Spans are exported in the OTLP/JSON format (see
+https://opentelemetry.io/docs/specs/otlp/) either to a collector over HTTP (OTLPExporter) or to a file with one export
+request per line (FileExporter).
+*/
+package tracing
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/tracecontext"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// SpanKind indicates the relationship between a span and the work it represents
+type SpanKind int
+
+const (
+	// InternalSpan represents an operation within the application (the default for spans created by StartEvent)
+	InternalSpan SpanKind = 1
+
+	// ServerSpan represents the handling of a request from a remote caller
+	ServerSpan SpanKind = 2
+)
+
+const (
+	defaultBatchSize     = 512
+	defaultQueueSize     = 2048
+	defaultFlushInterval = 5 * time.Second
+	stopTimeout          = 10 * time.Second
+)
+
+// Span is a single timed operation within a trace.
+type Span struct {
+	// 32 lowercase hex characters identifying the trace the span belongs to.
+	TraceID string
+
+	// 16 lowercase hex characters identifying the span.
+	SpanID string
+
+	// The span that started this span (empty for a span with no parent in the trace).
+	ParentSpanID string
+
+	// The tracestate propagated by the caller (only set on root spans).
+	TraceState string
+
+	// A description of the operation (e.g. the ID passed to StartEvent)
+	Name string
+
+	// The relationship between the span and the work it represents.
+	Kind SpanKind
+
+	// When the operation started and ended.
+	Start time.Time
+	End   time.Time
+
+	// Additional information about the operation. Values are strings, bools, int64s or float64s.
+	Attributes map[string]interface{}
+
+	// The number of attributes that were discarded because the span already had the maximum number of attributes.
+	DroppedAttributes int
+
+	// Whether or not the operation failed.
+	Error bool
+
+	// parent is resolved to ParentSpanID when the span is exported, as the root span's ID may change after child spans
+	// have started
+	parent *Span
+}
+
+// Resource describes the application that created a set of spans.
+type Resource struct {
+	// The name of the service (service.name)
+	ServiceName string
+
+	// The ID of the application instance (service.instance.id)
+	InstanceID string
+}
+
+// Exporter sends finished spans to a tracing system.
+type Exporter interface {
+	// Export sends a batch of spans created by the supplied resource.
+	Export(resource Resource, spans []*Span) error
+}
+
+// Tracer is an implementation of instrument.RequestInstrumentationManager that records spans for web service requests
+// and periodically exports them using an Exporter.
+type Tracer struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// The component that sends finished spans to a tracing system.
+	Exporter Exporter
+
+	// The name of the service recorded with each span. If empty, the application's instance ID is used.
+	ServiceName string
+
+	// The proportion (0 to 1) of new traces that are recorded.
+	SampleRate float64
+
+	// The maximum number of attributes a span may have. Additional attributes are discarded. Zero or less means no limit.
+	MaxAttributes int
+
+	// The maximum length (in bytes) of string attribute values. Longer values are truncated. Zero or less means no limit.
+	MaxAttributeLength int
+
+	// The maximum number of spans (including the root span) recorded for a request. Zero or less means no limit.
+	MaxSpans int
+
+	// The maximum number of spans sent to the Exporter at once. Defaults to 512.
+	BatchSize int
+
+	// The maximum number of traces waiting to be exported. Defaults to 2048.
+	QueueSize int
+
+	// How often (in milliseconds) queued spans are exported if a full batch has not been collected. Defaults to 5000.
+	FlushIntervalMS int
+
+	instanceID string
+	queue      chan []*Span
+	stop       chan struct{}
+	stopped    chan struct{}
+	stopOnce   sync.Once
+	dropped    uint64
+}
+
+// RegisterInstanceID implements instance.Receiver
+func (t *Tracer) RegisterInstanceID(i *instance.Identifier) {
+	t.instanceID = i.ID
+}
+
+// StartComponent checks the Tracer's configuration and starts exporting spans.
+func (t *Tracer) StartComponent() error {
+
+	if t.queue != nil {
+		return nil
+	}
+
+	if t.Exporter == nil {
+		return fmt.Errorf("tracers must have an Exporter set")
+	}
+
+	if t.SampleRate < 0 || t.SampleRate > 1 {
+		return fmt.Errorf("tracer SampleRate must be between 0 and 1 (was %v)", t.SampleRate)
+	}
+
+	if t.BatchSize <= 0 {
+		t.BatchSize = defaultBatchSize
+	}
+
+	if t.QueueSize <= 0 {
+		t.QueueSize = defaultQueueSize
+	}
+
+	t.queue = make(chan []*Span, t.QueueSize)
+	t.stop = make(chan struct{})
+	t.stopped = make(chan struct{})
+
+	go t.exportLoop()
+
+	return nil
+}
+
+// PrepareToStop does nothing - spans continue to be recorded until the application stops.
+func (t *Tracer) PrepareToStop() {
+}
+
+// ReadyToStop always returns true
+func (t *Tracer) ReadyToStop() (bool, error) {
+	return true, nil
+}
+
+// Stop exports any queued spans (waiting up to ten seconds) and stops the Tracer.
+func (t *Tracer) Stop() error {
+
+	if t.stop == nil {
+		return nil
+	}
+
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+
+	select {
+	case <-t.stopped:
+	case <-time.After(stopTimeout):
+		return fmt.Errorf("timed out waiting for spans to be exported")
+	}
+
+	if c, found := t.Exporter.(closer); found {
+		return c.Close()
+	}
+
+	return nil
+}
+
+type closer interface {
+	Close() error
+}
+
+// Dropped returns the number of traces that have been discarded because the export queue was full.
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// sampled decides whether a finished trace should be exported
+func (t *Tracer) sampled(tc *tracecontext.Context) bool {
+
+	if tc.ParentSpanID != "" {
+		// The caller has already decided
+		return tc.Sampled()
+	}
+
+	return withinRate(tc.TraceID, t.SampleRate)
+}
+
+// withinRate consistently maps a trace ID to a number between 0 and 1 and checks whether it is less than the rate
+func withinRate(traceID string, rate float64) bool {
+
+	if rate >= 1 {
+		return true
+	}
+
+	if rate <= 0 || len(traceID) < 16 {
+		return false
+	}
+
+	v, err := strconv.ParseUint(traceID[len(traceID)-16:], 16, 64)
+
+	if err != nil {
+		return false
+	}
+
+	return float64(v>>11)/float64(1<<53) < rate
+}
+
+func (t *Tracer) enqueue(spans []*Span) {
+
+	select {
+	case t.queue <- spans:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) exportLoop() {
+
+	defer close(t.stopped)
+
+	interval := defaultFlushInterval
+
+	if t.FlushIntervalMS > 0 {
+		interval = time.Duration(t.FlushIntervalMS) * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	var reported uint64
+
+	flush := func() {
+
+		if d := t.Dropped(); d != reported {
+			t.FrameworkLogger.LogWarnf("%d traces have been dropped because the tracing export queue was full", d-reported)
+			reported = d
+		}
+
+		for len(batch) > 0 {
+
+			n := t.BatchSize
+
+			if n > len(batch) {
+				n = len(batch)
+			}
+
+			if err := t.Exporter.Export(t.resource(), batch[:n]); err != nil {
+				t.FrameworkLogger.LogErrorf("Unable to export %d spans: %s", n, err.Error())
+			}
+
+			batch = batch[n:]
+		}
+
+		batch = nil
+	}
+
+	for {
+		select {
+		case spans := <-t.queue:
+			batch = append(batch, spans...)
+
+			if len(batch) >= t.BatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-t.stop:
+			for {
+				select {
+				case spans := <-t.queue:
+					batch = append(batch, spans...)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) resource() Resource {
+
+	r := Resource{ServiceName: t.ServiceName, InstanceID: t.instanceID}
+
+	if r.ServiceName == "" {
+		r.ServiceName = t.instanceID
+	}
+
+	return r
+}
+
+// setAttribute records an attribute on the span, applying the Tracer's limits
+func (t *Tracer) setAttribute(s *Span, key string, value interface{}) {
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+
+	if _, found := s.Attributes[key]; !found && t.MaxAttributes > 0 && len(s.Attributes) >= t.MaxAttributes {
+		s.DroppedAttributes++
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		value = t.truncate(v)
+	case bool, int64, float64:
+	case int:
+		value = int64(v)
+	case float32:
+		value = float64(v)
+	default:
+		value = t.truncate(fmt.Sprint(v))
+	}
+
+	s.Attributes[key] = value
+}
+
+func (t *Tracer) truncate(s string) string {
+
+	max := t.MaxAttributeLength
+
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+
+	// Don't split a multi-byte character
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+
+	return s[:max]
+}
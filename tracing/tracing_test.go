@@ -0,0 +1,328 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/graniticio/granitic/v2/iam"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/instrument"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/tracecontext"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRequestSpans(t *testing.T) {
+
+	e := new(recordingExporter)
+	tr := newTracer(e)
+
+	req := httptest.NewRequest("GET", "/artist/1", nil)
+	req.Header.Set("User-Agent", "test-agent")
+
+	ctx, ri, end := tr.Begin(context.Background(), nil, req)
+
+	caller := &tracecontext.Context{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentSpanID: "00f067aa0ba902b7", SpanID: "b7ad6b7169203331", Flags: tracecontext.SampledFlag, State: "vendor=x"}
+
+	endLogic := instrument.Event(ctx, "logic", map[string]interface{}{"artist": 1})
+
+	ri.Amend(instrument.Trace, caller)
+	ri.Amend(instrument.RequestID, "req-1")
+	ri.Amend(instrument.UserIdentity, iam.NewAuthenticatedIdentity("alice"))
+	ri.Amend(instrument.Handler, &namedHandler{"artistHandler"})
+
+	qm := map[string]interface{}{"db.qid": "ARTIST"}
+	endQuery := instrument.Event(ctx, "query", qm)
+
+	fctx, forked := ri.Fork(ctx)
+	endForked := instrument.Event(fctx, "async")
+	endForked()
+	ri.Integrate(forked)
+
+	qm["db.rows"] = 1
+	endQuery()
+	endLogic()
+
+	instrument.Event(ctx, "sibling")()
+
+	ri.Amend(instrument.ResponseStatus, 503)
+	end()
+	end()
+
+	test.ExpectNil(t, tr.Stop())
+
+	spans := e.all()
+
+	test.ExpectInt(t, len(spans), 5)
+
+	byName := make(map[string]*Span)
+
+	for _, s := range spans {
+		test.ExpectString(t, s.TraceID, caller.TraceID)
+		byName[s.Name] = s
+
+		if s.End.Before(s.Start) {
+			t.Errorf("Span %s ended before it started", s.Name)
+		}
+	}
+
+	root := byName["GET artistHandler"]
+
+	test.ExpectString(t, root.SpanID, caller.SpanID)
+	test.ExpectString(t, root.ParentSpanID, caller.ParentSpanID)
+	test.ExpectString(t, root.TraceState, "vendor=x")
+	test.ExpectBool(t, root.Error, true)
+	test.ExpectBool(t, root.Kind == ServerSpan, true)
+
+	test.ExpectString(t, root.Attributes[MethodAttribute].(string), "GET")
+	test.ExpectString(t, root.Attributes[PathAttribute].(string), "/artist/1")
+	test.ExpectString(t, root.Attributes[UserAgentAttribute].(string), "test-agent")
+	test.ExpectString(t, root.Attributes[RequestIDAttribute].(string), "req-1")
+	test.ExpectString(t, root.Attributes[UserAttribute].(string), "alice")
+	test.ExpectString(t, root.Attributes[HandlerAttribute].(string), "artistHandler")
+	test.ExpectBool(t, root.Attributes[StatusAttribute].(int64) == 503, true)
+
+	test.ExpectString(t, byName["logic"].ParentSpanID, root.SpanID)
+	test.ExpectBool(t, byName["logic"].Attributes["artist"].(int64) == 1, true)
+	test.ExpectString(t, byName["query"].ParentSpanID, byName["logic"].SpanID)
+	test.ExpectString(t, byName["query"].Attributes["db.qid"].(string), "ARTIST")
+	test.ExpectBool(t, byName["query"].Attributes["db.rows"].(int64) == 1, true)
+	test.ExpectString(t, byName["async"].ParentSpanID, byName["query"].SpanID)
+	test.ExpectString(t, byName["sibling"].ParentSpanID, root.SpanID)
+}
+
+func TestSampling(t *testing.T) {
+
+	e := new(recordingExporter)
+	tr := newTracer(e)
+	tr.SampleRate = 0
+
+	// Caller decided not to sample
+	_, ri, end := tr.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+	ri.Amend(instrument.Trace, &tracecontext.Context{TraceID: tracecontext.NewTraceID(), ParentSpanID: "00f067aa0ba902b7", SpanID: tracecontext.NewSpanID()})
+	end()
+
+	// New trace, rate of zero
+	_, _, end = tr.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+	end()
+
+	// Caller decided to sample
+	_, ri, end = tr.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+	ri.Amend(instrument.Trace, &tracecontext.Context{TraceID: tracecontext.NewTraceID(), ParentSpanID: "00f067aa0ba902b7", SpanID: tracecontext.NewSpanID(), Flags: tracecontext.SampledFlag})
+	end()
+
+	tr.Stop()
+
+	test.ExpectInt(t, len(e.all()), 1)
+
+	test.ExpectBool(t, withinRate("4bf92f3577b34da6a3ce929d0e0e4736", 1), true)
+	test.ExpectBool(t, withinRate("4bf92f3577b34da60000000000000000", 0.01), true)
+	test.ExpectBool(t, withinRate("4bf92f3577b34da6ffffffffffffffff", 0.99), false)
+	test.ExpectBool(t, withinRate("4bf92f3577b34da67fffffffffffffff", 0.5), true)
+	test.ExpectBool(t, withinRate("4bf92f3577b34da68000000000000000", 0.5), false)
+}
+
+func TestLimits(t *testing.T) {
+
+	e := new(recordingExporter)
+	tr := newTracer(e)
+	tr.MaxSpans = 2
+	tr.MaxAttributes = 6
+	tr.MaxAttributeLength = 4
+
+	req := httptest.NewRequest("GET", "/long/path", nil)
+	req.Header.Set("User-Agent", "agent")
+
+	ctx, ri, end := tr.Begin(context.Background(), nil, req)
+
+	instrument.Event(ctx, "one", "é€xyz")()
+	instrument.Event(ctx, "two")()
+
+	ri.Amend(instrument.RequestID, "abc")
+	ri.Amend(instrument.ResponseStatus, 200)
+	ri.Amend(instrument.Handler, &namedHandler{"h"})
+
+	end()
+	tr.Stop()
+
+	spans := e.all()
+
+	test.ExpectInt(t, len(spans), 2)
+
+	root := spans[0]
+
+	test.ExpectString(t, root.Attributes[PathAttribute].(string), "/lon")
+	test.ExpectInt(t, len(root.Attributes), 6)
+	test.ExpectInt(t, root.DroppedAttributes, 2)
+
+	// Truncation does not split characters
+	test.ExpectString(t, spans[1].Attributes["metadata.0"].(string), "é")
+}
+
+func TestTracerConfiguration(t *testing.T) {
+
+	tr := new(Tracer)
+
+	if tr.StartComponent() == nil {
+		t.Errorf("Expected error when no exporter set")
+	}
+
+	tr.Exporter = new(recordingExporter)
+	tr.SampleRate = 2
+
+	if tr.StartComponent() == nil {
+		t.Errorf("Expected error with invalid sample rate")
+	}
+}
+
+func TestEncodeOTLP(t *testing.T) {
+
+	s := &Span{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Name: "GET", Kind: ServerSpan, Error: true,
+		Attributes: map[string]interface{}{"s": "v", "i": int64(3), "b": true, "f": 1.5}}
+
+	b, err := EncodeOTLP(Resource{InstanceID: "blue"}, []*Span{s})
+
+	test.ExpectNil(t, err)
+
+	var r map[string]interface{}
+	test.ExpectNil(t, json.Unmarshal(b, &r))
+
+	rs := r["resourceSpans"].([]interface{})[0].(map[string]interface{})
+
+	ra := rs["resource"].(map[string]interface{})["attributes"].([]interface{})
+	test.ExpectInt(t, len(ra), 2)
+
+	service := ra[0].(map[string]interface{})
+	test.ExpectString(t, service["key"].(string), "service.instance.id")
+
+	span := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+
+	test.ExpectString(t, span["traceId"].(string), s.TraceID)
+	test.ExpectInt(t, int(span["kind"].(float64)), 2)
+	test.ExpectInt(t, int(span["status"].(map[string]interface{})["code"].(float64)), 2)
+
+	if !strings.Contains(string(b), `{"key":"i","value":{"intValue":"3"}}`) || !strings.Contains(string(b), `"service.name","value":{"stringValue":"unknown_service"}`) {
+		t.Errorf("Unexpected encoding %s", b)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+
+	var received []byte
+	var auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		auth = r.Header.Get("Authorization")
+
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("no such path"))
+		}
+	}))
+	defer srv.Close()
+
+	e := &OTLPExporter{Endpoint: srv.URL + "/v1/traces", Headers: map[string]string{"Authorization": "Bearer x"}}
+
+	test.ExpectNil(t, e.Export(Resource{ServiceName: "svc"}, []*Span{{Name: "GET"}}))
+	test.ExpectString(t, auth, "Bearer x")
+
+	if !strings.Contains(string(received), `"name":"GET"`) {
+		t.Errorf("Unexpected body %s", received)
+	}
+
+	e = &OTLPExporter{Endpoint: srv.URL + "/wrong"}
+
+	err := e.Export(Resource{}, []*Span{{Name: "GET"}})
+
+	if err == nil || !strings.Contains(err.Error(), "404 no such path") {
+		t.Errorf("Expected error including collector response, got %v", err)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tracing")
+	test.ExpectNil(t, err)
+	defer os.RemoveAll(dir)
+
+	e := &FileExporter{Path: filepath.Join(dir, "traces.jsonl")}
+
+	tr := newTracer(e)
+
+	_, _, end := tr.Begin(context.Background(), nil, httptest.NewRequest("GET", "/", nil))
+	end()
+
+	test.ExpectNil(t, tr.Stop())
+
+	f, err := os.Open(e.Path)
+	test.ExpectNil(t, err)
+	defer f.Close()
+
+	lines := 0
+
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+
+		var r map[string]interface{}
+
+		test.ExpectNil(t, json.Unmarshal(s.Bytes(), &r))
+	}
+
+	test.ExpectInt(t, lines, 1)
+}
+
+func newTracer(e Exporter) *Tracer {
+
+	tr := new(Tracer)
+	tr.FrameworkLogger = new(logging.NullLogger)
+	tr.Exporter = e
+	tr.SampleRate = 1
+	tr.RegisterInstanceID(&instance.Identifier{ID: "test"})
+
+	if err := tr.StartComponent(); err != nil {
+		panic(err)
+	}
+
+	return tr
+}
+
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+func (re *recordingExporter) Export(resource Resource, spans []*Span) error {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+
+	re.spans = append(re.spans, spans...)
+
+	return nil
+}
+
+func (re *recordingExporter) all() []*Span {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+
+	return re.spans
+}
+
+type namedHandler struct {
+	name string
+}
+
+func (nh *namedHandler) ComponentName() string {
+	return nh.name
+}
+
+func (nh *namedHandler) SetComponentName(name string) {
+	nh.name = name
+}
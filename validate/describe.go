@@ -0,0 +1,160 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package validate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	rangeSep    = "|"
+	rangeOpCode = "RANGE"
+)
+
+// FieldConstraints summarises the checks a RuleValidator makes on a single field in a form suitable for documenting
+// the field (for example as part of an OpenAPI schema). Checks that cannot be expressed as a simple constraint
+// (external components, mutual exclusivity etc) are not included.
+type FieldConstraints struct {
+	// The field (or dot-separated path to a field) the rule applies to.
+	Field string
+
+	// The rule type (STR, INT, FLOAT, BOOL, OBJ or SLICE).
+	Type string
+
+	// Whether or not the field must be set (REQ).
+	Required bool
+
+	// The minimum and maximum length of a string or number of elements in a slice (LEN). Nil if not checked.
+	MinLength *int
+	MaxLength *int
+
+	// The minimum and maximum value of an int or float (RANGE). Nil if not checked.
+	Minimum *float64
+	Maximum *float64
+
+	// A regular expression a string must match (REG).
+	Pattern string
+
+	// The values a string, int or float must be one of (IN).
+	In []string
+}
+
+// Constraints summarises each of the RuleValidator's rules (including rules shared via the RuleManager). The rules are
+// not required to have been parsed by StartComponent.
+func (ov *RuleValidator) Constraints() ([]*FieldConstraints, error) {
+
+	var fcs []*FieldConstraints
+
+	for _, rule := range ov.Rules {
+
+		if len(rule) < 2 {
+			return nil, fmt.Errorf("Rule is invalid (must have at least an identifier and a type). Supplied rule is: %q", rule)
+		}
+
+		field := rule[0]
+		ops := rule[1:]
+
+		if ov.isRuleRef(rule[1]) {
+
+			var err error
+
+			if ops, err = ov.findRule(field, rule[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		fc, err := summariseRule(field, ops)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fcs = append(fcs, fc)
+	}
+
+	return fcs, nil
+}
+
+func summariseRule(field string, ops []string) (*FieldConstraints, error) {
+
+	fc := new(FieldConstraints)
+	fc.Field = field
+
+	for _, op := range ops {
+
+		d := decomposeOperation(op)
+
+		switch d[0] {
+		case stringRuleCode, intRuleCode, floatRuleCode, boolRuleCode, objectRuleCode, sliceRuleCode:
+			fc.Type = d[0]
+
+		case commonOpRequired:
+			fc.Required = true
+
+		case commonOpLen:
+			if len(d) < 2 {
+				continue
+			}
+
+			bounds := strings.SplitN(d[1], "-", 2)
+
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("Length parameters for field %s are invalid. Values provided: %s", field, d[1])
+			}
+
+			fc.MinLength = optionalInt(bounds[0])
+			fc.MaxLength = optionalInt(bounds[1])
+
+		case rangeOpCode:
+			if len(d) < 2 {
+				continue
+			}
+
+			bounds := strings.SplitN(d[1], rangeSep, 2)
+
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("Range parameters for field %s are invalid. Values provided: %s", field, d[1])
+			}
+
+			fc.Minimum = optionalFloat(bounds[0])
+			fc.Maximum = optionalFloat(bounds[1])
+
+		case stringOpRegCode:
+			if len(d) > 1 {
+				fc.Pattern = d[1]
+			}
+
+		case commonOpIn:
+			if len(d) > 1 {
+				fc.In = strings.SplitN(d[1], setMemberSep, -1)
+			}
+		}
+	}
+
+	if fc.Type == "" {
+		return nil, fmt.Errorf("Unable to determine the type of rule from the rule definition for field %s: %v", field, ops)
+	}
+
+	return fc, nil
+}
+
+func optionalInt(s string) *int {
+
+	if i, err := strconv.Atoi(s); err == nil {
+		return &i
+	}
+
+	return nil
+}
+
+func optionalFloat(s string) *float64 {
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return &f
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package validate
+
+import (
+	"github.com/graniticio/granitic/v2/test"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+
+	ov := new(RuleValidator)
+	ov.Rules = [][]string{
+		{"CatalogRef", "STR", "REQ:CATALOG_REF_MISSING", "HARDTRIM", "BREAK", "REG:^[A-Z]{3}::[\\d]{6}$:CATALOG_REF"},
+		{"Name", "STR:RECORD_NAME", "LEN:1-128"},
+		{"Genre", "STR", "IN:rock,jazz"},
+		{"Year", "INT", "RANGE:1900|"},
+		{"Tracks", "SLICE:TRACK_COUNT", "LEN:-100", "ELEM:trackName"},
+		{"Price", "RULE:price"},
+	}
+
+	ov.RuleManager = &UnparsedRuleManager{Rules: map[string][]string{"price": {"FLOAT", "REQ", "RANGE:0.01|999.99"}}}
+
+	fcs, err := ov.Constraints()
+
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, len(fcs), 6)
+
+	c := fcs[0]
+	test.ExpectString(t, c.Type, "STR")
+	test.ExpectBool(t, c.Required, true)
+	test.ExpectString(t, c.Pattern, "^[A-Z]{3}:[\\d]{6}$")
+
+	c = fcs[1]
+	test.ExpectBool(t, c.Required, false)
+	test.ExpectInt(t, *c.MinLength, 1)
+	test.ExpectInt(t, *c.MaxLength, 128)
+
+	c = fcs[2]
+	test.ExpectInt(t, len(c.In), 2)
+	test.ExpectString(t, c.In[1], "jazz")
+
+	c = fcs[3]
+	test.ExpectString(t, c.Type, "INT")
+	test.ExpectBool(t, *c.Minimum == 1900, true)
+	test.ExpectBool(t, c.Maximum == nil, true)
+
+	c = fcs[4]
+	test.ExpectString(t, c.Type, "SLICE")
+	test.ExpectBool(t, c.MinLength == nil, true)
+	test.ExpectInt(t, *c.MaxLength, 100)
+
+	c = fcs[5]
+	test.ExpectString(t, c.Field, "Price")
+	test.ExpectString(t, c.Type, "FLOAT")
+	test.ExpectBool(t, c.Required, true)
+	test.ExpectBool(t, *c.Maximum == 999.99, true)
+
+	ov.Rules = [][]string{{"Unknown", "REQ"}}
+
+	_, err = ov.Constraints()
+	test.ExpectNotNil(t, err)
+}
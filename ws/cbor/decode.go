@@ -0,0 +1,394 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/ws/wire"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+
+	falseCode     = 0xf4
+	trueCode      = 0xf5
+	nullCode      = 0xf6
+	undefinedCode = 0xf7
+	float16Code   = 0xf9
+	float32Code   = 0xfa
+	float64Code   = 0xfb
+	breakCode     = 0xff
+
+	indefinite = 31
+
+	epochTag = 1
+)
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+// Unmarshal parses the CBOR encoded data and stores the result in the value pointed to by v, using the same rules as
+// Go's json.Unmarshal. Indefinite length items are supported. Epoch-based dates (tag 1) are converted to RFC 3339
+// strings so they can be stored in time.Time fields; the content of any other tagged item is used as-is.
+func Unmarshal(b []byte, v interface{}) error {
+
+	d := &decoder{data: b}
+
+	data, err := d.decode(0)
+
+	if err != nil {
+		return err
+	}
+
+	if d.pos != len(d.data) {
+		return errors.New("cbor: unexpected data after top-level value")
+	}
+
+	return wire.ToGo(data, v)
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) read(n uint64) ([]byte, error) {
+
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated
+	}
+
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return b, nil
+}
+
+func (d *decoder) readUint(size int) (uint64, error) {
+
+	b, err := d.read(uint64(size))
+
+	if err != nil {
+		return 0, err
+	}
+
+	var buf [8]byte
+	copy(buf[8-size:], b)
+
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// readHead reads the initial byte of a data item and its argument. For indefinite length items the returned
+// argument is meaningless and the returned bool is true.
+func (d *decoder) readHead() (byte, byte, uint64, bool, error) {
+
+	b, err := d.read(1)
+
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info <= 27:
+		n, err := d.readUint(1 << (info - 24))
+		return major, info, n, false, err
+	case info == indefinite:
+		return major, info, 0, true, nil
+	}
+
+	return 0, 0, 0, false, fmt.Errorf("cbor: invalid additional information %d", info)
+}
+
+func (d *decoder) atBreak() bool {
+
+	if d.pos < len(d.data) && d.data[d.pos] == breakCode {
+		d.pos++
+		return true
+	}
+
+	return false
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+
+	if depth > wire.MaxDepth {
+		return nil, wire.ErrMaxDepth
+	}
+
+	major, info, n, indef, err := d.readHead()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if indef && (major < majorBytes || major > majorMap) {
+
+		if major == majorSimple {
+			return nil, errors.New("cbor: unexpected break")
+		}
+
+		return nil, fmt.Errorf("cbor: major type %d cannot have an indefinite length", major)
+	}
+
+	switch major {
+	case majorUint:
+
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+
+		return n, nil
+
+	case majorNegInt:
+
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer is too large")
+		}
+
+		return -1 - int64(n), nil
+
+	case majorBytes, majorText:
+
+		b, err := d.decodeBytes(major, n, indef)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if major == majorText {
+			return string(b), nil
+		}
+
+		return b, nil
+
+	case majorArray:
+		return d.decodeArray(n, indef, depth)
+
+	case majorMap:
+		return d.decodeMap(n, indef, depth)
+
+	case majorTag:
+
+		content, err := d.decode(depth + 1)
+
+		if err != nil || n != epochTag {
+			return content, err
+		}
+
+		return epochToString(content)
+	}
+
+	switch info {
+	case falseCode & 0x1f:
+		return false, nil
+	case trueCode & 0x1f:
+		return true, nil
+	case nullCode & 0x1f, undefinedCode & 0x1f:
+		return nil, nil
+	case float16Code & 0x1f:
+		return halfToFloat(uint16(n)), nil
+	case float32Code & 0x1f:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case float64Code & 0x1f:
+		return math.Float64frombits(n), nil
+	}
+
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+}
+
+func (d *decoder) decodeBytes(major byte, n uint64, indef bool) ([]byte, error) {
+
+	if !indef {
+
+		b, err := d.read(n)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c := make([]byte, len(b))
+		copy(c, b)
+
+		return c, nil
+	}
+
+	// An indefinite length string is a series of definite length chunks of the same type
+	var b []byte
+
+	for !d.atBreak() {
+
+		cm, _, cn, cindef, err := d.readHead()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cm != major || cindef {
+			return nil, errors.New("cbor: invalid chunk in indefinite length string")
+		}
+
+		c, err := d.read(cn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b = append(b, c...)
+	}
+
+	if b == nil {
+		b = []byte{}
+	}
+
+	return b, nil
+}
+
+func (d *decoder) decodeArray(n uint64, indef bool, depth int) (interface{}, error) {
+
+	if indef {
+
+		a := make([]interface{}, 0)
+
+		for !d.atBreak() {
+
+			e, err := d.decode(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			a = append(a, e)
+		}
+
+		return a, nil
+	}
+
+	if n > uint64(len(d.data)-d.pos) {
+		// Every element takes up at least one byte, so the length cannot be valid
+		return nil, errTruncated
+	}
+
+	a := make([]interface{}, n)
+
+	for i := range a {
+
+		e, err := d.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		a[i] = e
+	}
+
+	return a, nil
+}
+
+func (d *decoder) decodeMap(n uint64, indef bool, depth int) (interface{}, error) {
+
+	if !indef && n > uint64(len(d.data)-d.pos)/2 {
+		return nil, errTruncated
+	}
+
+	m := make(wire.Map, 0, n)
+
+	for i := uint64(0); indef || i < n; i++ {
+
+		if indef && d.atBreak() {
+			break
+		}
+
+		k, err := d.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var e wire.Entry
+
+		switch key := k.(type) {
+		case string:
+			e.Key = key
+		case int64:
+			e.Key = strconv.FormatInt(key, 10)
+		case uint64:
+			e.Key = strconv.FormatUint(key, 10)
+		default:
+			return nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+		}
+
+		if e.Value, err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+
+		m = append(m, e)
+	}
+
+	return m, nil
+}
+
+func epochToString(content interface{}) (interface{}, error) {
+
+	var t time.Time
+
+	switch c := content.(type) {
+	case int64:
+		t = time.Unix(c, 0)
+	case uint64:
+		t = time.Unix(int64(c), 0)
+	case float64:
+		sec, frac := math.Modf(c)
+		t = time.Unix(int64(sec), int64(frac*1e9))
+	default:
+		return nil, fmt.Errorf("cbor: invalid content %T for an epoch-based date", content)
+	}
+
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float to a float64
+func halfToFloat(h uint16) float64 {
+
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		f = -f
+	}
+
+	return f
+}
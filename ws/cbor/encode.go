@@ -0,0 +1,131 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/graniticio/granitic/v2/ws/wire"
+	"math"
+)
+
+// Marshal returns the CBOR encoding of v, using the same rules as Go's json.Marshal to decide which fields are
+// encoded and how they are named.
+func Marshal(v interface{}) ([]byte, error) {
+
+	data, err := wire.FromGo(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	if err := encode(&b, data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func encode(b *bytes.Buffer, data interface{}) error {
+
+	switch d := data.(type) {
+	case nil:
+		b.WriteByte(nullCode)
+
+	case bool:
+
+		if d {
+			b.WriteByte(trueCode)
+		} else {
+			b.WriteByte(falseCode)
+		}
+
+	case int64:
+
+		if d >= 0 {
+			writeHead(b, majorUint, uint64(d))
+		} else {
+			// Negative integers are encoded as -1 - n
+			writeHead(b, majorNegInt, uint64(^d))
+		}
+
+	case uint64:
+		writeHead(b, majorUint, d)
+
+	case float64:
+		b.WriteByte(float64Code)
+		writeUint(b, math.Float64bits(d), 8)
+
+	case string:
+		writeHead(b, majorText, uint64(len(d)))
+		b.WriteString(d)
+
+	case []byte:
+		writeHead(b, majorBytes, uint64(len(d)))
+		b.Write(d)
+
+	case []interface{}:
+
+		writeHead(b, majorArray, uint64(len(d)))
+
+		for _, e := range d {
+			if err := encode(b, e); err != nil {
+				return err
+			}
+		}
+
+	case wire.Map:
+
+		writeHead(b, majorMap, uint64(len(d)))
+
+		for _, e := range d {
+
+			writeHead(b, majorText, uint64(len(e.Key)))
+			b.WriteString(e.Key)
+
+			if err := encode(b, e.Value); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("cbor: unable to encode %T", data)
+	}
+
+	return nil
+}
+
+// writeHead writes the initial byte (and any following argument bytes) of a data item, using the shortest form that
+// can hold the argument.
+func writeHead(b *bytes.Buffer, major byte, n uint64) {
+
+	switch {
+	case n < 24:
+		b.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(major<<5 | 24)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(major<<5 | 25)
+		writeUint(b, n, 2)
+	case n <= math.MaxUint32:
+		b.WriteByte(major<<5 | 26)
+		writeUint(b, n, 4)
+	default:
+		b.WriteByte(major<<5 | 27)
+		writeUint(b, n, 8)
+	}
+}
+
+func writeUint(b *bytes.Buffer, n uint64, size int) {
+
+	var buf [8]byte
+
+	binary.BigEndian.PutUint64(buf[:], n)
+
+	b.Write(buf[8-size:])
+}
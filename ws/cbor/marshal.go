@@ -0,0 +1,43 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package cbor defines types that are specific to handling web service requests and responses as CBOR (the Concise
+Binary Object Representation, RFC 8949). Components implementing these types will be created when you enable the CBORWs
+facility.
+
+Marshalling and unmarshalling
+
+The encoder and decoder in this package are self-contained and decide which fields of your types are sent and received
+using the same rules as Go's built-in json package - including json struct tags - so the same types can be used for
+JSON and CBOR web services. See the ws/wire package for details.
+
+Response wrapping and error formatting
+
+Responses are wrapped and service errors formatted by the same components used by the JSONWs facility
+(json.BodyOrErrorWrapper or json.GraniticJSONResponseWrapper and json.GraniticJSONErrorFormatter), so the structure of
+a CBOR response is identical to the equivalent JSON response.
+*/
+package cbor
+
+import (
+	"net/http"
+)
+
+// MarshalingWriter serialises a struct to CBOR and writes it to the HTTP response output stream.
+type MarshalingWriter struct {
+}
+
+// MarshalAndWrite serialises the supplied interface to CBOR and writes it to the HTTP response output stream.
+func (mw *MarshalingWriter) MarshalAndWrite(data interface{}, w http.ResponseWriter) error {
+
+	b, err := Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
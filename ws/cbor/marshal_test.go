@@ -0,0 +1,122 @@
+package cbor
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type item struct {
+	A int    `json:"a"`
+	B []int  `json:"b"`
+	C string `json:"c,omitempty"`
+}
+
+// Examples are taken from Appendix A of RFC 8949
+func TestMarshal(t *testing.T) {
+
+	b, err := Marshal(&item{A: 1, B: []int{2, 3}})
+	test.ExpectNil(t, err)
+	test.ExpectString(t, hex.EncodeToString(b), "a26161016162820203")
+
+	vectors := map[string]interface{}{
+		"00":                 0,
+		"17":                 23,
+		"1818":               24,
+		"1903e8":             1000,
+		"1bffffffffffffffff": uint64(18446744073709551615),
+		"20":                 -1,
+		"3903e7":             -1000,
+		"fb3ff8000000000000": 1.5,
+		"6161":               "a",
+		"4401020304":         []byte{1, 2, 3, 4},
+		"8201820203":         []interface{}{1, []int{2, 3}},
+		"f5":                 true,
+		"f6":                 nil,
+	}
+
+	for expected, v := range vectors {
+		b, err := Marshal(v)
+		test.ExpectNil(t, err)
+		test.ExpectString(t, hex.EncodeToString(b), expected)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+
+	for _, encoded := range []string{"a26161016162820203", "bf61610161629f0203ffff", "a3616101616282020361636161"} {
+
+		i := new(item)
+
+		test.ExpectNil(t, Unmarshal(mustDecodeHex(encoded), i))
+		test.ExpectInt(t, i.A, 1)
+		test.ExpectInt(t, len(i.B), 2)
+		test.ExpectInt(t, i.B[1], 3)
+	}
+
+	var f []float64
+	test.ExpectNil(t, Unmarshal(mustDecodeHex("83f93e00fa47c35000f97c00"), &f))
+	test.ExpectBool(t, f[0] == 1.5, true)
+	test.ExpectBool(t, f[1] == 100000, true)
+	test.ExpectBool(t, f[2] > 1e308, true)
+
+	var b []byte
+	test.ExpectNil(t, Unmarshal(mustDecodeHex("5f42010243030405ff"), &b))
+	test.ExpectInt(t, len(b), 5)
+
+	var s string
+	test.ExpectNil(t, Unmarshal(mustDecodeHex("7f657374726561646d696e67ff"), &s))
+	test.ExpectString(t, s, "streaming")
+
+	var d struct {
+		Epoch time.Time
+		Text  time.Time
+	}
+	test.ExpectNil(t, Unmarshal(mustDecodeHex("a26545706f6368c11a514b67b064546578"+
+		"74c074323031332d30332d32315432303a30343a30305a"), &d))
+	test.ExpectBool(t, d.Epoch.Equal(d.Text), true)
+	test.ExpectInt(t, d.Epoch.Year(), 2013)
+
+	for _, invalid := range []string{"8201", "f6f6", "ff", "3bffffffffffffffff", "a1f5f5", "5f6161ff", "1c", ""} {
+		test.ExpectNotNil(t, Unmarshal(mustDecodeHex(invalid), new(interface{})))
+	}
+}
+
+func TestMarshalingWriterAndUnmarshaller(t *testing.T) {
+
+	w := httptest.NewRecorder()
+
+	mw := new(MarshalingWriter)
+	test.ExpectNil(t, mw.MarshalAndWrite(map[string]int{"a": 1}, w))
+	test.ExpectString(t, hex.EncodeToString(w.Body.Bytes()), "a1616101")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(w.Body.Bytes())))
+
+	wsReq := new(ws.Request)
+	i := new(item)
+	wsReq.RequestBody = i
+
+	u := new(Unmarshaller)
+	u.FrameworkLogger = new(logging.NullLogger)
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, i.A, 1)
+}
+
+func mustDecodeHex(s string) []byte {
+
+	b, err := hex.DecodeString(s)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
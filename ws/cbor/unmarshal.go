@@ -0,0 +1,30 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cbor
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"io/ioutil"
+	"net/http"
+)
+
+// Unmarshaller parses CBOR request bodies into the target object of a web service request.
+type Unmarshaller struct {
+	FrameworkLogger logging.Logger
+}
+
+// Unmarshall parses a CBOR HTTP request body into wsReq.RequestBody.
+func (cu *Unmarshaller) Unmarshall(ctx context.Context, req *http.Request, wsReq *ws.Request) error {
+	defer req.Body.Close()
+
+	b, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(b, &wsReq.RequestBody)
+}
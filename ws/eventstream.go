@@ -0,0 +1,240 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EventStreamContentType is the content type of a Server-Sent Events response
+	EventStreamContentType = "text/event-stream"
+
+	// LastEventIDHeader is the header a browser uses to tell the server the ID of the last event it received before
+	// reconnecting to a stream.
+	LastEventIDHeader = "Last-Event-ID"
+)
+
+// ErrEventStreamClosed is returned when an attempt is made to send an event after the stream has been closed (because the
+// caller disconnected, the request's context was cancelled or the handler has finished processing the request).
+var ErrEventStreamClosed = errors.New("event stream is closed")
+
+// Event is a single Server-Sent Event. See https://html.spec.whatwg.org/multipage/server-sent-events.html
+type Event struct {
+	// An optional identifier for the event. Browsers send the ID of the last event they received in the Last-Event-ID
+	// header when they reconnect.
+	ID string
+
+	// An optional event type. If empty, browsers treat the event as a 'message' event.
+	Event string
+
+	// The payload of the event. Multi-line data is sent as multiple data fields.
+	Data string
+
+	// If greater than zero, instructs the browser how long to wait before reconnecting if the connection is lost.
+	Retry time.Duration
+}
+
+// EventSink writes Server-Sent Events to the HTTP response associated with a web service request. An EventSink is
+// supplied to logic components implementing handler.WsStreamProcessor.
+//
+// The stream is opened (the HTTP status and headers are sent) when the first event or comment is sent or when Open
+// is called. Until then, the logic component may abandon the stream by adding errors to the Errors field, in which
+// case a normal error response is sent to the caller.
+//
+// Each event is flushed to the caller as soon as it is written. The methods on EventSink are safe to call from
+// multiple goroutines.
+type EventSink struct {
+	// Errors that should be sent to the caller instead of opening the stream. Ignored once the stream has been opened.
+	Errors *ServiceErrors
+
+	// Headers that should be set on the HTTP response when the stream is opened.
+	Headers map[string]string
+
+	// The value of the Last-Event-ID header sent by a reconnecting browser (empty for new connections).
+	LastEventID string
+
+	ctx    context.Context
+	w      *httpendpoint.HTTPResponseWriter
+	mutex  sync.Mutex
+	opened bool
+	closed bool
+}
+
+// NewEventSink creates an EventSink that writes to the supplied response until the supplied context is cancelled or
+// the sink is closed.
+func NewEventSink(ctx context.Context, w *httpendpoint.HTTPResponseWriter, errorFinder ServiceErrorFinder) *EventSink {
+	es := new(EventSink)
+	es.ctx = ctx
+	es.w = w
+	es.Errors = new(ServiceErrors)
+	es.Errors.ErrorFinder = errorFinder
+	es.Headers = make(map[string]string)
+
+	return es
+}
+
+// Send writes an event to the stream (opening the stream if required) and flushes it to the caller. Returns
+// ErrEventStreamClosed if the stream has been closed or the error returned by the underlying response.
+func (es *EventSink) Send(e Event) error {
+
+	var b strings.Builder
+
+	if e.ID != "" {
+
+		if strings.ContainsAny(e.ID, "\r\n\x00") {
+			return fmt.Errorf("event ID %q contains invalid characters", e.ID)
+		}
+
+		b.WriteString("id: " + e.ID + "\n")
+	}
+
+	if e.Event != "" {
+
+		if strings.ContainsAny(e.Event, "\r\n") {
+			return fmt.Errorf("event type %q contains invalid characters", e.Event)
+		}
+
+		b.WriteString("event: " + e.Event + "\n")
+	}
+
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(int64(e.Retry/time.Millisecond), 10) + "\n")
+	}
+
+	data := strings.Replace(strings.Replace(e.Data, "\r\n", "\n", -1), "\r", "\n", -1)
+
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+
+	b.WriteString("\n")
+
+	return es.write(b.String())
+}
+
+// SendData writes an unnamed event with the supplied data.
+func (es *EventSink) SendData(data string) error {
+	return es.Send(Event{Data: data})
+}
+
+// Comment writes a comment line to the stream. Comments are ignored by browsers but keep idle connections open.
+func (es *EventSink) Comment(text string) error {
+
+	var b strings.Builder
+
+	for _, line := range strings.Split(strings.Replace(text, "\r", "", -1), "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+
+	b.WriteString("\n")
+
+	return es.write(b.String())
+}
+
+// Open sends the HTTP status and headers for the stream without sending an event. Has no effect if the stream is already open.
+func (es *EventSink) Open() error {
+	return es.write("")
+}
+
+// Opened returns true if the HTTP status and headers for the stream have been sent.
+func (es *EventSink) Opened() bool {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	return es.opened
+}
+
+// Close prevents any further events being written to the stream. Called automatically when the logic component
+// processing the request returns.
+func (es *EventSink) Close() {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	es.closed = true
+}
+
+// Heartbeat sends a comment to the caller at the supplied interval (once the stream has been opened) until the stream
+// is closed or the request's context is cancelled. The returned function stops the heartbeat and waits for any
+// heartbeat in progress to finish.
+func (es *EventSink) Heartbeat(interval time.Duration) (stop func()) {
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-es.ctx.Done():
+				return
+			case <-ticker.C:
+				if es.Opened() && es.Comment("heartbeat") != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}
+}
+
+func (es *EventSink) write(frame string) error {
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if es.closed || es.ctx.Err() != nil {
+		return ErrEventStreamClosed
+	}
+
+	if !es.opened {
+
+		h := es.w.Header()
+
+		h.Set("Content-Type", EventStreamContentType)
+		h.Set("Cache-Control", "no-cache")
+
+		// Stop proxies like nginx buffering the stream
+		h.Set("X-Accel-Buffering", "no")
+
+		WriteHeaders(es.w, es.Headers)
+
+		es.w.WriteHeader(http.StatusOK)
+		es.opened = true
+	}
+
+	if frame != "" {
+
+		if _, err := es.w.Write([]byte(frame)); err != nil {
+			es.closed = true
+			return err
+		}
+	}
+
+	es.w.Flush()
+
+	return nil
+}
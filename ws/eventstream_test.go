@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/test"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventFormatting(t *testing.T) {
+
+	res := httptest.NewRecorder()
+	es := NewEventSink(context.Background(), httpendpoint.NewHTTPResponseWriter(res), nil)
+	es.Headers["X-Stream"] = "progress"
+
+	test.ExpectBool(t, es.Opened(), false)
+
+	test.ExpectNil(t, es.Send(Event{ID: "1", Event: "progress", Data: "10%", Retry: 3 * time.Second}))
+
+	test.ExpectBool(t, es.Opened(), true)
+	test.ExpectBool(t, res.Flushed, true)
+	test.ExpectInt(t, res.Code, 200)
+	test.ExpectString(t, res.Header().Get("Content-Type"), EventStreamContentType)
+	test.ExpectString(t, res.Header().Get("Cache-Control"), "no-cache")
+	test.ExpectString(t, res.Header().Get("X-Stream"), "progress")
+
+	test.ExpectNil(t, es.SendData("line one\r\nline two"))
+	test.ExpectNil(t, es.Comment("still here"))
+
+	expected := "id: 1\nevent: progress\nretry: 3000\ndata: 10%\n\n" +
+		"data: line one\ndata: line two\n\n" +
+		": still here\n\n"
+
+	test.ExpectString(t, res.Body.String(), expected)
+
+	if es.Send(Event{ID: "a\nb"}) == nil || es.Send(Event{Event: "a\rb"}) == nil {
+		t.Errorf("Expected IDs and event types containing line breaks to be rejected")
+	}
+
+	es.Close()
+
+	if es.SendData("late") != ErrEventStreamClosed {
+		t.Errorf("Expected events sent after close to be rejected")
+	}
+
+	test.ExpectString(t, res.Body.String(), expected)
+}
+
+func TestEventSinkCancellation(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	res := httptest.NewRecorder()
+	es := NewEventSink(ctx, httpendpoint.NewHTTPResponseWriter(res), nil)
+
+	stop := es.Heartbeat(time.Millisecond)
+
+	// Heartbeats are not sent until the stream is open
+	time.Sleep(20 * time.Millisecond)
+	test.ExpectBool(t, es.Opened(), false)
+
+	es.Open()
+
+	deadline := time.Now().Add(time.Second)
+
+	for !strings.Contains(heartbeatBody(es, res), ": heartbeat\n\n") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	test.ExpectBool(t, strings.Contains(heartbeatBody(es, res), ": heartbeat\n\n"), true)
+
+	cancel()
+	stop()
+
+	if es.SendData("late") != ErrEventStreamClosed {
+		t.Errorf("Expected events sent after cancellation to be rejected")
+	}
+}
+
+func heartbeatBody(es *EventSink, res *httptest.ResponseRecorder) string {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	return res.Body.String()
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package form
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+)
+
+// File is a file uploaded as part of a multipart/form-data request. Small files are held in memory, larger files are
+// written to a temporary file which is removed automatically once the request has been processed, so a File must not
+// be used after your logic component has returned.
+type File struct {
+	// The name of the file as supplied by the client. This value must not be trusted as a path on the server.
+	Filename string
+
+	// The MIME headers of the part of the request that contained the file.
+	Header textproto.MIMEHeader
+
+	// The size of the file in bytes.
+	Size int64
+
+	data []byte
+	path string
+}
+
+// ContentType returns the Content-Type of the file as supplied by the client (or an empty string)
+func (f *File) ContentType() string {
+	return f.Header.Get("Content-Type")
+}
+
+// Open returns a reader for the contents of the file. The reader must be closed by the caller.
+func (f *File) Open() (io.ReadCloser, error) {
+
+	if f.path != "" {
+		return os.Open(f.path)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+// Bytes returns the entire contents of the file.
+func (f *File) Bytes() ([]byte, error) {
+
+	if f.path != "" {
+		return ioutil.ReadFile(f.path)
+	}
+
+	return f.data, nil
+}
+
+// InMemory returns true if the file is held in memory rather than written to a temporary file.
+func (f *File) InMemory() bool {
+	return f.path == ""
+}
+
+// Remove deletes the temporary file (if any) used to store the file's contents.
+func (f *File) Remove() error {
+
+	if f.path == "" {
+		return nil
+	}
+
+	err := os.Remove(f.path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
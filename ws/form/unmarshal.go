@@ -0,0 +1,409 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package form defines an Unmarshaller that parses HTML form submissions (application/x-www-form-urlencoded and
+multipart/form-data request bodies) into the target object of a web service request.
+
+Form fields are bound to fields on the target with the same name or, if the target field has a form tag, the name in
+that tag:
+
+	type ProfileUpdate struct {
+		DisplayName *types.NilableString `form:"display_name"`
+		Age         int
+		Avatar      *form.File
+		Attachments []*form.File
+		Internal    string `form:"-"`
+	}
+
+Values are converted using the same rules as query parameters (see ws.ParamBinder), and conversion problems are
+recorded as framework errors (FormWrongType and FormTargetNotArray) so they are reported to the caller in the same way
+as other binding problems.
+
+Files uploaded with multipart/form-data requests can be bound to fields of type *File or []*File. Files larger than the
+Unmarshaller's SpillThresholdBytes are written to a temporary file that is removed once the request has been processed.
+Files larger than MaxFileBytes cause a FileTooLarge framework error.
+
+Forms with more fields than MaxFields or more files than MaxFiles cause FormTooManyFields and FormTooManyFiles framework
+errors respectively. Requests with bodies larger than MaxBodyBytes or with a field value larger than MaxFieldBytes
+cannot be parsed.
+
+The web service facilities create an instance of Unmarshaller called grncFormUnmarshaller which can be set as the
+Unmarshaller of any handler that accepts form submissions:
+
+	"profileHandler": {
+	  "type": "handler.WsHandler",
+	  "HTTPMethod": "POST",
+	  "Logic": "ref:profileLogic",
+	  "PathPattern": "^/profile$",
+	  "Unmarshaller": "ref:grncFormUnmarshaller"
+	}
+*/
+package form
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+const (
+	urlEncodedType = "application/x-www-form-urlencoded"
+	multipartType  = "multipart/form-data"
+	tagName        = "form"
+	tempFilePrefix = "grnc-upload-"
+)
+
+var (
+	fileType  = reflect.TypeOf(new(File))
+	filesType = reflect.TypeOf([]*File{})
+)
+
+// Unmarshaller parses form submissions into the target object of a web service request.
+type Unmarshaller struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// Converts form values to the types of the target's fields and records any problems as framework errors.
+	ParamBinder *ws.ParamBinder
+
+	// The maximum size (in bytes) of an uploaded file. If zero, the size of files is not limited.
+	MaxFileBytes int64
+
+	// Uploaded files larger than this size (in bytes) are written to a temporary file rather than held in memory.
+	SpillThresholdBytes int64
+
+	// The maximum size (in bytes) of the value of a form field that is not a file. If zero, the size is not limited.
+	MaxFieldBytes int64
+
+	// The maximum number of fields (not including files) a form may contain. If zero, the number is not limited.
+	MaxFields int
+
+	// The maximum number of files that may be uploaded with a form. If zero, the number is not limited.
+	MaxFiles int
+
+	// The maximum size (in bytes) of the request body. If zero, the size is not limited.
+	MaxBodyBytes int64
+
+	// The directory in which temporary files are created. If empty, the operating system's default is used.
+	TempDir string
+}
+
+// Unmarshall binds the fields (and files) of a form submission into wsReq.RequestBody. Problems converting values
+// are recorded as framework errors on wsReq - an error is only returned if the request body cannot be parsed.
+func (u *Unmarshaller) Unmarshall(ctx context.Context, req *http.Request, wsReq *ws.Request) error {
+	defer req.Body.Close()
+
+	if u.MaxBodyBytes > 0 {
+		req.Body = http.MaxBytesReader(nil, req.Body, u.MaxBodyBytes)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	if err != nil {
+		return err
+	}
+
+	targets := formTargets(wsReq.RequestBody)
+
+	switch mediaType {
+	case urlEncodedType:
+
+		if err := req.ParseForm(); err != nil {
+			return err
+		}
+
+		return u.unmarshallURLEncoded(req.PostForm, wsReq, targets)
+
+	case multipartType:
+		return u.unmarshallMultipart(req.Body, params["boundary"], wsReq, targets)
+	}
+
+	return fmt.Errorf("unsupported content type %s", mediaType)
+}
+
+func (u *Unmarshaller) unmarshallURLEncoded(values url.Values, wsReq *ws.Request, targets map[string]*target) error {
+
+	var count int
+
+	for name, vs := range values {
+
+		for _, v := range vs {
+			if u.MaxFieldBytes > 0 && int64(len(v)) > u.MaxFieldBytes {
+				return u.fieldTooLarge(name)
+			}
+		}
+
+		count += len(vs)
+	}
+
+	if u.MaxFields > 0 && count > u.MaxFields {
+		u.tooMany(wsReq, ws.FormTooManyFields, u.MaxFields)
+		return nil
+	}
+
+	u.bindValues(wsReq, values, targets)
+
+	return nil
+}
+
+func (u *Unmarshaller) unmarshallMultipart(body io.Reader, boundary string, wsReq *ws.Request, targets map[string]*target) error {
+
+	if boundary == "" {
+		return fmt.Errorf("no boundary specified for multipart body")
+	}
+
+	mr := multipart.NewReader(body, boundary)
+	values := make(url.Values)
+
+	var fields, files int
+
+	for {
+		part, err := mr.NextPart()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := part.FormName()
+
+		if name == "" {
+			continue
+		}
+
+		if part.FileName() == "" {
+
+			if fields++; u.MaxFields > 0 && fields > u.MaxFields {
+				// The rest of the body is not read
+				u.tooMany(wsReq, ws.FormTooManyFields, u.MaxFields)
+				return nil
+			}
+
+			v, err := u.readValue(part)
+
+			if err != nil {
+				return err
+			}
+
+			values.Add(name, v)
+			continue
+		}
+
+		if files++; u.MaxFiles > 0 && files > u.MaxFiles {
+			u.tooMany(wsReq, ws.FormTooManyFiles, u.MaxFiles)
+			return nil
+		}
+
+		t := targets[name]
+
+		if t == nil {
+			u.FrameworkLogger.LogTracef("No field to bind uploaded file %s into", name)
+			continue
+		}
+
+		f, err := u.readFile(part)
+
+		if f != nil && !f.InMemory() {
+			wsReq.AddCleanup(func() {
+				if err := f.Remove(); err != nil {
+					u.FrameworkLogger.LogErrorf("Unable to remove temporary file for upload %s: %s", f.Filename, err.Error())
+				}
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if u.MaxFileBytes > 0 && f.Size > u.MaxFileBytes {
+			m, c := u.ParamBinder.FrameworkErrors.MessageCode(ws.FileTooLarge, name, u.MaxFileBytes)
+			wsReq.AddFrameworkError(ws.NewFormBindFrameworkError(m, c, name, t.field))
+
+			// The rest of the body is not read
+			return nil
+		}
+
+		u.bindFile(wsReq, name, t, f)
+	}
+
+	u.bindValues(wsReq, values, targets)
+
+	return nil
+}
+
+func (u *Unmarshaller) readValue(part *multipart.Part) (string, error) {
+
+	var r io.Reader = part
+
+	if u.MaxFieldBytes > 0 {
+		r = io.LimitReader(part, u.MaxFieldBytes+1)
+	}
+
+	b, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	if u.MaxFieldBytes > 0 && int64(len(b)) > u.MaxFieldBytes {
+		return "", u.fieldTooLarge(part.FormName())
+	}
+
+	return string(b), nil
+}
+
+func (u *Unmarshaller) fieldTooLarge(name string) error {
+	return fmt.Errorf("value of form field %s is larger than %d bytes", name, u.MaxFieldBytes)
+}
+
+// tooMany records a framework error for a form that has more fields or files than allowed
+func (u *Unmarshaller) tooMany(wsReq *ws.Request, event ws.FrameworkErrorEvent, max int) {
+	m, c := u.ParamBinder.FrameworkErrors.MessageCode(event, max)
+	wsReq.AddFrameworkError(ws.NewFormBindFrameworkError(m, c, "", ""))
+}
+
+// readFile reads an uploaded file into memory, writing it to a temporary file once it exceeds SpillThresholdBytes. At
+// most MaxFileBytes+1 bytes are read so that oversized files can be detected without reading them completely.
+func (u *Unmarshaller) readFile(part *multipart.Part) (*File, error) {
+
+	f := new(File)
+	f.Filename = part.FileName()
+	f.Header = part.Header
+
+	var r io.Reader = part
+
+	if u.MaxFileBytes > 0 {
+		r = io.LimitReader(part, u.MaxFileBytes+1)
+	}
+
+	var buf bytes.Buffer
+
+	n, err := io.CopyN(&buf, r, u.SpillThresholdBytes+1)
+
+	if err == io.EOF {
+		f.data = buf.Bytes()
+		f.Size = n
+
+		return f, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	tf, err := ioutil.TempFile(u.TempDir, tempFilePrefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tf.Close()
+
+	f.path = tf.Name()
+
+	if f.Size, err = io.Copy(tf, io.MultiReader(&buf, r)); err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
+func (u *Unmarshaller) bindFile(wsReq *ws.Request, name string, t *target, f *File) {
+
+	fv := reflect.ValueOf(wsReq.RequestBody).Elem().FieldByName(t.field)
+
+	switch fv.Type() {
+	case fileType:
+
+		if !fv.IsNil() {
+			m, c := u.ParamBinder.FrameworkErrors.MessageCode(ws.FormTargetNotArray, name)
+			wsReq.AddFrameworkError(ws.NewFormBindFrameworkError(m, c, name, t.field))
+
+			return
+		}
+
+		fv.Set(reflect.ValueOf(f))
+
+	case filesType:
+		fv.Set(reflect.Append(fv, reflect.ValueOf(f)))
+
+	default:
+		m, c := u.ParamBinder.FrameworkErrors.MessageCode(ws.FormWrongType, name, fv.Type().String(), f.Filename)
+		wsReq.AddFrameworkError(ws.NewFormBindFrameworkError(m, c, name, t.field))
+
+		return
+	}
+
+	wsReq.RecordFieldAsBound(t.field)
+}
+
+func (u *Unmarshaller) bindValues(wsReq *ws.Request, values url.Values, targets map[string]*target) {
+
+	fields := make(map[string]string)
+
+	for name, t := range targets {
+		if !t.file {
+			fields[t.field] = name
+		}
+	}
+
+	u.ParamBinder.BindFormParameters(wsReq, values, fields)
+}
+
+// target is a field on the target object that a form field can be bound to
+type target struct {
+	field string
+	file  bool
+}
+
+// formTargets maps form field names to the fields of the supplied object (a pointer to a struct)
+func formTargets(i interface{}) map[string]*target {
+
+	targets := make(map[string]*target)
+
+	rt := reflect.TypeOf(i)
+
+	if rt == nil || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Struct {
+		return targets
+	}
+
+	rt = rt.Elem()
+
+	for i := 0; i < rt.NumField(); i++ {
+
+		f := rt.Field(i)
+
+		if f.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		name := f.Name
+
+		if tag, found := f.Tag.Lookup(tagName); found {
+
+			if tag == "-" {
+				continue
+			}
+
+			name = tag
+		}
+
+		targets[name] = &target{field: f.Name, file: f.Type == fileType || f.Type == filesType}
+	}
+
+	return targets
+}
@@ -0,0 +1,264 @@
+package form
+
+import (
+	"bytes"
+	"context"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/types"
+	"github.com/graniticio/granitic/v2/ws"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type profile struct {
+	DisplayName *types.NilableString `form:"display_name"`
+	Age         int
+	Avatar      *File
+	Attachments []*File
+	Internal    string `form:"-"`
+}
+
+func TestURLEncoded(t *testing.T) {
+
+	u := newUnmarshaller()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("display_name=Ann&Age=41&Internal=x"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	wsReq, p := newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 0)
+
+	test.ExpectString(t, p.DisplayName.String(), "Ann")
+	test.ExpectInt(t, p.Age, 41)
+	test.ExpectString(t, p.Internal, "")
+	test.ExpectBool(t, wsReq.WasFieldBound("Age"), true)
+
+	// Conversion problems are recorded as framework errors
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Age=old&display_name=a&display_name=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	wsReq, _ = newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 2)
+
+	for _, fe := range wsReq.FrameworkErrors {
+		test.ExpectBool(t, fe.Phase == ws.FormBind, true)
+		test.ExpectString(t, fe.Code, "FORMBIND")
+	}
+}
+
+func TestMultipart(t *testing.T) {
+
+	u := newUnmarshaller()
+	u.SpillThresholdBytes = 8
+
+	req := multipartRequest(t, map[string]string{"display_name": "Ann", "Age": "41"}, []upload{
+		{"Avatar", "me.png", "small"},
+		{"Attachments", "a.txt", "this file is larger than eight bytes"},
+		{"Attachments", "b.txt", "b"},
+		{"Unknown", "c.txt", "ignored"},
+	})
+
+	wsReq, p := newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 0)
+
+	test.ExpectString(t, p.DisplayName.String(), "Ann")
+	test.ExpectInt(t, p.Age, 41)
+
+	test.ExpectNotNil(t, p.Avatar)
+	test.ExpectString(t, p.Avatar.Filename, "me.png")
+	test.ExpectString(t, p.Avatar.ContentType(), "application/octet-stream")
+	test.ExpectBool(t, p.Avatar.InMemory(), true)
+	test.ExpectInt(t, int(p.Avatar.Size), 5)
+
+	test.ExpectInt(t, len(p.Attachments), 2)
+
+	spilled := p.Attachments[0]
+	test.ExpectBool(t, spilled.InMemory(), false)
+	test.ExpectInt(t, int(spilled.Size), 36)
+
+	r, err := spilled.Open()
+	test.ExpectNil(t, err)
+	b, _ := ioutil.ReadAll(r)
+	r.Close()
+	test.ExpectString(t, string(b), "this file is larger than eight bytes")
+
+	b, err = p.Attachments[1].Bytes()
+	test.ExpectNil(t, err)
+	test.ExpectString(t, string(b), "b")
+
+	// Temporary files are removed once the request is complete
+	_, err = os.Stat(spilled.path)
+	test.ExpectNil(t, err)
+
+	wsReq.Cleanup()
+
+	_, err = os.Stat(spilled.path)
+	test.ExpectBool(t, os.IsNotExist(err), true)
+}
+
+func TestMultipartErrors(t *testing.T) {
+
+	u := newUnmarshaller()
+	u.SpillThresholdBytes = 4
+	u.MaxFileBytes = 10
+
+	req := multipartRequest(t, nil, []upload{{"Avatar", "big.png", "more than ten bytes"}})
+	wsReq, p := newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 1)
+	test.ExpectString(t, wsReq.FrameworkErrors[0].TargetField, "Avatar")
+	test.ExpectBool(t, p.Avatar == nil, true)
+
+	wsReq.Cleanup()
+
+	req = multipartRequest(t, nil, []upload{{"Avatar", "a.png", "a"}, {"Avatar", "b.png", "b"}, {"Age", "c.txt", "c"}})
+	wsReq, _ = newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 2)
+
+	u.MaxFieldBytes = 2
+
+	req = multipartRequest(t, map[string]string{"Age": "12345"}, nil)
+	wsReq, _ = newRequest()
+
+	test.ExpectNotNil(t, u.Unmarshall(context.Background(), req, wsReq))
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+
+	test.ExpectNotNil(t, u.Unmarshall(context.Background(), req, wsReq))
+}
+
+func TestLimits(t *testing.T) {
+
+	u := newUnmarshaller()
+	u.MaxFieldBytes = 3
+	u.MaxFields = 2
+	u.MaxFiles = 1
+
+	urlEncoded := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return req
+	}
+
+	wsReq, p := newRequest()
+	test.ExpectNil(t, u.Unmarshall(context.Background(), urlEncoded("display_name=Ann&Age=41"), wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 0)
+	test.ExpectInt(t, p.Age, 41)
+
+	wsReq, _ = newRequest()
+	test.ExpectNotNil(t, u.Unmarshall(context.Background(), urlEncoded("display_name=Anne"), wsReq))
+
+	wsReq, p = newRequest()
+	test.ExpectNil(t, u.Unmarshall(context.Background(), urlEncoded("display_name=a&display_name=b&Age=1"), wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 1)
+	test.ExpectString(t, wsReq.FrameworkErrors[0].Message, "More than 2 fields.")
+	test.ExpectInt(t, p.Age, 0)
+
+	req := multipartRequest(t, map[string]string{"Age": "1", "display_name": "a", "Internal": "x"}, nil)
+	wsReq, _ = newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 1)
+	test.ExpectString(t, wsReq.FrameworkErrors[0].Message, "More than 2 fields.")
+
+	req = multipartRequest(t, nil, []upload{{"Attachments", "a.txt", "a"}, {"Attachments", "b.txt", "b"}})
+	wsReq, p = newRequest()
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, len(wsReq.FrameworkErrors), 1)
+	test.ExpectString(t, wsReq.FrameworkErrors[0].Message, "More than 1 files.")
+	wsReq.Cleanup()
+
+	// Bodies larger than MaxBodyBytes cannot be parsed
+	u = newUnmarshaller()
+	u.MaxBodyBytes = 10
+
+	wsReq, _ = newRequest()
+	test.ExpectNotNil(t, u.Unmarshall(context.Background(), urlEncoded("display_name=Annabelle"), wsReq))
+
+	req = multipartRequest(t, nil, []upload{{"Avatar", "a.png", "a"}})
+	wsReq, _ = newRequest()
+
+	test.ExpectNotNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	wsReq.Cleanup()
+}
+
+type upload struct {
+	field    string
+	filename string
+	content  string
+}
+
+func multipartRequest(t *testing.T, values map[string]string, files []upload) *http.Request {
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for k, v := range values {
+		test.ExpectNil(t, mw.WriteField(k, v))
+	}
+
+	for _, f := range files {
+		w, err := mw.CreateFormFile(f.field, f.filename)
+		test.ExpectNil(t, err)
+
+		w.Write([]byte(f.content))
+	}
+
+	test.ExpectNil(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return req
+}
+
+func newUnmarshaller() *Unmarshaller {
+
+	feg := new(ws.FrameworkErrorGenerator)
+	feg.FrameworkLogger = new(logging.NullLogger)
+	feg.Messages = map[ws.FrameworkErrorEvent][]string{
+		ws.FormTargetNotArray: {"FORMBIND", "Multiple values for form field %s."},
+		ws.FormWrongType:      {"FORMBIND", "Unable to convert form field %s to type %s. Value provided was %s"},
+		ws.FileTooLarge:       {"FORMBIND", "The file uploaded as %s is larger than %d bytes."},
+		ws.FormTooManyFields:  {"FORMBIND", "More than %d fields."},
+		ws.FormTooManyFiles:   {"FORMBIND", "More than %d files."},
+	}
+
+	pb := new(ws.ParamBinder)
+	pb.FrameworkLogger = new(logging.NullLogger)
+	pb.FrameworkErrors = feg
+
+	u := new(Unmarshaller)
+	u.FrameworkLogger = new(logging.NullLogger)
+	u.ParamBinder = pb
+
+	return u
+}
+
+func newRequest() (*ws.Request, *profile) {
+
+	p := new(profile)
+
+	wsReq := new(ws.Request)
+	wsReq.RequestBody = p
+
+	return wsReq, p
+}
@@ -21,6 +21,9 @@ const (
 
 	//PathBind indicates an error was encountered while mapping elements of an HTTP request's path to fields on a struct
 	PathBind
+
+	// FormBind indicates an error was encountered while mapping the fields of an HTTP form to fields on a struct
+	FormBind
 )
 
 // FrameworkError an error encountered in early phases of request processing, before application code is invoked.
@@ -93,6 +96,19 @@ func NewPathBindFrameworkError(message, code, target string) *FrameworkError {
 	return f
 }
 
+// NewFormBindFrameworkError creates a FrameworkError with fields set appropriate for an error
+// encountered during mapping of the fields (or files) of an HTTP form to fields on a Request's Body
+func NewFormBindFrameworkError(message, code, param, target string) *FrameworkError {
+	f := new(FrameworkError)
+	f.Phase = FormBind
+	f.Message = message
+	f.ClientField = param
+	f.TargetField = target
+	f.Code = code
+
+	return f
+}
+
 // FrameworkErrorEvent uniquely identifies a 'handled' failure during the parsing and binding phases
 type FrameworkErrorEvent string
 
@@ -110,6 +126,21 @@ const (
 
 	// QueryNoTargetField indicates that no field on the target can be matched to the a named query parameter
 	QueryNoTargetField = "QueryNoTargetField"
+
+	// FormTargetNotArray indicates that a form field with multiple values has been bound to a target field that is not an array
+	FormTargetNotArray = "FormTargetNotArray"
+
+	// FormWrongType indicates that the value of a form field is not compatible with the type of field to which it is bound
+	FormWrongType = "FormWrongType"
+
+	// FileTooLarge indicates that a file uploaded with a form exceeds the maximum size allowed
+	FileTooLarge = "FileTooLarge"
+
+	// FormTooManyFields indicates that a form contains more (non-file) fields than allowed
+	FormTooManyFields = "FormTooManyFields"
+
+	// FormTooManyFiles indicates that more files were uploaded with a form than allowed
+	FormTooManyFiles = "FormTooManyFiles"
 )
 
 // A FrameworkErrorGenerator can create error messages for errors that occur outside of application code and messages
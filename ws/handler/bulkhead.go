@@ -0,0 +1,138 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bulkhead limits the number of requests that can be processed at the same time by one or more handlers, stopping
+// slow endpoints from using all of an application's resources. Requests that arrive when the limit has been reached
+// wait (for up to QueueTimeoutMS milliseconds) for another request to finish before they are rejected.
+//
+// A Bulkhead is created automatically for any WsHandler that has its MaxConcurrent field set. To share a limit
+// between several handlers, declare a Bulkhead component and set it on each handler's Bulkhead field:
+//
+//	{
+//	  "reportBulkhead": {
+//		"type": "handler.Bulkhead",
+//		"MaxConcurrent": 4,
+//		"QueueTimeoutMS": 500
+//	  },
+//
+//	  "salesReportHandler": {
+//		"type": "handler.WsHandler",
+//		"Bulkhead": "ref:reportBulkhead",
+//		...
+//	  }
+//	}
+type Bulkhead struct {
+	// The maximum number of requests that can be processed at the same time.
+	MaxConcurrent int
+
+	// How long (in milliseconds) a request may wait for another request to finish. If zero, requests are rejected as soon
+	// as the limit is reached.
+	QueueTimeoutMS int
+
+	componentName string
+	once          sync.Once
+	slots         chan struct{}
+	waiting       int64
+	rejected      uint64
+}
+
+// BulkheadOccupancy is a snapshot of the state of a Bulkhead.
+type BulkheadOccupancy struct {
+	// The number of requests currently being processed
+	Active int
+
+	// The number of requests waiting to be processed
+	Waiting int
+
+	// The maximum number of requests that can be processed at the same time
+	MaxConcurrent int
+
+	// The number of requests that have been rejected since the application started
+	Rejected uint64
+}
+
+// Acquire blocks until the request can be processed (returning true and a function that must be called when the request
+// has been processed) or until the request has waited too long or its context is cancelled (returning false).
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), acquired bool) {
+
+	b.once.Do(b.init)
+
+	release = func() {
+		<-b.slots
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	if b.QueueTimeoutMS <= 0 {
+		atomic.AddUint64(&b.rejected, 1)
+		return nil, false
+	}
+
+	atomic.AddInt64(&b.waiting, 1)
+	defer atomic.AddInt64(&b.waiting, -1)
+
+	timer := time.NewTimer(time.Duration(b.QueueTimeoutMS) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	atomic.AddUint64(&b.rejected, 1)
+
+	return nil, false
+}
+
+// Occupancy returns the current state of the Bulkhead.
+func (b *Bulkhead) Occupancy() BulkheadOccupancy {
+
+	b.once.Do(b.init)
+
+	return BulkheadOccupancy{
+		Active:        len(b.slots),
+		Waiting:       int(atomic.LoadInt64(&b.waiting)),
+		MaxConcurrent: b.MaxConcurrent,
+		Rejected:      atomic.LoadUint64(&b.rejected),
+	}
+}
+
+func (b *Bulkhead) init() {
+	b.slots = make(chan struct{}, b.MaxConcurrent)
+}
+
+// StartComponent is called by the IoC container. Verifies that MaxConcurrent has been set.
+func (b *Bulkhead) StartComponent() error {
+
+	if b.MaxConcurrent < 1 {
+		return errors.New("bulkheads must have MaxConcurrent set to a value greater than zero")
+	}
+
+	return nil
+}
+
+// ComponentName implements ComponentNamer.ComponentName
+func (b *Bulkhead) ComponentName() string {
+	return b.componentName
+}
+
+// SetComponentName implements ComponentNamer.SetComponentName
+func (b *Bulkhead) SetComponentName(name string) {
+	b.componentName = name
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+
+	b := &Bulkhead{MaxConcurrent: 2, QueueTimeoutMS: 20}
+
+	r1, ok := b.Acquire(context.Background())
+	test.ExpectBool(t, ok, true)
+
+	_, ok = b.Acquire(context.Background())
+	test.ExpectBool(t, ok, true)
+
+	test.ExpectInt(t, b.Occupancy().Active, 2)
+
+	// Full - waits then gives up
+	start := time.Now()
+	_, ok = b.Acquire(context.Background())
+
+	test.ExpectBool(t, ok, false)
+
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Expected request to wait before being rejected")
+	}
+
+	// A waiting request gets the slot when another finishes
+	acquired := make(chan bool)
+
+	go func() {
+		_, ok := b.Acquire(context.Background())
+		acquired <- ok
+	}()
+
+	for b.Occupancy().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	r1()
+	test.ExpectBool(t, <-acquired, true)
+
+	// Cancelled requests stop waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b.QueueTimeoutMS = 10000
+	_, ok = b.Acquire(ctx)
+	test.ExpectBool(t, ok, false)
+
+	o := b.Occupancy()
+	test.ExpectInt(t, o.Active, 2)
+	test.ExpectInt(t, o.Waiting, 0)
+	test.ExpectInt(t, int(o.Rejected), 2)
+
+	if (&Bulkhead{}).StartComponent() == nil {
+		t.Errorf("Expected error starting bulkhead without MaxConcurrent")
+	}
+}
+
+func TestHandlerConcurrencyLimit(t *testing.T) {
+
+	l := &blockingLogic{started: make(chan bool), release: make(chan bool)}
+
+	h, req := GetHandler(t)
+	h.Logic = l
+	h.MaxConcurrent = 1
+	h.TooBusyStatus = http.StatusTooManyRequests
+	h.FrameworkErrors = &ws.FrameworkErrorGenerator{HTTPMessages: map[string]string{"429": "Too busy"}}
+
+	rw := new(errorRecordingResponseWriter)
+	h.ResponseWriter = rw
+
+	test.ExpectNil(t, h.StartComponent())
+
+	go h.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(NewStringBufferResponseWriter()), req)
+
+	<-l.started
+
+	h.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(NewStringBufferResponseWriter()), req)
+
+	test.ExpectInt(t, rw.errors.HTTPStatus, http.StatusTooManyRequests)
+	test.ExpectString(t, rw.errors.Errors[0].Message, "Too busy")
+
+	close(l.release)
+
+	h, _ = GetHandler(t)
+	h.Logic = l
+	h.MaxConcurrent = 1
+	h.Bulkhead = new(Bulkhead)
+
+	if h.StartComponent() == nil {
+		t.Errorf("Expected error when both MaxConcurrent and Bulkhead set")
+	}
+}
+
+type blockingLogic struct {
+	started chan bool
+	release chan bool
+}
+
+func (l *blockingLogic) Process(ctx context.Context, request *ws.Request, response *ws.Response) {
+	l.started <- true
+	<-l.release
+}
+
+type errorRecordingResponseWriter struct {
+	errors *ws.ServiceErrors
+}
+
+func (rw *errorRecordingResponseWriter) Write(ctx context.Context, state *ws.ProcessState, outcome ws.Outcome) error {
+	if outcome == ws.Error {
+		rw.errors = state.ServiceErrors
+	}
+
+	return nil
+}
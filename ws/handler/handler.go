@@ -34,6 +34,17 @@ standard or custom HTTP method can be used.
 
 3. A 'logic' component that implements at least WsRequestProcessor (additional WsXXX interfaces can be implemented
 to support advanced behaviour) OR has a method with the signature ProcessPayload(ctx context.Context, request *ws.Request, response *ws.Response, payload *YourStruct)
+OR implements WsStreamProcessor.
+
+Streaming events
+
+A logic component implementing WsStreamProcessor receives a ws.EventSink instead of a ws.Response and can push
+Server-Sent Events (text/event-stream) to the caller for as long as it needs to. Identification, rate limiting, access
+checks, parsing and validation happen as they would for any other handler, and the request is recorded in the access
+log once the stream has finished. Heartbeat comments are sent to keep idle streams open (see StreamHeartbeatMS).
+
+The logic component must stop sending events and return when the request's context is cancelled (the caller has
+disconnected or the HTTP server is stopping).
 
 */
 package handler
@@ -42,6 +53,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/graniticio/granitic/v2/cors"
 	"github.com/graniticio/granitic/v2/httpendpoint"
 	"github.com/graniticio/granitic/v2/iam"
 	"github.com/graniticio/granitic/v2/instrument"
@@ -52,6 +64,9 @@ import (
 	"net/http"
 	"reflect"
 	"regexp"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const processPayloadFunc = "ProcessPayload"
@@ -64,6 +79,15 @@ type WsRequestProcessor interface {
 	Process(ctx context.Context, request *ws.Request, response *ws.Response)
 }
 
+// WsStreamProcessor is implemented by logic components that respond to a request with a stream of Server-Sent Events
+// rather than a single response.
+type WsStreamProcessor interface {
+	// ProcessStream sends events to the caller using the supplied sink. It should return once it has no more events to
+	// send or when the supplied context is cancelled. Adding errors to the sink's Errors field before any events are
+	// sent causes a normal error response to be sent instead of a stream.
+	ProcessStream(ctx context.Context, request *ws.Request, events *ws.EventSink)
+}
+
 // WsPostProcessor is implemented to indicate that an object is interested in observing/modifying a web service request after processing has been completed,
 // but before the HTTP response is written. Typical uses are the writing of response headers that are generic to all/most handlers or the recording of metrics.
 //
@@ -130,6 +154,10 @@ type WsHandler struct {
 	// Whether or not query parameters should be automatically injected into the request body.
 	AutoBindQuery bool
 
+	// A component limiting the number of requests this handler (and any other handlers sharing the Bulkhead) can process
+	// at the same time. Created automatically if MaxConcurrent is set.
+	Bulkhead *Bulkhead
+
 	// A component able to use a set of user-defined rules to validate a request.
 	AutoValidator *validate.RuleValidator
 
@@ -139,6 +167,9 @@ type WsHandler struct {
 	// Check caller's permissions after request has been parsed (true) or before parsing (false).
 	CheckAccessAfterParse bool
 
+	// A CORS policy to use for this handler instead of the default policy defined by the CORS facility.
+	CORS *cors.Policy
+
 	// A function able to create an empty initialised struct to use as a target for request binding
 	createTarget func() interface{}
 
@@ -166,10 +197,18 @@ type WsHandler struct {
 	// The HTTP method (GET, POST etc) that this handler supports.
 	HTTPMethod string
 
+	// The names of the HTTP listeners (see the HTTPServer facility) this handler should be registered with. If empty,
+	// the listener is chosen using the rules in the HTTPServer facility's configuration.
+	Listeners []string
+
 	// A logger injected by the Granitic framework. Note this will be an application logger rather than a framework logger
 	// as instances of WsHandler are considered application components.
 	Log logging.Logger
 
+	// The maximum number of requests this handler will process at the same time. Zero means no limit (other than the
+	// HTTP server's MaxConcurrent setting). Cannot be used if Bulkhead is set.
+	MaxConcurrent int
+
 	// The object representing the 'logic' behind this handler.
 	Logic interface{}
 
@@ -189,6 +228,13 @@ type WsHandler struct {
 	// Stop the framework automatically adding this handler to an HTTP server.
 	PreventAutoWiring bool
 
+	// How long (in milliseconds) a request may wait for another request to finish when MaxConcurrent requests are already
+	// being processed. If zero, requests are rejected as soon as the limit is reached.
+	QueueTimeoutMS int
+
+	// A component able to reject requests from callers who have made too many requests. Checked after the caller has been identified.
+	RateLimiter ws.RateLimiter
+
 	// A component injected by the Granitic framework that writes the response from this handler to an HTTP response.
 	ResponseWriter ws.ResponseWriter
 
@@ -201,6 +247,14 @@ type WsHandler struct {
 	// A component that can examine a request to determine the calling user/service's identity.
 	UserIdentifier ws.Identifier
 
+	// How often (in milliseconds) a heartbeat comment is sent to the caller while a WsStreamProcessor is streaming events.
+	// If zero, a heartbeat is sent every 15 seconds. If negative, heartbeats are not sent.
+	StreamHeartbeatMS int
+
+	// The HTTP status code sent when a request is rejected because the handler's Bulkhead is full. Set by the framework to
+	// match the HTTPServer facility's TooBusyStatus. If zero, 503 is used.
+	TooBusyStatus int
+
 	// A component that can check if this handler supports the version of functionality required by the caller.
 	VersionAssessor   WsVersionAssessor
 	bindPathParams    bool
@@ -212,8 +266,13 @@ type WsHandler struct {
 	validationEnabled bool
 	validator         WsRequestValidator
 	genericProcessor  WsRequestProcessor
+	streamProcessor   WsStreamProcessor
+	streams           map[*ws.EventSink]context.CancelFunc
+	streamMutex       sync.Mutex
 }
 
+const defaultStreamHeartbeat = 15 * time.Second
+
 // ProvideErrorFinder receives a component that can be used to map error codes to categorised errors.
 func (wh *WsHandler) ProvideErrorFinder(finder ws.ServiceErrorFinder) {
 
@@ -241,6 +300,8 @@ func (wh *WsHandler) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponse
 	wsReq := new(ws.Request)
 	wsReq.HTTPMethod = req.Method
 	wsReq.ServingHandler = wh.ComponentName()
+	defer wsReq.Cleanup()
+	wsReq.ClientIP = httpendpoint.ClientIP(ctx, req)
 
 	wsReq.ID = ws.RecoverIDFunction(ctx)
 
@@ -258,6 +319,13 @@ func (wh *WsHandler) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponse
 		wsReq.UnderlyingHTTP = da
 	}
 
+	//Choose the formats the request will be parsed and the response written in
+	var negotiated bool
+
+	if negotiated, ctx = wh.negotiate(ctx, w, req, wsReq); !negotiated {
+		return ctx
+	}
+
 	//Try to identify and/or authenticate the caller
 	var okay bool
 
@@ -266,11 +334,29 @@ func (wh *WsHandler) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponse
 		return ctx
 	}
 
+	//Check caller has not exceeded the rate at which they are allowed to make requests
+	if !wh.checkRateLimit(ctx, w, req, wsReq) {
+		return ctx
+	}
+
 	//Check caller has permission to use this resource
 	if !wh.CheckAccessAfterParse && !wh.checkAccess(ctx, w, wsReq) {
 		return ctx
 	}
 
+	//Wait until this handler is able to process another request
+	if wh.Bulkhead != nil {
+
+		release, acquired := wh.Bulkhead.Acquire(ctx)
+
+		if !acquired {
+			wh.writeTooBusyResponse(ctx, w, wsReq)
+			return ctx
+		}
+
+		defer release()
+	}
+
 	//Unmarshall body, query parameters and path parameters
 	wh.unmarshall(ctx, req, wsReq)
 	wh.processQueryParams(ctx, req, wsReq)
@@ -299,7 +385,11 @@ func (wh *WsHandler) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponse
 	}
 
 	//Execute logic
-	wh.process(ctx, wsReq, w)
+	if wh.streamProcessor != nil {
+		wh.processStream(ctx, wsReq, req, w)
+	} else {
+		wh.process(ctx, wsReq, w)
+	}
 
 	return ctx
 }
@@ -368,15 +458,9 @@ func (wh *WsHandler) validateRequest(ctx context.Context, wsReq *ws.Request, err
 
 func (wh *WsHandler) unmarshall(ctx context.Context, req *http.Request, wsReq *ws.Request) {
 
-	var uf func() interface{}
+	uf := wh.targetFactory()
 
-	if targetSource, found := wh.Logic.(WsUnmarshallTarget); found {
-		//Logic component implements WsUnmarshallTarget - use that to create target
-		uf = targetSource.UnmarshallTarget
-	} else if wh.createTarget != nil {
-		//A function has been provided to generate targets
-		uf = wh.createTarget
-	} else {
+	if uf == nil {
 		//No way of creating a target
 		return
 	}
@@ -402,6 +486,19 @@ func (wh *WsHandler) unmarshall(ctx context.Context, req *http.Request, wsReq *w
 
 }
 
+// targetFactory returns a function that creates the object the request will be parsed into or nil if the handler
+// does not parse requests.
+func (wh *WsHandler) targetFactory() func() interface{} {
+
+	if targetSource, found := wh.Logic.(WsUnmarshallTarget); found {
+		//Logic component implements WsUnmarshallTarget - use that to create target
+		return targetSource.UnmarshallTarget
+	}
+
+	//A function may have been provided to generate targets
+	return wh.createTarget
+}
+
 func (wh *WsHandler) processPathParams(req *http.Request, wsReq *ws.Request) {
 
 	if wh.DisablePathParsing {
@@ -467,6 +564,60 @@ func (wh *WsHandler) checkAccess(ctx context.Context, w *httpendpoint.HTTPRespon
 
 }
 
+func (wh *WsHandler) checkRateLimit(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request, wsReq *ws.Request) bool {
+
+	rl := wh.RateLimiter
+
+	if rl == nil {
+		return true
+	}
+
+	allowed, retryAfter := rl.Allow(ctx, wsReq, req)
+
+	if allowed {
+		return true
+	}
+
+	// Retry-After is expressed in whole seconds, so round up
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+
+	state := ws.NewAbnormalState(http.StatusTooManyRequests, w)
+	state.Identity = wsReq.UserIdentity
+	state.WsRequest = wsReq
+
+	wh.ResponseWriter.Write(ctx, state, ws.Abnormal)
+	return false
+}
+
+// negotiate asks the ResponseWriter and Unmarshaller (if they support more than one format) to choose a format for
+// this request, writing a 406 or 415 response if no suitable format is available.
+func (wh *WsHandler) negotiate(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request, wsReq *ws.Request) (bool, context.Context) {
+
+	status := 0
+
+	if n, found := wh.ResponseWriter.(ws.ContentNegotiator); found {
+		ctx, status = n.Negotiate(ctx, req)
+	}
+
+	if n, found := wh.Unmarshaller.(ws.ContentNegotiator); found && status == 0 && wh.targetFactory() != nil {
+		ctx, status = n.Negotiate(ctx, req)
+	}
+
+	if status == 0 {
+		return true, ctx
+	}
+
+	wh.writeHTTPErrorResponse(ctx, w, wsReq, status)
+
+	return false, ctx
+}
+
 func (wh *WsHandler) identifyAndAuthenticate(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request, wsReq *ws.Request) (bool, context.Context) {
 
 	var i iam.ClientIdentity
@@ -523,6 +674,18 @@ func (wh *WsHandler) SupportsVersion(version httpendpoint.RequiredVersion) bool
 	return wh.VersionAssessor.SupportsVersion(wh.ComponentName(), version)
 }
 
+// CORSPolicy returns the CORS policy that should be used for requests to this handler or nil if the default
+// policy should be used. Implements cors.PolicyProvider
+func (wh *WsHandler) CORSPolicy() *cors.Policy {
+	return wh.CORS
+}
+
+// AssignedListeners returns the names of the HTTP listeners this handler should be registered with. Implements
+// httpendpoint.ListenerAssigned
+func (wh *WsHandler) AssignedListeners() []string {
+	return wh.Listeners
+}
+
 // AutoWireable returns true if this handler should be automatically registered with any instances of httpserver.HTTPServer
 // that are running in the application.
 func (wh *WsHandler) AutoWireable() bool {
@@ -596,6 +759,99 @@ func (wh *WsHandler) process(ctx context.Context, request *ws.Request, w *httpen
 
 }
 
+func (wh *WsHandler) processStream(ctx context.Context, request *ws.Request, req *http.Request, w *httpendpoint.HTTPResponseWriter) {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	events := ws.NewEventSink(ctx, w, wh.ErrorFinder)
+	events.LastEventID = req.Header.Get(ws.LastEventIDHeader)
+
+	wh.trackStream(events, cancel)
+	defer wh.untrackStream(events)
+
+	if wh.StreamHeartbeatMS >= 0 {
+
+		interval := defaultStreamHeartbeat
+
+		if wh.StreamHeartbeatMS > 0 {
+			interval = time.Duration(wh.StreamHeartbeatMS) * time.Millisecond
+		}
+
+		stopHeartbeat := events.Heartbeat(interval)
+		defer stopHeartbeat()
+	}
+
+	// Nothing may be written to the response once this method has returned
+	defer events.Close()
+
+	defer func() {
+		if r := recover(); r != nil {
+			wh.Log.LogErrorfCtxWithTrace(ctx, "Panic recovered while streaming events %s", r)
+
+			if !events.Opened() {
+				wh.writePanicResponse(ctx, r, w)
+			}
+		}
+	}()
+
+	wh.streamProcessor.ProcessStream(ctx, request, events)
+
+	if events.Opened() {
+		return
+	}
+
+	if events.Errors.HasErrors() {
+		wh.writeErrorResponse(ctx, events.Errors, w, request)
+		return
+	}
+
+	// No events were sent - open (and immediately end) the stream so the caller sees a valid, empty stream
+	if err := events.Open(); err != nil && err != ws.ErrEventStreamClosed {
+		wh.Log.LogErrorfCtx(ctx, "Problem writing response: %s", err.Error())
+	}
+}
+
+func (wh *WsHandler) trackStream(events *ws.EventSink, cancel context.CancelFunc) {
+	wh.streamMutex.Lock()
+	defer wh.streamMutex.Unlock()
+
+	if wh.streams == nil {
+		wh.streams = make(map[*ws.EventSink]context.CancelFunc)
+	}
+
+	wh.streams[events] = cancel
+}
+
+func (wh *WsHandler) untrackStream(events *ws.EventSink) {
+	wh.streamMutex.Lock()
+	defer wh.streamMutex.Unlock()
+
+	if cancel, found := wh.streams[events]; found {
+		cancel()
+		delete(wh.streams, events)
+	}
+}
+
+// CloseConnections cancels the context of every event stream this handler currently has open, so that the
+// WsStreamProcessor returns and the stream ends. Called by the HTTP server when it is suspended or stopped. Implements
+// httpendpoint.ConnectionCloser
+func (wh *WsHandler) CloseConnections() {
+	wh.streamMutex.Lock()
+	defer wh.streamMutex.Unlock()
+
+	for _, cancel := range wh.streams {
+		cancel()
+	}
+}
+
+// OpenStreams returns the number of event streams currently open.
+func (wh *WsHandler) OpenStreams() int {
+	wh.streamMutex.Lock()
+	defer wh.streamMutex.Unlock()
+
+	return len(wh.streams)
+}
+
 func (wh *WsHandler) writeErrorResponse(ctx context.Context, errors *ws.ServiceErrors, w *httpendpoint.HTTPResponseWriter, wsReq *ws.Request) {
 
 	l := wh.Log
@@ -635,6 +891,36 @@ func (wh *WsHandler) writeErrorResponse(ctx context.Context, errors *ws.ServiceE
 
 }
 
+func (wh *WsHandler) writeTooBusyResponse(ctx context.Context, w *httpendpoint.HTTPResponseWriter, wsReq *ws.Request) {
+
+	status := wh.TooBusyStatus
+
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	wh.writeHTTPErrorResponse(ctx, w, wsReq, status)
+}
+
+// writeHTTPErrorResponse writes a response with the supplied status and the framework's generic message for that status
+func (wh *WsHandler) writeHTTPErrorResponse(ctx context.Context, w *httpendpoint.HTTPResponseWriter, wsReq *ws.Request, status int) {
+
+	if wh.FrameworkErrors == nil {
+		state := ws.NewAbnormalState(status, w)
+		state.Identity = wsReq.UserIdentity
+		state.WsRequest = wsReq
+
+		wh.ResponseWriter.Write(ctx, state, ws.Abnormal)
+		return
+	}
+
+	var se ws.ServiceErrors
+	se.HTTPStatus = status
+	se.AddError(wh.FrameworkErrors.HTTPError(status))
+
+	wh.writeErrorResponse(ctx, &se, w, wsReq)
+}
+
 func (wh *WsHandler) writePanicResponse(ctx context.Context, r interface{}, w *httpendpoint.HTTPResponseWriter) {
 
 	state := ws.NewAbnormalState(http.StatusInternalServerError, w)
@@ -667,6 +953,15 @@ func (wh *WsHandler) StartComponent() error {
 		return err
 	}
 
+	if wh.MaxConcurrent > 0 {
+
+		if wh.Bulkhead != nil {
+			return errors.New("handlers cannot have both MaxConcurrent and Bulkhead set")
+		}
+
+		wh.Bulkhead = &Bulkhead{MaxConcurrent: wh.MaxConcurrent, QueueTimeoutMS: wh.QueueTimeoutMS, componentName: wh.componentName}
+	}
+
 	validator, found := wh.Logic.(WsRequestValidator)
 
 	wh.validationEnabled = found || wh.AutoValidator != nil
@@ -712,12 +1007,18 @@ func (wh *WsHandler) checkLogicComponent() error {
 		return nil
 	}
 
+	if sp, found := wh.Logic.(WsStreamProcessor); found {
+
+		wh.streamProcessor = sp
+		return nil
+	}
+
 	return wh.validateProcessPayload()
 }
 
 func (wh *WsHandler) validateProcessPayload() error {
 
-	err := fmt.Errorf("Logic compoonent must either implement WsRequestProcessor or have method %s(ctx context.Context, request *ws.Request, response *ws.Response, payload *YourStruct)", processPayloadFunc)
+	err := fmt.Errorf("Logic compoonent must either implement WsRequestProcessor or WsStreamProcessor or have method %s(ctx context.Context, request *ws.Request, response *ws.Response, payload *YourStruct)", processPayloadFunc)
 
 	if wh.Logic == nil {
 		return err
@@ -783,6 +1084,21 @@ func (wh *WsHandler) extractFactoryFromLogic() func() interface{} {
 
 }
 
+// TargetType returns the type of the object that request data (body, path and query parameters) will be bound into,
+// or nil if the handler's Logic component neither implements WsUnmarshallTarget nor has a ProcessPayload method.
+func (wh *WsHandler) TargetType() reflect.Type {
+
+	if targetSource, found := wh.Logic.(WsUnmarshallTarget); found {
+		return reflect.TypeOf(targetSource.UnmarshallTarget())
+	}
+
+	if f := wh.extractFactoryFromLogic(); f != nil {
+		return reflect.TypeOf(f())
+	}
+
+	return nil
+}
+
 // ComponentName implements ComponentNamer.ComponentName
 func (wh *WsHandler) ComponentName() string {
 	return wh.componentName
@@ -11,9 +11,12 @@ import (
 	"github.com/graniticio/granitic/v2/test"
 	"github.com/graniticio/granitic/v2/ws"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMinimal(t *testing.T) {
@@ -174,6 +177,223 @@ func TestHandlerStart(t *testing.T) {
 
 }
 
+func TestRateLimitedRequest(t *testing.T) {
+
+	l := new(ProcessOnlyLogic)
+
+	h, req := GetHandler(t)
+
+	h.Logic = l
+	h.RateLimiter = &fixedRateLimiter{wait: 1500 * time.Millisecond}
+
+	rw := new(statusRecordingResponseWriter)
+	h.ResponseWriter = rw
+
+	test.ExpectNil(t, h.StartComponent())
+
+	uw := NewStringBufferResponseWriter()
+	w := httpendpoint.NewHTTPResponseWriter(uw)
+
+	h.ServeHTTP(context.Background(), w, req)
+
+	test.ExpectBool(t, l.Called, false)
+	test.ExpectInt(t, rw.status, http.StatusTooManyRequests)
+	test.ExpectString(t, uw.Header().Get("Retry-After"), "2")
+
+	h.RateLimiter = &fixedRateLimiter{allow: true}
+	h.ServeHTTP(context.Background(), w, req)
+
+	test.ExpectBool(t, l.Called, true)
+}
+
+func TestStreamingRequest(t *testing.T) {
+
+	l := &streamLogic{events: []string{"a", "b"}}
+
+	h, req := GetHandler(t)
+	req.Header.Set(ws.LastEventIDHeader, "41")
+
+	h.Logic = l
+	h.StreamHeartbeatMS = -1
+
+	test.ExpectNil(t, h.StartComponent())
+
+	uw := NewStringBufferResponseWriter()
+	w := httpendpoint.NewHTTPResponseWriter(uw)
+
+	h.ServeHTTP(context.Background(), w, req)
+
+	test.ExpectString(t, l.lastEventID, "41")
+	test.ExpectString(t, uw.buffer.String(), "data: a\n\ndata: b\n\n")
+	test.ExpectString(t, uw.Header().Get("Content-Type"), ws.EventStreamContentType)
+	test.ExpectInt(t, w.Status, http.StatusOK)
+
+	// Events sent after the logic has returned are discarded
+	test.ExpectBool(t, l.sink.SendData("late") == ws.ErrEventStreamClosed, true)
+
+	// Access is checked before streaming starts
+	l = &streamLogic{events: []string{"a"}}
+	h, req = GetHandler(t)
+
+	h.Logic = l
+	h.AccessChecker = new(denyingAccessChecker)
+
+	rw := new(statusRecordingResponseWriter)
+	h.ResponseWriter = rw
+
+	test.ExpectNil(t, h.StartComponent())
+
+	uw = NewStringBufferResponseWriter()
+	h.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(uw), req)
+
+	test.ExpectBool(t, l.sink == nil, true)
+	test.ExpectInt(t, rw.status, http.StatusForbidden)
+	test.ExpectString(t, uw.buffer.String(), "")
+}
+
+func TestStreamsCancelledOnClose(t *testing.T) {
+
+	l := &waitingStreamLogic{started: make(chan bool)}
+
+	h, req := GetHandler(t)
+	h.Logic = l
+	h.StreamHeartbeatMS = -1
+
+	test.ExpectNil(t, h.StartComponent())
+
+	done := make(chan bool)
+
+	go func() {
+		h.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(NewStringBufferResponseWriter()), req)
+		done <- true
+	}()
+
+	<-l.started
+	test.ExpectInt(t, h.OpenStreams(), 1)
+
+	h.CloseConnections()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Stream was not ended when the handler's connections were closed")
+	}
+
+	test.ExpectInt(t, h.OpenStreams(), 0)
+}
+
+func TestContentNegotiation(t *testing.T) {
+
+	l := new(AllPhasesLogic)
+
+	h, _ := GetHandler(t)
+	h.HTTPMethod = http.MethodPost
+	h.Logic = l
+
+	rw := new(statusRecordingResponseWriter)
+	um := new(recordingUnmarshaller)
+	f := &ws.NegotiatedFormat{Name: "JSON", MediaTypes: []string{"application/json"}, ResponseWriter: rw, Unmarshaller: um}
+
+	h.ResponseWriter = &ws.NegotiatingResponseWriter{Formats: []*ws.NegotiatedFormat{f}}
+	h.Unmarshaller = &ws.NegotiatingUnmarshaller{Formats: []*ws.NegotiatedFormat{f}}
+
+	test.ExpectNil(t, h.StartComponent())
+
+	post := func(contentType, accept string) {
+		req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+
+		h.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(NewStringBufferResponseWriter()), req)
+	}
+
+	post("application/json", "application/xml")
+	test.ExpectInt(t, rw.status, http.StatusNotAcceptable)
+	test.ExpectBool(t, l.ProcessCalled, false)
+
+	post("text/plain", "application/*")
+	test.ExpectInt(t, rw.status, http.StatusUnsupportedMediaType)
+	test.ExpectBool(t, um.called, false)
+
+	rw.status = 0
+	post("application/json; charset=utf-8", "application/xml;q=0.9, application/json;q=0.5")
+	test.ExpectInt(t, rw.status, 0)
+	test.ExpectBool(t, um.called, true)
+	test.ExpectBool(t, l.ProcessCalled, true)
+
+	// Resources created while parsing the request are released once it has been processed
+	test.ExpectBool(t, um.cleaned, true)
+}
+
+type recordingUnmarshaller struct {
+	called  bool
+	cleaned bool
+}
+
+func (um *recordingUnmarshaller) Unmarshall(ctx context.Context, req *http.Request, wsReq *ws.Request) error {
+	um.called = true
+	wsReq.AddCleanup(func() { um.cleaned = true })
+
+	return nil
+}
+
+type streamLogic struct {
+	events      []string
+	lastEventID string
+	sink        *ws.EventSink
+}
+
+func (l *streamLogic) ProcessStream(ctx context.Context, request *ws.Request, events *ws.EventSink) {
+
+	l.sink = events
+	l.lastEventID = events.LastEventID
+
+	for _, e := range l.events {
+		if events.SendData(e) != nil {
+			return
+		}
+	}
+}
+
+type waitingStreamLogic struct {
+	started chan bool
+}
+
+func (l *waitingStreamLogic) ProcessStream(ctx context.Context, request *ws.Request, events *ws.EventSink) {
+
+	events.Open()
+	l.started <- true
+
+	<-ctx.Done()
+}
+
+type denyingAccessChecker struct{}
+
+func (ac *denyingAccessChecker) Allowed(ctx context.Context, r *ws.Request) bool {
+	return false
+}
+
+type fixedRateLimiter struct {
+	allow bool
+	wait  time.Duration
+}
+
+func (rl *fixedRateLimiter) Allow(ctx context.Context, r *ws.Request, req *http.Request) (bool, time.Duration) {
+	return rl.allow, rl.wait
+}
+
+type statusRecordingResponseWriter struct {
+	status int
+}
+
+func (rw *statusRecordingResponseWriter) Write(ctx context.Context, state *ws.ProcessState, outcome ws.Outcome) error {
+	if outcome == ws.Abnormal {
+		rw.status = state.Status
+	}
+
+	return nil
+}
+
 func GetHandler(t *testing.T) (*WsHandler, *http.Request) {
 
 	gf := filepath.Join("ws", "get")
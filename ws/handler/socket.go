@@ -0,0 +1,393 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/iam"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/websocket"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxMessageBytes = 1024 * 1024
+	defaultPingInterval    = 30 * time.Second
+	socketWriteTimeout     = 10 * time.Second
+)
+
+// WsSocketProcessor is implemented by logic components that communicate with callers over a WebSocket.
+type WsSocketProcessor interface {
+	// ProcessSocket exchanges messages with the caller using the supplied connection. The connection is closed (with
+	// websocket.CloseNormal) when this method returns if the logic component has not already closed it. The supplied
+	// context is cancelled when the HTTP server closes the connection (because it is being suspended or stopped).
+	ProcessSocket(ctx context.Context, request *ws.Request, conn *websocket.Conn)
+}
+
+// WsSocketHandler upgrades HTTP requests to WebSocket connections (RFC 6455) and passes each connection to a logic
+// component. Implements httpendpoint.Provider
+//
+// Callers are identified and their access checked (using the UserIdentifier and AccessChecker fields) in the same way as
+// for a WsHandler before the connection is upgraded. Requests that are rejected receive a normal HTTP error response.
+//
+// A handler is declared in your component definition file like:
+//
+//	{
+//	  "chatHandler": {
+//		"type": "handler.WsSocketHandler",
+//		"Logic": "ref:chatLogic",
+//		"PathPattern": "^/chat$"
+//	  }
+//	}
+//
+// Connections are held open (and count as active requests on the HTTP server) until the logic component's ProcessSocket
+// method returns. All of the handler's connections are closed with websocket.CloseGoingAway when an HTTP server the
+// handler is registered with is suspended or stopped.
+type WsSocketHandler struct {
+	// A component able to examine a request and see if the caller is allowed to access this endpoint.
+	AccessChecker ws.AccessChecker
+
+	// The values of the Origin header that browsers may connect from (e.g. https://example.com). If empty, browsers
+	// may only connect from pages served from the same host as the handler. A single entry of * allows any origin.
+	AllowedOrigins []string
+
+	// The names of the HTTP listeners (see the HTTPServer facility) this handler should be registered with.
+	Listeners []string
+
+	// A logger injected by the Granitic framework.
+	Log logging.Logger
+
+	// The component that exchanges messages with the caller.
+	Logic WsSocketProcessor
+
+	// The maximum size (in bytes) of a message sent by the caller. Larger messages cause the connection to be closed with
+	// websocket.CloseMessageTooBig. If zero, messages are limited to 1 MiB. If negative, messages are limited only by
+	// websocket.MaxMessageLimit (64 MiB).
+	MaxMessageBytes int64
+
+	// A regex that will be matched against inbound request paths to check if this handler should be used to service the request.
+	PathPattern string
+
+	// How often (in milliseconds) a ping is sent to the caller. A connection is closed if nothing (including a pong) is
+	// received from the caller within twice this interval. If zero, pings are sent every 30 seconds. If negative, pings are
+	// not sent and connections never time out.
+	PingIntervalMS int
+
+	// Stop the framework automatically adding this handler to an HTTP server.
+	PreventAutoWiring bool
+
+	// Whether on not the caller needs to be authenticated (using a ws.Identifier) in order to open a connection.
+	RequireAuthentication bool
+
+	// A component injected by the Granitic framework that writes error responses if a request is rejected before the
+	// connection is upgraded.
+	ResponseWriter ws.ResponseWriter
+
+	// The WebSocket subprotocols (in order of preference) that the Logic component supports.
+	Subprotocols []string
+
+	// A component that can examine a request to determine the calling user/service's identity.
+	UserIdentifier ws.Identifier
+
+	componentName string
+	config        *websocket.Config
+	pathRegex     *regexp.Regexp
+	state         ioc.ComponentState
+
+	mutex       sync.Mutex
+	connections map[*websocket.Conn]context.CancelFunc
+}
+
+// ServeHTTP checks the caller is allowed to open a connection, upgrades the connection and passes it to the handler's
+// Logic component.
+func (sh *WsSocketHandler) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+
+	wsReq := new(ws.Request)
+	wsReq.HTTPMethod = req.Method
+	wsReq.ServingHandler = sh.ComponentName()
+	wsReq.ClientIP = httpendpoint.ClientIP(ctx, req)
+	wsReq.QueryParams = ws.NewParamsForQuery(req.URL.Query())
+	wsReq.PathParams = sh.pathRegex.FindStringSubmatch(req.URL.Path)[1:]
+
+	wsReq.ID = ws.RecoverIDFunction(ctx)
+
+	if wsReq.ID == nil {
+		wsReq.ID = func(ctx2 context.Context) string {
+			return ""
+		}
+	}
+
+	if err := websocket.CheckHandshake(req); err != nil {
+
+		if he := err.(*websocket.HandshakeError); he.Status == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", websocket.SupportedVersion)
+		}
+
+		sh.Log.LogDebugfCtx(ctx, "Rejected WebSocket handshake: %s", err.Error())
+		sh.reject(ctx, w, wsReq, err.(*websocket.HandshakeError).Status)
+
+		return ctx
+	}
+
+	if !sh.originAllowed(req) {
+		sh.Log.LogDebugfCtx(ctx, "Rejected WebSocket connection from origin %s", req.Header.Get("Origin"))
+		sh.reject(ctx, w, wsReq, http.StatusForbidden)
+
+		return ctx
+	}
+
+	if sh.UserIdentifier != nil {
+
+		var i iam.ClientIdentity
+
+		i, ctx = sh.UserIdentifier.Identify(ctx, req)
+		wsReq.UserIdentity = i
+
+		if sh.RequireAuthentication && !i.Authenticated() {
+			sh.reject(ctx, w, wsReq, http.StatusUnauthorized)
+			return ctx
+		}
+	}
+
+	if wsReq.UserIdentity == nil {
+		wsReq.UserIdentity = iam.NewAnonymousIdentity()
+	}
+
+	if sh.AccessChecker != nil && !sh.AccessChecker.Allowed(ctx, wsReq) {
+		sh.reject(ctx, w, wsReq, http.StatusForbidden)
+		return ctx
+	}
+
+	conn, err := websocket.Upgrade(w, req, sh.config)
+
+	if err != nil {
+		sh.Log.LogErrorfCtx(ctx, "Unable to upgrade connection to a WebSocket: %s", err.Error())
+
+		if !w.DataSent {
+			sh.reject(ctx, w, wsReq, http.StatusInternalServerError)
+		}
+
+		return ctx
+	}
+
+	// The response is now owned by the connection - record the outcome for the access log
+	w.Status = http.StatusSwitchingProtocols
+	w.DataSent = true
+
+	sCtx, cancel := context.WithCancel(ctx)
+
+	sh.track(conn, cancel)
+
+	defer func() {
+		sh.untrack(conn)
+		cancel()
+
+		w.BytesServed = int(conn.BytesWritten())
+
+		if r := recover(); r != nil {
+			sh.Log.LogErrorfCtxWithTrace(ctx, "Panic recovered while processing a WebSocket connection %s", r)
+			conn.Close(websocket.CloseInternalError, "")
+		}
+	}()
+
+	sh.Logic.ProcessSocket(sCtx, wsReq, conn)
+
+	conn.Close(websocket.CloseNormal, "")
+
+	return ctx
+}
+
+func (sh *WsSocketHandler) reject(ctx context.Context, w *httpendpoint.HTTPResponseWriter, wsReq *ws.Request, status int) {
+
+	if sh.ResponseWriter == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	state := ws.NewAbnormalState(status, w)
+	state.Identity = wsReq.UserIdentity
+	state.WsRequest = wsReq
+
+	sh.ResponseWriter.Write(ctx, state, ws.Abnormal)
+}
+
+// originAllowed protects against cross-site WebSocket hijacking by checking the Origin header sent by browsers
+func (sh *WsSocketHandler) originAllowed(req *http.Request) bool {
+
+	origin := req.Header.Get("Origin")
+
+	if origin == "" {
+		// Not a browser
+		return true
+	}
+
+	if len(sh.AllowedOrigins) == 0 {
+
+		u, err := url.Parse(origin)
+
+		return err == nil && strings.EqualFold(u.Host, req.Host)
+	}
+
+	for _, o := range sh.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sh *WsSocketHandler) track(conn *websocket.Conn, cancel context.CancelFunc) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	sh.connections[conn] = cancel
+}
+
+func (sh *WsSocketHandler) untrack(conn *websocket.Conn) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	delete(sh.connections, conn)
+}
+
+// CloseConnections closes all open connections with websocket.CloseGoingAway. Called by the HTTP server when it is
+// suspended or stopped. Implements httpendpoint.ConnectionCloser
+func (sh *WsSocketHandler) CloseConnections() {
+	sh.mutex.Lock()
+
+	open := make(map[*websocket.Conn]context.CancelFunc, len(sh.connections))
+
+	for conn, cancel := range sh.connections {
+		open[conn] = cancel
+	}
+
+	sh.mutex.Unlock()
+
+	// Connections are closed in parallel (and without holding the lock) so a stalled client cannot delay the others
+	var wg sync.WaitGroup
+
+	for conn, cancel := range open {
+
+		wg.Add(1)
+
+		go func(conn *websocket.Conn, cancel context.CancelFunc) {
+			defer wg.Done()
+
+			cancel()
+			conn.Close(websocket.CloseGoingAway, "server unavailable")
+		}(conn, cancel)
+	}
+
+	wg.Wait()
+}
+
+// OpenConnections returns the number of WebSocket connections currently open.
+func (sh *WsSocketHandler) OpenConnections() int {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	return len(sh.connections)
+}
+
+// SupportedHTTPMethods returns GET - the only method that can be used to open a WebSocket.
+func (sh *WsSocketHandler) SupportedHTTPMethods() []string {
+	return []string{http.MethodGet}
+}
+
+// RegexPattern returns the unparsed regex pattern that should be applied to the path of incoming requests to
+// see if this handler should handle the request.
+func (sh *WsSocketHandler) RegexPattern() string {
+	return sh.PathPattern
+}
+
+// VersionAware returns false - WebSocket handlers do not support versioning.
+func (sh *WsSocketHandler) VersionAware() bool {
+	return false
+}
+
+// SupportsVersion always returns true
+func (sh *WsSocketHandler) SupportsVersion(version httpendpoint.RequiredVersion) bool {
+	return true
+}
+
+// AssignedListeners returns the names of the HTTP listeners this handler should be registered with. Implements
+// httpendpoint.ListenerAssigned
+func (sh *WsSocketHandler) AssignedListeners() []string {
+	return sh.Listeners
+}
+
+// AutoWireable returns true if this handler should be automatically registered with any instances of httpserver.HTTPServer
+// that are running in the application.
+func (sh *WsSocketHandler) AutoWireable() bool {
+	return !sh.PreventAutoWiring
+}
+
+// StartComponent is called by the IoC container. Verifies that the handler's configuration is valid.
+func (sh *WsSocketHandler) StartComponent() error {
+
+	if sh.state != ioc.StoppedState {
+		return nil
+	}
+
+	sh.state = ioc.StartingState
+
+	if sh.PathPattern == "" || sh.Logic == nil {
+		return errors.New("WebSocket handlers must have at least a PathPattern string and Logic component set")
+	}
+
+	r, err := regexp.Compile(sh.PathPattern)
+
+	if err != nil {
+		return err
+	}
+
+	sh.pathRegex = r
+
+	c := new(websocket.Config)
+	c.Subprotocols = sh.Subprotocols
+	c.WriteTimeout = socketWriteTimeout
+
+	switch {
+	case sh.MaxMessageBytes == 0:
+		c.MaxMessageBytes = defaultMaxMessageBytes
+	case sh.MaxMessageBytes > 0:
+		c.MaxMessageBytes = sh.MaxMessageBytes
+	}
+
+	switch {
+	case sh.PingIntervalMS == 0:
+		c.PingInterval = defaultPingInterval
+	case sh.PingIntervalMS > 0:
+		c.PingInterval = time.Duration(sh.PingIntervalMS) * time.Millisecond
+	}
+
+	c.ReadTimeout = 2 * c.PingInterval
+
+	sh.config = c
+	sh.connections = make(map[*websocket.Conn]context.CancelFunc)
+
+	sh.state = ioc.RunningState
+
+	return nil
+}
+
+// ComponentName implements ComponentNamer.ComponentName
+func (sh *WsSocketHandler) ComponentName() string {
+	return sh.componentName
+}
+
+// SetComponentName implements ComponentNamer.SetComponentName
+func (sh *WsSocketHandler) SetComponentName(name string) {
+	sh.componentName = name
+}
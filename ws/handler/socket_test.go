@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/websocket"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSocketHandler(t *testing.T) {
+
+	l := &echoSocketLogic{finished: make(chan error, 1)}
+
+	sh := new(WsSocketHandler)
+	sh.PathPattern = "^/chat/([a-z]+)$"
+	sh.Logic = l
+	sh.Log = new(logging.NullLogger)
+	sh.Subprotocols = []string{"echo"}
+
+	test.ExpectNil(t, sh.StartComponent())
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sh.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(w), req)
+	}))
+
+	defer s.Close()
+
+	// Browsers on other sites are refused
+	c, r := socketRequest(t, s, "http://elsewhere.example.com")
+	test.ExpectString(t, statusLine(t, r), "HTTP/1.1 403 Forbidden")
+	c.Close()
+
+	c, r = socketRequest(t, s, "")
+	defer c.Close()
+
+	test.ExpectString(t, statusLine(t, r), "HTTP/1.1 101 Switching Protocols")
+
+	headers := readHeaders(t, r)
+	test.ExpectString(t, headers["sec-websocket-accept"], websocket.AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+	test.ExpectString(t, headers["sec-websocket-protocol"], "echo")
+
+	// Masked text frame containing "hi"
+	c.Write([]byte{0x81, 0x82, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2})
+
+	op, payload := readFrame(t, r)
+	test.ExpectInt(t, int(op), 1)
+	test.ExpectString(t, payload, "room: hi")
+
+	test.ExpectInt(t, sh.OpenConnections(), 1)
+
+	// Suspending or stopping the server closes the connection
+	sh.CloseConnections()
+
+	op, payload = readFrame(t, r)
+	test.ExpectInt(t, int(op), 8)
+	test.ExpectInt(t, int(binary.BigEndian.Uint16([]byte(payload))), int(websocket.CloseGoingAway))
+
+	select {
+	case err := <-l.finished:
+		if err != websocket.ErrClosed {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Logic did not finish after connection was closed")
+	}
+
+	// The connection is forgotten once the handler has finished with it
+	deadline := time.Now().Add(time.Second)
+
+	for sh.OpenConnections() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	test.ExpectInt(t, sh.OpenConnections(), 0)
+}
+
+func TestSocketHandlerAccess(t *testing.T) {
+
+	sh := new(WsSocketHandler)
+	sh.PathPattern = "^/chat/([a-z]+)$"
+	sh.Logic = new(echoSocketLogic)
+	sh.Log = new(logging.NullLogger)
+	sh.AccessChecker = new(denyingAccessChecker)
+
+	test.ExpectNil(t, sh.StartComponent())
+
+	req := httptest.NewRequest("GET", "/chat/room", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	res := httptest.NewRecorder()
+	sh.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(res), req)
+
+	test.ExpectInt(t, res.Code, http.StatusForbidden)
+
+	req.Header.Set("Sec-WebSocket-Version", "12")
+
+	res = httptest.NewRecorder()
+	sh.ServeHTTP(context.Background(), httpendpoint.NewHTTPResponseWriter(res), req)
+
+	test.ExpectInt(t, res.Code, http.StatusUpgradeRequired)
+	test.ExpectString(t, res.Header().Get("Sec-WebSocket-Version"), "13")
+
+	if err := new(WsSocketHandler).StartComponent(); err == nil {
+		t.Errorf("Expected error starting handler without PathPattern and Logic")
+	}
+}
+
+type echoSocketLogic struct {
+	finished chan error
+}
+
+func (l *echoSocketLogic) ProcessSocket(ctx context.Context, request *ws.Request, conn *websocket.Conn) {
+
+	for {
+		_, m, err := conn.ReadMessage()
+
+		if err != nil {
+			l.finished <- err
+			return
+		}
+
+		conn.WriteText(request.PathParams[0] + ": " + string(m))
+	}
+}
+
+func socketRequest(t *testing.T, s *httptest.Server, origin string) (net.Conn, *bufio.Reader) {
+
+	c, err := net.Dial("tcp", strings.TrimPrefix(s.URL, "http://"))
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := "GET /chat/room HTTP/1.1\r\nHost: " + strings.TrimPrefix(s.URL, "http://") + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: chat, echo\r\n"
+
+	if origin != "" {
+		req += "Origin: " + origin + "\r\n"
+	}
+
+	c.Write([]byte(req + "\r\n"))
+
+	return c, bufio.NewReader(c)
+}
+
+func statusLine(t *testing.T, r *bufio.Reader) string {
+
+	l, err := r.ReadString('\n')
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return strings.TrimSpace(l)
+}
+
+func readHeaders(t *testing.T, r *bufio.Reader) map[string]string {
+
+	h := make(map[string]string)
+
+	for {
+		l := statusLine(t, r)
+
+		if l == "" {
+			return h
+		}
+
+		kv := strings.SplitN(l, ":", 2)
+		h[strings.ToLower(kv[0])] = strings.TrimSpace(kv[1])
+	}
+}
+
+func readFrame(t *testing.T, r *bufio.Reader) (byte, string) {
+
+	var header [2]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	payload := make([]byte, header[1]&0x7F)
+	io.ReadFull(r, payload)
+
+	return header[0] & 0x0F, string(payload)
+}
@@ -0,0 +1,370 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/ws/wire"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	fixMapCode    = 0x80
+	fixArrayCode  = 0x90
+	fixStrCode    = 0xa0
+	nilCode       = 0xc0
+	falseCode     = 0xc2
+	trueCode      = 0xc3
+	bin8Code      = 0xc4
+	bin16Code     = 0xc5
+	bin32Code     = 0xc6
+	ext8Code      = 0xc7
+	ext16Code     = 0xc8
+	ext32Code     = 0xc9
+	float32Code   = 0xca
+	float64Code   = 0xcb
+	uint8Code     = 0xcc
+	uint16Code    = 0xcd
+	uint32Code    = 0xce
+	uint64Code    = 0xcf
+	int8Code      = 0xd0
+	int16Code     = 0xd1
+	int32Code     = 0xd2
+	int64Code     = 0xd3
+	fixExt1Code   = 0xd4
+	fixExt16Code  = 0xd8
+	str8Code      = 0xd9
+	str16Code     = 0xda
+	str32Code     = 0xdb
+	array16Code   = 0xdc
+	array32Code   = 0xdd
+	map16Code     = 0xde
+	map32Code     = 0xdf
+	timestampType = -1
+)
+
+var errTruncated = errors.New("msgpack: unexpected end of data")
+
+// Unmarshal parses the MessagePack encoded data and stores the result in the value pointed to by v, using the same
+// rules as Go's json.Unmarshal. Timestamps (extension type -1) are converted to RFC 3339 strings so they can be
+// stored in time.Time fields; other extension types are not supported.
+func Unmarshal(b []byte, v interface{}) error {
+
+	d := &decoder{data: b}
+
+	data, err := d.decode(0)
+
+	if err != nil {
+		return err
+	}
+
+	if d.pos != len(d.data) {
+		return errors.New("msgpack: unexpected data after top-level value")
+	}
+
+	return wire.ToGo(data, v)
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+func (d *decoder) readUint(size int) (uint64, error) {
+
+	b, err := d.read(size)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var buf [8]byte
+	copy(buf[8-size:], b)
+
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+
+	if depth > wire.MaxDepth {
+		return nil, wire.ErrMaxDepth
+	}
+
+	b, err := d.read(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == fixMapCode:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == fixArrayCode:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == fixStrCode:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case nilCode:
+		return nil, nil
+	case falseCode:
+		return false, nil
+	case trueCode:
+		return true, nil
+
+	case bin8Code, bin16Code, bin32Code:
+
+		n, err := d.readLength(1 << (c - bin8Code))
+
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := d.read(n)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bin := make([]byte, n)
+		copy(bin, b)
+
+		return bin, nil
+
+	case str8Code, str16Code, str32Code:
+
+		n, err := d.readLength(1 << (c - str8Code))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeString(n)
+
+	case array16Code, array32Code:
+
+		n, err := d.readLength(2 << (c - array16Code))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeArray(n, depth)
+
+	case map16Code, map32Code:
+
+		n, err := d.readLength(2 << (c - map16Code))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeMap(n, depth)
+
+	case float32Code:
+
+		n, err := d.readUint(4)
+
+		return float64(math.Float32frombits(uint32(n))), err
+
+	case float64Code:
+
+		n, err := d.readUint(8)
+
+		return math.Float64frombits(n), err
+
+	case uint8Code, uint16Code, uint32Code, uint64Code:
+
+		n, err := d.readUint(1 << (c - uint8Code))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+
+		return n, nil
+
+	case int8Code:
+		n, err := d.readUint(1)
+		return int64(int8(n)), err
+
+	case int16Code:
+		n, err := d.readUint(2)
+		return int64(int16(n)), err
+
+	case int32Code:
+		n, err := d.readUint(4)
+		return int64(int32(n)), err
+
+	case int64Code:
+		n, err := d.readUint(8)
+		return int64(n), err
+
+	case ext8Code, ext16Code, ext32Code:
+
+		n, err := d.readLength(1 << (c - ext8Code))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return d.decodeExt(n)
+	}
+
+	if c >= fixExt1Code && c <= fixExt16Code {
+		return d.decodeExt(1 << (c - fixExt1Code))
+	}
+
+	return nil, fmt.Errorf("msgpack: invalid code 0x%x", c)
+}
+
+func (d *decoder) readLength(size int) (int, error) {
+
+	n, err := d.readUint(size)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n > uint64(len(d.data)-d.pos) {
+		// Every element takes up at least one byte, so the length cannot be valid
+		return 0, errTruncated
+	}
+
+	return int(n), nil
+}
+
+func (d *decoder) decodeString(n int) (interface{}, error) {
+
+	b, err := d.read(n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (d *decoder) decodeArray(n int, depth int) (interface{}, error) {
+
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+
+	a := make([]interface{}, n)
+
+	for i := range a {
+
+		e, err := d.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		a[i] = e
+	}
+
+	return a, nil
+}
+
+func (d *decoder) decodeMap(n int, depth int) (interface{}, error) {
+
+	if n*2 > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+
+	m := make(wire.Map, n)
+
+	for i := range m {
+
+		k, err := d.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch key := k.(type) {
+		case string:
+			m[i].Key = key
+		case []byte:
+			m[i].Key = string(key)
+		case int64:
+			m[i].Key = strconv.FormatInt(key, 10)
+		case uint64:
+			m[i].Key = strconv.FormatUint(key, 10)
+		default:
+			return nil, fmt.Errorf("msgpack: unsupported map key type %T", k)
+		}
+
+		if m[i].Value, err = d.decode(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (d *decoder) decodeExt(n int) (interface{}, error) {
+
+	t, err := d.read(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := d.read(n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(t[0]) != timestampType {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(t[0]))
+	}
+
+	var sec int64
+	var nsec int64
+
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(b))
+	case 8:
+		v := binary.BigEndian.Uint64(b)
+		nsec = int64(v >> 34)
+		sec = int64(v & 0x3ffffffff)
+	case 12:
+		nsec = int64(binary.BigEndian.Uint32(b))
+		sec = int64(binary.BigEndian.Uint64(b[4:]))
+	default:
+		return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+	}
+
+	return time.Unix(sec, nsec).UTC().Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/graniticio/granitic/v2/ws/wire"
+	"math"
+)
+
+// Marshal returns the MessagePack encoding of v, using the same rules as Go's json.Marshal to decide which fields are
+// encoded and how they are named.
+func Marshal(v interface{}) ([]byte, error) {
+
+	data, err := wire.FromGo(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	if err := encode(&b, data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func encode(b *bytes.Buffer, data interface{}) error {
+
+	switch d := data.(type) {
+	case nil:
+		b.WriteByte(nilCode)
+
+	case bool:
+
+		if d {
+			b.WriteByte(trueCode)
+		} else {
+			b.WriteByte(falseCode)
+		}
+
+	case int64:
+		encodeInt(b, d)
+
+	case uint64:
+		encodeUint(b, d)
+
+	case float64:
+		b.WriteByte(float64Code)
+		writeUint(b, math.Float64bits(d), 8)
+
+	case string:
+
+		if err := encodeLength(b, len(d), fixStrCode, 31, str8Code); err != nil {
+			return err
+		}
+
+		b.WriteString(d)
+
+	case []byte:
+
+		if err := encodeLength(b, len(d), 0, -1, bin8Code); err != nil {
+			return err
+		}
+
+		b.Write(d)
+
+	case []interface{}:
+
+		if err := encodeLength(b, len(d), fixArrayCode, 15, array16Code); err != nil {
+			return err
+		}
+
+		for _, e := range d {
+			if err := encode(b, e); err != nil {
+				return err
+			}
+		}
+
+	case wire.Map:
+
+		if err := encodeLength(b, len(d), fixMapCode, 15, map16Code); err != nil {
+			return err
+		}
+
+		for _, e := range d {
+
+			if err := encode(b, e.Key); err != nil {
+				return err
+			}
+
+			if err := encode(b, e.Value); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack: unable to encode %T", data)
+	}
+
+	return nil
+}
+
+func encodeInt(b *bytes.Buffer, n int64) {
+
+	switch {
+	case n >= 0:
+		encodeUint(b, uint64(n))
+	case n >= -32:
+		b.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		b.WriteByte(int8Code)
+		b.WriteByte(byte(n))
+	case n >= math.MinInt16:
+		b.WriteByte(int16Code)
+		writeUint(b, uint64(n), 2)
+	case n >= math.MinInt32:
+		b.WriteByte(int32Code)
+		writeUint(b, uint64(n), 4)
+	default:
+		b.WriteByte(int64Code)
+		writeUint(b, uint64(n), 8)
+	}
+}
+
+func encodeUint(b *bytes.Buffer, n uint64) {
+
+	switch {
+	case n <= math.MaxInt8:
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(uint8Code)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(uint16Code)
+		writeUint(b, n, 2)
+	case n <= math.MaxUint32:
+		b.WriteByte(uint32Code)
+		writeUint(b, n, 4)
+	default:
+		b.WriteByte(uint64Code)
+		writeUint(b, n, 8)
+	}
+}
+
+// encodeLength writes the header for a string, binary, array or map. Lengths up to fixMax are written in a single
+// byte with the fix code, otherwise the header starts with one of three consecutive codes for 8, 16 and 32 bit
+// lengths (arrays and maps have no 8 bit form, so their first code is the 16 bit one).
+func encodeLength(b *bytes.Buffer, n int, fixCode byte, fixMax int, code byte) error {
+
+	hasByteLength := code == str8Code || code == bin8Code
+
+	switch {
+	case n <= fixMax:
+		b.WriteByte(fixCode | byte(n))
+	case hasByteLength && n <= math.MaxUint8:
+		b.WriteByte(code)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+
+		if hasByteLength {
+			code++
+		}
+
+		b.WriteByte(code)
+		writeUint(b, uint64(n), 2)
+
+	case uint64(n) <= math.MaxUint32:
+
+		if hasByteLength {
+			code++
+		}
+
+		b.WriteByte(code + 1)
+		writeUint(b, uint64(n), 4)
+
+	default:
+		return errors.New("msgpack: value is too long to encode")
+	}
+
+	return nil
+}
+
+func writeUint(b *bytes.Buffer, n uint64, size int) {
+
+	var buf [8]byte
+
+	binary.BigEndian.PutUint64(buf[:], n)
+
+	b.Write(buf[8-size:])
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package msgpack defines types that are specific to handling web service requests and responses as MessagePack
+(https://msgpack.org). Components implementing these types will be created when you enable the MsgPackWs facility.
+
+Marshalling and unmarshalling
+
+The encoder and decoder in this package are self-contained and decide which fields of your types are sent and received
+using the same rules as Go's built-in json package - including json struct tags - so the same types can be used for
+JSON and MessagePack web services. See the ws/wire package for details.
+
+Response wrapping and error formatting
+
+Responses are wrapped and service errors formatted by the same components used by the JSONWs facility
+(json.BodyOrErrorWrapper or json.GraniticJSONResponseWrapper and json.GraniticJSONErrorFormatter), so the structure of
+a MessagePack response is identical to the equivalent JSON response.
+*/
+package msgpack
+
+import (
+	"net/http"
+)
+
+// MarshalingWriter serialises a struct to MessagePack and writes it to the HTTP response output stream.
+type MarshalingWriter struct {
+}
+
+// MarshalAndWrite serialises the supplied interface to MessagePack and writes it to the HTTP response output stream.
+func (mw *MarshalingWriter) MarshalAndWrite(data interface{}, w http.ResponseWriter) error {
+
+	b, err := Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
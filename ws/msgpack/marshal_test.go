@@ -0,0 +1,137 @@
+package msgpack
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/types"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type item struct {
+	A int                  `json:"a"`
+	B []interface{}        `json:"b"`
+	C string               `json:"c,omitempty"`
+	D *types.NilableString `json:"d,omitempty"`
+}
+
+func TestMarshal(t *testing.T) {
+
+	b, err := Marshal(&item{A: 1, B: []interface{}{true, nil}})
+	test.ExpectNil(t, err)
+	test.ExpectString(t, hex.EncodeToString(b), "82a16101a16292c3c0")
+
+	vectors := map[string]interface{}{
+		"ff":                 -1,
+		"d0df":               -33,
+		"ccc8":               200,
+		"ce00011170":         70000,
+		"d3ffffffff7fffffff": -2147483649,
+		"cf8000000000000000": uint64(1) << 63,
+		"cb3ff8000000000000": 1.5,
+		"c403010203":         []byte{1, 2, 3},
+	}
+
+	for expected, v := range vectors {
+		b, err := Marshal(v)
+		test.ExpectNil(t, err)
+		test.ExpectString(t, hex.EncodeToString(b), expected)
+	}
+
+	b, err = Marshal(strings.Repeat("x", 32))
+	test.ExpectNil(t, err)
+	test.ExpectString(t, hex.EncodeToString(b), "d920"+strings.Repeat("78", 32))
+}
+
+func TestUnmarshal(t *testing.T) {
+
+	i := new(item)
+
+	test.ExpectNil(t, Unmarshal(mustDecodeHex("84a16101a16292c3c0a163a178a164a3616e6e"), i))
+	test.ExpectInt(t, i.A, 1)
+	test.ExpectInt(t, len(i.B), 2)
+	test.ExpectString(t, i.C, "x")
+	test.ExpectString(t, i.D.String(), "ann")
+
+	// Round trip
+	in := &item{A: -70000, B: []interface{}{"s", 2.5}, D: types.NewNilableString("z")}
+
+	b, err := Marshal(in)
+	test.ExpectNil(t, err)
+
+	out := new(item)
+	test.ExpectNil(t, Unmarshal(b, out))
+	test.ExpectInt(t, out.A, -70000)
+	test.ExpectString(t, out.B[0].(string), "s")
+	test.ExpectBool(t, out.B[1].(float64) == 2.5, true)
+	test.ExpectString(t, out.D.String(), "z")
+
+	// Timestamp extension
+	var ts struct{ T time.Time }
+	test.ExpectNil(t, Unmarshal(mustDecodeHex("81a154d6ff5c7925c8"), &ts))
+	test.ExpectInt(t, ts.T.Year(), 2019)
+
+	for _, invalid := range []string{"92c3", "c0c0", "c1", "d40100", "81c3c3", ""} {
+		test.ExpectNotNil(t, Unmarshal(mustDecodeHex(invalid), new(interface{})))
+	}
+}
+
+func TestMarshalingWriterAndUnmarshaller(t *testing.T) {
+
+	w := httptest.NewRecorder()
+
+	mw := new(MarshalingWriter)
+	test.ExpectNil(t, mw.MarshalAndWrite(map[string]int{"a": 1}, w))
+	test.ExpectString(t, hex.EncodeToString(w.Body.Bytes()), "81a16101")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(w.Body.Bytes())))
+
+	wsReq := new(ws.Request)
+	i := new(item)
+	wsReq.RequestBody = i
+
+	u := new(Unmarshaller)
+	u.FrameworkLogger = new(logging.NullLogger)
+
+	test.ExpectNil(t, u.Unmarshall(context.Background(), req, wsReq))
+	test.ExpectInt(t, i.A, 1)
+}
+
+func TestWrappedErrors(t *testing.T) {
+
+	se := new(ws.ServiceErrors)
+	se.AddNewError(ws.Client, "NAME", "Name is required")
+
+	ef := new(json.GraniticJSONErrorFormatter)
+	rw := &json.GraniticJSONResponseWrapper{ErrorsFieldName: "Errors", BodyFieldName: "Response"}
+
+	b, err := Marshal(rw.WrapResponse(nil, ef.FormatErrors(se)))
+	test.ExpectNil(t, err)
+
+	var m map[string]interface{}
+	test.ExpectNil(t, Unmarshal(b, &m))
+
+	general := m["Errors"].(map[string]interface{})["General"].([]interface{})
+	e := general[0].(map[string]interface{})
+
+	test.ExpectString(t, e["Code"].(string), "C-NAME")
+	test.ExpectString(t, e["Message"].(string), "Name is required")
+}
+
+func mustDecodeHex(s string) []byte {
+
+	b, err := hex.DecodeString(s)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ws
+
+import (
+	"context"
+	"errors"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"net/http"
+	"strings"
+)
+
+// A ContentNegotiator is a ResponseWriter or Unmarshaller that supports more than one format and chooses between them
+// based on the headers of each request.
+type ContentNegotiator interface {
+	// Negotiate examines the headers of the supplied request. If the request can be supported, a status of zero is
+	// returned along with a context recording the format chosen. Otherwise the returned status is the HTTP status
+	// (e.g. 406 or 415) the request should be rejected with.
+	Negotiate(ctx context.Context, req *http.Request) (context.Context, int)
+}
+
+// NegotiatedFormat is a format (e.g. JSON or XML) that can be chosen by a NegotiatingResponseWriter or
+// NegotiatingUnmarshaller.
+type NegotiatedFormat struct {
+	// A name for the format (e.g. JSON)
+	Name string
+
+	// The media types (e.g. application/json) that the format can parse and render.
+	MediaTypes []string
+
+	// The component that writes responses in this format.
+	ResponseWriter ResponseWriter
+
+	// The component that parses request bodies in this format.
+	Unmarshaller Unmarshaller
+}
+
+type negotiatedFormatKey string
+
+const negotiatedFormat negotiatedFormatKey = "GRNCNEGFORMAT"
+
+// NegotiatedFormatFromContext returns the format chosen for the response to the current request or nil if no
+// format has been negotiated.
+func NegotiatedFormatFromContext(ctx context.Context) *NegotiatedFormat {
+
+	if f, found := ctx.Value(negotiatedFormat).(*NegotiatedFormat); found {
+		return f
+	}
+
+	return nil
+}
+
+// NegotiatingResponseWriter is a ResponseWriter that chooses between a number of formats based on the Accept header
+// of each request (respecting q-values). If a request has no Accept header, or has not been negotiated (for example
+// a 404 response written by the HTTP server), the first format is used.
+type NegotiatingResponseWriter struct {
+	// The formats available, in order of preference.
+	Formats []*NegotiatedFormat
+}
+
+// Negotiate chooses the format the response to the supplied request will be written in, returning 406 (Not
+// Acceptable) if none of the formats are acceptable to the caller. Implements ContentNegotiator
+func (rw *NegotiatingResponseWriter) Negotiate(ctx context.Context, req *http.Request) (context.Context, int) {
+
+	f := chooseAcceptable(rw.Formats, req.Header.Get("Accept"))
+
+	if f == nil {
+		return ctx, http.StatusNotAcceptable
+	}
+
+	return context.WithValue(ctx, negotiatedFormat, f), 0
+}
+
+// Write delegates to the ResponseWriter of the negotiated format. Implements ResponseWriter
+func (rw *NegotiatingResponseWriter) Write(ctx context.Context, state *ProcessState, outcome Outcome) error {
+
+	rw.vary(state)
+
+	return rw.chosen(ctx).ResponseWriter.Write(ctx, state, outcome)
+}
+
+// WriteAbnormalStatus delegates to the ResponseWriter of the negotiated format, if that ResponseWriter implements
+// AbnormalStatusWriter. Implements AbnormalStatusWriter
+func (rw *NegotiatingResponseWriter) WriteAbnormalStatus(ctx context.Context, state *ProcessState) error {
+
+	rw.vary(state)
+
+	f := rw.chosen(ctx)
+
+	if asw, found := f.ResponseWriter.(AbnormalStatusWriter); found {
+		return asw.WriteAbnormalStatus(ctx, state)
+	}
+
+	return f.ResponseWriter.Write(ctx, state, Abnormal)
+}
+
+func (rw *NegotiatingResponseWriter) chosen(ctx context.Context) *NegotiatedFormat {
+
+	if f := NegotiatedFormatFromContext(ctx); f != nil {
+		return f
+	}
+
+	return rw.Formats[0]
+}
+
+// vary tells caches that the format of the response depends on the Accept header
+func (rw *NegotiatingResponseWriter) vary(state *ProcessState) {
+
+	if len(rw.Formats) > 1 && state.HTTPResponseWriter != nil {
+		state.HTTPResponseWriter.Header().Add("Vary", "Accept")
+	}
+}
+
+// NegotiatingUnmarshaller is an Unmarshaller that chooses between a number of formats based on the Content-Type
+// header of each request. Requests without a Content-Type header are parsed with the first format.
+type NegotiatingUnmarshaller struct {
+	// The formats available, in order of preference.
+	Formats []*NegotiatedFormat
+}
+
+// Negotiate returns 415 (Unsupported Media Type) if the supplied request has a body in a format that cannot be
+// parsed. Implements ContentNegotiator
+func (um *NegotiatingUnmarshaller) Negotiate(ctx context.Context, req *http.Request) (context.Context, int) {
+
+	if req.ContentLength == 0 {
+		return ctx, 0
+	}
+
+	if um.forContentType(req.Header.Get("Content-Type")) == nil {
+		return ctx, http.StatusUnsupportedMediaType
+	}
+
+	return ctx, 0
+}
+
+// Unmarshall delegates to the Unmarshaller of the format matching the request's Content-Type. Implements Unmarshaller
+func (um *NegotiatingUnmarshaller) Unmarshall(ctx context.Context, req *http.Request, wsReq *Request) error {
+
+	f := um.forContentType(req.Header.Get("Content-Type"))
+
+	if f == nil {
+		return errors.New("no Unmarshaller available for content type " + req.Header.Get("Content-Type"))
+	}
+
+	return f.Unmarshaller.Unmarshall(ctx, req, wsReq)
+}
+
+func (um *NegotiatingUnmarshaller) forContentType(contentType string) *NegotiatedFormat {
+
+	mediaType, _ := httpendpoint.ParseQualityValue(contentType)
+
+	if mediaType == "" {
+		return um.Formats[0]
+	}
+
+	for _, f := range um.Formats {
+		for _, mt := range f.MediaTypes {
+			if strings.ToLower(mt) == mediaType {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
+
+// chooseAcceptable returns the format with the highest q-value in the supplied Accept header, preferring formats
+// earlier in the list when q-values are equal. Returns nil if no format is acceptable.
+func chooseAcceptable(formats []*NegotiatedFormat, accept string) *NegotiatedFormat {
+
+	if len(formats) == 0 {
+		return nil
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return formats[0]
+	}
+
+	var ranges []string
+	var qs []float64
+
+	for _, part := range strings.Split(accept, ",") {
+		r, q := httpendpoint.ParseQualityValue(part)
+
+		ranges = append(ranges, r)
+		qs = append(qs, q)
+	}
+
+	var best *NegotiatedFormat
+	bestQ := 0.0
+
+	for _, f := range formats {
+		for _, mt := range f.MediaTypes {
+
+			if q := acceptQuality(strings.ToLower(mt), ranges, qs); q > bestQ {
+				best = f
+				bestQ = q
+			}
+		}
+	}
+
+	return best
+}
+
+// acceptQuality finds the q-value of the most specific media range matching the supplied media type
+func acceptQuality(mediaType string, ranges []string, qs []float64) float64 {
+
+	q := 0.0
+	specificity := -1
+
+	mainType := strings.Split(mediaType, "/")[0]
+
+	for i, r := range ranges {
+
+		s := -1
+
+		switch {
+		case r == mediaType:
+			s = 2
+		case r == mainType+"/*":
+			s = 1
+		case r == "*/*" || r == "*":
+			s = 0
+		}
+
+		if s > specificity {
+			specificity = s
+			q = qs[i]
+		}
+	}
+
+	return q
+}
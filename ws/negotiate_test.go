@@ -0,0 +1,124 @@
+package ws
+
+import (
+	"context"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChooseAcceptable(t *testing.T) {
+
+	jf := &NegotiatedFormat{Name: "JSON", MediaTypes: []string{"application/json"}}
+	xf := &NegotiatedFormat{Name: "XML", MediaTypes: []string{"application/xml", "text/xml"}}
+	formats := []*NegotiatedFormat{jf, xf}
+
+	choose := func(accept string) string {
+		if f := chooseAcceptable(formats, accept); f != nil {
+			return f.Name
+		}
+
+		return ""
+	}
+
+	test.ExpectString(t, choose(""), "JSON")
+	test.ExpectString(t, choose("*/*"), "JSON")
+	test.ExpectString(t, choose("text/xml"), "XML")
+	test.ExpectString(t, choose("application/*"), "JSON")
+	test.ExpectString(t, choose("application/json;q=0.4, application/xml;q=0.8"), "XML")
+	test.ExpectString(t, choose("text/*;q=0.9, application/json;q=0.5"), "XML")
+	test.ExpectString(t, choose("application/*, application/json;q=0"), "XML")
+	test.ExpectString(t, choose("text/html"), "")
+	test.ExpectString(t, choose("application/json;q=0"), "")
+}
+
+func TestNegotiatingResponseWriter(t *testing.T) {
+
+	jw := new(formatRecordingWriter)
+	xw := new(formatRecordingWriter)
+
+	rw := new(NegotiatingResponseWriter)
+	rw.Formats = []*NegotiatedFormat{
+		{Name: "JSON", MediaTypes: []string{"application/json"}, ResponseWriter: jw},
+		{Name: "XML", MediaTypes: []string{"application/xml"}, ResponseWriter: xw},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/xml")
+
+	ctx, status := rw.Negotiate(context.Background(), req)
+	test.ExpectInt(t, status, 0)
+	test.ExpectString(t, NegotiatedFormatFromContext(ctx).Name, "XML")
+
+	rec := httptest.NewRecorder()
+	state := NewAbnormalState(http.StatusNotFound, httpendpoint.NewHTTPResponseWriter(rec))
+
+	test.ExpectNil(t, rw.Write(ctx, state, Normal))
+	test.ExpectInt(t, xw.writes, 1)
+	test.ExpectString(t, rec.Header().Get("Vary"), "Accept")
+
+	// Requests that have not been negotiated use the first format
+	test.ExpectNil(t, rw.WriteAbnormalStatus(context.Background(), state))
+	test.ExpectInt(t, jw.writes, 1)
+
+	req.Header.Set("Accept", "text/html")
+	_, status = rw.Negotiate(context.Background(), req)
+	test.ExpectInt(t, status, http.StatusNotAcceptable)
+}
+
+func TestNegotiatingUnmarshaller(t *testing.T) {
+
+	ju := new(formatRecordingUnmarshaller)
+	xu := new(formatRecordingUnmarshaller)
+
+	um := new(NegotiatingUnmarshaller)
+	um.Formats = []*NegotiatedFormat{
+		{Name: "JSON", MediaTypes: []string{"application/json"}, Unmarshaller: ju},
+		{Name: "XML", MediaTypes: []string{"application/xml", "text/xml"}, Unmarshaller: xu},
+	}
+
+	body := func(contentType string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body"))
+		req.Header.Set("Content-Type", contentType)
+
+		return req
+	}
+
+	_, status := um.Negotiate(context.Background(), body("text/xml; charset=utf-8"))
+	test.ExpectInt(t, status, 0)
+
+	test.ExpectNil(t, um.Unmarshall(context.Background(), body("text/xml; charset=utf-8"), new(Request)))
+	test.ExpectInt(t, xu.calls, 1)
+
+	test.ExpectNil(t, um.Unmarshall(context.Background(), body(""), new(Request)))
+	test.ExpectInt(t, ju.calls, 1)
+
+	_, status = um.Negotiate(context.Background(), body("text/plain"))
+	test.ExpectInt(t, status, http.StatusUnsupportedMediaType)
+	test.ExpectNotNil(t, um.Unmarshall(context.Background(), body("text/plain"), new(Request)))
+
+	// Requests without a body are not checked
+	_, status = um.Negotiate(context.Background(), httptest.NewRequest(http.MethodPost, "/", nil))
+	test.ExpectInt(t, status, 0)
+}
+
+type formatRecordingWriter struct {
+	writes int
+}
+
+func (w *formatRecordingWriter) Write(ctx context.Context, state *ProcessState, outcome Outcome) error {
+	w.writes++
+	return nil
+}
+
+type formatRecordingUnmarshaller struct {
+	calls int
+}
+
+func (u *formatRecordingUnmarshaller) Unmarshall(ctx context.Context, req *http.Request, wsReq *Request) error {
+	u.calls++
+	return nil
+}
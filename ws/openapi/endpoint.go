@@ -0,0 +1,83 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/logging"
+	"net/http"
+	"regexp"
+)
+
+// Endpoint is an httpendpoint.Provider that serves the document built by a Generator as JSON.
+type Endpoint struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// The generator that builds the document.
+	Generator *Generator
+
+	// The exact path (e.g. /openapi.json) this endpoint responds to.
+	Path string
+
+	// The names of the HTTP listeners this endpoint should be registered with (see the HTTPServer facility). If empty,
+	// the endpoint is registered with the default listener.
+	Listeners []string
+}
+
+// SupportedHTTPMethods returns GET
+func (e *Endpoint) SupportedHTTPMethods() []string {
+	return []string{http.MethodGet}
+}
+
+// RegexPattern returns a pattern that only matches the endpoint's Path
+func (e *Endpoint) RegexPattern() string {
+	return "^" + regexp.QuoteMeta(e.Path) + "$"
+}
+
+// ServeHTTP generates and writes the document
+func (e *Endpoint) ServeHTTP(ctx context.Context, w *httpendpoint.HTTPResponseWriter, req *http.Request) context.Context {
+
+	d, err := e.Generator.Generate()
+
+	if err == nil {
+
+		var b []byte
+
+		if b, err = json.MarshalIndent(d, "", "  "); err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(b)
+
+			return ctx
+		}
+	}
+
+	e.FrameworkLogger.LogErrorfCtx(ctx, "Unable to generate OpenAPI document: %s", err.Error())
+	w.WriteHeader(http.StatusInternalServerError)
+
+	return ctx
+}
+
+// VersionAware returns false
+func (e *Endpoint) VersionAware() bool {
+	return false
+}
+
+// SupportsVersion returns true
+func (e *Endpoint) SupportsVersion(version httpendpoint.RequiredVersion) bool {
+	return true
+}
+
+// AutoWireable returns true
+func (e *Endpoint) AutoWireable() bool {
+	return true
+}
+
+// AssignedListeners returns the endpoint's Listeners. Implements httpendpoint.ListenerAssigned
+func (e *Endpoint) AssignedListeners() []string {
+	return e.Listeners
+}
@@ -0,0 +1,460 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package openapi
+
+import (
+	"fmt"
+	"github.com/graniticio/granitic/v2/grncerror"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/validate"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/handler"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultContentType = "application/json"
+	streamContentType  = "text/event-stream"
+	defaultTooBusy     = http.StatusServiceUnavailable
+)
+
+// Generator builds an OpenAPI document describing every handler.WsHandler in the IoC container (other than those
+// created by Granitic itself).
+type Generator struct {
+	// Injected by Granitic
+	FrameworkLogger logging.Logger
+
+	// The title of the API. If empty, the application's instance ID is used.
+	Title string
+
+	// A description of the API.
+	Description string
+
+	// The version of the API (not the version of the OpenAPI specification).
+	Version string
+
+	// The URLs at which the API is available.
+	Servers []string
+
+	// The content types request bodies and successful responses are described with. Defaults to application/json
+	ContentTypes []string
+
+	container  *ioc.ComponentContainer
+	instanceID string
+}
+
+// Container accepts a reference to the IoC container. Implements ioc.ContainerAccessor
+func (g *Generator) Container(container *ioc.ComponentContainer) {
+	g.container = container
+}
+
+// RegisterInstanceID implements instance.Receiver
+func (g *Generator) RegisterInstanceID(i *instance.Identifier) {
+	g.instanceID = i.ID
+}
+
+// Generate builds a document describing the handlers currently in the container.
+func (g *Generator) Generate() (*Document, error) {
+
+	d := new(Document)
+	d.OpenAPI = SpecificationVersion
+	d.Info = Info{Title: g.Title, Description: g.Description, Version: g.Version}
+	d.Paths = make(map[string]*PathItem)
+
+	if d.Info.Title == "" {
+		d.Info.Title = g.instanceID
+	}
+
+	for _, s := range g.Servers {
+		d.Servers = append(d.Servers, Server{URL: s})
+	}
+
+	sb := newSchemaBuilder()
+
+	for _, c := range g.handlers() {
+
+		h := c.Instance.(*handler.WsHandler)
+
+		if err := g.addHandler(d, sb, c.Name, h); err != nil {
+			return nil, fmt.Errorf("unable to describe handler %s: %s", c.Name, err.Error())
+		}
+	}
+
+	if len(sb.components) > 0 {
+		d.Components = &Components{Schemas: sb.components}
+	}
+
+	return d, nil
+}
+
+// handlers returns the application's handlers sorted by name
+func (g *Generator) handlers() []*ioc.Component {
+
+	var hs []*ioc.Component
+
+	if g.container == nil {
+		return hs
+	}
+
+	for _, c := range g.container.AllComponents() {
+
+		if _, found := c.Instance.(*handler.WsHandler); found && !strings.HasPrefix(c.Name, instance.FrameworkPrefix) {
+			hs = append(hs, c)
+		}
+	}
+
+	sort.Sort(ioc.ByName{Components: hs})
+
+	return hs
+}
+
+func (g *Generator) addHandler(d *Document, sb *schemaBuilder, name string, h *handler.WsHandler) error {
+
+	target := h.TargetType()
+	fields := make(map[string]property)
+
+	if target != nil {
+		for _, p := range properties(target) {
+			fields[p.field] = p
+		}
+	}
+
+	constraints := make(map[string]*validate.FieldConstraints)
+
+	if h.AutoValidator != nil {
+
+		fcs, err := h.AutoValidator.Constraints()
+
+		if err != nil {
+			return err
+		}
+
+		for _, fc := range fcs {
+			constraints[fc.Field] = fc
+		}
+	}
+
+	op := new(Operation)
+	op.OperationID = name
+	op.PathPattern = h.PathPattern
+
+	bound := make(map[string]bool)
+
+	paramName := func(i int, pg pathGroup) string {
+
+		if i < len(h.BindPathParams) && h.BindPathParams[i] != "" {
+			return h.BindPathParams[i]
+		}
+
+		if pg.name != "" {
+			return pg.name
+		}
+
+		return "param" + strconv.Itoa(i)
+	}
+
+	path, groups := templatePath(h.PathPattern, paramName)
+
+	for i, pg := range groups {
+
+		if pg.nested {
+			continue
+		}
+
+		p := &Parameter{Name: paramName(i, pg), In: "path", Required: true}
+
+		if i < len(h.BindPathParams) && !h.DisablePathParsing {
+
+			if f, found := fields[h.BindPathParams[i]]; found {
+				p.Schema = sb.schemaFor(f.t)
+				bound[f.field] = true
+			}
+		}
+
+		if p.Schema == nil {
+			p.Schema = &Schema{Type: "string"}
+		}
+
+		if fc := constraints[p.Name]; fc != nil && bound[p.Name] {
+			constrain(p.Schema, fc)
+		}
+
+		if p.Schema.Type == "string" && p.Schema.Pattern == "" {
+			p.Schema.Pattern = "^" + pg.pattern + "$"
+		}
+
+		op.Parameters = append(op.Parameters, p)
+	}
+
+	if target != nil && !h.DisableQueryParsing {
+		op.Parameters = append(op.Parameters, g.queryParameters(sb, h, fields, constraints, bound)...)
+	}
+
+	for _, m := range h.SupportedHTTPMethods() {
+
+		if h.Unmarshaller != nil && target != nil && hasBody(m) {
+			op.RequestBody = g.requestBody(sb, target, constraints, bound)
+		}
+
+		op.Responses = g.responses(h, target != nil)
+
+		pi := d.Paths[path]
+
+		if pi == nil {
+			pi = &PathItem{}
+			d.Paths[path] = pi
+		}
+
+		method := strings.ToLower(m)
+
+		if existing := (*pi)[method]; existing != nil {
+			g.FrameworkLogger.LogWarnf("Handlers %s and %s both handle %s %s. Only %s is included in the OpenAPI document", existing.OperationID, name, m, path, existing.OperationID)
+			continue
+		}
+
+		(*pi)[method] = op
+	}
+
+	return nil
+}
+
+func (g *Generator) queryParameters(sb *schemaBuilder, h *handler.WsHandler, fields map[string]property, constraints map[string]*validate.FieldConstraints, bound map[string]bool) []*Parameter {
+
+	fieldParams := make(map[string]string)
+
+	if h.AutoBindQuery {
+
+		for f := range fields {
+			if !bound[f] {
+				fieldParams[f] = f
+			}
+		}
+
+	} else {
+
+		for f, p := range h.FieldQueryParam {
+			if _, found := fields[f]; found {
+				fieldParams[f] = p
+			}
+		}
+	}
+
+	var ps []*Parameter
+
+	for f, n := range fieldParams {
+
+		p := &Parameter{Name: n, In: "query", Schema: sb.schemaFor(fields[f].t)}
+
+		if fc := constraints[f]; fc != nil {
+			p.Required = fc.Required
+			constrain(p.Schema, fc)
+		}
+
+		bound[f] = true
+		ps = append(ps, p)
+	}
+
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+
+	return ps
+}
+
+func (g *Generator) requestBody(sb *schemaBuilder, target reflect.Type, constraints map[string]*validate.FieldConstraints, bound map[string]bool) *RequestBody {
+
+	s, names := sb.objectSchema(target, bound)
+
+	if len(s.Properties) == 0 {
+		return nil
+	}
+
+	for f, fc := range constraints {
+
+		n, found := names[f]
+
+		if !found {
+			continue
+		}
+
+		constrain(s.Properties[n], fc)
+
+		if fc.Required {
+			s.Required = append(s.Required, n)
+		}
+	}
+
+	sort.Strings(s.Required)
+
+	rb := &RequestBody{Content: make(map[string]*MediaType)}
+
+	for _, ct := range g.contentTypes() {
+		rb.Content[ct] = &MediaType{Schema: s}
+	}
+
+	return rb
+}
+
+func (g *Generator) responses(h *handler.WsHandler, binds bool) map[string]*Response {
+
+	rs := make(map[string]*Response)
+
+	success := &Response{Description: "Success", Content: make(map[string]*MediaType)}
+
+	if _, found := h.Logic.(handler.WsStreamProcessor); found {
+		success.Content[streamContentType] = &MediaType{Schema: &Schema{Type: "string"}}
+	} else {
+		for _, ct := range g.contentTypes() {
+			success.Content[ct] = &MediaType{Schema: &Schema{}}
+		}
+	}
+
+	rs[strconv.Itoa(http.StatusOK)] = success
+
+	add := func(status int) *Response {
+
+		k := strconv.Itoa(status)
+		r := rs[k]
+
+		if r == nil {
+			r = &Response{Description: http.StatusText(status)}
+			rs[k] = r
+		}
+
+		return r
+	}
+
+	if binds || h.AutoValidator != nil {
+		add(http.StatusBadRequest)
+	}
+
+	if h.UserIdentifier != nil && h.RequireAuthentication {
+		add(http.StatusUnauthorized)
+	}
+
+	if h.AccessChecker != nil {
+		add(http.StatusForbidden)
+	}
+
+	if h.RateLimiter != nil {
+		add(http.StatusTooManyRequests)
+	}
+
+	if h.MaxConcurrent > 0 || h.Bulkhead != nil {
+
+		tb := h.TooBusyStatus
+
+		if tb == 0 {
+			tb = defaultTooBusy
+		}
+
+		add(tb)
+	}
+
+	add(http.StatusInternalServerError)
+
+	sd := ws.NewGraniticHTTPStatusCodeDeterminer()
+
+	for _, code := range errorCodes(h) {
+
+		if h.ErrorFinder == nil {
+			break
+		}
+
+		ce := h.ErrorFinder.Find(code)
+
+		if ce == nil {
+			continue
+		}
+
+		var status int
+
+		switch ce.Category {
+		case ws.Client:
+			status = sd.Client
+		case ws.Logic:
+			status = sd.Logic
+		case ws.Security:
+			status = sd.Security
+		case ws.HTTP:
+			status, _ = strconv.Atoi(ce.Code)
+		default:
+			status = sd.Unexpected
+		}
+
+		if status == 0 {
+			continue
+		}
+
+		r := add(status)
+
+		dc := ws.CategoryToCode(ce.Category) + "-" + code
+		r.ErrorCodes = append(r.ErrorCodes, dc)
+		r.Description += fmt.Sprintf("\n\n* `%s` %s", dc, ce.Message)
+	}
+
+	return rs
+}
+
+// errorCodes returns the (sorted) codes used by the handler's validator and logic component
+func errorCodes(h *handler.WsHandler) []string {
+
+	var users []grncerror.ErrorCodeUser
+
+	if h.AutoValidator != nil {
+		users = append(users, h.AutoValidator)
+	}
+
+	if u, found := h.Logic.(grncerror.ErrorCodeUser); found {
+		users = append(users, u)
+	}
+
+	unique := make(map[string]bool)
+
+	for _, u := range users {
+
+		codes, _ := u.ErrorCodesInUse()
+
+		if codes == nil {
+			continue
+		}
+
+		for _, c := range codes.Contents() {
+			unique[c] = true
+		}
+	}
+
+	var sorted []string
+
+	for c := range unique {
+		sorted = append(sorted, c)
+	}
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func (g *Generator) contentTypes() []string {
+
+	if len(g.ContentTypes) == 0 {
+		return []string{defaultContentType}
+	}
+
+	return g.ContentTypes
+}
+
+func hasBody(method string) bool {
+
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/graniticio/granitic/v2/config"
+	"github.com/graniticio/granitic/v2/httpendpoint"
+	"github.com/graniticio/granitic/v2/instance"
+	"github.com/graniticio/granitic/v2/ioc"
+	"github.com/graniticio/granitic/v2/logging"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/types"
+	"github.com/graniticio/granitic/v2/validate"
+	"github.com/graniticio/granitic/v2/ws"
+	"github.com/graniticio/granitic/v2/ws/handler"
+	wsjson "github.com/graniticio/granitic/v2/ws/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+
+	g := buildGenerator(t)
+
+	d, err := g.Generate()
+
+	test.ExpectNil(t, err)
+	test.ExpectString(t, d.OpenAPI, SpecificationVersion)
+	test.ExpectString(t, d.Info.Title, "testInstance")
+	test.ExpectInt(t, len(d.Paths), 2)
+
+	// Path parameters and query parameters
+	get := (*d.Paths["/artist/{ID}"])["get"]
+	test.ExpectNotNil(t, get)
+	test.ExpectString(t, get.OperationID, "artistHandler")
+	test.ExpectString(t, get.PathPattern, "^/artist/([\\d]+)[/]?$")
+	test.ExpectBool(t, get.RequestBody == nil, true)
+	test.ExpectInt(t, len(get.Parameters), 2)
+
+	id := get.Parameters[0]
+	test.ExpectString(t, id.In, "path")
+	test.ExpectBool(t, id.Required, true)
+	test.ExpectString(t, id.Schema.Type, "integer")
+
+	detail := get.Parameters[1]
+	test.ExpectString(t, detail.Name, "detail")
+	test.ExpectString(t, detail.In, "query")
+	test.ExpectString(t, detail.Schema.Type, "boolean")
+
+	test.ExpectNotNil(t, get.Responses["200"])
+	test.ExpectNotNil(t, get.Responses["400"])
+	test.ExpectNotNil(t, get.Responses["429"])
+
+	// Request body and validation rules
+	post := (*d.Paths["/artist"])["post"]
+	test.ExpectNotNil(t, post)
+
+	body := post.RequestBody.Content["application/json"].Schema
+	test.ExpectString(t, body.Type, "object")
+	test.ExpectInt(t, len(body.Properties), 5)
+	test.ExpectInt(t, len(body.Required), 1)
+	test.ExpectString(t, body.Required[0], "name")
+
+	name := body.Properties["name"]
+	test.ExpectString(t, name.Type, "string")
+	test.ExpectInt(t, *name.MinLength, 1)
+	test.ExpectInt(t, *name.MaxLength, 64)
+
+	test.ExpectInt(t, len(body.Properties["Genre"].Enum), 2)
+	test.ExpectInt(t, *body.Properties["Tags"].MaxItems, 5)
+	test.ExpectString(t, body.Properties["Formed"].Format, "date-time")
+	test.ExpectString(t, body.Properties["Address"].Ref, "#/components/schemas/address")
+
+	addr := d.Components.Schemas["address"]
+	test.ExpectString(t, addr.Properties["street"].Type, "string")
+	test.ExpectString(t, addr.Properties["Postcode"].Type, "string")
+
+	// Error codes
+	bad := post.Responses["400"]
+	test.ExpectInt(t, len(bad.ErrorCodes), 2)
+	test.ExpectString(t, bad.ErrorCodes[0], "C-INVALID_ARTIST")
+
+	conflict := post.Responses["409"]
+	test.ExpectInt(t, len(conflict.ErrorCodes), 1)
+	test.ExpectString(t, conflict.ErrorCodes[0], "L-ARTIST_EXISTS")
+
+	// Document can be serialised
+	_, err = json.Marshal(d)
+	test.ExpectNil(t, err)
+}
+
+func TestEndpoint(t *testing.T) {
+
+	e := new(Endpoint)
+	e.Generator = buildGenerator(t)
+	e.Path = "/openapi.json"
+	e.FrameworkLogger = new(logging.NullLogger)
+
+	test.ExpectString(t, e.RegexPattern(), "^/openapi\\.json$")
+
+	rec := httptest.NewRecorder()
+	w := httpendpoint.NewHTTPResponseWriter(rec)
+
+	e.ServeHTTP(context.Background(), w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	test.ExpectInt(t, rec.Code, http.StatusOK)
+
+	d := new(Document)
+	test.ExpectNil(t, json.Unmarshal(rec.Body.Bytes(), d))
+	test.ExpectInt(t, len(d.Paths), 2)
+}
+
+func buildGenerator(t *testing.T) *Generator {
+
+	fm := logging.CreateComponentLoggerManager(logging.Fatal, map[string]interface{}{}, []logging.LogWriter{}, logging.NewFrameworkLogMessageFormatter())
+
+	cc := ioc.NewComponentContainer(fm, new(config.Accessor), new(instance.System))
+
+	artist := new(handler.WsHandler)
+	artist.HTTPMethod = http.MethodGet
+	artist.PathPattern = "^/artist/([\\d]+)[/]?$"
+	artist.BindPathParams = []string{"ID"}
+	artist.FieldQueryParam = map[string]string{"Detail": "detail"}
+	artist.Logic = new(artistLogic)
+	artist.RateLimiter = new(neverLimited)
+	cc.WrapAndAddProto("artistHandler", artist)
+
+	v := new(validate.RuleValidator)
+	v.DefaultErrorCode = "INVALID_ARTIST"
+	v.Log = new(logging.NullLogger)
+	v.Rules = [][]string{
+		{"Name", "STR", "REQ:NAME_MISSING", "LEN:1-64:NAME_LENGTH"},
+		{"Genre", "STR", "IN:rock,jazz"},
+		{"Tags", "SLICE", "LEN:-5"},
+	}
+
+	test.ExpectNil(t, v.StartComponent())
+
+	create := new(handler.WsHandler)
+	create.HTTPMethod = http.MethodPost
+	create.PathPattern = "^/artist[/]?$"
+	create.Logic = new(createArtistLogic)
+	create.AutoValidator = v
+	create.ErrorFinder = new(testErrorFinder)
+	create.Unmarshaller = new(wsjson.Unmarshaller)
+	cc.WrapAndAddProto("createArtistHandler", create)
+
+	framework := new(handler.WsHandler)
+	framework.HTTPMethod = http.MethodPost
+	framework.PathPattern = "^/command$"
+	cc.WrapAndAddProto(instance.FrameworkPrefix+"CommandHandler", framework)
+
+	test.ExpectNil(t, cc.Populate())
+
+	g := new(Generator)
+	g.FrameworkLogger = new(logging.NullLogger)
+	g.Version = "1.0.0"
+	g.Container(cc)
+	g.RegisterInstanceID(&instance.Identifier{ID: "testInstance"})
+
+	return g
+}
+
+type artistQuery struct {
+	ID     int64
+	Detail *types.NilableBool
+}
+
+type artistLogic struct{}
+
+func (al *artistLogic) Process(ctx context.Context, request *ws.Request, response *ws.Response) {}
+
+func (al *artistLogic) UnmarshallTarget() interface{} {
+	return new(artistQuery)
+}
+
+type address struct {
+	Street   string `json:"street"`
+	Postcode string
+}
+
+type createArtist struct {
+	Name     string `json:"name"`
+	Genre    string
+	Tags     []string
+	Formed   time.Time
+	Address  *address
+	Internal string `json:"-"`
+}
+
+type createArtistLogic struct{}
+
+func (cl *createArtistLogic) ProcessPayload(ctx context.Context, request *ws.Request, response *ws.Response, ca *createArtist) {
+}
+
+func (cl *createArtistLogic) ErrorCodesInUse() (codes types.StringSet, component string) {
+	return types.NewOrderedStringSet([]string{"ARTIST_EXISTS"}), "createArtistLogic"
+}
+
+func (cl *createArtistLogic) ValidateMissing() bool {
+	return true
+}
+
+type testErrorFinder struct{}
+
+func (ef *testErrorFinder) Find(code string) *ws.CategorisedError {
+
+	if code == "ARTIST_EXISTS" {
+		return ws.NewCategorisedError(ws.Logic, code, "An artist with that name already exists")
+	}
+
+	return ws.NewCategorisedError(ws.Client, code, "Invalid artist")
+}
+
+type neverLimited struct{}
+
+func (nl *neverLimited) Allow(ctx context.Context, wsReq *ws.Request, req *http.Request) (bool, time.Duration) {
+	return true, 0
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package openapi generates OpenAPI 3 (https://spec.openapis.org/oas/v3.0.3) documents describing the web service
+endpoints (instances of handler.WsHandler) hosted by an application.
+
+Most applications will not use the types in this package directly. Instead they will enable the OpenAPI facility
+(see the facility/openapi package), which serves the document from an HTTP endpoint and makes it available via
+grnc-ctl.
+
+# How handlers are described
+
+Each handler becomes an operation (with the handler's component name as its operationId) on the path described by its
+PathPattern. Regular expression groups in the pattern become path parameters, named after the corresponding entry
+in the handler's BindPathParams (or the group's name if it is a named group). For example
+
+	^/artist/([\d]+)[/]?$
+
+with BindPathParams set to ["ID"] becomes
+
+	/artist/{ID}
+
+Patterns that contain regular expression syntax outside of groups cannot be represented exactly as an OpenAPI path, so
+the original pattern is always included in the operation as the extension x-granitic-path-pattern.
+
+The type of the handler's target object (created by the Logic component's UnmarshallTarget method or the type of the
+last argument to its ProcessPayload method) is used to describe:
+
+1. Path parameters bound into fields with BindPathParams.
+
+2. Query parameters bound into fields with FieldQueryParam or, if AutoBindQuery is set, every field of the target.
+
+3. The request body (for methods other than GET, HEAD, DELETE and OPTIONS if the handler has an Unmarshaller). Fields
+bound from path or query parameters are not included. Property names follow the fields' json tags.
+
+If the handler has an AutoValidator, its rules become constraints on the matching parameters and properties:
+
+	REQ    required
+	LEN    minLength/maxLength (strings) or minItems/maxItems (slices)
+	RANGE  minimum/maximum
+	REG    pattern
+	IN     enum
+
+Rules for nested fields (e.g. Address.Street) are not reflected in the document.
+
+Error responses are described using the error codes declared by the handler's AutoValidator and Logic component (if it
+implements grncerror.ErrorCodeUser). Codes are grouped by the HTTP status their category results in and listed in
+each response's description and in the extension x-granitic-error-codes.
+*/
+package openapi
+
+// SpecificationVersion is the version of the OpenAPI specification generated documents conform to
+const SpecificationVersion = "3.0.3"
+
+// Document is the root of an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a URL at which the API is available
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem holds the operations available on a path, keyed by lowercase HTTP method
+type PathItem map[string]*Operation
+
+// Operation describes a single endpoint (handler)
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	PathPattern string               `json:"x-granitic-path-pattern,omitempty"`
+}
+
+// Parameter describes a path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request
+type RequestBody struct {
+	Content map[string]*MediaType `json:"content"`
+}
+
+// MediaType associates a schema with a content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Response describes a response with a particular status code
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+	ErrorCodes  []string              `json:"x-granitic-error-codes,omitempty"`
+}
+
+// Components holds schemas that are referenced from more than one place
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema describes the type of a parameter, property or body
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package openapi
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// pathGroup is a capturing group in a handler's PathPattern
+type pathGroup struct {
+	// The name of a named group (?P<name>...)
+	name string
+
+	// The regular expression matched by the group
+	pattern string
+
+	// Whether the group is contained within another expression (and so does not appear in the path template)
+	nested bool
+}
+
+// templatePath converts a PathPattern regular expression into an OpenAPI path template, replacing each top-level
+// capturing group with a parameter named by the supplied function. Returns the template and every capturing group in
+// the pattern, numbered in the same way as regexp.FindStringSubmatch (and so the path parameters extracted by WsHandler).
+func templatePath(pattern string, name func(i int, g pathGroup) string) (string, []pathGroup) {
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+
+	if err != nil {
+		// WsHandler will refuse to start with an invalid pattern, so there is nothing useful to document
+		return pattern, nil
+	}
+
+	groups := make([]pathGroup, re.MaxCap())
+	captures(re, groups)
+
+	var b strings.Builder
+
+	for _, sub := range pathElements(re) {
+
+		switch sub.Op {
+		case syntax.OpCapture:
+			groups[sub.Cap-1].nested = false
+			b.WriteString("{" + name(sub.Cap-1, groups[sub.Cap-1]) + "}")
+
+		case syntax.OpLiteral:
+			b.WriteString(literal(sub))
+
+		default:
+			b.WriteString(portable(sub).String())
+		}
+	}
+
+	return b.String(), groups
+}
+
+// pathElements returns the top-level expressions in a pattern, with anchors and an optional trailing slash removed
+func pathElements(re *syntax.Regexp) []*syntax.Regexp {
+
+	subs := []*syntax.Regexp{re}
+
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+
+	for len(subs) > 0 && (subs[0].Op == syntax.OpBeginText || subs[0].Op == syntax.OpBeginLine) {
+		subs = subs[1:]
+	}
+
+	for len(subs) > 0 && (subs[len(subs)-1].Op == syntax.OpEndText || subs[len(subs)-1].Op == syntax.OpEndLine) {
+		subs = subs[:len(subs)-1]
+	}
+
+	if l := len(subs); l > 1 && optionalSlash(subs[l-1]) {
+		subs = subs[:l-1]
+	}
+
+	return subs
+}
+
+// optionalSlash returns true if the expression is /? (or an equivalent like [/]?)
+func optionalSlash(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpQuest && re.Sub[0].Op == syntax.OpLiteral && string(re.Sub[0].Rune) == "/"
+}
+
+// captures records every capturing group in the expression as a nested group at the index of its group number.
+// templatePath marks the top-level groups as not nested.
+func captures(re *syntax.Regexp, groups []pathGroup) {
+
+	if re.Op == syntax.OpCapture {
+		groups[re.Cap-1] = pathGroup{name: re.Name, pattern: portable(re.Sub[0]).String(), nested: true}
+	}
+
+	for _, sub := range re.Sub {
+		captures(sub, groups)
+	}
+}
+
+// literal returns the text matched by a literal expression. Case-insensitive literals are shown in lower case.
+func literal(re *syntax.Regexp) string {
+
+	s := string(re.Rune)
+
+	if re.Flags&syntax.FoldCase != 0 {
+		s = strings.ToLower(s)
+	}
+
+	return s
+}
+
+// portable rewrites the parts of an expression that Go would otherwise print using flag groups like (?-s:.) or (?i:a),
+// which are not understood by the ECMA 262 regular expressions used in OpenAPI documents. The expression is modified
+// in place and returned.
+func portable(re *syntax.Regexp) *syntax.Regexp {
+
+	switch {
+	case re.Op == syntax.OpAnyCharNotNL:
+		re.Op = syntax.OpCharClass
+		re.Rune = []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune}
+
+	case re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase != 0:
+
+		re.Op = syntax.OpConcat
+
+		for _, r := range re.Rune {
+
+			folds := []int{int(r)}
+
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				folds = append(folds, int(f))
+			}
+
+			if len(folds) == 1 {
+				re.Sub = append(re.Sub, &syntax.Regexp{Op: syntax.OpLiteral, Rune: []rune{r}})
+				continue
+			}
+
+			sort.Ints(folds)
+
+			c := &syntax.Regexp{Op: syntax.OpCharClass}
+
+			for _, f := range folds {
+				c.Rune = append(c.Rune, rune(f), rune(f))
+			}
+
+			re.Sub = append(re.Sub, c)
+		}
+
+		re.Rune = nil
+		re.Flags &^= syntax.FoldCase
+	}
+
+	for _, sub := range re.Sub {
+		portable(sub)
+	}
+
+	return re
+}
@@ -0,0 +1,65 @@
+package openapi
+
+import (
+	"github.com/graniticio/granitic/v2/test"
+	"strconv"
+	"testing"
+)
+
+func TestTemplatePath(t *testing.T) {
+
+	byIndex := func(i int, g pathGroup) string {
+		if g.name != "" {
+			return g.name
+		}
+
+		return "p" + strconv.Itoa(i)
+	}
+
+	p, g := templatePath("^/artist/([\\d]+)[/]?$", byIndex)
+	test.ExpectString(t, p, "/artist/{p0}")
+	test.ExpectInt(t, len(g), 1)
+	test.ExpectString(t, g[0].pattern, "[0-9]+")
+
+	p, g = templatePath("^/catalogue/(?P<ref>[A-Z]{3}-\\d+)/track/(\\d+)/?$", byIndex)
+	test.ExpectString(t, p, "/catalogue/{ref}/track/{p1}")
+	test.ExpectInt(t, len(g), 2)
+	test.ExpectString(t, g[0].pattern, "[A-Z]{3}-[0-9]+")
+
+	p, g = templatePath("^/a\\.json/((x)|(y))/(\\d)$", byIndex)
+	test.ExpectString(t, p, "/a.json/{p0}/{p3}")
+	test.ExpectInt(t, len(g), 4)
+	test.ExpectBool(t, g[1].nested && g[2].nested, true)
+	test.ExpectBool(t, g[0].nested || g[3].nested, false)
+
+	p, g = templatePath("^/(?:v1|v2)/status[/]?$", byIndex)
+	test.ExpectString(t, p, "/v[12]/status")
+	test.ExpectInt(t, len(g), 0)
+
+	p, _ = templatePath("^/[/]?$", byIndex)
+	test.ExpectString(t, p, "/")
+
+	// Parentheses in character classes are not groups
+	p, g = templatePath("^/a[(]b/([^)]+)$", byIndex)
+	test.ExpectString(t, p, "/a(b/{p0}")
+	test.ExpectInt(t, len(g), 1)
+	test.ExpectString(t, g[0].pattern, "[^\\)]+")
+
+	// Both named group syntaxes are recognised and numbered in order
+	p, g = templatePath("^/x/(?<id>.+)/(?P<part>[a-z]+)/(\\d+)$", byIndex)
+	test.ExpectString(t, p, "/x/{id}/{part}/{p2}")
+	test.ExpectInt(t, len(g), 3)
+	test.ExpectString(t, g[0].pattern, "[^\\n]+")
+
+	// Groups inside other expressions are numbered but not templated
+	p, g = templatePath("^/items(?:/(\\d+))?/(\\w+)$", byIndex)
+	test.ExpectInt(t, len(g), 2)
+	test.ExpectBool(t, g[0].nested, true)
+	test.ExpectBool(t, g[1].nested, false)
+	test.ExpectString(t, p, "/items(?:/([0-9]+))?/{p1}")
+
+	// Case-insensitive patterns produce patterns without Go specific flags
+	p, g = templatePath("^/(?i)abc/(a-[0-9]+)$", byIndex)
+	test.ExpectString(t, p, "/abc/{p0}")
+	test.ExpectString(t, g[0].pattern, "[Aa]-[0-9]+")
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package openapi
+
+import (
+	"github.com/graniticio/granitic/v2/types"
+	"github.com/graniticio/granitic/v2/validate"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const componentPrefix = "#/components/schemas/"
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	nilableStringType  = reflect.TypeOf(types.NilableString{})
+	nilableBoolType    = reflect.TypeOf(types.NilableBool{})
+	nilableInt64Type   = reflect.TypeOf(types.NilableInt64{})
+	nilableFloat64Type = reflect.TypeOf(types.NilableFloat64{})
+)
+
+// schemaBuilder converts Go types to schemas, adding a component for each named struct type it encounters
+type schemaBuilder struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{components: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+}
+
+// property is a field of a struct that is serialised as part of the struct
+type property struct {
+	field string
+	name  string
+	t     reflect.Type
+}
+
+func (sb *schemaBuilder) schemaFor(t reflect.Type) *Schema {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case nilableStringType:
+		return &Schema{Type: "string"}
+	case nilableBoolType:
+		return &Schema{Type: "boolean"}
+	case nilableInt64Type:
+		return &Schema{Type: "integer", Format: "int64"}
+	case nilableFloat64Type:
+		return &Schema{Type: "number", Format: "double"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+
+	case reflect.Slice, reflect.Array:
+
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Encoded as base64 by encoding/json
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: sb.schemaFor(t.Elem())}
+
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: sb.schemaFor(t.Elem())}
+
+	case reflect.Struct:
+		return sb.ref(t)
+	}
+
+	// Interfaces etc. can hold any value
+	return &Schema{}
+}
+
+// ref returns a reference to the component describing the supplied struct type, creating the component if required
+func (sb *schemaBuilder) ref(t reflect.Type) *Schema {
+
+	name, found := sb.names[t]
+
+	if !found {
+		name = sb.componentName(t)
+
+		// Reserve the name before building the schema in case the type refers to itself
+		sb.names[t] = name
+		sb.components[name] = nil
+		sb.components[name], _ = sb.objectSchema(t, nil)
+	}
+
+	return &Schema{Ref: componentPrefix + name}
+}
+
+func (sb *schemaBuilder) componentName(t reflect.Type) string {
+
+	name := t.Name()
+
+	if name == "" {
+		name = "Object"
+	}
+
+	if _, found := sb.components[name]; !found {
+		return name
+	}
+
+	qualified := path.Base(t.PkgPath()) + "_" + name
+
+	candidate := qualified
+
+	for i := 2; ; i++ {
+
+		if _, found := sb.components[candidate]; !found {
+			return candidate
+		}
+
+		candidate = qualified + strconv.Itoa(i)
+	}
+}
+
+// objectSchema describes the properties of a struct, omitting the named fields. Also returns a map of field names to
+// property names
+func (sb *schemaBuilder) objectSchema(t reflect.Type, exclude map[string]bool) (*Schema, map[string]string) {
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	names := make(map[string]string)
+
+	for _, p := range properties(t) {
+
+		if exclude[p.field] {
+			continue
+		}
+
+		s.Properties[p.name] = sb.schemaFor(p.t)
+		names[p.field] = p.name
+	}
+
+	return s, names
+}
+
+// properties lists the fields of a struct that encoding/json would serialise, along with their serialised names
+func properties(t reflect.Type) []property {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var ps []property
+
+	for i := 0; i < t.NumField(); i++ {
+
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		ft := f.Type
+
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// Fields of embedded structs are promoted
+			ps = append(ps, properties(ft)...)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		ps = append(ps, property{field: f.Name, name: name, t: f.Type})
+	}
+
+	return ps
+}
+
+// constrain adds the checks made by a validation rule to a schema
+func constrain(s *Schema, fc *validate.FieldConstraints) {
+
+	if s.Ref != "" {
+		// Siblings of $ref are ignored
+		return
+	}
+
+	if s.Type == "array" {
+		s.MinItems = fc.MinLength
+		s.MaxItems = fc.MaxLength
+	} else {
+		s.MinLength = fc.MinLength
+		s.MaxLength = fc.MaxLength
+	}
+
+	s.Minimum = fc.Minimum
+	s.Maximum = fc.Maximum
+	s.Pattern = fc.Pattern
+
+	for _, v := range fc.In {
+
+		var e interface{} = v
+
+		switch s.Type {
+		case "integer":
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				e = i
+			}
+		case "number":
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				e = f
+			}
+		}
+
+		s.Enum = append(s.Enum, e)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/graniticio/granitic/v2/logging"
 	rt "github.com/graniticio/granitic/v2/reflecttools"
 	"github.com/graniticio/granitic/v2/types"
+	"net/url"
 	"reflect"
 	"strconv"
 )
@@ -125,6 +126,46 @@ func (pb *ParamBinder) AutoBindQueryParameters(wsReq *Request) {
 	pb.initialiseUnsetNilables(t)
 }
 
+// BindFormParameters takes the (non-file) fields of an HTTP form and injects them into fields on the Request.RequestBody
+// using the keys of the supplied map as the name of the target fields and the values as the names of the form fields.
+// Form fields that are not present in the supplied values are ignored. Any errors encountered are recorded as framework
+// errors in the Request.
+func (pb *ParamBinder) BindFormParameters(wsReq *Request, values url.Values, targets map[string]string) {
+
+	t := wsReq.RequestBody
+	p := NewParamsForQuery(values)
+
+	for field, param := range targets {
+
+		if !p.Exists(param) || !rt.HasFieldOfName(t, field) {
+			continue
+		}
+
+		if !rt.TargetFieldIsArray(t, field) && p.MultipleValues(param) {
+			m, c := pb.FrameworkErrors.MessageCode(FormTargetNotArray, param)
+			wsReq.AddFrameworkError(NewFormBindFrameworkError(m, c, param, field))
+
+			continue
+		}
+
+		pi := new(types.ParamValueInjector)
+
+		if err := pi.BindValueToField(param, field, p, t, pb.formParamError); err != nil {
+
+			if fe, okay := err.(*FrameworkError); okay {
+				wsReq.AddFrameworkError(fe)
+			} else {
+				pb.FrameworkLogger.LogErrorf("Unexpected error of type %t (was expecting *FrameworkError). Message was: %s", err, err.Error())
+			}
+
+		} else {
+			wsReq.RecordFieldAsBound(field)
+		}
+	}
+
+	pb.initialiseUnsetNilables(t)
+}
+
 func (pb *ParamBinder) bindValueToField(paramName string, fieldName string, p *types.Params, t interface{}, errorFn types.GenerateMappingError) error {
 
 	if !rt.TargetFieldIsArray(t, fieldName) && p.MultipleValues(paramName) {
@@ -189,6 +230,19 @@ func (pb *ParamBinder) queryParamError(paramName string, fieldName string, typeN
 
 }
 
+func (pb *ParamBinder) formParamError(paramName string, fieldName string, typeName string, p *types.Params) error {
+
+	var v = ""
+
+	if p.Exists(paramName) {
+		v, _ = p.StringValue(paramName)
+	}
+
+	m, c := pb.FrameworkErrors.MessageCode(FormWrongType, paramName, typeName, v)
+	return NewFormBindFrameworkError(m, c, paramName, fieldName)
+
+}
+
 func (pb *ParamBinder) pathParamError(paramName string, fieldName string, typeName string, p *types.Params) error {
 
 	var v = ""
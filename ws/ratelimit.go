@@ -0,0 +1,18 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package ws
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RateLimiter is implemented by components that are able to determine whether a caller has exceeded the rate at which
+// they are allowed to make requests.
+type RateLimiter interface {
+	// Allow returns true if the request may be processed. If the request should be rejected, the returned duration is
+	// how long the caller should wait before trying again.
+	Allow(ctx context.Context, r *Request, req *http.Request) (bool, time.Duration)
+}
@@ -41,6 +41,29 @@ type Request struct {
 
 	// The unique ID assigned to this request and stored in the context
 	ID func(ctx context.Context) string
+
+	// The IP address of the client that made the request. If the HTTP server has been configured with trusted proxies,
+	// this is the address of the original client rather than the proxy that forwarded the request.
+	ClientIP string
+
+	cleanups []func()
+}
+
+// AddCleanup registers a function to be called once the request has been processed and its response written (for
+// example to remove temporary files created while parsing the request).
+func (wsr *Request) AddCleanup(f func()) {
+	wsr.cleanups = append(wsr.cleanups, f)
+}
+
+// Cleanup calls the functions registered with AddCleanup, in reverse order of registration. Called by handler.WsHandler
+// when it has finished with the request.
+func (wsr *Request) Cleanup() {
+
+	for i := len(wsr.cleanups) - 1; i >= 0; i-- {
+		wsr.cleanups[i]()
+	}
+
+	wsr.cleanups = nil
 }
 
 // HasFrameworkErrors returns true if one or more framework errors have been recorded.
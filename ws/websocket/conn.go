@@ -0,0 +1,483 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType identifies whether a message contains text (UTF-8) or binary data.
+type MessageType int
+
+const (
+	// TextMessage is a message containing UTF-8 text
+	TextMessage MessageType = 1
+
+	// BinaryMessage is a message containing arbitrary binary data
+	BinaryMessage MessageType = 2
+)
+
+const (
+	continuationFrame = 0x0
+	textFrame         = 0x1
+	binaryFrame       = 0x2
+	closeFrame        = 0x8
+	pingFrame         = 0x9
+	pongFrame         = 0xA
+
+	finalBit = 0x80
+	maskBit  = 0x80
+
+	maxControlPayload = 125
+)
+
+// CloseCode is a status code sent in a close frame to indicate why a connection is being closed (RFC 6455 section 7.4)
+type CloseCode int
+
+const (
+	// CloseNormal indicates the purpose for which the connection was established has been fulfilled.
+	CloseNormal CloseCode = 1000
+
+	// CloseGoingAway indicates the server is going away (e.g. shutting down).
+	CloseGoingAway CloseCode = 1001
+
+	// CloseProtocolError indicates the peer violated the WebSocket protocol.
+	CloseProtocolError CloseCode = 1002
+
+	// CloseUnsupportedData indicates the peer sent a type of message that cannot be accepted.
+	CloseUnsupportedData CloseCode = 1003
+
+	// CloseNoStatus is reported when a close frame without a status code is received. Never sent.
+	CloseNoStatus CloseCode = 1005
+
+	// CloseAbnormal is reported when a connection is lost without a close frame being received. Never sent.
+	CloseAbnormal CloseCode = 1006
+
+	// CloseInvalidPayload indicates a message contained data inconsistent with its type (e.g. invalid UTF-8 text).
+	CloseInvalidPayload CloseCode = 1007
+
+	// ClosePolicyViolation indicates a message violated the server's policy.
+	ClosePolicyViolation CloseCode = 1008
+
+	// CloseMessageTooBig indicates a message was too large to process.
+	CloseMessageTooBig CloseCode = 1009
+
+	// CloseInternalError indicates the server encountered an unexpected condition.
+	CloseInternalError CloseCode = 1011
+)
+
+// ErrClosed is returned when an attempt is made to use a connection that has been closed.
+var ErrClosed = errors.New("websocket connection is closed")
+
+// CloseError is returned by ReadMessage when the connection has been closed, either by the client or by the server
+// because the client violated the protocol or sent a message that was too large.
+type CloseError struct {
+	// The close code sent or received
+	Code CloseCode
+
+	// The reason sent or received (may be empty)
+	Reason string
+}
+
+func (ce *CloseError) Error() string {
+
+	if ce.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", ce.Code)
+	}
+
+	return fmt.Sprintf("websocket closed with code %d (%s)", ce.Code, ce.Reason)
+}
+
+// Conn is an upgraded WebSocket connection.
+type Conn struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	config   Config
+	protocol string
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closeSent  bool
+	done       chan struct{}
+	written    int64
+}
+
+// Subprotocol returns the subprotocol selected during the opening handshake (or an empty string if none was selected).
+func (c *Conn) Subprotocol() string {
+	return c.protocol
+}
+
+// RemoteAddr returns the network address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// BytesWritten returns the total number of bytes (including framing) sent to the client.
+func (c *Conn) BytesWritten() int64 {
+	return atomic.LoadInt64(&c.written)
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// ReadMessage blocks until a complete message is received from the client. Pings are answered while waiting. If the
+// client closes the connection or violates the protocol, the connection is closed and a *CloseError is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+
+	var message []byte
+	var messageType MessageType
+
+	for {
+
+		if c.config.ReadTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout))
+		}
+
+		fin, opcode, payload, err := c.readFrame(int64(len(message)))
+
+		if err != nil {
+			return 0, nil, c.readFailed(err)
+		}
+
+		switch opcode {
+
+		case pingFrame:
+			if err := c.writeFrame(pongFrame, payload); err != nil {
+				return 0, nil, err
+			}
+
+			continue
+
+		case pongFrame:
+			continue
+
+		case closeFrame:
+			return 0, nil, c.closeReceived(payload)
+
+		case textFrame, binaryFrame:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message started before previous message finished")
+			}
+
+			messageType = MessageType(opcode)
+
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		message = append(message, payload...)
+
+		if !fin {
+			continue
+		}
+
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidPayload, "text message is not valid UTF-8")
+		}
+
+		return messageType, message, nil
+	}
+}
+
+// WriteMessage sends a message to the client. Safe to call from multiple goroutines.
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("unsupported message type %d", messageType)
+	}
+
+	if messageType == TextMessage && !utf8.Valid(data) {
+		return errors.New("text messages must be valid UTF-8")
+	}
+
+	return c.writeFrame(byte(messageType), data)
+}
+
+// WriteText sends a text message to the client.
+func (c *Conn) WriteText(text string) error {
+	return c.WriteMessage(TextMessage, []byte(text))
+}
+
+// Ping sends a ping to the client. The client's pong is processed by ReadMessage.
+func (c *Conn) Ping(data []byte) error {
+
+	if len(data) > maxControlPayload {
+		return errors.New("ping data too long")
+	}
+
+	return c.writeFrame(pingFrame, data)
+}
+
+// Close sends a close frame with the supplied code and reason to the client (unless one has already been sent) and
+// closes the underlying network connection. It is safe to call Close more than once.
+func (c *Conn) Close(code CloseCode, reason string) error {
+
+	var err error
+
+	c.closeOnce.Do(func() {
+
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+
+		if len(payload) > maxControlPayload {
+			payload = payload[:maxControlPayload]
+		}
+
+		err = c.writeFrame(closeFrame, payload)
+
+		c.shutdown()
+	})
+
+	return err
+}
+
+func (c *Conn) shutdown() {
+
+	c.writeMutex.Lock()
+	c.closeSent = true
+	c.writeMutex.Unlock()
+
+	// Closed before the network connection so a blocked reader can tell the server closed the connection
+	close(c.done)
+
+	c.conn.Close()
+}
+
+func (c *Conn) keepAlive() {
+
+	ticker := time.NewTicker(c.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if c.writeFrame(pingFrame, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+// fail closes the connection because the client sent something unacceptable
+func (c *Conn) fail(code CloseCode, reason string) error {
+	c.Close(code, reason)
+
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (c *Conn) readFailed(err error) error {
+
+	if ce, found := err.(*CloseError); found {
+		return c.fail(ce.Code, ce.Reason)
+	}
+
+	select {
+	case <-c.done:
+		// Closed by the server while waiting for a message
+		return ErrClosed
+	default:
+	}
+
+	// The connection was lost (or timed out) without a closing handshake
+	c.closeOnce.Do(c.shutdown)
+
+	return &CloseError{Code: CloseAbnormal, Reason: err.Error()}
+}
+
+// closeReceived echoes the client's close frame and closes the connection
+func (c *Conn) closeReceived(payload []byte) error {
+
+	ce := &CloseError{Code: CloseNoStatus}
+
+	if len(payload) == 1 {
+		return c.fail(CloseProtocolError, "invalid close frame")
+	}
+
+	if len(payload) >= 2 {
+
+		ce.Code = CloseCode(binary.BigEndian.Uint16(payload))
+		ce.Reason = string(payload[2:])
+
+		if !validReceivedCode(ce.Code) || !utf8.Valid(payload[2:]) {
+			return c.fail(CloseProtocolError, "invalid close frame")
+		}
+	}
+
+	c.closeOnce.Do(func() {
+
+		if ce.Code == CloseNoStatus {
+			c.writeFrame(closeFrame, nil)
+		} else {
+			c.writeFrame(closeFrame, payload[:2])
+		}
+
+		c.shutdown()
+	})
+
+	return ce
+}
+
+func validReceivedCode(code CloseCode) bool {
+
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+
+	return false
+}
+
+// readFrame reads a single frame, unmasking its payload. buffered is the size of the message assembled so far
+func (c *Conn) readFrame(buffered int64) (fin bool, opcode byte, payload []byte, err error) {
+
+	var header [2]byte
+
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&finalBit != 0
+	opcode = header[0] & 0x0F
+
+	if header[0]&0x70 != 0 {
+		err = &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+		return
+	}
+
+	if header[1]&maskBit == 0 {
+		err = &CloseError{Code: CloseProtocolError, Reason: "client frames must be masked"}
+		return
+	}
+
+	length := int64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+
+	case 127:
+		var ext [8]byte
+
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+
+		if length < 0 {
+			err = &CloseError{Code: CloseProtocolError, Reason: "invalid frame length"}
+			return
+		}
+	}
+
+	if opcode >= closeFrame {
+
+		if !fin || length > maxControlPayload {
+			err = &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+			return
+		}
+
+	} else if max := c.maxMessageBytes(); buffered+length > max {
+		err = &CloseError{Code: CloseMessageTooBig, Reason: fmt.Sprintf("messages must not exceed %d bytes", max)}
+		return
+	}
+
+	var mask [4]byte
+
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+
+	// The payload is read as it arrives rather than allocated up front, so a client cannot force a large allocation
+	// just by declaring a large frame
+	var b bytes.Buffer
+
+	if _, err = io.CopyN(&b, c.reader, length); err != nil {
+		return
+	}
+
+	payload = b.Bytes()
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return
+}
+
+func (c *Conn) maxMessageBytes() int64 {
+
+	if max := c.config.MaxMessageBytes; max > 0 && max < MaxMessageLimit {
+		return max
+	}
+
+	return MaxMessageLimit
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, finalBit|opcode)
+
+	switch l := len(payload); {
+	case l <= 125:
+		frame = append(frame, byte(l))
+	case l <= 0xFFFF:
+		frame = append(frame, 126, byte(l>>8), byte(l))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(l))
+		frame = append(append(frame, 127), ext[:]...)
+	}
+
+	frame = append(frame, payload...)
+
+	if c.config.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	}
+
+	n, err := c.conn.Write(frame)
+	atomic.AddInt64(&c.written, int64(n))
+
+	if opcode == closeFrame {
+		c.closeSent = true
+	}
+
+	return err
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package websocket provides a server-side implementation of the WebSocket protocol (RFC 6455).
+
+Applications do not normally use the functions in this package directly. Instead they declare a component of type
+handler.WsSocketHandler, which performs the opening handshake and passes a Conn to a logic component. A Conn
+is message oriented - fragmented messages are reassembled, ping frames are answered automatically and the closing
+handshake is handled on the application's behalf.
+
+Only one goroutine may read from a Conn at a time, but messages may be written from multiple goroutines. Control frames
+(pings, pongs and close requests) sent by the client are only processed while a goroutine is reading from the
+connection, so logic components should keep reading until ReadMessage returns an error even if they are only
+interested in sending messages.
+*/
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The GUID appended to a client's key when calculating the Sec-WebSocket-Accept header (RFC 6455 section 1.3)
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	// SupportedVersion is the only version of the WebSocket protocol supported (RFC 6455)
+	SupportedVersion = "13"
+
+	secKeyHeader      = "Sec-WebSocket-Key"
+	secVersionHeader  = "Sec-WebSocket-Version"
+	secProtocolHeader = "Sec-WebSocket-Protocol"
+	secAcceptHeader   = "Sec-WebSocket-Accept"
+)
+
+// MaxMessageLimit is the size (in bytes) of the largest message a connection will ever accept, whatever the value of
+// Config.MaxMessageBytes.
+const MaxMessageLimit int64 = 64 * 1024 * 1024
+
+// Config controls the behaviour of upgraded connections.
+type Config struct {
+	// The maximum size (in bytes) of a message received from the client. Larger messages cause the connection to be
+	// closed with CloseMessageTooBig. If zero or less (or greater than MaxMessageLimit), MaxMessageLimit is used.
+	MaxMessageBytes int64
+
+	// How often a ping is sent to the client. If zero or less, pings are not sent.
+	PingInterval time.Duration
+
+	// How long to wait for any frame (including a pong) from the client before the connection is considered dead.
+	// If zero or less, reads never time out.
+	ReadTimeout time.Duration
+
+	// How long a write to the client may take before the connection is considered dead.
+	WriteTimeout time.Duration
+
+	// The subprotocols (in order of preference) the server supports. If the client requests any of these protocols, the
+	// most preferred is selected.
+	Subprotocols []string
+}
+
+// HandshakeError is returned when an HTTP request is not a valid WebSocket opening handshake.
+type HandshakeError struct {
+	// The HTTP status code that should be sent to the client
+	Status int
+
+	// A description of the problem
+	Message string
+}
+
+func (he *HandshakeError) Error() string {
+	return he.Message
+}
+
+// CheckHandshake returns a *HandshakeError if the supplied request is not a valid WebSocket opening handshake.
+func CheckHandshake(req *http.Request) error {
+
+	if req.Method != http.MethodGet {
+		return &HandshakeError{http.StatusMethodNotAllowed, "WebSocket handshakes must use the GET method"}
+	}
+
+	if !headerContainsToken(req.Header, "Connection", "upgrade") || !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return &HandshakeError{http.StatusBadRequest, "request is not a WebSocket upgrade request"}
+	}
+
+	if req.Header.Get(secVersionHeader) != SupportedVersion {
+		return &HandshakeError{http.StatusUpgradeRequired, "unsupported WebSocket version"}
+	}
+
+	if k, err := base64.StdEncoding.DecodeString(req.Header.Get(secKeyHeader)); err != nil || len(k) != 16 {
+		return &HandshakeError{http.StatusBadRequest, "missing or invalid " + secKeyHeader + " header"}
+	}
+
+	return nil
+}
+
+// AcceptKey calculates the value of the Sec-WebSocket-Accept header the server must send in response to the supplied
+// Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Upgrade completes the opening handshake for the supplied request and takes over the underlying network
+// connection. The supplied http.ResponseWriter must implement http.Hijacker. Responses to invalid handshakes are not
+// written by this function - callers should use CheckHandshake first and respond with the status in any error returned.
+func Upgrade(w http.ResponseWriter, req *http.Request, config *Config) (*Conn, error) {
+
+	if err := CheckHandshake(req); err != nil {
+		return nil, err
+	}
+
+	hj, found := w.(http.Hijacker)
+
+	if !found {
+		return nil, errors.New("response does not support taking over the connection")
+	}
+
+	protocol := selectSubprotocol(req, config.Subprotocols)
+
+	nc, brw, err := hj.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove any deadlines set by the HTTP server
+	nc.SetDeadline(time.Time{})
+
+	var b strings.Builder
+
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString(secAcceptHeader + ": " + AcceptKey(req.Header.Get(secKeyHeader)) + "\r\n")
+
+	if protocol != "" {
+		b.WriteString(secProtocolHeader + ": " + protocol + "\r\n")
+	}
+
+	b.WriteString("\r\n")
+
+	if config.WriteTimeout > 0 {
+		nc.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+	}
+
+	if _, err = brw.WriteString(b.String()); err == nil {
+		err = brw.Flush()
+	}
+
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("unable to complete WebSocket handshake: %s", err.Error())
+	}
+
+	return newConn(nc, brw.Reader, config, protocol), nil
+}
+
+func selectSubprotocol(req *http.Request, supported []string) string {
+
+	requested := tokens(req.Header, secProtocolHeader)
+
+	for _, s := range supported {
+		for _, r := range requested {
+			if r == s {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+
+	for _, t := range tokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tokens(h http.Header, name string) []string {
+
+	var t []string
+
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				t = append(t, e)
+			}
+		}
+	}
+
+	return t
+}
+
+// newConn is separated from Upgrade to allow connections to be tested without an HTTP server
+func newConn(nc net.Conn, r *bufio.Reader, config *Config, protocol string) *Conn {
+
+	c := new(Conn)
+	c.conn = nc
+	c.reader = r
+	c.config = *config
+	c.protocol = protocol
+	c.done = make(chan struct{})
+
+	if c.config.PingInterval > 0 {
+		go c.keepAlive()
+	}
+
+	return c
+}
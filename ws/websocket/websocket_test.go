@@ -0,0 +1,346 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graniticio/granitic/v2/test"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	test.ExpectString(t, AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+}
+
+func TestCheckHandshake(t *testing.T) {
+
+	valid := func() *http.Request {
+		req := httptest.NewRequest("GET", "/chat", nil)
+		req.Header.Set("Connection", "keep-alive, Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+		return req
+	}
+
+	test.ExpectNil(t, CheckHandshake(valid()))
+
+	status := func(req *http.Request) int {
+		if he, found := CheckHandshake(req).(*HandshakeError); found {
+			return he.Status
+		}
+
+		return 0
+	}
+
+	req := valid()
+	req.Method = "POST"
+	test.ExpectInt(t, status(req), http.StatusMethodNotAllowed)
+
+	req = valid()
+	req.Header.Del("Upgrade")
+	test.ExpectInt(t, status(req), http.StatusBadRequest)
+
+	req = valid()
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	test.ExpectInt(t, status(req), http.StatusUpgradeRequired)
+
+	req = valid()
+	req.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=")
+	test.ExpectInt(t, status(req), http.StatusBadRequest)
+
+	req = valid()
+	req.Header.Set("Sec-WebSocket-Protocol", "v1.chat, v2.chat")
+	test.ExpectString(t, selectSubprotocol(req, []string{"v2.chat", "v1.chat"}), "v2.chat")
+	test.ExpectString(t, selectSubprotocol(req, []string{"other"}), "")
+}
+
+func TestMessages(t *testing.T) {
+
+	c, client := pipe(t, &Config{MaxMessageBytes: 10})
+
+	go func() {
+		// Fragmented message with a ping between the fragments
+		client.send(textFrame, false, "Hel")
+		client.send(pingFrame, true, "p")
+		client.send(continuationFrame, true, "lo")
+		client.send(binaryFrame, true, "\x00\x01")
+	}()
+
+	mt, m, err := c.ReadMessage()
+
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, int(mt), int(TextMessage))
+	test.ExpectString(t, string(m), "Hello")
+
+	// The ping must have been answered
+	op, payload := client.receive(t)
+	test.ExpectInt(t, int(op), pongFrame)
+	test.ExpectString(t, payload, "p")
+
+	mt, m, err = c.ReadMessage()
+
+	test.ExpectNil(t, err)
+	test.ExpectInt(t, int(mt), int(BinaryMessage))
+	test.ExpectString(t, string(m), "\x00\x01")
+
+	go c.WriteText(strings.Repeat("a", 300))
+
+	op, payload = client.receive(t)
+	test.ExpectInt(t, int(op), textFrame)
+	test.ExpectInt(t, len(payload), 300)
+
+	// Message exceeding the limit
+	go client.send(textFrame, true, "01234567890")
+
+	_, _, err = c.ReadMessage()
+
+	if ce, found := err.(*CloseError); !found || ce.Code != CloseMessageTooBig {
+		t.Fatalf("Expected message too big, got %v", err)
+	}
+
+	op, payload = client.receive(t)
+	test.ExpectInt(t, int(op), closeFrame)
+	test.ExpectInt(t, int(binary.BigEndian.Uint16([]byte(payload))), int(CloseMessageTooBig))
+
+	if c.WriteText("late") != ErrClosed {
+		t.Errorf("Expected writes after close to fail")
+	}
+}
+
+func TestHardMessageLimit(t *testing.T) {
+
+	c, client := pipe(t, &Config{MaxMessageBytes: -1})
+
+	// A frame claiming a payload far larger than the hard limit must be rejected before any payload is read
+	header := []byte{finalBit | binaryFrame, maskBit | 127, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(header[2:], uint64(MaxMessageLimit)<<4)
+
+	go client.raw(header)
+
+	_, _, err := c.ReadMessage()
+
+	if ce, found := err.(*CloseError); !found || ce.Code != CloseMessageTooBig {
+		t.Fatalf("Expected message too big, got %v", err)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+
+	c, client := pipe(t, &Config{})
+
+	go client.send(closeFrame, true, "\x03\xe9bye")
+
+	_, _, err := c.ReadMessage()
+
+	if ce, found := err.(*CloseError); !found || ce.Code != CloseGoingAway || ce.Reason != "bye" {
+		t.Fatalf("Expected close error, got %v", err)
+	}
+
+	// The close frame is echoed
+	op, payload := client.receive(t)
+	test.ExpectInt(t, int(op), closeFrame)
+	test.ExpectString(t, payload, "\x03\xe9")
+
+	select {
+	case <-c.Done():
+	default:
+		t.Errorf("Expected connection to be closed")
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+
+	frames := map[string]func(client *testClient){
+		"unmasked": func(client *testClient) { client.raw([]byte{finalBit | textFrame, 0}) },
+		"reserved": func(client *testClient) { client.raw([]byte{finalBit | 0x40 | textFrame, maskBit}) },
+		"continuation": func(client *testClient) {
+			client.send(continuationFrame, true, "x")
+		},
+		"invalid utf8": func(client *testClient) { client.send(textFrame, true, "\xff") },
+		"long ping":    func(client *testClient) { client.send(pingFrame, true, strings.Repeat("p", 126)) },
+		"close code":   func(client *testClient) { client.send(closeFrame, true, "\x03\xed") },
+	}
+
+	for name, send := range frames {
+
+		c, client := pipe(t, &Config{})
+
+		go send(client)
+
+		_, _, err := c.ReadMessage()
+
+		ce, found := err.(*CloseError)
+
+		if !found || (ce.Code != CloseProtocolError && ce.Code != CloseInvalidPayload) {
+			t.Errorf("%s: expected protocol error, got %v", name, err)
+		}
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+
+	c, client := pipe(t, &Config{PingInterval: 5 * time.Millisecond, ReadTimeout: 50 * time.Millisecond})
+
+	op, _ := client.receive(t)
+	test.ExpectInt(t, int(op), pingFrame)
+
+	// No pong is sent, so the read times out
+	go func() {
+		for {
+			if _, err := client.r.ReadByte(); err != nil {
+				return
+			}
+		}
+	}()
+
+	_, _, err := c.ReadMessage()
+
+	if ce, found := err.(*CloseError); !found || ce.Code != CloseAbnormal {
+		t.Fatalf("Expected abnormal closure, got %v", err)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+
+	c, client := pipe(t, &Config{})
+
+	result := make(chan error)
+
+	go func() {
+		_, _, err := c.ReadMessage()
+		result <- err
+	}()
+
+	go c.Close(CloseGoingAway, "stopping")
+
+	op, payload := client.receive(t)
+	test.ExpectInt(t, int(op), closeFrame)
+	test.ExpectString(t, payload[2:], "stopping")
+
+	if err := <-result; err != ErrClosed {
+		t.Errorf("Expected blocked reader to see connection closed, got %v", err)
+	}
+}
+
+func TestUpgradeWriteFailure(t *testing.T) {
+
+	server, client := net.Pipe()
+	client.Close()
+
+	req := httptest.NewRequest("GET", "/chat", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	c, err := Upgrade(&hijackableRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server}, req, &Config{})
+
+	test.ExpectNotNil(t, err)
+
+	if c != nil {
+		t.Errorf("Expected no connection when the handshake response could not be written")
+	}
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (hr *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hr.conn, bufio.NewReadWriter(bufio.NewReader(hr.conn), bufio.NewWriter(hr.conn)), nil
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// pipe connects a Conn to a test client over loopback TCP (which, unlike net.Pipe, buffers writes)
+func pipe(t *testing.T, config *Config) (*Conn, *testClient) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	server, err := ln.Accept()
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return newConn(server, bufio.NewReader(server), config, ""), &testClient{conn: client, r: bufio.NewReader(client)}
+}
+
+func (tc *testClient) raw(b []byte) {
+	tc.conn.Write(b)
+}
+
+func (tc *testClient) send(opcode byte, fin bool, payload string) {
+
+	first := opcode
+
+	if fin {
+		first |= finalBit
+	}
+
+	frame := []byte{first}
+
+	if l := len(payload); l < 126 {
+		frame = append(frame, maskBit|byte(l))
+	} else {
+		frame = append(frame, maskBit|126, byte(l>>8), byte(l))
+	}
+
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+
+	tc.conn.Write(frame)
+}
+
+func (tc *testClient) receive(t *testing.T) (byte, string) {
+
+	tc.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var header [2]byte
+
+	if _, err := io.ReadFull(tc.r, header[:]); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	length := int(header[1] & 0x7F)
+
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(tc.r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+
+	payload := make([]byte, length)
+	io.ReadFull(tc.r, payload)
+
+	return header[0] & 0x0F, string(payload)
+}
@@ -0,0 +1,526 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package wire
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ToGo stores the supplied data model value in the value pointed to by target, following the same rules as
+// encoding/json's Unmarshal function.
+func ToGo(data interface{}, target interface{}) error {
+
+	rv := reflect.ValueOf(target)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("wire: target must be a non-nil pointer")
+	}
+
+	return decodeValue(data, rv.Elem())
+}
+
+func decodeValue(data interface{}, v reflect.Value) error {
+
+	v, u, err := indirect(data, v)
+
+	if err != nil || u {
+		return err
+	}
+
+	switch d := data.(type) {
+	case nil:
+
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+
+		return nil
+
+	case bool:
+
+		switch {
+		case v.Kind() == reflect.Bool:
+			v.SetBool(d)
+			return nil
+		case isEmptyInterface(v):
+			v.Set(reflect.ValueOf(d))
+			return nil
+		}
+
+	case int64, uint64, float64:
+		return decodeNumber(d, v)
+
+	case string:
+
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(d)
+			return nil
+		case isByteSlice(v):
+
+			b, err := base64.StdEncoding.DecodeString(d)
+
+			if err != nil {
+				return err
+			}
+
+			v.SetBytes(b)
+			return nil
+
+		case isEmptyInterface(v):
+			v.Set(reflect.ValueOf(d))
+			return nil
+		}
+
+	case []byte:
+
+		switch {
+		case isByteSlice(v):
+			b := make([]byte, len(d))
+			copy(b, d)
+
+			v.SetBytes(b)
+			return nil
+
+		case v.Kind() == reflect.String:
+			v.SetString(string(d))
+			return nil
+
+		case isEmptyInterface(v):
+			v.Set(reflect.ValueOf(d))
+			return nil
+		}
+
+	case []interface{}:
+		return decodeArray(d, v)
+
+	case Map:
+		return decodeMap(d, v)
+
+	default:
+		return fmt.Errorf("wire: %T is not part of the data model", data)
+	}
+
+	return typeError(data, v)
+}
+
+// indirect follows pointers (allocating them as necessary) until it reaches a non-pointer value. If a value
+// implementing json.Unmarshaler (or encoding.TextUnmarshaler for strings) is found along the way, the data is passed
+// to it and true is returned.
+func indirect(data interface{}, v reflect.Value) (reflect.Value, bool, error) {
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+
+		if u, err := unmarshalInto(data, v.Addr()); u || err != nil {
+			return v, u, err
+		}
+	}
+
+	for {
+
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+
+			if e := v.Elem(); e.Kind() == reflect.Ptr && !e.IsNil() && (data != nil || e.Elem().Kind() == reflect.Ptr) {
+				v = e
+				continue
+			}
+		}
+
+		if v.Kind() != reflect.Ptr {
+			return v, false, nil
+		}
+
+		if data == nil && v.CanSet() {
+			return v, false, nil
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		if u, err := unmarshalInto(data, v); u || err != nil {
+			return v, u, err
+		}
+
+		v = v.Elem()
+	}
+}
+
+func unmarshalInto(data interface{}, p reflect.Value) (bool, error) {
+
+	if p.Type().Implements(unmarshalerType) {
+
+		b, err := json.Marshal(data)
+
+		if err != nil {
+			return true, err
+		}
+
+		return true, p.Interface().(json.Unmarshaler).UnmarshalJSON(b)
+	}
+
+	if s, found := data.(string); found && p.Type().Implements(textUnmarshalerType) {
+		return true, p.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	return false, nil
+}
+
+func decodeNumber(data interface{}, v reflect.Value) error {
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+
+		var n int64
+
+		switch d := data.(type) {
+		case int64:
+			n = d
+		case uint64:
+
+			if d > math.MaxInt64 {
+				return typeError(data, v)
+			}
+
+			n = int64(d)
+
+		case float64:
+
+			if d != math.Trunc(d) || d < math.MinInt64 || d >= math.MaxInt64 {
+				return typeError(data, v)
+			}
+
+			n = int64(d)
+		}
+
+		if v.OverflowInt(n) {
+			return typeError(data, v)
+		}
+
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+
+		var n uint64
+
+		switch d := data.(type) {
+		case int64:
+
+			if d < 0 {
+				return typeError(data, v)
+			}
+
+			n = uint64(d)
+
+		case uint64:
+			n = d
+		case float64:
+
+			if d != math.Trunc(d) || d < 0 || d >= math.MaxUint64 {
+				return typeError(data, v)
+			}
+
+			n = uint64(d)
+		}
+
+		if v.OverflowUint(n) {
+			return typeError(data, v)
+		}
+
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+
+		var f float64
+
+		switch d := data.(type) {
+		case int64:
+			f = float64(d)
+		case uint64:
+			f = float64(d)
+		case float64:
+			f = d
+		}
+
+		if v.OverflowFloat(f) {
+			return typeError(data, v)
+		}
+
+		v.SetFloat(f)
+
+	case reflect.Interface:
+
+		if !isEmptyInterface(v) {
+			return typeError(data, v)
+		}
+
+		v.Set(reflect.ValueOf(data))
+
+	default:
+		return typeError(data, v)
+	}
+
+	return nil
+}
+
+func decodeArray(data []interface{}, v reflect.Value) error {
+
+	switch v.Kind() {
+	case reflect.Slice:
+
+		s := reflect.MakeSlice(v.Type(), len(data), len(data))
+
+		for i, e := range data {
+			if err := decodeValue(e, s.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		v.Set(s)
+
+	case reflect.Array:
+
+		for i := 0; i < v.Len(); i++ {
+
+			if i >= len(data) {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+				continue
+			}
+
+			if err := decodeValue(data[i], v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Interface:
+
+		if !isEmptyInterface(v) {
+			return typeError(data, v)
+		}
+
+		v.Set(reflect.ValueOf(Natural(data)))
+
+	default:
+		return typeError(data, v)
+	}
+
+	return nil
+}
+
+func decodeMap(data Map, v reflect.Value) error {
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return decodeStruct(data, v)
+
+	case reflect.Map:
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+
+		for _, e := range data {
+
+			k, err := decodeKey(e.Key, v.Type().Key())
+
+			if err != nil {
+				return err
+			}
+
+			ev := reflect.New(v.Type().Elem()).Elem()
+
+			if err := decodeValue(e.Value, ev); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(k, ev)
+		}
+
+	case reflect.Interface:
+
+		if !isEmptyInterface(v) {
+			return typeError(data, v)
+		}
+
+		v.Set(reflect.ValueOf(Natural(data)))
+
+	default:
+		return typeError(data, v)
+	}
+
+	return nil
+}
+
+func decodeKey(key string, t reflect.Type) (reflect.Value, error) {
+
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(key).Convert(t), nil
+	}
+
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		k := reflect.New(t)
+
+		err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key))
+
+		return k.Elem(), err
+	}
+
+	k := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+
+		n, err := strconv.ParseInt(key, 10, 64)
+
+		if err != nil || k.OverflowInt(n) {
+			return k, fmt.Errorf("wire: cannot use %q as a map key of type %s", key, t)
+		}
+
+		k.SetInt(n)
+		return k, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+
+		n, err := strconv.ParseUint(key, 10, 64)
+
+		if err != nil || k.OverflowUint(n) {
+			return k, fmt.Errorf("wire: cannot use %q as a map key of type %s", key, t)
+		}
+
+		k.SetUint(n)
+		return k, nil
+	}
+
+	return k, fmt.Errorf("wire: unsupported map key type %s", t)
+}
+
+func decodeStruct(data Map, v reflect.Value) error {
+
+	fields := structFields(v.Type())
+
+	for _, e := range data {
+
+		f := matchField(fields, e.Key)
+
+		if f == nil {
+			// Unknown fields are ignored
+			continue
+		}
+
+		if err := decodeValue(e.Value, allocateField(v, f.index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchField finds the field with the supplied name, preferring an exact match to a case-insensitive one
+func matchField(fields []field, name string) *field {
+
+	var folded *field
+
+	for i := range fields {
+
+		f := &fields[i]
+
+		if f.name == name {
+			return f
+		}
+
+		if folded == nil && strings.EqualFold(f.name, name) {
+			folded = f
+		}
+	}
+
+	return folded
+}
+
+// allocateField finds a (possibly promoted) field, allocating any nil embedded pointers on the way
+func allocateField(v reflect.Value, index []int) reflect.Value {
+
+	for i, x := range index {
+
+		if i > 0 && v.Kind() == reflect.Ptr {
+
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// Natural converts a data model value to the types that encoding/json would use when decoding into an interface{}
+// (except that integers are kept as int64 or uint64 rather than converted to float64)
+func Natural(data interface{}) interface{} {
+
+	switch d := data.(type) {
+	case []interface{}:
+
+		a := make([]interface{}, len(d))
+
+		for i, e := range d {
+			a[i] = Natural(e)
+		}
+
+		return a
+
+	case Map:
+
+		m := make(map[string]interface{}, len(d))
+
+		for _, e := range d {
+			m[e.Key] = Natural(e.Value)
+		}
+
+		return m
+	}
+
+	return data
+}
+
+func isEmptyInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.NumMethod() == 0
+}
+
+func isByteSlice(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8
+}
+
+func typeError(data interface{}, v reflect.Value) error {
+
+	var desc string
+
+	switch data.(type) {
+	case bool:
+		desc = "bool"
+	case int64, uint64, float64:
+		desc = "number"
+	case string:
+		desc = "string"
+	case []byte:
+		desc = "binary data"
+	case []interface{}:
+		desc = "array"
+	case Map:
+		desc = "object"
+	}
+
+	return fmt.Errorf("wire: cannot unmarshal %s into Go value of type %s", desc, v.Type())
+}
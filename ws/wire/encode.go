@@ -0,0 +1,295 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package wire
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var (
+	marshalerType       = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FromGo converts the supplied value to the data model.
+func FromGo(v interface{}) (interface{}, error) {
+	return encodeValue(reflect.ValueOf(v), 0)
+}
+
+func encodeValue(v reflect.Value, depth int) (interface{}, error) {
+
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if depth > MaxDepth {
+		return nil, ErrMaxDepth
+	}
+
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+
+	if m, found := implementation(v, marshalerType); found {
+		return encodeMarshaler(m.(json.Marshaler))
+	}
+
+	if m, found := implementation(v, textMarshalerType); found {
+
+		b, err := m.(encoding.TextMarshaler).MarshalText()
+
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Ptr, reflect.Interface:
+		return encodeValue(v.Elem(), depth+1)
+
+	case reflect.Slice:
+
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(v.Type().Elem()).Implements(marshalerType) {
+			b := make([]byte, v.Len())
+			copy(b, v.Bytes())
+
+			return b, nil
+		}
+
+		return encodeArray(v, depth)
+
+	case reflect.Array:
+		return encodeArray(v, depth)
+
+	case reflect.Map:
+
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		return encodeMap(v, depth)
+
+	case reflect.Struct:
+		return encodeStruct(v, depth)
+	}
+
+	return nil, fmt.Errorf("wire: unsupported type %s", v.Type())
+}
+
+// implementation returns v (or a pointer to v) as an interface{} if it implements the supplied interface type
+func implementation(v reflect.Value, it reflect.Type) (interface{}, bool) {
+
+	if v.Type().Implements(it) {
+		return v.Interface(), true
+	}
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(it) {
+		return v.Addr().Interface(), true
+	}
+
+	return nil, false
+}
+
+func encodeArray(v reflect.Value, depth int) (interface{}, error) {
+
+	a := make([]interface{}, v.Len())
+
+	for i := range a {
+
+		e, err := encodeValue(v.Index(i), depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		a[i] = e
+	}
+
+	return a, nil
+}
+
+func encodeMap(v reflect.Value, depth int) (interface{}, error) {
+
+	m := make(Map, 0, v.Len())
+
+	for _, k := range v.MapKeys() {
+
+		key, err := mapKey(k)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := encodeValue(v.MapIndex(k), depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m = append(m, Entry{Key: key, Value: e})
+	}
+
+	sort.Slice(m, func(i, j int) bool { return m[i].Key < m[j].Key })
+
+	return m, nil
+}
+
+func mapKey(k reflect.Value) (string, error) {
+
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+
+	if tm, found := k.Interface().(encoding.TextMarshaler); found {
+
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+
+		b, err := tm.MarshalText()
+
+		return string(b), err
+	}
+
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+
+	return "", fmt.Errorf("wire: unsupported map key type %s", k.Type())
+}
+
+func encodeStruct(v reflect.Value, depth int) (interface{}, error) {
+
+	fields := structFields(v.Type())
+	m := make(Map, 0, len(fields))
+
+	for _, f := range fields {
+
+		fv, found := fieldByIndex(v, f.index)
+
+		if !found || (f.omitEmpty && isEmpty(fv)) {
+			continue
+		}
+
+		e, err := encodeValue(fv, depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m = append(m, Entry{Key: f.name, Value: e})
+	}
+
+	return m, nil
+}
+
+// fieldByIndex finds a (possibly promoted) field, returning false if it is inside a nil embedded pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+
+	for i, x := range index {
+
+		if i > 0 && v.Kind() == reflect.Ptr {
+
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// encodeMarshaler converts the JSON produced by a json.Marshaler to the data model
+func encodeMarshaler(m json.Marshaler) (interface{}, error) {
+
+	b, err := m.MarshalJSON()
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var i interface{}
+
+	if err := d.Decode(&i); err != nil {
+		return nil, err
+	}
+
+	return fromJSON(i), nil
+}
+
+func fromJSON(i interface{}) interface{} {
+
+	switch v := i.(type) {
+	case json.Number:
+
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+
+		if n, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return n
+		}
+
+		f, _ := v.Float64()
+
+		return f
+
+	case []interface{}:
+
+		for j, e := range v {
+			v[j] = fromJSON(e)
+		}
+
+		return v
+
+	case map[string]interface{}:
+
+		m := make(Map, 0, len(v))
+
+		for k, e := range v {
+			m = append(m, Entry{Key: k, Value: fromJSON(e)})
+		}
+
+		sort.Slice(m, func(i, j int) bool { return m[i].Key < m[j].Key })
+
+		return m
+	}
+
+	return i
+}
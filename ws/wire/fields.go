@@ -0,0 +1,207 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package wire
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const tagName = "json"
+
+// field is a struct field (possibly promoted from an embedded struct) that is encoded and decoded
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+}
+
+var fieldCache sync.Map
+
+// structFields returns the fields of the supplied struct type that are visible to encoding/json
+func structFields(t reflect.Type) []field {
+
+	if f, found := fieldCache.Load(t); found {
+		return f.([]field)
+	}
+
+	var candidates []field
+
+	collectFields(t, nil, map[reflect.Type]bool{t: true}, &candidates)
+
+	fields := dominantFields(candidates)
+
+	fieldCache.Store(t, fields)
+
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, visited map[reflect.Type]bool, candidates *[]field) {
+
+	for i := 0; i < t.NumField(); i++ {
+
+		sf := t.Field(i)
+		tag := sf.Tag.Get(tagName)
+
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := parseTag(tag)
+
+		ft := sf.Type
+
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous {
+
+			if sf.PkgPath != "" && (sf.Type.Kind() == reflect.Ptr || ft.Kind() != reflect.Struct) {
+				// Unexported embedded fields can only be used if they are structs (not pointers to structs)
+				continue
+			}
+
+			if name == "" && ft.Kind() == reflect.Struct {
+
+				if !visited[ft] {
+					visited[ft] = true
+					collectFields(ft, appendIndex(index, i), visited, candidates)
+					delete(visited, ft)
+				}
+
+				continue
+			}
+
+		} else if sf.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		f := field{
+			name:      name,
+			index:     appendIndex(index, i),
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+			tagged:    name != "",
+		}
+
+		if f.name == "" {
+			f.name = sf.Name
+		}
+
+		*candidates = append(*candidates, f)
+	}
+}
+
+// dominantFields applies Go's rules for promoted fields - where more than one field has the same name, the
+// shallowest is used. If there is more than one at that depth, a tagged field wins, otherwise none is used.
+func dominantFields(candidates []field) []field {
+
+	byName := make(map[string][]field)
+
+	for _, f := range candidates {
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	var fields []field
+
+	for _, f := range candidates {
+
+		if d, found := dominant(byName[f.name]); found && sameIndex(d.index, f.index) {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+func dominant(fields []field) (field, bool) {
+
+	depth := -1
+	var shallowest []field
+
+	for _, f := range fields {
+
+		switch {
+		case depth == -1 || len(f.index) < depth:
+			depth = len(f.index)
+			shallowest = []field{f}
+		case len(f.index) == depth:
+			shallowest = append(shallowest, f)
+		}
+	}
+
+	if len(shallowest) == 1 {
+		return shallowest[0], true
+	}
+
+	var tagged []field
+
+	for _, f := range shallowest {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+
+	return field{}, false
+}
+
+func parseTag(tag string) (string, string) {
+
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+
+	return tag, ""
+}
+
+func appendIndex(index []int, i int) []int {
+
+	ni := make([]int, len(index)+1)
+	copy(ni, index)
+	ni[len(index)] = i
+
+	return ni
+}
+
+func sameIndex(a, b []int) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEmpty(v reflect.Value) bool {
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Granitic. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+/*
+Package wire converts Go values to and from a simple, format-neutral data model that is shared by Granitic's binary
+web service encodings (see the ws/msgpack and ws/cbor packages).
+
+Conversion follows the same rules as Go's encoding/json package, so that a type that can be sent and received as JSON
+can be sent and received in any other supported format without modification. In particular:
+
+	Exported struct fields are used, named either after the field or the name in the field's json tag.
+	The json tag options omitempty and "-" are respected.
+	The fields of embedded structs are promoted into the containing object.
+	Types implementing json.Marshaler and json.Unmarshaler (including time.Time and the types.Nilable types) are
+	converted via their JSON representation.
+	Types implementing encoding.TextMarshaler and encoding.TextUnmarshaler are converted to and from strings.
+	Maps must have string, integer or encoding.TextMarshaler keys.
+
+The data model consists of the following Go types:
+
+	nil
+	bool
+	int64, uint64 and float64
+	string
+	[]byte
+	[]interface{}
+	Map
+
+One difference from JSON is that []byte values are kept as binary data rather than being base64 encoded, as the binary
+formats support raw byte strings natively. A []byte field will still accept a base64 encoded string.
+*/
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// The maximum depth of nested objects and arrays that will be encoded or decoded.
+const MaxDepth = 1000
+
+// Map is an object in the data model: an ordered list of named values.
+type Map []Entry
+
+// Entry is a single named value in a Map.
+type Entry struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON writes the Map as a JSON object, preserving the order of its entries.
+func (m Map) MarshalJSON() ([]byte, error) {
+
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+
+	for i, e := range m {
+
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		k, err := json.Marshal(e.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := json.Marshal(e.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// ErrMaxDepth is returned when a value is nested more deeply than MaxDepth.
+var ErrMaxDepth = fmt.Errorf("wire: data is nested more deeply than %d levels", MaxDepth)
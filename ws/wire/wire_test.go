@@ -0,0 +1,132 @@
+package wire
+
+import (
+	"encoding/json"
+	"github.com/graniticio/granitic/v2/test"
+	"github.com/graniticio/granitic/v2/types"
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID      int64
+	Created time.Time
+}
+
+type account struct {
+	base
+	Name     string               `json:"name"`
+	Nickname *types.NilableString `json:"nickname,omitempty"`
+	Balance  float64              `json:",omitempty"`
+	Secret   string               `json:"-"`
+	Tags     []string
+	Scores   map[string]int
+	Avatar   []byte
+	internal string
+}
+
+func TestFromGo(t *testing.T) {
+
+	created := time.Date(2019, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	a := &account{
+		base:     base{ID: 7, Created: created},
+		Name:     "Ann",
+		Nickname: types.NewNilableString("Annie"),
+		Secret:   "hidden",
+		Scores:   map[string]int{"b": 2, "a": 1},
+		Avatar:   []byte{1, 2},
+		internal: "x",
+	}
+
+	d, err := FromGo(a)
+	test.ExpectNil(t, err)
+
+	m := d.(Map)
+
+	var keys []string
+
+	for _, e := range m {
+		keys = append(keys, e.Key)
+	}
+
+	test.ExpectInt(t, len(keys), 7)
+	test.ExpectString(t, keys[0], "ID")
+	test.ExpectString(t, keys[1], "Created")
+	test.ExpectString(t, keys[2], "name")
+	test.ExpectString(t, keys[3], "nickname")
+
+	test.ExpectBool(t, m[0].Value == int64(7), true)
+	test.ExpectString(t, m[1].Value.(string), "2019-03-01T12:30:00Z")
+	test.ExpectString(t, m[3].Value.(string), "Annie")
+
+	// Nil slices are nil, maps are sorted by key and byte slices are kept as binary
+	test.ExpectBool(t, m[4].Value == nil, true)
+	test.ExpectString(t, m[5].Value.(Map)[0].Key, "a")
+	test.ExpectInt(t, len(m[6].Value.([]byte)), 2)
+
+	// Output matches encoding/json
+	jb, _ := json.Marshal(a)
+	wb, _ := json.Marshal(m)
+
+	var fromJSON, fromWire map[string]interface{}
+	json.Unmarshal(jb, &fromJSON)
+	json.Unmarshal(wb, &fromWire)
+
+	test.ExpectInt(t, len(fromWire), len(fromJSON))
+
+	for k, v := range fromJSON {
+		jv, _ := json.Marshal(v)
+		wv, _ := json.Marshal(fromWire[k])
+
+		test.ExpectString(t, string(wv), string(jv))
+	}
+
+	_, err = FromGo(make(chan int))
+	test.ExpectNotNil(t, err)
+}
+
+func TestToGo(t *testing.T) {
+
+	d := Map{
+		{"ID", int64(9)},
+		{"Created", "2019-03-01T12:30:00Z"},
+		{"NAME", "Bob"},
+		{"nickname", nil},
+		{"Secret", "ignored"},
+		{"Tags", []interface{}{"x", "y"}},
+		{"Scores", Map{{"a", uint64(3)}}},
+		{"Avatar", "AQI="},
+		{"Unknown", true},
+	}
+
+	a := new(account)
+	a.Nickname = types.NewNilableString("old")
+
+	test.ExpectNil(t, ToGo(d, a))
+
+	test.ExpectInt(t, int(a.ID), 9)
+	test.ExpectInt(t, a.Created.Day(), 1)
+	test.ExpectString(t, a.Name, "Bob")
+	test.ExpectBool(t, a.Nickname == nil, true)
+	test.ExpectString(t, a.Secret, "")
+	test.ExpectInt(t, len(a.Tags), 2)
+	test.ExpectInt(t, a.Scores["a"], 3)
+	test.ExpectInt(t, len(a.Avatar), 2)
+
+	// Decoding into an interface{} holding a pointer uses the pointer
+	var i interface{} = new(account)
+	test.ExpectNil(t, ToGo(Map{{"nickname", "Al"}}, &i))
+	test.ExpectString(t, i.(*account).Nickname.String(), "Al")
+
+	var g interface{}
+	test.ExpectNil(t, ToGo(Map{{"a", []interface{}{int64(1)}}}, &g))
+	test.ExpectBool(t, g.(map[string]interface{})["a"].([]interface{})[0] == int64(1), true)
+
+	var small struct{ N int8 }
+
+	test.ExpectNotNil(t, ToGo(Map{{"N", int64(300)}}, &small))
+	test.ExpectNotNil(t, ToGo(Map{{"N", 1.5}}, &small))
+	test.ExpectNotNil(t, ToGo(Map{{"N", "1"}}, &small))
+	test.ExpectNotNil(t, ToGo(Map{}, small))
+}